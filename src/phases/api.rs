@@ -0,0 +1,515 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/api.md")]
+
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::info;
+use tree_sitter::Node;
+
+use crate::utils::census::{self, enclosing_function, nodes, text};
+use crate::utils::fs::check_path;
+use crate::utils::gomod::parse_go_mod;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("api")
+        .about("Extracts the exported types, functions, methods, constants and variables of the Go packages of the downloaded projects")
+        .long_about(include_str!("../docs/api.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the exported declarations of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// An exported declaration of a Go file.
+#[derive(Debug, PartialEq)]
+struct Declaration {
+    /// One of type, function, method, constant and variable.
+    kind: &'static str,
+    /// The name of the declaration, qualified by the receiver type for a method (e.g. Stack.Push).
+    name: String,
+    signature: String,
+    line: usize,
+}
+
+/// Whether an identifier is exported, i.e. starts with an upper case letter.
+fn is_exported(name: &str) -> bool {
+    name.chars().next().is_some_and(char::is_uppercase)
+}
+
+/// Joins the lines of a declaration into a single one, with its whitespace collapsed. As the Go compiler does, a
+/// semicolon separates the lines ending with an identifier, a literal or a closing bracket, except before a closing
+/// bracket, e.g. `struct { A int; B string }`.
+fn flatten(text: &str) -> String {
+    let mut flat: String = String::new();
+    for line in text.lines().map(str::trim).filter(|line| !line.is_empty()) {
+        if let Some(last) = flat.chars().last() {
+            let terminated: bool = last.is_alphanumeric()
+                || matches!(last, '_' | '"' | '`' | '\'' | ')' | ']' | '}')
+                || flat.ends_with("++")
+                || flat.ends_with("--");
+            if terminated && !line.starts_with([')', ']', '}']) {
+                flat.push(';');
+            }
+            flat.push(' ');
+        }
+        flat.push_str(&line.split_whitespace().collect::<Vec<&str>>().join(" "));
+    }
+    flat
+}
+
+/// Returns the source code of a declaration up to a byte offset, e.g. the start of the body of a function, without its
+/// comments and flattened into a single line.
+fn signature(node: &Node, end: usize, source: &[u8]) -> String {
+    let mut code: String = String::new();
+    let mut offset: usize = node.start_byte();
+    for comment in nodes(node)
+        .into_iter()
+        .filter(|n| n.kind() == "comment" && n.end_byte() <= end)
+    {
+        code.push_str(&String::from_utf8_lossy(
+            &source[offset..comment.start_byte()],
+        ));
+        code.push(' ');
+        offset = comment.end_byte();
+    }
+    code.push_str(&String::from_utf8_lossy(&source[offset..end]));
+    flatten(&code)
+}
+
+/// Returns the exported constants or variables declared by a const or var declaration, one per name. The signature of
+/// a constant holds its value, absent for the implicit repetitions of a constant group, e.g. with iota.
+fn value_declarations(declaration: &Node, source: &[u8]) -> Vec<Declaration> {
+    let (keyword, kind): (&str, &'static str) = match declaration.kind() {
+        "const_declaration" => ("const", "constant"),
+        _ => ("var", "variable"),
+    };
+    let mut cursor = declaration.walk();
+    let mut specs: Vec<Node> = Vec::new();
+    for child in declaration.named_children(&mut cursor) {
+        match child.kind() {
+            "const_spec" | "var_spec" => specs.push(child),
+            "var_spec_list" => specs.extend(child.named_children(&mut child.walk())),
+            _ => (),
+        }
+    }
+    let mut declarations: Vec<Declaration> = Vec::new();
+    for spec in specs.iter().filter(|spec| spec.kind().ends_with("_spec")) {
+        let typed: String = spec
+            .child_by_field_name("type")
+            .map(|t| format!(" {}", signature(&t, t.end_byte(), source)))
+            .unwrap_or_default();
+        let values: Vec<Node> = spec
+            .child_by_field_name("value")
+            .map(|list| list.named_children(&mut list.walk()).collect())
+            .unwrap_or_default();
+        let mut cursor = spec.walk();
+        for (i, name) in spec.children_by_field_name("name", &mut cursor).enumerate() {
+            let name: &str = text(&name, source);
+            if !is_exported(name) {
+                continue;
+            }
+            let value: String = match values.get(i) {
+                Some(value) if kind == "constant" => {
+                    format!(" = {}", signature(value, value.end_byte(), source))
+                }
+                _ => String::new(),
+            };
+            declarations.push(Declaration {
+                kind,
+                name: name.to_string(),
+                signature: format!("{keyword} {name}{typed}{value}"),
+                line: spec.start_position().row + 1,
+            });
+        }
+    }
+    declarations
+}
+
+/// Returns the exported declarations of a Go file, in the order of the file. Methods are exported when both their
+/// name and their receiver type are.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn exported_declarations(root: &Node, source: &[u8]) -> Vec<Declaration> {
+    let mut declarations: Vec<Declaration> = Vec::new();
+    let mut cursor = root.walk();
+    for node in root.named_children(&mut cursor) {
+        match node.kind() {
+            "function_declaration" | "method_declaration" => {
+                let Some(name) = node.child_by_field_name("name") else {
+                    continue;
+                };
+                let (kind, name): (&'static str, String) = if node.kind() == "method_declaration" {
+                    ("method", enclosing_function(&name, source))
+                } else {
+                    ("function", text(&name, source).to_string())
+                };
+                if !name.split('.').all(is_exported) {
+                    continue;
+                }
+                let end: usize = node
+                    .child_by_field_name("body")
+                    .map_or(node.end_byte(), |body| body.start_byte());
+                declarations.push(Declaration {
+                    kind,
+                    name,
+                    signature: signature(&node, end, source),
+                    line: node.start_position().row + 1,
+                });
+            }
+            "type_declaration" => {
+                let mut cursor = node.walk();
+                for spec in node.named_children(&mut cursor) {
+                    let Some(name) = spec.child_by_field_name("name") else {
+                        continue;
+                    };
+                    if matches!(spec.kind(), "type_spec" | "type_alias")
+                        && is_exported(text(&name, source))
+                    {
+                        declarations.push(Declaration {
+                            kind: "type",
+                            name: text(&name, source).to_string(),
+                            signature: format!(
+                                "type {}",
+                                signature(&spec, spec.end_byte(), source)
+                            ),
+                            line: spec.start_position().row + 1,
+                        });
+                    }
+                }
+            }
+            "const_declaration" | "var_declaration" => {
+                declarations.extend(value_declarations(&node, source))
+            }
+            _ => (),
+        }
+    }
+    declarations
+}
+
+/// Returns the name of the package declared by a Go file, empty if it has no package clause.
+fn package_name<'a>(root: &Node, source: &'a [u8]) -> &'a str {
+    let mut cursor = root.walk();
+    let name: Option<&str> = root
+        .named_children(&mut cursor)
+        .find(|node| node.kind() == "package_clause")
+        .and_then(|clause| clause.named_child(0))
+        .map(|name| text(&name, source));
+    name.unwrap_or_default()
+}
+
+/// Returns the directory and the path of the module a directory of a project belongs to, i.e. of the go.mod file of its
+/// closest ancestor having one within the project, if any. The modules of the directories are cached.
+fn module_of(
+    dir: &Path,
+    project_path: &Path,
+    modules: &mut HashMap<PathBuf, Option<(PathBuf, String)>>,
+) -> Option<(PathBuf, String)> {
+    if let Some(module) = modules.get(dir) {
+        return module.clone();
+    }
+    let go_mod: PathBuf = dir.join("go.mod");
+    let module: Option<(PathBuf, String)> = if go_mod.is_file() {
+        std::fs::read_to_string(&go_mod)
+            .ok()
+            .and_then(|content| parse_go_mod(&content).ok())
+            .map(|go_mod| (dir.to_path_buf(), go_mod.module))
+    } else if dir != project_path && dir.starts_with(project_path) {
+        dir.parent()
+            .and_then(|parent| module_of(parent, project_path, modules))
+    } else {
+        None
+    };
+    modules.insert(dir.to_path_buf(), module.clone());
+    module
+}
+
+/// Returns the import path of a package, given the directory and the path of its module.
+fn import_path(package_dir: &Path, module_dir: &Path, module: &str) -> String {
+    match package_dir.strip_prefix(module_dir) {
+        Ok(relative) if relative.as_os_str().is_empty() => module.to_string(),
+        Ok(relative) => {
+            let relative: Vec<String> = relative
+                .components()
+                .map(|c| c.as_os_str().to_string_lossy().to_string())
+                .collect();
+            format!("{module}/{}", relative.join("/"))
+        }
+        Err(_) => String::new(),
+    }
+}
+
+/// Extracts the exported declarations of the Go packages of the projects listed in a manifest, with their signature,
+/// module and version.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the declarations. Defaults to the input path with ".api.csv" appended.
+/// * `force` - Whether to override the output file if it already exists.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output file could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.api.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+
+    let mut modules: HashMap<PathBuf, Option<(PathBuf, String)>> = HashMap::new();
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut module_paths: Vec<String> = Vec::new();
+    let mut versions: Vec<Option<String>> = Vec::new();
+    let mut import_paths: Vec<String> = Vec::new();
+    let mut internal: Vec<bool> = Vec::new();
+    let mut packages: Vec<String> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut declarations: Vec<Declaration> = Vec::new();
+    census::visit_go_files(input_path, |file| {
+        let root: Node = file.tree.root_node();
+        let name: &str = package_name(&root, &file.source);
+        // Test files and commands are not part of the API of a module.
+        if file.path.ends_with("_test.go") || name == "main" {
+            return Ok(());
+        }
+        let entry: &JsonValue = entries[file.project];
+        let project_path: &Path = Path::new(entry["path"].as_str().unwrap_or_default());
+        let package_dir: PathBuf = match file.package.as_str() {
+            "." => project_path.to_path_buf(),
+            package => project_path.join(package),
+        };
+        let (module, path): (String, String) =
+            match module_of(&package_dir, project_path, &mut modules) {
+                Some((module_dir, module)) => {
+                    let path: String = import_path(&package_dir, &module_dir, &module);
+                    (module, path)
+                }
+                None => (String::new(), String::new()),
+            };
+        for declaration in exported_declarations(&root, &file.source) {
+            ids.push(file.id);
+            module_paths.push(module.clone());
+            versions.push(entry["commit"].as_str().map(str::to_string));
+            internal.push(path.split('/').any(|element| element == "internal"));
+            import_paths.push(path.clone());
+            packages.push(file.package.clone());
+            paths.push(file.path.clone());
+            declarations.push(declaration);
+        }
+        Ok(())
+    })?;
+    info!("Exported declarations found: {}", declarations.len());
+
+    let mut api_df: DataFrame = df!(
+        "id" => ids,
+        "module" => module_paths,
+        "version" => versions,
+        "import_path" => import_paths,
+        "internal" => internal,
+        "package" => packages,
+        "path" => paths,
+        "kind" => declarations.iter().map(|d| d.kind).collect::<Vec<&str>>(),
+        "name" => declarations.iter().map(|d| d.name.as_str()).collect::<Vec<&str>>(),
+        "signature" => declarations.iter().map(|d| d.signature.as_str()).collect::<Vec<&str>>(),
+        "line" => declarations.iter().map(|d| d.line as u32).collect::<Vec<u32>>(),
+    )?;
+    log_write_output(logger, output_path, &mut api_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn declarations() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            // Stack is a stack.\n\
+            type Stack[T any] struct {\n\
+            \titems []T  // the items\n\
+            \tSize  int\n\
+            }\n\n\
+            type (\n\
+            \tID = int\n\
+            \tvalue float64\n\
+            )\n\n\
+            func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }\n\n\
+            func (v value) String() string { return \"\" }\n\n\
+            func New[T any](\n\
+            \tsize int, // initial size\n\
+            ) *Stack[T] {\n\
+            \treturn &Stack[T]{}\n\
+            }\n\n\
+            func helper() {}\n\n\
+            const (\n\
+            \tA, b int = iota, 2\n\
+            \tC\n\
+            )\n\n\
+            var Default, other = New[int](0), 1\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, String, usize)> =
+            exported_declarations(&tree.root_node(), source)
+                .into_iter()
+                .map(|d| (d.kind, d.name, d.signature, d.line))
+                .collect();
+        assert_eq!(
+            found,
+            vec![
+                (
+                    "type",
+                    "Stack".to_string(),
+                    "type Stack[T any] struct { items []T; Size int }".to_string(),
+                    4
+                ),
+                ("type", "ID".to_string(), "type ID = int".to_string(), 10),
+                (
+                    "method",
+                    "Stack.Push".to_string(),
+                    "func (s *Stack[T]) Push(v T)".to_string(),
+                    14
+                ),
+                (
+                    "function",
+                    "New".to_string(),
+                    "func New[T any]( size int, ) *Stack[T]".to_string(),
+                    18
+                ),
+                (
+                    "constant",
+                    "A".to_string(),
+                    "const A int = iota".to_string(),
+                    27
+                ),
+                ("constant", "C".to_string(), "const C".to_string(), 28),
+                (
+                    "variable",
+                    "Default".to_string(),
+                    "var Default".to_string(),
+                    31
+                ),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn api() -> Result<()> {
+        let test_dir = "target/tests/phases/api";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/go.mod"),
+            "module example.com/m\n\ngo 1.21\n",
+        )?;
+        write_file(format!("{test_dir}/1/m.go"), "package m\n\nfunc F() {}\n")?;
+        write_file(
+            format!("{test_dir}/1/m_test.go"),
+            "package m\n\nfunc TestF() {}\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/internal/x/x.go"),
+            "package x\n\nvar V int\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/cmd/tool/main.go"),
+            "package main\n\nfunc Run() {}\n",
+        )?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "example.com/m", commit: "v1.2.0", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, false, test_logger())?;
+        let api: DataFrame = open_csv(&format!("{manifest_path}.api.csv"), None, None)?;
+        assert_eq!(
+            api.column("import_path")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("example.com/m/internal/x"), Some("example.com/m")]
+        );
+        assert_eq!(
+            api.column("name")?.str()?.into_iter().collect::<Vec<_>>(),
+            vec![Some("V"), Some("F")]
+        );
+        assert_eq!(
+            api.column("version")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("v1.2.0"), Some("v1.2.0")]
+        );
+        assert_eq!(
+            api.column("internal")?
+                .bool()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some(true), Some(false)]
+        );
+
+        delete_dir(test_dir, false)
+    }
+}
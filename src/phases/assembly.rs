@@ -0,0 +1,362 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/assembly.md")]
+
+use std::collections::{HashMap, HashSet};
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::{info, warn};
+use tree_sitter::{Node, Parser};
+use walkdir::{DirEntry, WalkDir};
+
+use crate::phases::gomod::is_ignored_dir;
+use crate::utils::constraints::{architectures, KNOWN_ARCH};
+use crate::utils::fs::*;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("assembly")
+        .about("Lists the assembly files of the downloaded projects and the Go functions they implement")
+        .long_about(include_str!("../docs/assembly.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the assembly files of every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("functions")
+                .long("functions")
+                .value_name("FUNCTIONS_FILE.csv")
+                .help("Path to the output csv file storing the Go functions implemented by every assembly file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Returns the Go functions implemented by an assembly file, i.e. the symbols of its TEXT directives qualified by a
+/// middle dot, with the package they belong to (empty for the package of the file) and their name.
+/// Symbols without a middle dot and file-local symbols (suffixed by `<>`) cannot be called from Go and are ignored.
+///
+/// # Arguments
+///
+/// * `source` - The content of the assembly file.
+fn text_symbols(source: &str) -> Vec<(String, String)> {
+    source
+        .lines()
+        .filter_map(|line| {
+            let symbol: &str = line
+                .trim_start()
+                .strip_prefix("TEXT")?
+                .trim_start()
+                .split_once("(SB)")?
+                .0;
+            let (package, name) = symbol.rsplit_once('·')?;
+            if name.is_empty() || name.ends_with("<>") {
+                return None;
+            }
+            // Slashes of package paths are written with the division slash.
+            let package: String = package.trim_matches('"').replace('∕', "/");
+            Some((package, name.to_string()))
+        })
+        .collect()
+}
+
+/// Returns the names of the Go functions declared without a body in the Go files of a directory,
+/// whose implementation is provided by assembly files.
+///
+/// # Arguments
+///
+/// * `parser` - A parser for the Go language.
+/// * `dir` - The directory of the package.
+fn bodyless_functions(parser: &mut Parser, dir: &Path) -> Result<HashSet<String>> {
+    let mut functions: HashSet<String> = HashSet::new();
+    for entry in std::fs::read_dir(dir)? {
+        let path: PathBuf = entry?.path();
+        if !path.is_file() || path.extension().is_none_or(|ext| ext != "go") {
+            continue;
+        }
+        let source: Vec<u8> = std::fs::read(&path)?;
+        let tree = parser
+            .parse(&source, None)
+            .with_context(|| format!("Failed to parse file {}", path.display()))?;
+        let root: Node = tree.root_node();
+        let mut cursor = root.walk();
+        for declaration in root.children(&mut cursor) {
+            if declaration.kind() == "function_declaration"
+                && declaration.child_by_field_name("body").is_none()
+            {
+                if let Some(name) = declaration.child_by_field_name("name") {
+                    functions.insert(name.utf8_text(&source)?.to_string());
+                }
+            }
+        }
+    }
+    Ok(functions)
+}
+
+/// Lists the assembly files of the projects listed in a manifest, with the architectures they target and the Go functions they implement.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the assembly files. Defaults to the input path with ".assembly.csv" appended.
+/// * `functions_path` - The optional path to the output CSV file storing the functions. Defaults to the input path with ".assembly_functions.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest, the source files or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    functions_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.assembly.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_functions_path = format!("{input_path}.assembly_functions.csv");
+    let functions_path = functions_path.unwrap_or(&default_functions_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(functions_path, false, force)?;
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    let mut parser: Parser = Parser::new();
+    parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut names: Vec<Option<String>> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut packages: Vec<String> = Vec::new();
+    let mut archs: Vec<String> = Vec::new();
+    let mut counts: Vec<u32> = Vec::new();
+
+    let mut function_ids: Vec<Option<u32>> = Vec::new();
+    let mut function_paths: Vec<String> = Vec::new();
+    let mut function_packages: Vec<String> = Vec::new();
+    let mut function_names: Vec<String> = Vec::new();
+    let mut declared: Vec<bool> = Vec::new();
+
+    for entry in entries {
+        let project_path: &str = entry["path"]
+            .as_str()
+            .context("Manifest entry without path")?;
+        let mut files: Vec<PathBuf> = WalkDir::new(project_path)
+            .into_iter()
+            .filter_entry(|e| !is_ignored_dir(e))
+            .filter_map(Result::ok)
+            .filter(|e| e.file_type().is_file())
+            .map(DirEntry::into_path)
+            .filter(|p| p.extension().is_some_and(|ext| ext == "s"))
+            .collect();
+        files.sort();
+
+        let mut declarations: HashMap<PathBuf, HashSet<String>> = HashMap::new();
+        for file in files {
+            let source: String = match std::fs::read_to_string(&file) {
+                Ok(source) => source,
+                Err(e) => {
+                    warn!("Cannot read {}: {e}", file.display());
+                    continue;
+                }
+            };
+            let dir: PathBuf = file.parent().map(Path::to_path_buf).unwrap_or_default();
+            if !declarations.contains_key(&dir) {
+                declarations.insert(dir.clone(), bodyless_functions(&mut parser, &dir)?);
+            }
+            let file_name: &str = file
+                .file_name()
+                .and_then(|n| n.to_str())
+                .unwrap_or_default();
+            let relative_path: String = file
+                .strip_prefix(project_path)?
+                .to_string_lossy()
+                .to_string();
+            let built: Vec<&str> = match architectures(file_name, &source) {
+                Ok(built) => built,
+                Err(e) => {
+                    warn!("Invalid build constraint in {}: {e:#}", file.display());
+                    Vec::new()
+                }
+            };
+            let symbols: Vec<(String, String)> = text_symbols(&source);
+
+            ids.push(entry["id"].as_u32());
+            names.push(entry["name"].as_str().map(str::to_string));
+            paths.push(relative_path.clone());
+            packages.push(
+                dir.strip_prefix(project_path)?
+                    .to_string_lossy()
+                    .to_string(),
+            );
+            archs.push(match built.len() {
+                0 => "none".to_string(),
+                n if n == KNOWN_ARCH.len() => "all".to_string(),
+                _ => built.join(";"),
+            });
+            counts.push(symbols.len() as u32);
+            for (package, name) in symbols {
+                function_ids.push(entry["id"].as_u32());
+                function_paths.push(relative_path.clone());
+                declared.push(package.is_empty() && declarations[&dir].contains(&name));
+                function_packages.push(package);
+                function_names.push(name);
+            }
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+
+    info!("Assembly files found: {}", paths.len());
+    info!(
+        "Go functions implemented in assembly: {}",
+        function_names.len()
+    );
+
+    let mut files_df: DataFrame = df!(
+        "id" => ids,
+        "name" => names,
+        "path" => paths,
+        "package" => packages,
+        "architectures" => archs,
+        "functions" => counts,
+    )?;
+    log_write_output(logger, output_path, &mut files_df, false)?;
+
+    let mut functions_df: DataFrame = df!(
+        "id" => function_ids,
+        "path" => function_paths,
+        "package" => function_packages,
+        "function" => function_names,
+        "declared" => declared,
+    )?;
+    log_write_output(logger, functions_path, &mut functions_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn text_directives() {
+        assert_eq!(
+            text_symbols(
+                "#include \"textflag.h\"\n\n\
+                 TEXT ·Sqrt(SB), NOSPLIT, $0-16\n\
+                 \tTEXT\truntime∕internal∕sys·Bswap64(SB),NOSPLIT,$0\n\
+                 TEXT ·p256MulInternal<>(SB), NOSPLIT, $8\n\
+                 TEXT _rt0_amd64(SB),NOSPLIT,$-8\n"
+            ),
+            vec![
+                (String::new(), "Sqrt".to_string()),
+                ("runtime/internal/sys".to_string(), "Bswap64".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn assembly() -> Result<()> {
+        let test_dir = "target/tests/phases/assembly";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/math/sqrt.go"),
+            "package math\n\nfunc archSqrt(x float64) float64\n\nfunc sqrt(x float64) float64 { return x }\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/math/sqrt_amd64.s"),
+            "#include \"textflag.h\"\n\nTEXT ·archSqrt(SB), NOSPLIT, $0\n\tSQRTSD x+0(FP), X0\n\tRET\n\nTEXT ·undeclared(SB), NOSPLIT, $0\n\tRET\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/math/sqrt_arm64.s"),
+            "//go:build !purego\n\nTEXT ·archSqrt(SB), NOSPLIT, $0\n\tRET\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/vendor/x/x_amd64.s"),
+            "TEXT ·X(SB), 0, $0\n",
+        )?;
+
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/math", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let files: DataFrame = open_csv(&format!("{manifest_path}.assembly.csv"), None, None)?;
+        assert_eq!(
+            files
+                .column("architectures")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("amd64"), Some("arm64")]
+        );
+        let functions: DataFrame = open_csv(
+            &format!("{manifest_path}.assembly_functions.csv"),
+            None,
+            None,
+        )?;
+        assert_eq!(
+            functions
+                .column("declared")?
+                .bool()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some(true), Some(false), Some(true)]
+        );
+
+        delete_dir(test_dir, false)
+    }
+}
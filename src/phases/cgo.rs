@@ -0,0 +1,416 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/cgo.md")]
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, nodes, text, Occurrence};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("cgo")
+        .about("Characterizes the uses of cgo in the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/cgo.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the uses of cgo of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of uses of cgo of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the uses of cgo, in the order of the columns of the census.
+const CATEGORIES: [&str; 6] = [
+    "call",
+    "allocation",
+    "copy",
+    "type_conversion",
+    "pointer",
+    "export",
+];
+
+/// Functions of cgo allocating a copy of a Go value in the C heap, which must be released with C.free.
+const ALLOCATIONS: [&str; 2] = ["CString", "CBytes"];
+
+/// Functions of cgo copying a C value to a Go value.
+const COPIES: [&str; 3] = ["GoString", "GoStringN", "GoBytes"];
+
+/// The numeric types of C known to cgo, whose calls are conversions.
+const C_TYPES: [&str; 27] = [
+    "char",
+    "schar",
+    "uchar",
+    "short",
+    "ushort",
+    "int",
+    "uint",
+    "long",
+    "ulong",
+    "longlong",
+    "ulonglong",
+    "float",
+    "double",
+    "complexfloat",
+    "complexdouble",
+    "size_t",
+    "int8_t",
+    "int16_t",
+    "int32_t",
+    "int64_t",
+    "uint8_t",
+    "uint16_t",
+    "uint32_t",
+    "uint64_t",
+    "intptr_t",
+    "uintptr_t",
+    "ptrdiff_t",
+];
+
+/// Returns the name of the C function or type called by a call expression, e.g. `strlen` for `C.strlen(s)`.
+fn c_callee<'a>(call: &Node, source: &'a [u8]) -> Option<&'a str> {
+    if call.kind() != "call_expression" {
+        return None;
+    }
+    let function: Node = call.child_by_field_name("function")?;
+    if function.kind() != "selector_expression"
+        || text(&function.child_by_field_name("operand")?, source) != "C"
+    {
+        return None;
+    }
+    Some(text(&function.child_by_field_name("field")?, source))
+}
+
+/// Returns the function or type of a call or of a conversion.
+fn converter<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    match node.kind() {
+        "call_expression" => node.child_by_field_name("function"),
+        "type_conversion_expression" => node.child_by_field_name("type"),
+        _ => None,
+    }
+}
+
+/// Returns the pattern of an argument of a call of a C function passing a pointer, if it does:
+/// * `unsafe-pointer`: a conversion to unsafe.Pointer, e.g. `unsafe.Pointer(p)`.
+/// * `c-pointer-conversion`: a conversion to a pointer to a C type, e.g. `(*C.char)(p)`.
+/// * `slice-element-address`: the address of an element of a slice or an array, e.g. `&buf[0]`.
+/// * `go-address`: the address of another Go value, e.g. `&x`, subject to the cgo pointer passing rules.
+fn pointer_argument(argument: &Node, source: &[u8]) -> Option<&'static str> {
+    if argument.kind() == "unary_expression" {
+        let operator: &str = argument.child_by_field_name("operator")?.kind();
+        let operand: Node = argument.child_by_field_name("operand")?;
+        return (operator == "&").then(|| match operand.kind() {
+            "index_expression" => "slice-element-address",
+            _ => "go-address",
+        });
+    }
+    let converter: &str = text(&converter(argument)?, source);
+    if converter == "unsafe.Pointer" {
+        Some("unsafe-pointer")
+    } else if converter.starts_with("(*C.") || converter.starts_with("*C.") {
+        Some("c-pointer-conversion")
+    } else {
+        None
+    }
+}
+
+/// Returns the innermost function, function literal or method enclosing a node, or the root of the file.
+fn scope<'a>(node: &Node<'a>) -> Node<'a> {
+    let mut current: Node = *node;
+    while let Some(parent) = current.parent() {
+        if matches!(
+            parent.kind(),
+            "function_declaration" | "method_declaration" | "func_literal"
+        ) {
+            return parent;
+        }
+        current = parent;
+    }
+    current
+}
+
+/// Returns the name of the variable a value is assigned to or declared with, e.g. `s` for `s := C.CString(x)`.
+fn assigned_name<'a>(value: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let values: Node = value.parent()?;
+    if values.kind() != "expression_list" {
+        return None;
+    }
+    let index: usize = {
+        let mut cursor = values.walk();
+        let values: Vec<Node> = values.named_children(&mut cursor).collect();
+        values.iter().position(|v| v == value)?
+    };
+    let statement: Node = values.parent()?;
+    let mut cursor = statement.walk();
+    let names: Vec<Node> = match statement.kind() {
+        "short_var_declaration" | "assignment_statement" => statement
+            .child_by_field_name("left")?
+            .named_children(&mut cursor)
+            .collect(),
+        "var_spec" => statement
+            .children_by_field_name("name", &mut cursor)
+            .collect(),
+        _ => return None,
+    };
+    names.get(index).map(|name| text(name, source))
+}
+
+/// Returns whether the C memory allocated by a call of C.CString or C.CBytes is released in its function:
+/// * `deferred-free`: the variable it is assigned to is passed to C.free in a defer statement.
+/// * `freed`: the variable it is assigned to is passed to C.free.
+/// * `unfreed`: it is not released in the function, e.g. it is passed directly to a C function or returned.
+fn allocation_pattern(call: &Node, source: &[u8]) -> &'static str {
+    let Some(name) = assigned_name(call, source) else {
+        return "unfreed";
+    };
+    let scope: Node = scope(call);
+    let frees: Vec<Node> = nodes(&scope)
+        .into_iter()
+        .filter(|node| c_callee(node, source) == Some("free"))
+        .filter(|free| {
+            free.child_by_field_name("arguments")
+                .and_then(|arguments| arguments.named_child(0))
+                .is_some_and(|argument| {
+                    // The pointer is usually converted, e.g. C.free(unsafe.Pointer(s)).
+                    let freed: Node = match converter(&argument) {
+                        Some(_) if argument.kind() == "call_expression" => argument
+                            .child_by_field_name("arguments")
+                            .and_then(|arguments| arguments.named_child(0))
+                            .unwrap_or(argument),
+                        Some(_) => argument.child_by_field_name("operand").unwrap_or(argument),
+                        None => argument,
+                    };
+                    text(&freed, source) == name
+                })
+        })
+        .collect();
+    let deferred = |free: &Node| {
+        let mut current: Option<Node> = free.parent();
+        while let Some(ancestor) = current.filter(|ancestor| *ancestor != scope) {
+            if ancestor.kind() == "defer_statement" {
+                return true;
+            }
+            current = ancestor.parent();
+        }
+        false
+    };
+    if frees.iter().any(deferred) {
+        "deferred-free"
+    } else if !frees.is_empty() {
+        "freed"
+    } else {
+        "unfreed"
+    }
+}
+
+/// Returns the use of cgo at a node, if any.
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+fn occurrence(node: &Node, source: &[u8]) -> Option<Occurrence> {
+    if node.kind() == "comment" {
+        let name: &str = text(node, source).strip_prefix("//export ")?.trim();
+        return Some(Occurrence::new("export", name, node));
+    }
+    if let Some(name) = c_callee(node, source) {
+        return Some(if ALLOCATIONS.contains(&name) {
+            Occurrence::new("allocation", allocation_pattern(node, source), node)
+        } else if COPIES.contains(&name) {
+            Occurrence::new("copy", format!("C.{name}"), node)
+        } else if C_TYPES.contains(&name) {
+            Occurrence::new("type_conversion", format!("C.{name}"), node)
+        } else {
+            Occurrence::new("call", format!("C.{name}"), node)
+        });
+    }
+    let call: Node = node
+        .parent()
+        .filter(|arguments| arguments.kind() == "argument_list")?
+        .parent()?;
+    let callee: &str = c_callee(&call, source)?;
+    if ALLOCATIONS.contains(&callee) || C_TYPES.contains(&callee) {
+        return None;
+    }
+    pointer_argument(node, source).map(|pattern| Occurrence::new("pointer", pattern, node))
+}
+
+/// Returns the uses of cgo of a Go file, in the order of the file. References to C are recognized by their qualifier,
+/// whether the file imports "C" or not, and calls of C types other than the numeric ones (e.g. typedefs of the
+/// preamble) cannot be told apart from calls of C functions.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn cgo_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    nodes(root)
+        .iter()
+        .filter_map(|node| occurrence(node, source))
+        .collect()
+}
+
+/// Characterizes the uses of cgo in the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the uses. Defaults to the input path with ".cgo.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".cgo_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.cgo.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.cgo_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        cgo_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use polars::frame::DataFrame;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            // #include <stdlib.h>\n\
+            import \"C\"\n\n\
+            //export callback\n\
+            func callback(n C.int) {}\n\n\
+            func f(s string, buf []byte) string {\n\
+            \tp := C.CString(s)\n\
+            \tC.free(unsafe.Pointer(p))\n\
+            \tC.puts(C.CString(s))\n\
+            \tC.fill(&buf[0], C.size_t(len(buf)))\n\
+            \treturn C.GoString(p)\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = cgo_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("export", "callback".to_string(), 6),
+                ("allocation", "freed".to_string(), 10),
+                ("call", "C.free".to_string(), 11),
+                ("pointer", "unsafe-pointer".to_string(), 11),
+                ("call", "C.puts".to_string(), 12),
+                ("allocation", "unfreed".to_string(), 12),
+                ("call", "C.fill".to_string(), 13),
+                ("pointer", "slice-element-address".to_string(), 13),
+                ("type_conversion", "C.size_t".to_string(), 13),
+                ("copy", "C.GoString".to_string(), 14),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn cgo() -> Result<()> {
+        let test_dir = "target/tests/phases/cgo";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/weird.go"),
+            std::fs::read("tests/data/phases/parse/weird.go")?,
+        )?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/a", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let occurrences: DataFrame = open_csv(&format!("{manifest_path}.cgo.csv"), None, None)?;
+        assert_eq!(
+            occurrences
+                .column("construct")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("deferred-free"),
+                Some("C.free"),
+                Some("unsafe-pointer"),
+                Some("C.gtk_print_settings_get_double_with_default"),
+                Some("c-pointer-conversion"),
+                Some("C.gdouble"),
+            ]
+        );
+        let census: DataFrame = open_csv(&format!("{manifest_path}.cgo_census.csv"), None, None)?;
+        assert_eq!(census.column("call")?.i64()?.get(0), Some(3));
+
+        delete_dir(test_dir, false)
+    }
+}
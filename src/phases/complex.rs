@@ -0,0 +1,337 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/complex.md")]
+
+use std::collections::{HashMap, HashSet};
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, called_function, imported_packages, nodes, text, Occurrence};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("complex")
+        .about("Counts and locates the uses of complex numbers in the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/complex.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the uses of complex numbers of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of uses of complex numbers of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the uses of complex numbers, in the order of the columns of the census.
+const CATEGORIES: [&str; 7] = [
+    "type",
+    "literal",
+    "construction",
+    "extraction",
+    "cmplx",
+    "arithmetic",
+    "comparison",
+];
+
+/// The complex types of Go.
+const COMPLEX_TYPES: [&str; 2] = ["complex64", "complex128"];
+
+const ARITHMETIC_OPERATORS: [&str; 4] = ["+", "-", "*", "/"];
+
+const COMPOUND_OPERATORS: [&str; 4] = ["+=", "-=", "*=", "/="];
+
+/// Complex numbers can only be compared for equality.
+const COMPARISON_OPERATORS: [&str; 2] = ["==", "!="];
+
+/// Functions of the math/cmplx package whose result is not a single complex value.
+const NON_COMPLEX_CMPLX_FUNCTIONS: [&str; 5] = ["Abs", "Phase", "Polar", "IsNaN", "IsInf"];
+
+/// Returns the operator of a binary expression or of an assignment.
+fn operator<'a>(node: &Node<'a>) -> Option<&'a str> {
+    node.child_by_field_name("operator").map(|op| op.kind())
+}
+
+/// What is known of the complex values of a Go file without type-checking it.
+struct Complexes<'a> {
+    source: &'a [u8],
+    imports: HashMap<String, String>,
+    /// The names of the variables, constants, parameters and fields declared with a complex type or value,
+    /// whatever their scope.
+    names: HashSet<String>,
+}
+
+impl Complexes<'_> {
+    /// Returns the name of the builtin function or of the type called by a call expression, if any.
+    fn callee(&self, node: &Node) -> Option<&str> {
+        if node.kind() != "call_expression" {
+            return None;
+        }
+        let function: Node = node.child_by_field_name("function")?;
+        (function.kind() == "identifier").then(|| text(&function, self.source))
+    }
+
+    /// Whether an expression is known to have a complex value.
+    fn is_complex(&self, node: &Node) -> bool {
+        match node.kind() {
+            "imaginary_literal" => true,
+            "identifier" | "field_identifier" => self.names.contains(text(node, self.source)),
+            "parenthesized_expression" => node.named_child(0).is_some_and(|e| self.is_complex(&e)),
+            "unary_expression" => node
+                .child_by_field_name("operand")
+                .is_some_and(|e| self.is_complex(&e)),
+            "binary_expression" => {
+                operator(node).is_some_and(|op| ARITHMETIC_OPERATORS.contains(&op))
+                    && self.has_complex_operand(node)
+            }
+            "selector_expression" => node
+                .child_by_field_name("field")
+                .is_some_and(|f| self.is_complex(&f)),
+            "call_expression" => {
+                self.callee(node)
+                    .is_some_and(|callee| callee == "complex" || COMPLEX_TYPES.contains(&callee))
+                    || called_function(node, self.source, &self.imports).is_some_and(
+                        |(package, name)| {
+                            package == "math/cmplx" && !NON_COMPLEX_CMPLX_FUNCTIONS.contains(&name)
+                        },
+                    )
+            }
+            _ => false,
+        }
+    }
+
+    /// Whether a binary expression or an assignment has an operand known to have a complex value.
+    fn has_complex_operand(&self, node: &Node) -> bool {
+        ["left", "right"].iter().any(|field| {
+            node.child_by_field_name(field).is_some_and(|operand| {
+                if operand.kind() == "expression_list" {
+                    let mut cursor = operand.walk();
+                    let operands: Vec<Node> = operand.named_children(&mut cursor).collect();
+                    operands.iter().any(|o| self.is_complex(o))
+                } else {
+                    self.is_complex(&operand)
+                }
+            })
+        })
+    }
+
+    /// Records the names declared by a declaration with a complex type or value.
+    fn declare(&mut self, node: &Node) {
+        let list = |field: &str| -> Vec<Node> {
+            node.child_by_field_name(field)
+                .map(|list| list.named_children(&mut list.walk()).collect())
+                .unwrap_or_default()
+        };
+        let (names, values, typed): (Vec<Node>, Vec<Node>, bool) = match node.kind() {
+            "var_spec" | "const_spec" | "parameter_declaration" | "field_declaration" => {
+                let mut cursor = node.walk();
+                (
+                    node.children_by_field_name("name", &mut cursor).collect(),
+                    list("value"),
+                    node.child_by_field_name("type")
+                        .is_some_and(|t| COMPLEX_TYPES.contains(&text(&t, self.source))),
+                )
+            }
+            "short_var_declaration" => (list("left"), list("right"), false),
+            _ => return,
+        };
+        let declared: Vec<String> = names
+            .iter()
+            .enumerate()
+            .filter(|(i, _)| typed || values.get(*i).is_some_and(|value| self.is_complex(value)))
+            .map(|(_, name)| text(name, self.source).to_string())
+            .collect();
+        self.names.extend(declared);
+    }
+
+    /// Returns the use of complex numbers at a node, if any.
+    fn occurrence(&self, node: &Node) -> Option<Occurrence> {
+        match node.kind() {
+            // Conversions name the type with an identifier, counted as a construction instead.
+            "type_identifier" => COMPLEX_TYPES
+                .contains(&text(node, self.source))
+                .then(|| Occurrence::new("type", text(node, self.source), node)),
+            "imaginary_literal" => Some(Occurrence::new("literal", text(node, self.source), node)),
+            "call_expression" => {
+                if let Some(callee) = self.callee(node) {
+                    return match callee {
+                        "complex" | "complex64" | "complex128" => {
+                            Some(Occurrence::new("construction", callee, node))
+                        }
+                        "real" | "imag" => Some(Occurrence::new("extraction", callee, node)),
+                        _ => None,
+                    };
+                }
+                let (package, name) = called_function(node, self.source, &self.imports)?;
+                (package == "math/cmplx")
+                    .then(|| Occurrence::new("cmplx", format!("cmplx.{name}"), node))
+            }
+            "binary_expression" => {
+                let op: &str = operator(node)?;
+                if !self.has_complex_operand(node) {
+                    None
+                } else if ARITHMETIC_OPERATORS.contains(&op) {
+                    Some(Occurrence::new("arithmetic", op, node))
+                } else if COMPARISON_OPERATORS.contains(&op) {
+                    Some(Occurrence::new("comparison", op, node))
+                } else {
+                    None
+                }
+            }
+            "assignment_statement" => {
+                let op: &str = operator(node)?;
+                (COMPOUND_OPERATORS.contains(&op) && self.has_complex_operand(node))
+                    .then(|| Occurrence::new("arithmetic", op, node))
+            }
+            _ => None,
+        }
+    }
+}
+
+/// Returns the uses of complex numbers of a Go file, in the order of the file.
+/// Without type-checking the file, the values known to be complex are the imaginary literals, the results of the
+/// complex builtin, of the conversions to complex types and of the functions of the math/cmplx package returning a
+/// complex value, and the names declared with a complex type or value.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn complex_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let mut complexes = Complexes {
+        source,
+        imports: imported_packages(root, source),
+        names: HashSet::new(),
+    };
+    let nodes: Vec<Node> = nodes(root);
+    for node in &nodes {
+        complexes.declare(node);
+    }
+    nodes
+        .iter()
+        .filter_map(|node| complexes.occurrence(node))
+        .collect()
+}
+
+/// Counts and locates the uses of complex numbers in the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the uses. Defaults to the input path with ".complex.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".complex_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.complex.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.complex_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        complex_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import \"math/cmplx\"\n\n\
+            func f(c complex128, x float64) float64 {\n\
+            \tz := complex(x, 1) * c\n\
+            \tw := 2i\n\
+            \tz += cmplx.Sqrt(w)\n\
+            \tif z == w || x == 0 {\n\
+            \t\treturn real(z) + cmplx.Abs(w)\n\
+            \t}\n\
+            \treturn imag(complex64(z))\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = complex_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("type", "complex128".to_string(), 5),
+                ("arithmetic", "*".to_string(), 6),
+                ("construction", "complex".to_string(), 6),
+                ("literal", "2i".to_string(), 7),
+                ("arithmetic", "+=".to_string(), 8),
+                ("cmplx", "cmplx.Sqrt".to_string(), 8),
+                ("comparison", "==".to_string(), 9),
+                ("extraction", "real".to_string(), 10),
+                ("cmplx", "cmplx.Abs".to_string(), 10),
+                ("extraction", "imag".to_string(), 12),
+                ("construction", "complex64".to_string(), 12),
+            ]
+        );
+        Ok(())
+    }
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/concurrency.md")]
+
+use std::collections::HashMap;
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, imported_packages, nodes, qualified_name, text, Occurrence};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("concurrency")
+        .about("Inventories the concurrency constructs of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/concurrency.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the concurrency constructs of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of concurrency constructs of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the concurrency constructs, in the order of the columns of the census.
+const CATEGORIES: [&str; 6] = [
+    "goroutine",
+    "channel",
+    "make_channel",
+    "select",
+    "sync",
+    "context",
+];
+
+/// Returns the direction of a channel type: `chan`, `<-chan` for a receive-only channel or `chan<-` for a send-only one.
+fn direction(channel: &Node) -> &'static str {
+    let mut cursor = channel.walk();
+    let tokens: Vec<&str> = channel
+        .children(&mut cursor)
+        .take(2)
+        .map(|c| c.kind())
+        .collect();
+    match tokens.as_slice() {
+        ["<-", ..] => "<-chan",
+        [_, "<-"] => "chan<-",
+        _ => "chan",
+    }
+}
+
+/// Returns whether a call of the make builtin creates a buffered or an unbuffered channel, if it creates a channel.
+fn made_channel(call: &Node, source: &[u8]) -> Option<&'static str> {
+    let function: Node = call.child_by_field_name("function")?;
+    if function.kind() != "identifier" || text(&function, source) != "make" {
+        return None;
+    }
+    let arguments: Node = call.child_by_field_name("arguments")?;
+    let mut cursor = arguments.walk();
+    let arguments: Vec<Node> = arguments.named_children(&mut cursor).collect();
+    if arguments.first()?.kind() != "channel_type" {
+        return None;
+    }
+    Some(match arguments.get(1) {
+        Some(size) if text(size, source) != "0" => "buffered",
+        _ => "unbuffered",
+    })
+}
+
+/// Returns the concurrency construct at a node, if any.
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+/// * `imports` - The packages imported by the file.
+fn occurrence(node: &Node, source: &[u8], imports: &HashMap<String, String>) -> Option<Occurrence> {
+    match node.kind() {
+        "go_statement" => Some(Occurrence::new("goroutine", "go", node)),
+        "channel_type" => Some(Occurrence::new("channel", direction(node), node)),
+        "call_expression" => {
+            made_channel(node, source).map(|kind| Occurrence::new("make_channel", kind, node))
+        }
+        // A select statement without a default case blocks until one of its cases can proceed.
+        "select_statement" => {
+            let mut cursor = node.walk();
+            let blocking: bool = !node
+                .named_children(&mut cursor)
+                .any(|c| c.kind() == "default_case");
+            Some(Occurrence::new(
+                "select",
+                if blocking { "blocking" } else { "default" },
+                node,
+            ))
+        }
+        "selector_expression" | "qualified_type" => {
+            let (package, name) = qualified_name(node, source, imports)?;
+            let category: &'static str = match package {
+                "sync" | "sync/atomic" => "sync",
+                "context" => "context",
+                _ => return None,
+            };
+            let package: &str = package.rsplit('/').next().unwrap_or(package);
+            Some(Occurrence::new(category, format!("{package}.{name}"), node))
+        }
+        _ => None,
+    }
+}
+
+/// Returns the concurrency constructs of a Go file, in the order of the file.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn concurrency_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let imports: HashMap<String, String> = imported_packages(root, source);
+    nodes(root)
+        .iter()
+        .filter_map(|node| occurrence(node, source, &imports))
+        .collect()
+}
+
+/// Inventories the concurrency constructs of the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the constructs. Defaults to the input path with ".concurrency.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".concurrency_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.concurrency.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.concurrency_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        concurrency_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import (\n\t\"context\"\n\t\"sync\"\n\t\"sync/atomic\"\n)\n\n\
+            func f(ctx context.Context, in <-chan int, out chan<- int) {\n\
+            \tvar wg sync.WaitGroup\n\
+            \tdone := make(chan struct{})\n\
+            \tjobs := make(chan int, 8)\n\
+            \tgo func() { atomic.AddInt64(nil, 1) }()\n\
+            \tselect {\n\
+            \tcase <-ctx.Done():\n\
+            \tcase v := <-in:\n\
+            \t\tout <- v\n\
+            \tdefault:\n\
+            \t}\n\
+            \t_, _, _ = wg, done, jobs\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = concurrency_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("context", "context.Context".to_string(), 9),
+                ("channel", "<-chan".to_string(), 9),
+                ("channel", "chan<-".to_string(), 9),
+                ("sync", "sync.WaitGroup".to_string(), 10),
+                ("make_channel", "unbuffered".to_string(), 11),
+                ("channel", "chan".to_string(), 11),
+                ("make_channel", "buffered".to_string(), 12),
+                ("channel", "chan".to_string(), 12),
+                ("goroutine", "go".to_string(), 13),
+                ("sync", "atomic.AddInt64".to_string(), 13),
+                ("select", "default".to_string(), 14),
+            ]
+        );
+        Ok(())
+    }
+}
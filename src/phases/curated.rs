@@ -0,0 +1,307 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/curated.md")]
+
+use std::collections::HashMap;
+use std::io::Write;
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use regex::Regex;
+use reqwest::Url;
+use tracing::{info, warn};
+
+use crate::utils::csv::*;
+use crate::utils::forge::{Forge, ForgeProject, Provider};
+use crate::utils::fs::{check_path, FileMode};
+use crate::utils::github::ToCSV;
+use crate::utils::logger::{log_output_file, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("curated")
+        .about("Collects the projects listed in a curated Markdown list such as awesome-go.")
+        .long_about(include_str!("../docs/curated.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("LIST.md")
+                .help("Path to the Markdown file of the list.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output CSV file storing the projects and their tags. Defaults to the input file name with \".projects.csv\" appended."),
+        )
+        .arg(
+            Arg::new("provider")
+                .long("provider")
+                .value_name("PROVIDER")
+                .help("Code hosting platform whose projects are collected. Links to other hosts are ignored.")
+                .default_value("github")
+                .value_parser(Provider::NAMES),
+        )
+        .arg(
+            Arg::new("host")
+                .long("host")
+                .value_name("HOST")
+                .help("Host of a self-hosted instance of the provider (e.g. gitlab.example.com). \
+                       If not specified, the public instance of the provider is used."),
+        )
+        .arg(
+            Arg::new("tokens")
+                .short('t')
+                .long("tokens")
+                .value_name("TOKENS_FILE.csv")
+                .help("Path to the file containing the tokens to use. It must be a valid CSV file with one column named 'token'. \
+                       Only the first token is used. If not specified, the token is read from the environment variable of the provider."),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output file if it already exists.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Returns the path of the project (namespace/name) a link points to, or `None` if it does not point to a project of the forge.
+///
+/// # Arguments
+///
+/// * `url` - The URL of the link.
+/// * `forge` - The forge whose projects are collected.
+fn link_project(url: &str, forge: &Forge) -> Option<String> {
+    let url: Url = Url::parse(url).ok()?;
+    if !url
+        .host_str()?
+        .trim_start_matches("www.")
+        .eq_ignore_ascii_case(forge.host())
+    {
+        return None;
+    }
+    let segments: Vec<&str> = url.path_segments()?.filter(|s| !s.is_empty()).collect();
+    let segments: &[&str] = match forge.provider() {
+        // GitLab projects can be nested in subgroups, the pages of a project are below '/-/'.
+        Provider::GitLab => match segments.iter().position(|s| *s == "-") {
+            Some(end) => &segments[..end],
+            None => &segments[..],
+        },
+        _ => segments.get(..2)?,
+    };
+    if segments.len() < 2 {
+        return None;
+    }
+    Some(segments.join("/").trim_end_matches(".git").to_string())
+}
+
+/// Parses a curated Markdown list.
+///
+/// Every list item linking to a project of the forge adds the first such project to the list, labelled with the headings
+/// of the sections enclosing the item. The first level heading, the title of the list, is not used as a label.
+/// Projects listed in several sections get the labels of all of them.
+///
+/// # Arguments
+///
+/// * `markdown` - The content of the list.
+/// * `forge` - The forge whose projects are collected.
+///
+/// # Returns
+///
+/// The paths of the projects in the order of the list, with their labels.
+fn parse_list(markdown: &str, forge: &Forge) -> Vec<(String, Vec<String>)> {
+    let link: Regex = Regex::new(r"\[[^\]]*\]\((https?://[^)\s]+)\)").unwrap();
+
+    let mut projects: Vec<(String, Vec<String>)> = Vec::new();
+    let mut index: HashMap<String, usize> = HashMap::new();
+    // Headings of the enclosing sections, with their level.
+    let mut sections: Vec<(usize, String)> = Vec::new();
+    let mut code_block: bool = false;
+    for line in markdown.lines() {
+        let line: &str = line.trim_start();
+        if line.starts_with("```") {
+            code_block = !code_block;
+        } else if code_block {
+            continue;
+        } else if line.starts_with('#') {
+            let level: usize = line.chars().take_while(|c| *c == '#').count();
+            let title: &str = line[level..].trim().trim_end_matches('#').trim();
+            sections.retain(|(l, _)| *l < level);
+            if level > 1 && !title.is_empty() {
+                sections.push((level, title.to_string()));
+            }
+        } else if ["- ", "* ", "+ "].iter().any(|m| line.starts_with(m)) {
+            let Some(path) = link
+                .captures_iter(line)
+                .find_map(|c| link_project(&c[1], forge))
+            else {
+                continue;
+            };
+            let i: usize = *index.entry(path.to_lowercase()).or_insert_with(|| {
+                projects.push((path, Vec::new()));
+                projects.len() - 1
+            });
+            for (_, title) in sections.iter() {
+                if !projects[i].1.contains(title) {
+                    projects[i].1.push(title.clone());
+                }
+            }
+        }
+    }
+    projects
+}
+
+/// Collects the projects of a curated Markdown list and writes them in a format that can be passed to the download subcommand.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the Markdown file of the list.
+/// * `output_path` - The optional path to the output CSV file. Defaults to the input path with ".projects.csv" appended.
+/// * `provider` - The name of the code hosting platform whose projects are collected.
+/// * `host` - The host of a self-hosted instance of the provider. If not specified, the public instance is used.
+/// * `tokens_file` - Path to the file containing the tokens. If not specified, the token is read from the environment.
+/// * `force` - Whether to override the output file if it already exists.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// A result indicating success or failure of the operation.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    provider: &str,
+    host: Option<&str>,
+    tokens_file: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.projects.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+
+    let forge: Forge = Forge::new(provider.parse()?, host);
+    let token: String = forge
+        .load_tokens(tokens_file, logger)?
+        .into_iter()
+        .next()
+        .context("No token available")?;
+
+    let markdown: String = std::fs::read_to_string(input_path)
+        .with_context(|| format!("Could not read {input_path}"))?;
+    let listed: Vec<(String, Vec<String>)> = parse_list(&markdown, &forge);
+    info!("{} projects of {forge} listed.", listed.len());
+
+    let mut output_file = CSVFile::new(output_path, FileMode::Overwrite)?;
+    let mut header: Vec<&str> = ForgeProject::header().to_vec();
+    header.push("tags");
+    output_file.write_header(&header)?;
+
+    let progress = ProgressBar::new(listed.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    let mut found: usize = 0;
+    for (path, tags) in listed.iter() {
+        match forge.project(&token, path)? {
+            Some(project) => {
+                writeln!(
+                    &mut output_file,
+                    "{},{}",
+                    project.to_csv(()),
+                    clean_string_to_csv(&tags.join(";"))
+                )?;
+                found += 1;
+            }
+            None => warn!("{path} does not exist or is empty"),
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+
+    info!("{} projects found.", found);
+    info!("{} projects could not be found.", listed.len() - found);
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn parse_lists() {
+        let markdown = "# Awesome Go\n\
+            \n\
+            - [Audio](#audio)\n\
+            \n\
+            ## Audio and Music\n\
+            \n\
+            - [flac](https://github.com/mewkiz/flac) - FLAC decoder, see [the spec](https://xiph.org/flac).\n\
+            - [beep](https://github.com/faiface/beep/tree/main/) - Sound library.\n\
+            \n\
+            ### Players\n\
+            \n\
+            * [Beep](https://github.com/Faiface/beep) - Again.\n\
+            \n\
+            ```\n\
+            - [ignored](https://github.com/a/b)\n\
+            ```\n\
+            \n\
+            ## Databases\n\
+            \n\
+            - [gitlab](https://gitlab.com/group/sub/project) - Other host.\n\
+            - [badger](https://github.com/dgraph-io/badger.git) - Key-value store.\n\
+            See [github](https://github.com/c/d) outside of a list.\n";
+
+        let projects = parse_list(markdown, &Forge::new(Provider::GitHub, None));
+        assert_eq!(
+            projects,
+            vec![
+                (
+                    "mewkiz/flac".to_string(),
+                    vec!["Audio and Music".to_string()]
+                ),
+                (
+                    "faiface/beep".to_string(),
+                    vec!["Audio and Music".to_string(), "Players".to_string()]
+                ),
+                (
+                    "dgraph-io/badger".to_string(),
+                    vec!["Databases".to_string()]
+                ),
+            ]
+        );
+
+        let projects = parse_list(markdown, &Forge::new(Provider::GitLab, None));
+        assert_eq!(
+            projects,
+            vec![(
+                "group/sub/project".to_string(),
+                vec!["Databases".to_string()]
+            )]
+        );
+    }
+}
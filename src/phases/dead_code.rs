@@ -0,0 +1,519 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/dead_code.md")]
+
+use std::collections::{BTreeMap, HashMap, HashSet};
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{
+    self, called_function, enclosing_function, imported_packages, nodes, text, Census, Occurrence,
+};
+use crate::utils::fs::check_path;
+use crate::utils::logger::{log_output_file, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("dead_code")
+        .about("Flags the unreferenced declarations and the unreachable statements of the Go packages of the downloaded projects")
+        .long_about(include_str!("../docs/dead_code.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the dead code of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of unreferenced declarations and unreachable statements of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("profile")
+                .long("profile")
+                .value_name("PROFILE_FILE.csv")
+                .help("Path to the output csv file storing the dead code profile of every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the dead code, in the order of the columns of the census.
+const CATEGORIES: [&str; 6] = [
+    "function",
+    "method",
+    "type",
+    "constant",
+    "variable",
+    "unreachable",
+];
+
+/// Nodes whose named children are the statements of a block, in order.
+const STATEMENT_LISTS: [&str; 6] = [
+    "block",
+    "statement_list",
+    "expression_case",
+    "type_case",
+    "default_case",
+    "communication_case",
+];
+
+/// Nodes declaring the identifiers of their name field.
+const DECLARATIONS: [&str; 6] = [
+    "function_declaration",
+    "method_declaration",
+    "type_spec",
+    "type_alias",
+    "const_spec",
+    "var_spec",
+];
+
+/// Dead code candidate of a package: an unexported declaration, dead unless the package references its name, or an
+/// unreachable statement.
+struct Finding {
+    /// Index of the file in the order of the visit.
+    file: usize,
+    function: String,
+    name: Option<String>,
+    occurrence: Occurrence,
+}
+
+/// Dead code candidates of a package, with the names referenced by its files.
+#[derive(Default)]
+struct Package {
+    findings: Vec<Finding>,
+    references: HashSet<String>,
+}
+
+/// Whether an identifier is exported, i.e. starts with an upper case letter.
+fn is_exported(name: &str) -> bool {
+    name.chars().next().is_some_and(char::is_uppercase)
+}
+
+/// Returns the unexported top-level declarations of a Go file, with the name their references use and their enclosing
+/// function. Exported declarations may be used by other packages, and init and main functions by the runtime.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn declarations(root: &Node, source: &[u8]) -> Vec<(String, String, Occurrence)> {
+    let mut declarations: Vec<(String, String, Occurrence)> = Vec::new();
+    let mut declare = |category: &'static str, name: &Node, construct: String| {
+        let identifier: &str = text(name, source);
+        if !is_exported(identifier) && identifier != "_" {
+            declarations.push((
+                identifier.to_string(),
+                enclosing_function(name, source),
+                Occurrence::new(category, construct, name),
+            ));
+        }
+    };
+    let mut cursor = root.walk();
+    for node in root.named_children(&mut cursor) {
+        let mut specs: Vec<Node> = Vec::new();
+        let mut cursor = node.walk();
+        for child in node.named_children(&mut cursor) {
+            match child.kind() {
+                "var_spec_list" => specs.extend(child.named_children(&mut child.walk())),
+                _ => specs.push(child),
+            }
+        }
+        match node.kind() {
+            "function_declaration" => {
+                if let Some(name) = node.child_by_field_name("name") {
+                    if !matches!(text(&name, source), "init" | "main") {
+                        declare("function", &name, text(&name, source).to_string());
+                    }
+                }
+            }
+            "method_declaration" => {
+                if let Some(name) = node.child_by_field_name("name") {
+                    declare("method", &name, enclosing_function(&name, source));
+                }
+            }
+            "type_declaration" | "const_declaration" | "var_declaration" => {
+                let category: &'static str = match node.kind() {
+                    "type_declaration" => "type",
+                    "const_declaration" => "constant",
+                    _ => "variable",
+                };
+                for spec in specs
+                    .iter()
+                    .filter(|spec| DECLARATIONS.contains(&spec.kind()))
+                {
+                    let mut cursor = spec.walk();
+                    for name in spec.children_by_field_name("name", &mut cursor) {
+                        declare(category, &name, text(&name, source).to_string());
+                    }
+                }
+            }
+            _ => (),
+        }
+    }
+    declarations
+}
+
+/// Returns the names referenced by a Go file, i.e. its identifiers other than the declared ones, and the functions
+/// exported to C or linked by name with `//export` and `//go:linkname` directives.
+fn references(root: &Node, source: &[u8]) -> HashSet<String> {
+    let mut references: HashSet<String> = HashSet::new();
+    for node in nodes(root) {
+        match node.kind() {
+            "identifier" | "type_identifier" | "field_identifier" => {
+                let declared: bool = node.parent().is_some_and(|parent| {
+                    DECLARATIONS.contains(&parent.kind()) && {
+                        let mut cursor = parent.walk();
+                        let is_name: bool = parent
+                            .children_by_field_name("name", &mut cursor)
+                            .any(|name| name == node);
+                        is_name
+                    }
+                });
+                if !declared {
+                    references.insert(text(&node, source).to_string());
+                }
+            }
+            "comment" => {
+                let comment: &str = text(&node, source);
+                if let Some(names) = comment
+                    .strip_prefix("//export ")
+                    .or_else(|| comment.strip_prefix("//go:linkname "))
+                {
+                    references.extend(names.split_whitespace().map(str::to_string));
+                }
+            }
+            _ => (),
+        }
+    }
+    references
+}
+
+/// Returns how a statement ends the execution of its block, if it does: by returning, jumping, panicking or exiting
+/// the program.
+fn terminator(
+    statement: &Node,
+    source: &[u8],
+    imports: &HashMap<String, String>,
+) -> Option<&'static str> {
+    match statement.kind() {
+        "return_statement" => Some("after-return"),
+        "goto_statement" => Some("after-goto"),
+        "break_statement" => Some("after-break"),
+        "continue_statement" => Some("after-continue"),
+        "expression_statement" => {
+            let call: Node = statement.named_child(0)?;
+            let function: Node = call.child_by_field_name("function")?;
+            if call.kind() == "call_expression"
+                && function.kind() == "identifier"
+                && text(&function, source) == "panic"
+            {
+                return Some("after-panic");
+            }
+            match called_function(&call, source, imports)? {
+                ("os", "Exit") | ("log", "Fatal" | "Fatalf" | "Fatalln") => Some("after-exit"),
+                ("log", "Panic" | "Panicf" | "Panicln") => Some("after-panic"),
+                _ => None,
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Returns the unreachable statements of a Go file, in the order of the file: the statements following a return,
+/// a jump, a panic or an exit in the same block, up to the next labeled statement, which a goto statement may reach.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn unreachable_statements(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let imports: HashMap<String, String> = imported_packages(root, source);
+    let mut occurrences: Vec<Occurrence> = Vec::new();
+    for list in nodes(root)
+        .into_iter()
+        .filter(|node| STATEMENT_LISTS.contains(&node.kind()))
+    {
+        let mut after: Option<&'static str> = None;
+        let mut cursor = list.walk();
+        for statement in list.named_children(&mut cursor) {
+            match (statement.kind(), after) {
+                ("comment" | "empty_statement", _) => (),
+                // The statement of a label can be reached by a goto statement, but may end the block itself.
+                ("labeled_statement", _) => {
+                    let labeled: Option<Node> =
+                        statement.named_child(statement.named_child_count().saturating_sub(1));
+                    after = labeled.and_then(|labeled| terminator(&labeled, source, &imports));
+                }
+                (_, Some(pattern)) => {
+                    occurrences.push(Occurrence::new("unreachable", pattern, &statement))
+                }
+                (_, None) => after = terminator(&statement, source, &imports),
+            }
+        }
+    }
+    occurrences.sort_by_key(|occurrence| occurrence.start);
+    occurrences
+}
+
+/// Flags the unreferenced declarations and the unreachable statements of the Go packages of the projects listed in a
+/// manifest, and sums them up in a profile of every project.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the dead code. Defaults to the input path with ".dead_code.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".dead_code_census.csv" appended.
+/// * `profile_path` - The optional path to the output CSV file storing the profile of the projects. Defaults to the input path with ".dead_code_profile.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    profile_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.dead_code.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.dead_code_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+    let default_profile_path = format!("{input_path}.dead_code_profile.csv");
+    let profile_path = profile_path.unwrap_or(&default_profile_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(census_path, false, force)?;
+    log_output_file(profile_path, false, force)?;
+
+    // A declaration is only known to be dead once all the files of its package have been visited.
+    let mut census: Census = Census::new(&CATEGORIES);
+    let mut files: Vec<(usize, Option<u32>, String, String)> = Vec::new();
+    let mut packages: BTreeMap<(usize, String), Package> = BTreeMap::new();
+    census::visit_go_files(input_path, |file| {
+        census.count_file(file);
+        let root: Node = file.tree.root_node();
+        let package: &mut Package = packages
+            .entry((file.project, file.package.clone()))
+            .or_default();
+        package.references.extend(references(&root, &file.source));
+        for (name, function, occurrence) in declarations(&root, &file.source) {
+            package.findings.push(Finding {
+                file: files.len(),
+                function,
+                name: Some(name),
+                occurrence,
+            });
+        }
+        for occurrence in unreachable_statements(&root, &file.source) {
+            package.findings.push(Finding {
+                file: files.len(),
+                function: root
+                    .descendant_for_byte_range(occurrence.start, occurrence.start + 1)
+                    .map(|node| enclosing_function(&node, &file.source))
+                    .unwrap_or_default(),
+                name: None,
+                occurrence,
+            });
+        }
+        files.push((
+            file.project,
+            file.id,
+            file.path.clone(),
+            file.package.clone(),
+        ));
+        Ok(())
+    })?;
+
+    for package in packages.into_values() {
+        let mut findings: Vec<Finding> = package
+            .findings
+            .into_iter()
+            .filter(|f| {
+                f.name
+                    .as_ref()
+                    .is_none_or(|name| !package.references.contains(name))
+            })
+            .collect();
+        findings.sort_by_key(|f| (f.file, f.occurrence.start));
+        for finding in findings {
+            let (project, id, path, file_package) = &files[finding.file];
+            census.record(
+                *project,
+                *id,
+                path,
+                file_package,
+                finding.function,
+                finding.occurrence,
+            );
+        }
+    }
+    census.write(output_path, census_path, logger)?;
+    census::profile(census_path, profile_path, &CATEGORIES, logger)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use polars::frame::DataFrame;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn unreachable() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import \"os\"\n\n\
+            func f(xs []int) int {\n\
+            \tfor _, x := range xs {\n\
+            \t\tif x < 0 {\n\
+            \t\t\tcontinue\n\
+            \t\t\tx = -x\n\
+            \t\t}\n\
+            \t}\n\
+            \tgoto end\n\
+            \tos.Exit(1)\n\
+            end:\n\
+            \treturn 0\n\
+            \tpanic(\"unreachable\")\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = unreachable_statements(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("unreachable", "after-continue".to_string(), 9),
+                ("unreachable", "after-goto".to_string(), 13),
+                ("unreachable", "after-return".to_string(), 16),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn dead_code() -> Result<()> {
+        let test_dir = "target/tests/phases/dead_code";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/a.go"),
+            "package a\n\n\
+             type point struct{ x int }\n\n\
+             type unused int\n\n\
+             const (\n\tlimit = 10\n\tspare = 2\n)\n\n\
+             var cache map[string]int\n\n\
+             func init() {}\n\n\
+             func f() int {\n\treturn limit\n\tprintln()\n}\n\n\
+             func (p point) norm() int { return p.x }\n\n\
+             func helper() {}\n\n\
+             //export callback\n\
+             func callback() {}\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/b.go"),
+            "package a\n\nfunc G() point {\n\t_ = f()\n\tpanic(\"G\")\n}\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/c/c.go"),
+            "package c\n\nfunc limit() {}\n",
+        )?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/a", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, None, false, test_logger())?;
+        let occurrences: DataFrame =
+            open_csv(&format!("{manifest_path}.dead_code.csv"), None, None)?;
+        assert_eq!(
+            occurrences
+                .column("construct")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("unused"),
+                Some("spare"),
+                Some("cache"),
+                Some("after-return"),
+                Some("point.norm"),
+                Some("helper"),
+                Some("limit"),
+            ]
+        );
+        assert_eq!(
+            occurrences
+                .column("line")?
+                .i64()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some(5),
+                Some(9),
+                Some(12),
+                Some(18),
+                Some(21),
+                Some(23),
+                Some(3)
+            ]
+        );
+        let profile: DataFrame = open_csv(
+            &format!("{manifest_path}.dead_code_profile.csv"),
+            None,
+            None,
+        )?;
+        assert_eq!(profile.column("packages")?.i64()?.get(0), Some(2));
+        assert_eq!(profile.column("files")?.i64()?.get(0), Some(3));
+        assert_eq!(profile.column("function")?.i64()?.get(0), Some(2));
+        assert_eq!(profile.column("occurrences")?.i64()?.get(0), Some(7));
+
+        delete_dir(test_dir, false)
+    }
+}
@@ -0,0 +1,349 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/defers.md")]
+
+use std::collections::{HashMap, HashSet};
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, called_function, imported_packages, nodes, text, Occurrence};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("defers")
+        .about("Extracts and classifies the defer statements, panics and recover sites of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/defers.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the defer statements, panics and recover sites of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of defer statements, panics and recover sites of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the constructs, in the order of the columns of the census.
+const CATEGORIES: [&str; 3] = ["defer", "panic", "recover"];
+
+/// Returns the innermost function, function literal or method enclosing a node, if any.
+fn innermost_function<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let mut current: Option<Node> = node.parent();
+    while let Some(ancestor) = current {
+        if matches!(
+            ancestor.kind(),
+            "function_declaration" | "method_declaration" | "func_literal"
+        ) {
+            return Some(ancestor);
+        }
+        current = ancestor.parent();
+    }
+    None
+}
+
+/// Whether a function literal is called by a defer statement, e.g. `defer func() { ... }()`.
+fn is_deferred_closure(function: &Node) -> bool {
+    function.kind() == "func_literal"
+        && function.parent().is_some_and(|call| {
+            call.kind() == "call_expression"
+                && call.child_by_field_name("function") == Some(*function)
+                && call
+                    .parent()
+                    .is_some_and(|statement| statement.kind() == "defer_statement")
+        })
+}
+
+/// Whether a defer statement is in the body of a loop of its function, hence only run when the function returns and
+/// not at the end of every iteration.
+fn in_loop(statement: &Node) -> bool {
+    let mut current: Option<Node> = statement.parent();
+    while let Some(ancestor) = current {
+        match ancestor.kind() {
+            "for_statement" => return true,
+            "function_declaration" | "method_declaration" | "func_literal" => return false,
+            _ => current = ancestor.parent(),
+        }
+    }
+    false
+}
+
+/// Returns the name of the builtin function called by a call expression, if it is called with an identifier.
+fn callee<'a>(call: &Node, source: &'a [u8]) -> Option<&'a str> {
+    let function: Node = call.child_by_field_name("function")?;
+    (function.kind() == "identifier").then(|| text(&function, source))
+}
+
+/// Returns the names of the functions and methods called by the defer statements of a file, e.g. `handle` for
+/// `defer handle()` or `defer s.handle()`.
+fn deferred_names<'a>(nodes: &[Node], source: &'a [u8]) -> HashSet<&'a str> {
+    nodes
+        .iter()
+        .filter(|node| node.kind() == "defer_statement")
+        .filter_map(|statement| statement.named_child(0))
+        .filter_map(|call| call.child_by_field_name("function"))
+        .filter_map(|function| match function.kind() {
+            "identifier" => Some(text(&function, source)),
+            "selector_expression" => function
+                .child_by_field_name("field")
+                .map(|field| text(&field, source)),
+            _ => None,
+        })
+        .collect()
+}
+
+/// Returns the kind of value a panic is raised with: an error, a string or another value.
+fn panic_value(call: &Node, source: &[u8], imports: &HashMap<String, String>) -> &'static str {
+    let Some(value) = call
+        .child_by_field_name("arguments")
+        .and_then(|arguments| arguments.named_child(0))
+    else {
+        return "value";
+    };
+    match value.kind() {
+        "interpreted_string_literal" | "raw_string_literal" => "string",
+        "identifier" if text(&value, source).to_lowercase().ends_with("err") => "error",
+        "call_expression" => match called_function(&value, source, imports) {
+            Some(("errors", "New")) | Some(("fmt", "Errorf")) => "error",
+            Some(("fmt", "Sprintf")) | Some(("fmt", "Sprint")) => "string",
+            _ => "value",
+        },
+        _ => "value",
+    }
+}
+
+/// Returns the defer statements, panics and recover sites of a Go file, classified by pattern, in the order of the file.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn defer_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let imports: HashMap<String, String> = imported_packages(root, source);
+    let nodes: Vec<Node> = nodes(root);
+    let deferred: HashSet<&str> = deferred_names(&nodes, source);
+    nodes
+        .iter()
+        .filter_map(|node| match node.kind() {
+            "defer_statement" => {
+                let pattern: &str = if in_loop(node) {
+                    "defer-in-loop"
+                } else if node
+                    .named_child(0)
+                    .and_then(|call| call.child_by_field_name("function"))
+                    .is_some_and(|function| function.kind() == "func_literal")
+                {
+                    "deferred-closure"
+                } else {
+                    "deferred-call"
+                };
+                Some(Occurrence::new("defer", pattern, node))
+            }
+            "call_expression" => match callee(node, source)? {
+                "panic" => {
+                    let pattern: String = if innermost_function(node)
+                        .is_some_and(|function| is_deferred_closure(&function))
+                    {
+                        "panic-in-defer".to_string()
+                    } else {
+                        format!("panic-{}", panic_value(node, source, &imports))
+                    };
+                    Some(Occurrence::new("panic", pattern, node))
+                }
+                // Recover only stops a panic when it is called directly by a deferred function.
+                "recover" => {
+                    let pattern: &str = match innermost_function(node) {
+                        Some(function) if is_deferred_closure(&function) => {
+                            "recover-in-deferred-closure"
+                        }
+                        Some(function)
+                            if function.kind() != "func_literal"
+                                && function
+                                    .child_by_field_name("name")
+                                    .is_some_and(|name| deferred.contains(text(&name, source))) =>
+                        {
+                            "recover-in-deferred-function"
+                        }
+                        _ => "recover-not-deferred",
+                    };
+                    Some(Occurrence::new("recover", pattern, node))
+                }
+                _ => None,
+            },
+            _ => None,
+        })
+        .collect()
+}
+
+/// Extracts and classifies the defer statements, panics and recover sites of the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the constructs. Defaults to the input path with ".defers.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".defers_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.defers.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.defers_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        defer_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use polars::frame::DataFrame;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    /// Returns the category, pattern and line of the constructs of a Go file.
+    fn patterns(source: &[u8]) -> Result<Vec<(&'static str, String, usize)>> {
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        Ok(defer_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect())
+    }
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import \"errors\"\n\n\
+            func handle() { recover() }\n\n\
+            func f(files []*File) {\n\
+            \tdefer handle()\n\
+            \tfor _, file := range files {\n\
+            \t\tdefer file.Close()\n\
+            \t}\n\
+            \tdefer func() { panic(recover()) }()\n\
+            \tgo func() { recover() }()\n\
+            \tpanic(errors.New(\"f\"))\n\
+            }\n";
+        assert_eq!(
+            patterns(source)?,
+            vec![
+                ("recover", "recover-in-deferred-function".to_string(), 5),
+                ("defer", "deferred-call".to_string(), 8),
+                ("defer", "defer-in-loop".to_string(), 10),
+                ("defer", "deferred-closure".to_string(), 12),
+                ("panic", "panic-in-defer".to_string(), 12),
+                ("recover", "recover-in-deferred-closure".to_string(), 12),
+                ("recover", "recover-not-deferred".to_string(), 13),
+                ("panic", "panic-error".to_string(), 14),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn defers() -> Result<()> {
+        let test_dir = "target/tests/phases/defers";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/several_functions.go"),
+            std::fs::read("tests/data/phases/parse/several_functions.go")?,
+        )?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/a", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let occurrences: DataFrame = open_csv(&format!("{manifest_path}.defers.csv"), None, None)?;
+        assert_eq!(
+            occurrences
+                .column("function")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("deferredDivision"),
+                Some("safeDivision"),
+                Some("safeDivision"),
+                Some("safeDivision"),
+            ]
+        );
+        assert_eq!(
+            occurrences
+                .column("construct")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("deferred-closure"),
+                Some("deferred-closure"),
+                Some("recover-in-deferred-closure"),
+                Some("panic-string"),
+            ]
+        );
+
+        delete_dir(test_dir, false)
+    }
+}
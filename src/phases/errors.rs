@@ -0,0 +1,453 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/errors.md")]
+
+use std::collections::HashMap;
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, called_function, imported_packages, nodes, text, Occurrence};
+use crate::utils::logger::{log_output_file, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("errors")
+        .about("Classifies the error handling sites of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/errors.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the error handling sites of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of error handling sites of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("profile")
+                .long("profile")
+                .value_name("PROFILE_FILE.csv")
+                .help("Path to the output csv file storing the error handling idiom profile of every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the error handling sites, in the order of the columns of the census.
+const CATEGORIES: [&str; 8] = [
+    "nil_check",
+    "chain",
+    "inspection",
+    "wrapping",
+    "sentinel",
+    "comparison",
+    "ignored",
+    "panic_on_error",
+];
+
+/// Import paths of the packages of errors, the standard one and its popular predecessor.
+const ERROR_PACKAGES: [&str; 2] = ["errors", "github.com/pkg/errors"];
+
+/// Functions of the log package terminating the program or raising a panic.
+const FATAL_LOG_FUNCTIONS: [&str; 6] = ["Fatal", "Fatalf", "Fatalln", "Panic", "Panicf", "Panicln"];
+
+/// Whether a node is an identifier conventionally naming an error, e.g. `err` or `parseErr`.
+fn is_error_name(node: &Node, source: &[u8]) -> bool {
+    node.kind() == "identifier" && text(node, source).to_lowercase().ends_with("err")
+}
+
+/// Whether an expression compares an error to nil, e.g. `err != nil`.
+fn is_nil_check(condition: &Node, source: &[u8]) -> bool {
+    if condition.kind() != "binary_expression"
+        || condition
+            .child_by_field_name("operator")
+            .map(|op| op.kind())
+            != Some("!=")
+    {
+        return false;
+    }
+    match (
+        condition.child_by_field_name("left"),
+        condition.child_by_field_name("right"),
+    ) {
+        (Some(left), Some(right)) => {
+            (is_error_name(&left, source) && right.kind() == "nil")
+                || (left.kind() == "nil" && is_error_name(&right, source))
+        }
+        _ => false,
+    }
+}
+
+/// Returns the statements of a block, whether they are wrapped in a statement list or not.
+fn statements<'a>(block: &Node<'a>) -> Vec<Node<'a>> {
+    let mut cursor = block.walk();
+    let children: Vec<Node> = block.named_children(&mut cursor).collect();
+    match children.as_slice() {
+        [list] if list.kind() == "statement_list" => list.named_children(&mut cursor).collect(),
+        _ => children,
+    }
+}
+
+/// Whether an if statement checks an error against nil.
+fn checks_error(statement: &Node, source: &[u8]) -> bool {
+    statement.kind() == "if_statement"
+        && statement
+            .child_by_field_name("condition")
+            .is_some_and(|condition| is_nil_check(&condition, source))
+}
+
+/// Returns how a call panics or terminates the program, if it does: `panic` or the function of the log package.
+fn fatal_call(call: &Node, source: &[u8], imports: &HashMap<String, String>) -> Option<String> {
+    let function: Node = call.child_by_field_name("function")?;
+    if function.kind() == "identifier" && text(&function, source) == "panic" {
+        return Some("panic".to_string());
+    }
+    match called_function(call, source, imports)? {
+        ("log", name) if FATAL_LOG_FUNCTIONS.contains(&name) => Some(format!("log.{name}")),
+        _ => None,
+    }
+}
+
+/// Returns the pattern of the handling of an error checked against nil: `panic` if the block panics or terminates
+/// the program, `return` if it ends with a return statement, `log` if it logs the error, and `other` otherwise.
+fn handling(block: &Node, source: &[u8], imports: &HashMap<String, String>) -> &'static str {
+    let calls: Vec<Node> = nodes(block)
+        .into_iter()
+        .filter(|node| node.kind() == "call_expression")
+        .collect();
+    if calls
+        .iter()
+        .any(|call| fatal_call(call, source, imports).is_some())
+    {
+        "panic"
+    } else if statements(block)
+        .last()
+        .is_some_and(|last| last.kind() == "return_statement")
+    {
+        "return"
+    } else if calls.iter().any(|call| {
+        called_function(call, source, imports)
+            .is_some_and(|(package, _)| package == "log" || package == "log/slog")
+    }) {
+        "log"
+    } else {
+        "other"
+    }
+}
+
+/// Whether a name or a selector refers to a sentinel error, e.g. `ErrNotFound` or `io.EOF`.
+fn is_sentinel(node: &Node, source: &[u8]) -> bool {
+    let name: Option<Node> = match node.kind() {
+        "identifier" => Some(*node),
+        "selector_expression" => node.child_by_field_name("field"),
+        _ => None,
+    };
+    name.is_some_and(|name| {
+        let name: &str = text(&name, source);
+        name.starts_with("Err") || name == "EOF"
+    })
+}
+
+/// Whether a call creates an error, with errors.New or fmt.Errorf.
+fn creates_error(call: &Node, source: &[u8], imports: &HashMap<String, String>) -> bool {
+    match called_function(call, source, imports) {
+        Some((package, "New")) => ERROR_PACKAGES.contains(&package),
+        Some(("fmt", "Errorf")) => true,
+        _ => false,
+    }
+}
+
+/// Returns the error handling site at a node, if any.
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+/// * `imports` - The packages imported by the file.
+fn occurrence(node: &Node, source: &[u8], imports: &HashMap<String, String>) -> Option<Occurrence> {
+    match node.kind() {
+        "if_statement" if checks_error(node, source) => {
+            let block: Node = node.child_by_field_name("consequence")?;
+            Some(Occurrence::new(
+                "nil_check",
+                handling(&block, source, imports),
+                node,
+            ))
+        }
+        // Consecutive checks of errors in a block, recorded at the first one with their number.
+        "block" => {
+            let checks: Vec<Node> = statements(node)
+                .into_iter()
+                .filter(|statement| checks_error(statement, source))
+                .collect();
+            (checks.len() > 1)
+                .then(|| Occurrence::new("chain", checks.len().to_string(), &checks[0]))
+        }
+        "call_expression" => {
+            if let Some(fatal) = fatal_call(node, source, imports) {
+                let arguments: Node = node.child_by_field_name("arguments")?;
+                let mut cursor = arguments.walk();
+                let mut arguments = arguments.named_children(&mut cursor);
+                return arguments
+                    .any(|argument| is_error_name(&argument, source))
+                    .then(|| Occurrence::new("panic_on_error", fatal, node));
+            }
+            let (package, name) = called_function(node, source, imports)?;
+            let qualified: String = match package {
+                "github.com/pkg/errors" => format!("pkg/errors.{name}"),
+                _ => format!("{package}.{name}"),
+            };
+            match (package, name) {
+                ("fmt", "Errorf") => {
+                    // Errors are wrapped by the %w verb of the format.
+                    let wraps: bool = node
+                        .child_by_field_name("arguments")
+                        .and_then(|arguments| arguments.named_child(0))
+                        .is_some_and(|format| text(&format, source).contains("%w"));
+                    wraps.then(|| Occurrence::new("wrapping", "fmt.Errorf(%w)", node))
+                }
+                ("errors", "Join")
+                | (
+                    "github.com/pkg/errors",
+                    "Wrap" | "Wrapf" | "WithMessage" | "WithMessagef" | "WithStack",
+                ) => Some(Occurrence::new("wrapping", qualified, node)),
+                (_, "Is" | "As" | "Unwrap") | ("github.com/pkg/errors", "Cause")
+                    if ERROR_PACKAGES.contains(&package) =>
+                {
+                    Some(Occurrence::new("inspection", qualified, node))
+                }
+                _ => None,
+            }
+        }
+        // Errors declared at the top level of the file, e.g. var ErrNotFound = errors.New("not found").
+        "identifier" => {
+            let spec: Node = node.parent().filter(|spec| spec.kind() == "var_spec")?;
+            let top_level: bool = spec
+                .parent()
+                .and_then(|declaration| declaration.parent())
+                .is_some_and(|parent| parent.kind() == "source_file");
+            let mut cursor = spec.walk();
+            let index: usize = spec
+                .children_by_field_name("name", &mut cursor)
+                .position(|name| name == *node)?;
+            let value: Node = spec.child_by_field_name("value")?.named_child(index)?;
+            (top_level && creates_error(&value, source, imports))
+                .then(|| Occurrence::new("sentinel", text(node, source), node))
+        }
+        "binary_expression" => {
+            let operator: &str = node.child_by_field_name("operator")?.kind();
+            let left: Node = node.child_by_field_name("left")?;
+            let right: Node = node.child_by_field_name("right")?;
+            let sentinel: Node = if is_error_name(&left, source) && is_sentinel(&right, source) {
+                right
+            } else if is_error_name(&right, source) && is_sentinel(&left, source) {
+                left
+            } else {
+                return None;
+            };
+            matches!(operator, "==" | "!=")
+                .then(|| Occurrence::new("comparison", text(&sentinel, source), node))
+        }
+        // Errors are conventionally the last result of a function, e.g. v, _ := strconv.Atoi(s).
+        "assignment_statement" | "short_var_declaration" => {
+            let left: Node = node.child_by_field_name("left")?;
+            let right: Node = node.child_by_field_name("right")?;
+            let mut cursor = left.walk();
+            let names: Vec<Node> = left.named_children(&mut cursor).collect();
+            let single_call: bool =
+                right.named_child_count() == 1 && right.named_child(0)?.kind() == "call_expression";
+            let blank: bool = names.last().is_some_and(|last| text(last, source) == "_");
+            (single_call && blank).then(|| {
+                Occurrence::new(
+                    "ignored",
+                    if names.len() == 1 {
+                        "blank"
+                    } else {
+                        "blank-last"
+                    },
+                    node,
+                )
+            })
+        }
+        _ => None,
+    }
+}
+
+/// Returns the error handling sites of a Go file, in the order of the file. Without type-checking the file, errors are
+/// recognized by their conventional names (e.g. err or parseErr, and ErrNotFound or io.EOF for sentinel errors).
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn error_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let imports: HashMap<String, String> = imported_packages(root, source);
+    nodes(root)
+        .iter()
+        .filter_map(|node| occurrence(node, source, &imports))
+        .collect()
+}
+
+/// Classifies the error handling sites of the Go files of the projects listed in a manifest, and sums them up in an
+/// idiom profile of every project.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the sites. Defaults to the input path with ".errors.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".errors_census.csv" appended.
+/// * `profile_path` - The optional path to the output CSV file storing the profile of the projects. Defaults to the input path with ".errors_profile.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    profile_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.errors.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.errors_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+    let default_profile_path = format!("{input_path}.errors_profile.csv");
+    let profile_path = profile_path.unwrap_or(&default_profile_path);
+    log_output_file(profile_path, false, force)?;
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        error_occurrences,
+        force,
+        logger,
+    )?;
+    census::profile(census_path, profile_path, &CATEGORIES, logger)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use polars::frame::DataFrame;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    const SOURCE: &[u8] = b"package a\n\n\
+        import (\n\t\"errors\"\n\t\"fmt\"\n\t\"io\"\n\t\"log\"\n)\n\n\
+        var ErrEmpty = errors.New(\"empty\")\n\n\
+        func read(r io.Reader) error {\n\
+        \tn, err := r.Read(nil)\n\
+        \tif err != nil {\n\
+        \t\treturn fmt.Errorf(\"read: %w\", err)\n\
+        \t}\n\
+        \t_, err = r.Read(nil)\n\
+        \tif err == io.EOF || errors.Is(err, ErrEmpty) {\n\
+        \t\treturn nil\n\
+        \t}\n\
+        \tif err != nil {\n\
+        \t\tlog.Fatal(err)\n\
+        \t}\n\
+        \t_, _ = fmt.Println(n)\n\
+        \treturn nil\n\
+        }\n";
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(SOURCE, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = error_occurrences(&tree.root_node(), SOURCE)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("sentinel", "ErrEmpty".to_string(), 10),
+                ("chain", "2".to_string(), 14),
+                ("nil_check", "return".to_string(), 14),
+                ("wrapping", "fmt.Errorf(%w)".to_string(), 15),
+                ("comparison", "io.EOF".to_string(), 18),
+                ("inspection", "errors.Is".to_string(), 18),
+                ("nil_check", "panic".to_string(), 21),
+                ("panic_on_error", "log.Fatal".to_string(), 22),
+                ("ignored", "blank-last".to_string(), 24),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn errors() -> Result<()> {
+        let test_dir = "target/tests/phases/errors";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/1/a.go"), SOURCE)?;
+        write_file(format!("{test_dir}/1/b/b.go"), b"package b\n")?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/a", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, None, false, test_logger())?;
+        let profile: DataFrame =
+            open_csv(&format!("{manifest_path}.errors_profile.csv"), None, None)?;
+        assert_eq!(profile.height(), 1);
+        assert_eq!(profile.column("packages")?.i64()?.get(0), Some(2));
+        assert_eq!(profile.column("files")?.i64()?.get(0), Some(2));
+        assert_eq!(profile.column("occurrences")?.i64()?.get(0), Some(9));
+        assert!(profile
+            .column("nil_check_share")?
+            .f64()?
+            .get(0)
+            .is_some_and(|share| (share - 2.0 / 9.0).abs() < 1e-9));
+
+        delete_dir(test_dir, false)
+    }
+}
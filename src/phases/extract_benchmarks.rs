@@ -662,8 +662,28 @@ pub fn run(
         &project_input,
         Some(&projects_output),
         None,
+        None,
+        None,
         target,
         Some(tokens_file),
+        Some("github"),
+        None,
+        None,
+        crate::phases::download::FetchMode::default(),
+        &crate::phases::download::BranchPolicy::default(),
+        false,
+        None,
+        false,
+        None,
+        false,
+        None,
+        None,
+        None,
+        crate::phases::download::RetryPolicy::default(),
+        &crate::phases::download::Filters {
+            include_forks: true,
+            ..Default::default()
+        },
         &["keywords/c_files.json"],
         false,
         false,
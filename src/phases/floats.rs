@@ -0,0 +1,421 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/floats.md")]
+
+use std::collections::{HashMap, HashSet};
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{
+    self, called_function, imported_packages, nodes, qualified_name, text, Occurrence,
+};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("floats")
+        .about("Counts and locates the floating-point operations of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/floats.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the floating-point operations of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of floating-point operations of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the floating-point constructs, in the order of the columns of the census.
+const CATEGORIES: [&str; 7] = [
+    "literal",
+    "conversion",
+    "arithmetic",
+    "comparison",
+    "math",
+    "cmplx",
+    "nan_inf",
+];
+
+/// The floating-point types of Go.
+const FLOAT_TYPES: [&str; 2] = ["float32", "float64"];
+
+const ARITHMETIC_OPERATORS: [&str; 4] = ["+", "-", "*", "/"];
+
+const COMPOUND_OPERATORS: [&str; 4] = ["+=", "-=", "*=", "/="];
+
+const COMPARISON_OPERATORS: [&str; 6] = ["==", "!=", "<", "<=", ">", ">="];
+
+/// Functions of the math and math/cmplx packages creating or testing NaN and infinite values.
+const NAN_INF_FUNCTIONS: [&str; 4] = ["NaN", "IsNaN", "Inf", "IsInf"];
+
+/// Functions of the math package whose result is not a single floating-point value.
+const NON_FLOAT_MATH_FUNCTIONS: [&str; 10] = [
+    "IsNaN",
+    "IsInf",
+    "Signbit",
+    "Float32bits",
+    "Float64bits",
+    "Ilogb",
+    "Frexp",
+    "Modf",
+    "Sincos",
+    "Lgamma",
+];
+
+/// Constants of the math package with a floating-point value.
+const FLOAT_MATH_CONSTANTS: [&str; 15] = [
+    "E",
+    "Pi",
+    "Phi",
+    "Sqrt2",
+    "SqrtE",
+    "SqrtPi",
+    "SqrtPhi",
+    "Ln2",
+    "Log2E",
+    "Ln10",
+    "Log10E",
+    "MaxFloat32",
+    "SmallestNonzeroFloat32",
+    "MaxFloat64",
+    "SmallestNonzeroFloat64",
+];
+
+/// Returns the operator of a binary expression or of an assignment.
+fn operator<'a>(node: &Node<'a>) -> Option<&'a str> {
+    node.child_by_field_name("operator").map(|op| op.kind())
+}
+
+/// What is known of the floating-point values of a Go file without type-checking it.
+struct Floats<'a> {
+    source: &'a [u8],
+    imports: HashMap<String, String>,
+    /// The names of the variables, constants, parameters and fields declared with a floating-point type or value,
+    /// whatever their scope.
+    names: HashSet<String>,
+}
+
+impl Floats<'_> {
+    /// Returns the floating-point type an expression converts to, if it is a conversion to such a type.
+    fn conversion(&self, node: &Node) -> Option<&str> {
+        if node.kind() != "call_expression" {
+            return None;
+        }
+        let target: &str = text(&node.child_by_field_name("function")?, self.source);
+        FLOAT_TYPES.contains(&target).then_some(target)
+    }
+
+    /// Whether an expression is known to have a floating-point value.
+    fn is_float(&self, node: &Node) -> bool {
+        match node.kind() {
+            "float_literal" => true,
+            "identifier" | "field_identifier" => self.names.contains(text(node, self.source)),
+            "parenthesized_expression" => node.named_child(0).is_some_and(|e| self.is_float(&e)),
+            "unary_expression" => node
+                .child_by_field_name("operand")
+                .is_some_and(|e| self.is_float(&e)),
+            "binary_expression" => {
+                operator(node).is_some_and(|op| ARITHMETIC_OPERATORS.contains(&op))
+                    && self.has_float_operand(node)
+            }
+            "selector_expression" => match qualified_name(node, self.source, &self.imports) {
+                Some((package, name)) => package == "math" && FLOAT_MATH_CONSTANTS.contains(&name),
+                None => node
+                    .child_by_field_name("field")
+                    .is_some_and(|f| self.is_float(&f)),
+            },
+            "call_expression" => {
+                self.conversion(node).is_some()
+                    || called_function(node, self.source, &self.imports).is_some_and(
+                        |(package, name)| {
+                            package == "math" && !NON_FLOAT_MATH_FUNCTIONS.contains(&name)
+                        },
+                    )
+            }
+            _ => false,
+        }
+    }
+
+    /// Whether a binary expression or an assignment has an operand known to have a floating-point value.
+    fn has_float_operand(&self, node: &Node) -> bool {
+        ["left", "right"].iter().any(|field| {
+            node.child_by_field_name(field).is_some_and(|operand| {
+                if operand.kind() == "expression_list" {
+                    let mut cursor = operand.walk();
+                    let operands: Vec<Node> = operand.named_children(&mut cursor).collect();
+                    operands.iter().any(|o| self.is_float(o))
+                } else {
+                    self.is_float(&operand)
+                }
+            })
+        })
+    }
+
+    /// Records the names declared by a declaration with a floating-point type or value.
+    fn declare(&mut self, node: &Node) {
+        let list = |field: &str| -> Vec<Node> {
+            node.child_by_field_name(field)
+                .map(|list| list.named_children(&mut list.walk()).collect())
+                .unwrap_or_default()
+        };
+        let (names, values, typed): (Vec<Node>, Vec<Node>, bool) = match node.kind() {
+            "var_spec" | "const_spec" | "parameter_declaration" | "field_declaration" => {
+                let mut cursor = node.walk();
+                (
+                    node.children_by_field_name("name", &mut cursor).collect(),
+                    list("value"),
+                    node.child_by_field_name("type")
+                        .is_some_and(|t| FLOAT_TYPES.contains(&text(&t, self.source))),
+                )
+            }
+            "short_var_declaration" => (list("left"), list("right"), false),
+            _ => return,
+        };
+        let declared: Vec<String> = names
+            .iter()
+            .enumerate()
+            .filter(|(i, _)| typed || values.get(*i).is_some_and(|value| self.is_float(value)))
+            .map(|(_, name)| text(name, self.source).to_string())
+            .collect();
+        self.names.extend(declared);
+    }
+
+    /// Returns the floating-point construct at a node, if any.
+    fn occurrence(&self, node: &Node) -> Option<Occurrence> {
+        match node.kind() {
+            "float_literal" => Some(Occurrence::new("literal", text(node, self.source), node)),
+            "call_expression" => {
+                if let Some(target) = self.conversion(node) {
+                    return Some(Occurrence::new("conversion", target, node));
+                }
+                let (package, name) = called_function(node, self.source, &self.imports)?;
+                let category: &'static str = match package {
+                    _ if NAN_INF_FUNCTIONS.contains(&name) && package.starts_with("math") => {
+                        "nan_inf"
+                    }
+                    "math" => "math",
+                    "math/cmplx" => "cmplx",
+                    _ => return None,
+                };
+                let package: &str = package.rsplit('/').next().unwrap_or(package);
+                Some(Occurrence::new(category, format!("{package}.{name}"), node))
+            }
+            "binary_expression" => {
+                let op: &str = operator(node)?;
+                let operand = |field: &str| {
+                    node.child_by_field_name(field)
+                        .map(|operand| text(&operand, self.source))
+                };
+                // Comparing a value with itself only makes sense to test whether it is NaN.
+                if (op == "==" || op == "!=")
+                    && operand("left").is_some()
+                    && operand("left") == operand("right")
+                {
+                    Some(Occurrence::new("nan_inf", format!("x {op} x"), node))
+                } else if COMPARISON_OPERATORS.contains(&op) && self.has_float_operand(node) {
+                    Some(Occurrence::new("comparison", op, node))
+                } else if ARITHMETIC_OPERATORS.contains(&op) && self.has_float_operand(node) {
+                    Some(Occurrence::new("arithmetic", op, node))
+                } else {
+                    None
+                }
+            }
+            "assignment_statement" => {
+                let op: &str = operator(node)?;
+                (COMPOUND_OPERATORS.contains(&op) && self.has_float_operand(node))
+                    .then(|| Occurrence::new("arithmetic", op, node))
+            }
+            _ => None,
+        }
+    }
+}
+
+/// Returns the floating-point constructs of a Go file, in the order of the file.
+/// Without type-checking the file, the values known to be floating-point are the literals, the conversions, the results of
+/// the functions and the constants of the math package, and the names declared with a floating-point type or value.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn float_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let mut floats = Floats {
+        source,
+        imports: imported_packages(root, source),
+        names: HashSet::new(),
+    };
+    let nodes: Vec<Node> = nodes(root);
+    for node in &nodes {
+        floats.declare(node);
+    }
+    nodes
+        .iter()
+        .filter_map(|node| floats.occurrence(node))
+        .collect()
+}
+
+/// Counts and locates the floating-point operations of the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the operations. Defaults to the input path with ".floats.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".floats_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.floats.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.floats_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        float_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use polars::frame::DataFrame;
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import m \"math\"\n\n\
+            func f(x float64, n int) bool {\n\
+            \ty := x * 2\n\
+            \tz := float32(n) + 0.5\n\
+            \tn = n * 2\n\
+            \ty /= m.Sqrt(y)\n\
+            \treturn y != y || m.IsNaN(float64(z)) || x < m.Pi\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = float_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("arithmetic", "*".to_string(), 6),
+                ("arithmetic", "+".to_string(), 7),
+                ("conversion", "float32".to_string(), 7),
+                ("literal", "0.5".to_string(), 7),
+                ("arithmetic", "/=".to_string(), 9),
+                ("math", "math.Sqrt".to_string(), 9),
+                ("nan_inf", "x != x".to_string(), 10),
+                ("nan_inf", "math.IsNaN".to_string(), 10),
+                ("conversion", "float64".to_string(), 10),
+                ("comparison", "<".to_string(), 10),
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn floats() -> Result<()> {
+        let test_dir = "target/tests/phases/floats";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/main.go"),
+            "package main\n\nfunc main() { println(1.5 * 2) }\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/util/util.go"),
+            "package util\n\nfunc Half(x int) int { return x / 2 }\n",
+        )?;
+        let manifest = json::object! {
+            projects: [{ id: 1, name: "owner/a", path: format!("{test_dir}/1") }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let census: DataFrame =
+            open_csv(&format!("{manifest_path}.floats_census.csv"), None, None)?;
+        assert_eq!(
+            census
+                .column("package")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("."), Some("util")]
+        );
+        assert_eq!(
+            census
+                .column("arithmetic")?
+                .i64()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some(1), Some(0)]
+        );
+        let occurrences: DataFrame = open_csv(&format!("{manifest_path}.floats.csv"), None, None)?;
+        assert_eq!(occurrences.height(), 2);
+
+        delete_dir(test_dir, false)
+    }
+}
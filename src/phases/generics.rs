@@ -0,0 +1,296 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/generics.md")]
+
+use std::collections::HashSet;
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{self, nodes, text, Occurrence};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("generics")
+        .about("Counts and locates the generic declarations, constraints and instantiations of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/generics.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the generic declarations, constraints and instantiations of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of generic declarations, constraints and instantiations of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the constructs, in the order of the columns of the census.
+const CATEGORIES: [&str; 6] = [
+    "function",
+    "type",
+    "method",
+    "constraint",
+    "instantiation",
+    "inferred",
+];
+
+/// Returns the source code of a node on a single line, e.g. a type parameter list written over several lines.
+fn flat_text(node: &Node, source: &[u8]) -> String {
+    text(node, source)
+        .split_whitespace()
+        .collect::<Vec<&str>>()
+        .join(" ")
+}
+
+/// Returns the form of the constraint of a type parameter:
+/// * `any` or `comparable` for the predeclared constraints.
+/// * `union` for a union of terms, e.g. `~int | ~float64`.
+/// * `approximation` for a single term with an underlying type, e.g. `~string`.
+/// * `interface` for an interface literal, e.g. `interface{ String() string }`.
+/// * `named` for another named type, e.g. `constraints.Ordered` or `fmt.Stringer`.
+/// * `type` for a type literal, e.g. `[]byte`.
+fn constraint_form(constraint: &Node, source: &[u8]) -> &'static str {
+    let mut cursor = constraint.walk();
+    let terms: Vec<Node> = match constraint.kind() {
+        "type_constraint" | "type_elem" => constraint.named_children(&mut cursor).collect(),
+        _ => vec![*constraint],
+    };
+    match terms.as_slice() {
+        [term] => match term.kind() {
+            "negated_type" => "approximation",
+            "interface_type" => "interface",
+            "type_identifier" if text(term, source) == "any" => "any",
+            "type_identifier" if text(term, source) == "comparable" => "comparable",
+            "type_identifier" | "qualified_type" | "generic_type" => "named",
+            _ => "type",
+        },
+        _ => "union",
+    }
+}
+
+/// Whether a node is part of the receiver of a method, whose generic type is not an instantiation.
+fn in_receiver(node: &Node) -> bool {
+    let mut current: Node = *node;
+    while let Some(parent) = current.parent() {
+        match parent.kind() {
+            "method_declaration" => return parent.child_by_field_name("receiver") == Some(current),
+            "function_declaration" | "func_literal" | "block" => return false,
+            _ => current = parent,
+        }
+    }
+    false
+}
+
+/// Returns the generic construct at a node, if any.
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+/// * `generic_functions` - The names of the generic functions declared in the file.
+fn occurrence(node: &Node, source: &[u8], generic_functions: &HashSet<&str>) -> Option<Occurrence> {
+    let is_generic =
+        |f: &Node| f.kind() == "identifier" && generic_functions.contains(text(f, source));
+    match node.kind() {
+        "function_declaration" => node
+            .child_by_field_name("type_parameters")
+            .map(|params| Occurrence::new("function", flat_text(&params, source), node)),
+        "type_spec" => node
+            .child_by_field_name("type_parameters")
+            .map(|params| Occurrence::new("type", flat_text(&params, source), node)),
+        "method_declaration" => node
+            .child_by_field_name("receiver")
+            .and_then(|receiver| {
+                nodes(&receiver)
+                    .into_iter()
+                    .find(|n| n.kind() == "generic_type")
+            })
+            .and_then(|t| t.child_by_field_name("type_arguments"))
+            .map(|args| Occurrence::new("method", flat_text(&args, source), node)),
+        "type_parameter_declaration" => node.child_by_field_name("type").map(|constraint| {
+            Occurrence::new("constraint", constraint_form(&constraint, source), node)
+        }),
+        "generic_type" if !in_receiver(node) => node
+            .child_by_field_name("type")
+            .map(|t| Occurrence::new("instantiation", flat_text(&t, source), node)),
+        "call_expression" => {
+            let function: Node = node.child_by_field_name("function")?;
+            if node.child_by_field_name("type_arguments").is_some() {
+                Some(Occurrence::new(
+                    "instantiation",
+                    flat_text(&function, source),
+                    node,
+                ))
+            } else if function.kind() == "index_expression" {
+                // A single type argument is parsed as an index, e.g. Sum[float32](xs).
+                let operand: Node = function.child_by_field_name("operand")?;
+                is_generic(&operand)
+                    .then(|| Occurrence::new("instantiation", text(&operand, source), node))
+            } else {
+                is_generic(&function)
+                    .then(|| Occurrence::new("inferred", text(&function, source), node))
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Returns the generic declarations, constraints and instantiations of a Go file, in the order of the file.
+/// Instantiations with inferred type arguments are only recognized for the generic functions declared in the file.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn generic_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let nodes: Vec<Node> = nodes(root);
+    let generic_functions: HashSet<&str> = nodes
+        .iter()
+        .filter(|node| node.kind() == "function_declaration")
+        .filter(|f| f.child_by_field_name("type_parameters").is_some())
+        .filter_map(|f| f.child_by_field_name("name"))
+        .map(|name| text(&name, source))
+        .collect();
+    nodes
+        .iter()
+        .filter_map(|node| occurrence(node, source, &generic_functions))
+        .collect()
+}
+
+/// Counts and locates the generic declarations, constraints and instantiations of the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the constructs. Defaults to the input path with ".generics.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".generics_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.generics.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.generics_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        generic_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import \"golang.org/x/exp/constraints\"\n\n\
+            type Number interface { ~int | ~float64 }\n\n\
+            type Stack[T any] struct { items []T }\n\n\
+            func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }\n\n\
+            func Sum[T Number](xs []T) (s T) { return }\n\n\
+            func Map[K comparable, V constraints.Ordered, S ~string](m map[K]V, f func(V) S) {}\n\n\
+            func Min[T int | float64, U interface{ String() string }](a T, b U) {}\n\n\
+            func f() {\n\
+            \tvar s Stack[int]\n\
+            \t_ = Sum([]int{1})\n\
+            \t_ = Sum[float64](nil)\n\
+            \tMap[string, int, string](nil, nil)\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = generic_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("type", "[T any]".to_string(), 7),
+                ("constraint", "any".to_string(), 7),
+                ("method", "[T]".to_string(), 9),
+                ("function", "[T Number]".to_string(), 11),
+                ("constraint", "named".to_string(), 11),
+                (
+                    "function",
+                    "[K comparable, V constraints.Ordered, S ~string]".to_string(),
+                    13
+                ),
+                ("constraint", "comparable".to_string(), 13),
+                ("constraint", "named".to_string(), 13),
+                ("constraint", "approximation".to_string(), 13),
+                (
+                    "function",
+                    "[T int | float64, U interface{ String() string }]".to_string(),
+                    15
+                ),
+                ("constraint", "union".to_string(), 15),
+                ("constraint", "interface".to_string(), 15),
+                ("instantiation", "Stack".to_string(), 18),
+                ("inferred", "Sum".to_string(), 19),
+                ("instantiation", "Sum".to_string(), 20),
+                ("instantiation", "Map".to_string(), 21),
+            ]
+        );
+        Ok(())
+    }
+}
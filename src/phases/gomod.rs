@@ -0,0 +1,316 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/gomod.md")]
+
+use std::path::PathBuf;
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::{info, warn};
+use walkdir::{DirEntry, WalkDir};
+
+use crate::utils::fs::*;
+use crate::utils::gomod::{go_sum_versions, parse_go_mod, GoMod};
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("gomod")
+        .about("Parses the go.mod and go.sum files of the downloaded projects")
+        .long_about(include_str!("../docs/gomod.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the modules of every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("directives")
+                .short('d')
+                .long("directives")
+                .value_name("DIRECTIVES_FILE.csv")
+                .help("Path to the output csv file storing the require, replace and exclude directives of every module.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Returns true if a directory cannot contain a module of the project, i.e. if it is ignored by the go command
+/// (its name starts with '.' or '_', or it is a testdata directory) or if it holds vendored dependencies.
+pub fn is_ignored_dir(entry: &DirEntry) -> bool {
+    entry.depth() > 0
+        && entry.file_type().is_dir()
+        && entry.file_name().to_str().is_some_and(|name| {
+            name.starts_with('.') || name.starts_with('_') || name == "testdata" || name == "vendor"
+        })
+}
+
+/// Returns the paths of the go.mod files of a project, in lexicographic order.
+///
+/// # Arguments
+///
+/// * `project_path` - The root of the project.
+pub fn go_mod_files(project_path: &str) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = WalkDir::new(project_path)
+        .into_iter()
+        .filter_entry(|e| !is_ignored_dir(e))
+        .filter_map(Result::ok)
+        .filter(|e| e.file_type().is_file() && e.file_name() == "go.mod")
+        .map(DirEntry::into_path)
+        .collect();
+    files.sort();
+    files
+}
+
+/// Parses the go.mod and go.sum files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the modules. Defaults to the input path with ".go_modules.csv" appended.
+/// * `directives_path` - The optional path to the output CSV file storing the directives. Defaults to the input path with ".go_directives.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    directives_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.go_modules.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_directives_path = format!("{input_path}.go_directives.csv");
+    let directives_path = directives_path.unwrap_or(&default_directives_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(directives_path, false, force)?;
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut names: Vec<Option<String>> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut modules: Vec<String> = Vec::new();
+    let mut go_versions: Vec<Option<String>> = Vec::new();
+    let mut toolchains: Vec<Option<String>> = Vec::new();
+    let mut requires: Vec<u32> = Vec::new();
+    let mut indirects: Vec<u32> = Vec::new();
+    let mut replaces: Vec<u32> = Vec::new();
+    let mut excludes: Vec<u32> = Vec::new();
+    let mut go_sums: Vec<Option<u32>> = Vec::new();
+
+    let mut directive_ids: Vec<Option<u32>> = Vec::new();
+    let mut directive_paths: Vec<String> = Vec::new();
+    let mut verbs: Vec<&str> = Vec::new();
+    let mut directive_modules: Vec<String> = Vec::new();
+    let mut versions: Vec<String> = Vec::new();
+    let mut indirect_flags: Vec<bool> = Vec::new();
+    let mut replacements: Vec<String> = Vec::new();
+    let mut replacement_versions: Vec<String> = Vec::new();
+
+    let mut malformed: usize = 0;
+    for entry in entries {
+        let project_path: &str = entry["path"]
+            .as_str()
+            .context("Manifest entry without path")?;
+        for go_mod_path in go_mod_files(project_path) {
+            let relative_path: String = go_mod_path
+                .strip_prefix(project_path)?
+                .to_string_lossy()
+                .to_string();
+            let go_mod: GoMod = match parse_go_mod(&std::fs::read_to_string(&go_mod_path)?) {
+                Ok(go_mod) => go_mod,
+                Err(e) => {
+                    warn!("Cannot parse {}: {e:#}", go_mod_path.display());
+                    malformed += 1;
+                    continue;
+                }
+            };
+            let go_sum_path: PathBuf = go_mod_path.with_file_name("go.sum");
+            go_sums.push(if go_sum_path.is_file() {
+                Some(go_sum_versions(&std::fs::read_to_string(&go_sum_path)?) as u32)
+            } else {
+                None
+            });
+
+            ids.push(entry["id"].as_u32());
+            names.push(entry["name"].as_str().map(str::to_string));
+            paths.push(relative_path.clone());
+            requires.push(go_mod.count("require") as u32);
+            indirects.push(go_mod.directives.iter().filter(|d| d.indirect).count() as u32);
+            replaces.push(go_mod.count("replace") as u32);
+            excludes.push(go_mod.count("exclude") as u32);
+            for directive in go_mod.directives {
+                directive_ids.push(entry["id"].as_u32());
+                directive_paths.push(relative_path.clone());
+                verbs.push(directive.verb);
+                directive_modules.push(directive.module);
+                versions.push(directive.version);
+                indirect_flags.push(directive.indirect);
+                replacements.push(directive.replacement);
+                replacement_versions.push(directive.replacement_version);
+            }
+            modules.push(go_mod.module);
+            go_versions.push(go_mod.go);
+            toolchains.push(go_mod.toolchain);
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+
+    info!("Modules found: {}", modules.len());
+    info!("Directives found: {}", verbs.len());
+    if malformed > 0 {
+        info!("Malformed go.mod files skipped: {malformed}");
+    }
+
+    let mut modules_df: DataFrame = df!(
+        "id" => ids,
+        "name" => names,
+        "path" => paths,
+        "module" => modules,
+        "go" => go_versions,
+        "toolchain" => toolchains,
+        "requires" => requires,
+        "indirect" => indirects,
+        "replaces" => replaces,
+        "excludes" => excludes,
+        "go_sum" => go_sums,
+    )?;
+    log_write_output(logger, output_path, &mut modules_df, false)?;
+
+    let mut directives_df: DataFrame = df!(
+        "id" => directive_ids,
+        "path" => directive_paths,
+        "directive" => verbs,
+        "module" => directive_modules,
+        "version" => versions,
+        "indirect" => indirect_flags,
+        "replacement" => replacements,
+        "replacement_version" => replacement_versions,
+    )?;
+    log_write_output(logger, directives_path, &mut directives_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn gomod() -> Result<()> {
+        let test_dir = "target/tests/phases/gomod";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/go.mod"),
+            "module example.com/a\n\ngo 1.22\n\nrequire (\n\texample.com/b v1.0.0\n\texample.com/c v0.1.0 // indirect\n)\n\nreplace example.com/b => ./b\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/go.sum"),
+            "example.com/c v0.1.0 h1:abc=\nexample.com/c v0.1.0/go.mod h1:def=\n",
+        )?;
+        write_file(format!("{test_dir}/1/b/go.mod"), "module example.com/b\n")?;
+        write_file(format!("{test_dir}/1/vendor/x/go.mod"), "module x\n")?;
+        write_file(format!("{test_dir}/1/testdata/go.mod"), "module y\n")?;
+        write_file(format!("{test_dir}/2/go.mod"), "go 1.21\n")?;
+        write_file(format!("{test_dir}/2/main.go"), "package main")?;
+
+        let manifest = json::object! {
+            projects: [
+                { id: 1, name: "owner/a", path: format!("{test_dir}/1") },
+                { id: 2, name: "owner/b", path: format!("{test_dir}/2") },
+            ]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let modules: DataFrame = open_csv(&format!("{manifest_path}.go_modules.csv"), None, None)?;
+        assert_eq!(
+            modules
+                .column("module")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("example.com/a"), Some("example.com/b")]
+        );
+        assert_eq!(
+            modules
+                .column("go_sum")?
+                .i64()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some(1), None]
+        );
+        assert_eq!(
+            modules
+                .column("indirect")?
+                .i64()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some(1), Some(0)]
+        );
+
+        let directives: DataFrame =
+            open_csv(&format!("{manifest_path}.go_directives.csv"), None, None)?;
+        assert_eq!(
+            directives
+                .column("directive")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("require"), Some("require"), Some("replace")]
+        );
+
+        delete_dir(test_dir, false)
+    }
+}
@@ -0,0 +1,604 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/imports.md")]
+
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::{info, warn};
+use tree_sitter::{Node, Parser};
+use walkdir::{DirEntry, WalkDir};
+
+use crate::phases::gomod::{go_mod_files, is_ignored_dir};
+use crate::utils::fs::*;
+use crate::utils::gomod::{parse_go_mod, GoMod};
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("imports")
+        .about("Resolves the imports of the Go files of the downloaded projects to the packages of the corpus or to required modules")
+        .long_about(include_str!("../docs/imports.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the imports of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("graph")
+                .long("graph")
+                .value_name("GRAPH_FILE.csv")
+                .help("Path to the output csv file storing the import graph of the packages of the corpus.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Returns the import paths of a Go file, in the order of the file.
+///
+/// # Arguments
+///
+/// * `parser` - A parser for the Go language.
+/// * `source` - The content of the file.
+fn import_paths(parser: &mut Parser, source: &[u8]) -> Result<Vec<String>> {
+    let tree = parser.parse(source, None).context("Failed to parse")?;
+    let root: Node = tree.root_node();
+    let mut imports: Vec<String> = Vec::new();
+    let mut stack: Vec<Node> = vec![root];
+    while let Some(node) = stack.pop() {
+        if node.kind() == "import_spec" {
+            if let Some(path) = node.child_by_field_name("path") {
+                imports.push(path.utf8_text(source)?.trim_matches(['"', '`']).to_string());
+            }
+            continue;
+        }
+        // Imports are declared at the top level of the file.
+        if node.kind() == "source_file"
+            || node.kind() == "import_declaration"
+            || node.kind() == "import_spec_list"
+        {
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        }
+    }
+    Ok(imports)
+}
+
+/// Whether an import path belongs to a module, i.e. is the module path or one of its packages.
+fn in_module(import: &str, module: &str) -> bool {
+    import
+        .strip_prefix(module)
+        .is_some_and(|rest| rest.is_empty() || rest.starts_with('/'))
+}
+
+/// Whether an import path is a package of the standard library, whose first element, unlike those of module paths, has no dot.
+fn is_standard(import: &str) -> bool {
+    !import.split('/').next().unwrap_or_default().contains('.')
+}
+
+/// Returns the required module an import path belongs to, with its version, after applying the replace directives.
+/// The longest module path matches, as for the go command.
+///
+/// # Arguments
+///
+/// * `go_mod` - The go.mod file of the importing module.
+/// * `import` - The import path.
+fn required_module(go_mod: &GoMod, import: &str) -> Option<(String, String)> {
+    let require = go_mod
+        .directives
+        .iter()
+        .filter(|d| d.verb == "require" && in_module(import, &d.module))
+        .max_by_key(|d| d.module.len())?;
+    let replace = go_mod.directives.iter().find(|d| {
+        d.verb == "replace"
+            && d.module == require.module
+            && (d.version.is_empty() || d.version == require.version)
+    });
+    Some(match replace {
+        Some(replace) => (
+            replace.replacement.clone(),
+            replace.replacement_version.clone(),
+        ),
+        None => (require.module.clone(), require.version.clone()),
+    })
+}
+
+/// A module of a project: the directory of its go.mod file and its content.
+type Module = (PathBuf, GoMod);
+
+/// Returns the index of the module a directory belongs to, i.e. of the module of the closest ancestor directory having a go.mod file.
+fn module_of(modules: &[Module], dir: &Path) -> Option<usize> {
+    modules
+        .iter()
+        .enumerate()
+        .filter(|(_, (module_dir, _))| dir.starts_with(module_dir))
+        .max_by_key(|(_, (module_dir, _))| module_dir.components().count())
+        .map(|(index, _)| index)
+}
+
+/// Returns the import path of the package of a directory, given the module it belongs to.
+fn package_path(module: &Module, dir: &Path) -> String {
+    let (module_dir, go_mod) = module;
+    let relative: Vec<String> = dir
+        .strip_prefix(module_dir)
+        .map(|rel| {
+            rel.components()
+                .map(|c| c.as_os_str().to_string_lossy().to_string())
+                .collect()
+        })
+        .unwrap_or_default();
+    std::iter::once(go_mod.module.clone())
+        .chain(relative)
+        .collect::<Vec<String>>()
+        .join("/")
+}
+
+/// An edge of the import graph, from a package of the corpus to an imported package.
+struct Edge {
+    /// Import path of the importing package, if it belongs to a module.
+    import_path: Option<String>,
+    /// Module path of the importing package, if it belongs to a module.
+    module: Option<String>,
+    resolution: &'static str,
+    target_id: Option<u32>,
+    target_package: Option<String>,
+    /// The module required for the import and its version, as in the imports of the files.
+    required: Option<(String, String)>,
+    /// Number of files of the importing package with the import.
+    files: u32,
+}
+
+/// Returns the path of a file or directory relative to the root of its project.
+fn relative_path(path: &Path, project_path: &str) -> Result<String> {
+    Ok(path
+        .strip_prefix(project_path)?
+        .to_string_lossy()
+        .to_string())
+}
+
+/// Resolves the imports of the Go files of the projects listed in a manifest.
+/// Every import is resolved to a package of the corpus, found from the module paths of the go.mod files of the projects,
+/// and to the module version required by the go.mod file of the importing module. The imports are then aggregated
+/// into the import graph of the packages of the corpus.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the imports. Defaults to the input path with ".imports.csv" appended.
+/// * `graph_path` - The optional path to the output CSV file storing the import graph. Defaults to the input path with ".imports_graph.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    graph_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.imports.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_graph_path = format!("{input_path}.imports_graph.csv");
+    let graph_path = graph_path.unwrap_or(&default_graph_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(graph_path, false, force)?;
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    let mut parser: Parser = Parser::new();
+    parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    // The packages of the corpus, indexed by their import path, with the project and directory providing them.
+    let mut packages: HashMap<String, Vec<(u32, String)>> = HashMap::new();
+    // The imports of every Go file, with the project, module and package of the file.
+    let mut files: Vec<(usize, Option<usize>, String, String, Vec<String>)> = Vec::new();
+    let mut modules: Vec<Vec<Module>> = Vec::new();
+
+    for (project, entry) in entries.iter().enumerate() {
+        let project_path: &str = entry["path"]
+            .as_str()
+            .context("Manifest entry without path")?;
+        let id: Option<u32> = entry["id"].as_u32();
+        let mut project_modules: Vec<Module> = Vec::new();
+        for go_mod_path in go_mod_files(project_path) {
+            match parse_go_mod(&std::fs::read_to_string(&go_mod_path)?) {
+                Ok(go_mod) => project_modules.push((
+                    go_mod_path
+                        .parent()
+                        .map(Path::to_path_buf)
+                        .unwrap_or_default(),
+                    go_mod,
+                )),
+                Err(e) => warn!("Cannot parse {}: {e:#}", go_mod_path.display()),
+            }
+        }
+
+        let mut go_files: Vec<PathBuf> = WalkDir::new(project_path)
+            .into_iter()
+            .filter_entry(|e| !is_ignored_dir(e))
+            .filter_map(Result::ok)
+            .filter(|e| e.file_type().is_file())
+            .map(DirEntry::into_path)
+            .filter(|p| p.extension().is_some_and(|ext| ext == "go"))
+            .collect();
+        go_files.sort();
+
+        let mut dirs: HashSet<PathBuf> = HashSet::new();
+        for file in go_files {
+            let source: Vec<u8> = match std::fs::read(&file) {
+                Ok(source) => source,
+                Err(e) => {
+                    warn!("Cannot read {}: {e}", file.display());
+                    continue;
+                }
+            };
+            let dir: PathBuf = file.parent().map(Path::to_path_buf).unwrap_or_default();
+            let module: Option<usize> = module_of(&project_modules, &dir);
+            if let (Some(id), Some(module)) = (id, module) {
+                if dirs.insert(dir.clone()) {
+                    packages
+                        .entry(package_path(&project_modules[module], &dir))
+                        .or_default()
+                        .push((id, relative_path(&dir, project_path)?));
+                }
+            }
+            files.push((
+                project,
+                module,
+                relative_path(&dir, project_path)?,
+                relative_path(&file, project_path)?,
+                import_paths(&mut parser, &source)
+                    .with_context(|| format!("Cannot parse {}", file.display()))?,
+            ));
+        }
+        modules.push(project_modules);
+        progress.inc(1);
+    }
+    progress.finish();
+
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut imports: Vec<String> = Vec::new();
+    let mut resolutions: Vec<&str> = Vec::new();
+    let mut target_ids: Vec<Option<u32>> = Vec::new();
+    let mut target_packages: Vec<Option<String>> = Vec::new();
+    let mut candidates: Vec<u32> = Vec::new();
+    let mut required_modules: Vec<Option<String>> = Vec::new();
+    let mut versions: Vec<Option<String>> = Vec::new();
+    // The edges of the import graph, indexed by the project and the directory of the importing package and by the import.
+    let mut edges: BTreeMap<(usize, String, String), Edge> = BTreeMap::new();
+
+    for (project, module, package, path, file_imports) in files {
+        let id: Option<u32> = entries[project]["id"].as_u32();
+        let go_mod: Option<&GoMod> = module.map(|m| &modules[project][m].1);
+        let import_path: Option<String> = module.map(|m| {
+            package_path(
+                &modules[project][m],
+                &Path::new(entries[project]["path"].as_str().unwrap_or_default()).join(&package),
+            )
+        });
+        // A file importing a package several times, e.g. under different names, is counted once.
+        let mut imported: HashSet<String> = HashSet::new();
+        for import in file_imports {
+            let targets: &[(u32, String)] = packages.get(&import).map_or(&[], Vec::as_slice);
+            // Packages provided by the project itself are preferred, then those of the first project of the corpus.
+            let target: Option<&(u32, String)> = targets
+                .iter()
+                .find(|(target_id, _)| Some(*target_id) == id)
+                .or_else(|| targets.iter().min_by_key(|(target_id, _)| *target_id));
+            let required: Option<(String, String)> =
+                go_mod.and_then(|go_mod| required_module(go_mod, &import));
+            let resolution: &str = if import == "C" {
+                "cgo"
+            } else if go_mod.is_some_and(|go_mod| in_module(&import, &go_mod.module))
+                || target.is_some_and(|(target_id, _)| Some(*target_id) == id)
+            {
+                "local"
+            } else if target.is_some() {
+                "corpus"
+            } else if required.is_some() {
+                "module"
+            } else if is_standard(&import) {
+                "std"
+            } else {
+                "unresolved"
+            };
+            if resolution != "cgo" && imported.insert(import.clone()) {
+                edges
+                    .entry((project, package.clone(), import.clone()))
+                    .or_insert_with(|| Edge {
+                        import_path: import_path.clone(),
+                        module: go_mod.map(|go_mod| go_mod.module.clone()),
+                        resolution,
+                        target_id: target.map(|(target_id, _)| *target_id),
+                        target_package: target.map(|(_, dir)| dir.clone()),
+                        required: required.clone(),
+                        files: 0,
+                    })
+                    .files += 1;
+            }
+            ids.push(id);
+            paths.push(path.clone());
+            imports.push(import);
+            resolutions.push(resolution);
+            target_ids.push(target.map(|(target_id, _)| *target_id));
+            target_packages.push(target.map(|(_, dir)| dir.clone()));
+            candidates.push(targets.len() as u32);
+            let (required_module, version) = required.unzip();
+            required_modules.push(required_module);
+            versions.push(version.filter(|v| !v.is_empty()));
+        }
+    }
+
+    info!("Packages found in the corpus: {}", packages.len());
+    info!("Imports found: {}", imports.len());
+    for resolution in ["local", "corpus", "module", "std", "cgo", "unresolved"] {
+        info!(
+            "  {resolution}: {}",
+            resolutions.iter().filter(|r| **r == resolution).count()
+        );
+    }
+
+    let mut imports_df: DataFrame = df!(
+        "id" => ids,
+        "path" => paths,
+        "import" => imports,
+        "resolution" => resolutions,
+        "target_id" => target_ids,
+        "target_package" => target_packages,
+        "candidates" => candidates,
+        "module" => required_modules,
+        "version" => versions,
+    )?;
+    log_write_output(logger, output_path, &mut imports_df, false)?;
+
+    info!("Edges of the import graph: {}", edges.len());
+    // The version of a project is the commit recorded in the manifest, which is the module version for the projects
+    // downloaded from the Go module proxy.
+    let version = |id: Option<u32>| -> Option<String> {
+        entries
+            .iter()
+            .find(|entry| id.is_some() && entry["id"].as_u32() == id)
+            .and_then(|entry| entry["commit"].as_str().map(str::to_string))
+    };
+    let (keys, edges): (Vec<(usize, String, String)>, Vec<Edge>) = edges.into_iter().unzip();
+    let mut graph_df: DataFrame = df!(
+        "id" => keys.iter().map(|(project, _, _)| entries[*project]["id"].as_u32()).collect::<Vec<Option<u32>>>(),
+        "package" => keys.iter().map(|(_, package, _)| package.as_str()).collect::<Vec<&str>>(),
+        "import_path" => edges.iter().map(|e| e.import_path.clone()).collect::<Vec<Option<String>>>(),
+        "module" => edges.iter().map(|e| e.module.clone()).collect::<Vec<Option<String>>>(),
+        "version" => keys
+            .iter()
+            .map(|(project, _, _)| entries[*project]["commit"].as_str().map(str::to_string))
+            .collect::<Vec<Option<String>>>(),
+        "import" => keys.iter().map(|(_, _, import)| import.as_str()).collect::<Vec<&str>>(),
+        "edge" => edges
+            .iter()
+            .map(|e| if e.resolution == "local" { "internal" } else { "external" })
+            .collect::<Vec<&str>>(),
+        "resolution" => edges.iter().map(|e| e.resolution).collect::<Vec<&str>>(),
+        "target_id" => edges.iter().map(|e| e.target_id).collect::<Vec<Option<u32>>>(),
+        "target_package" => edges.iter().map(|e| e.target_package.clone()).collect::<Vec<Option<String>>>(),
+        "target_version" => edges.iter().map(|e| version(e.target_id)).collect::<Vec<Option<String>>>(),
+        "required_module" => edges
+            .iter()
+            .map(|e| e.required.as_ref().map(|(module, _)| module.clone()))
+            .collect::<Vec<Option<String>>>(),
+        "required_version" => edges
+            .iter()
+            .map(|e| e.required.as_ref().map(|(_, version)| version.clone()).filter(|v| !v.is_empty()))
+            .collect::<Vec<Option<String>>>(),
+        "files" => edges.iter().map(|e| e.files).collect::<Vec<u32>>(),
+    )?;
+    log_write_output(logger, graph_path, &mut graph_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::ensure;
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn required_modules() -> Result<()> {
+        let go_mod: GoMod = parse_go_mod(
+            "module example.com/a\n\n\
+             require (\n\tgithub.com/x/y v1.2.0\n\tgithub.com/x/y/v2 v2.0.1\n\tgolang.org/x/net v0.1.0\n)\n\n\
+             replace golang.org/x/net => github.com/fork/net v0.2.0\n",
+        )?;
+        assert_eq!(
+            required_module(&go_mod, "github.com/x/y/z"),
+            Some(("github.com/x/y".to_string(), "v1.2.0".to_string()))
+        );
+        assert_eq!(
+            required_module(&go_mod, "github.com/x/y/v2/z"),
+            Some(("github.com/x/y/v2".to_string(), "v2.0.1".to_string()))
+        );
+        assert_eq!(
+            required_module(&go_mod, "golang.org/x/net/http2"),
+            Some(("github.com/fork/net".to_string(), "v0.2.0".to_string()))
+        );
+        assert_eq!(required_module(&go_mod, "github.com/x/yz"), None);
+        ensure!(is_standard("net/http"));
+        ensure!(!is_standard("example.com/a"));
+        Ok(())
+    }
+
+    #[test]
+    fn imports() -> Result<()> {
+        let test_dir = "target/tests/phases/imports";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/go.mod"),
+            "module example.com/a\n\nrequire github.com/x/y v1.2.0\n",
+        )?;
+        write_file(
+            format!("{test_dir}/1/main.go"),
+            "package main\n\nimport (\n\t\"fmt\"\n\tu \"example.com/a/util\"\n\t\"example.com/b/lib\"\n\t\"github.com/x/y/z\"\n\t\"C\"\n\t\"unknown.org/q\"\n)\n",
+        )?;
+        write_file(format!("{test_dir}/1/util/util.go"), "package util\n")?;
+        write_file(format!("{test_dir}/2/go.mod"), "module example.com/b\n")?;
+        write_file(
+            format!("{test_dir}/2/lib/lib.go"),
+            "package lib\n\nimport `example.com/a/util`\n",
+        )?;
+
+        let manifest = json::object! {
+            projects: [
+                { id: 1, name: "owner/a", commit: "abc", path: format!("{test_dir}/1") },
+                { id: 2, name: "owner/b", commit: "def", path: format!("{test_dir}/2") },
+            ]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        run(&manifest_path, None, None, false, test_logger())?;
+        let imports: DataFrame = open_csv(&format!("{manifest_path}.imports.csv"), None, None)?;
+        assert_eq!(
+            imports
+                .column("resolution")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("std"),
+                Some("local"),
+                Some("corpus"),
+                Some("module"),
+                Some("cgo"),
+                Some("unresolved"),
+                Some("corpus"),
+            ]
+        );
+        assert_eq!(
+            imports
+                .column("target_package")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                None,
+                Some("util"),
+                Some("lib"),
+                None,
+                None,
+                None,
+                Some("util")
+            ]
+        );
+        assert_eq!(
+            imports
+                .column("version")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![None, None, None, Some("v1.2.0"), None, None, None]
+        );
+
+        let graph: DataFrame = open_csv(&format!("{manifest_path}.imports_graph.csv"), None, None)?;
+        assert_eq!(
+            graph
+                .column("import_path")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("example.com/a"),
+                Some("example.com/a"),
+                Some("example.com/a"),
+                Some("example.com/a"),
+                Some("example.com/a"),
+                Some("example.com/b/lib"),
+            ]
+        );
+        assert_eq!(
+            graph
+                .column("import")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![
+                Some("example.com/a/util"),
+                Some("example.com/b/lib"),
+                Some("fmt"),
+                Some("github.com/x/y/z"),
+                Some("unknown.org/q"),
+                Some("example.com/a/util"),
+            ]
+        );
+        assert_eq!(
+            graph.column("edge")?.str()?.into_iter().collect::<Vec<_>>(),
+            vec![
+                Some("internal"),
+                Some("external"),
+                Some("external"),
+                Some("external"),
+                Some("external"),
+                Some("external"),
+            ]
+        );
+        assert_eq!(
+            graph
+                .column("target_version")?
+                .str()?
+                .into_iter()
+                .collect::<Vec<_>>(),
+            vec![Some("abc"), Some("def"), None, None, None, Some("abc")]
+        );
+
+        delete_dir(test_dir, false)
+    }
+}
@@ -0,0 +1,666 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/metrics.md")]
+
+use std::collections::HashSet;
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::info;
+use tree_sitter::Node;
+
+use crate::utils::census::{self, enclosing_function, nodes, text};
+use crate::utils::fs::check_path;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("metrics")
+        .about("Computes the complexity and size metrics of the functions of the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/metrics.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the metrics of every function.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("files")
+                .long("files")
+                .value_name("FILES_FILE.csv")
+                .help("Path to the output csv file storing the metrics of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Nodes adding a path to the control flow of a function. The default cases of switch and select statements do not.
+const DECISIONS: [&str; 5] = [
+    "if_statement",
+    "for_statement",
+    "expression_case",
+    "type_case",
+    "communication_case",
+];
+
+/// Statements nesting the statements of their body.
+const NESTED: [&str; 5] = [
+    "if_statement",
+    "for_statement",
+    "expression_switch_statement",
+    "type_switch_statement",
+    "select_statement",
+];
+
+/// Kinds of the statements of a function. Labeled statements are counted as the statement they label.
+const STATEMENTS: [&str; 21] = [
+    "expression_statement",
+    "send_statement",
+    "inc_statement",
+    "dec_statement",
+    "assignment_statement",
+    "short_var_declaration",
+    "var_declaration",
+    "const_declaration",
+    "type_declaration",
+    "return_statement",
+    "go_statement",
+    "defer_statement",
+    "if_statement",
+    "for_statement",
+    "expression_switch_statement",
+    "type_switch_statement",
+    "select_statement",
+    "fallthrough_statement",
+    "break_statement",
+    "continue_statement",
+    "goto_statement",
+];
+
+/// Nodes whose children are statements, rather than e.g. the initializer of an if statement.
+const STATEMENT_PARENTS: [&str; 7] = [
+    "block",
+    "statement_list",
+    "expression_case",
+    "type_case",
+    "default_case",
+    "communication_case",
+    "labeled_statement",
+];
+
+/// Tokens counted as the operands of Halstead's metrics. Every other token is an operator, except comments and the
+/// closing brackets, counted with the opening ones.
+const OPERANDS: [&str; 15] = [
+    "identifier",
+    "field_identifier",
+    "type_identifier",
+    "package_identifier",
+    "label_name",
+    "int_literal",
+    "float_literal",
+    "imaginary_literal",
+    "rune_literal",
+    "interpreted_string_literal",
+    "raw_string_literal",
+    "true",
+    "false",
+    "nil",
+    "iota",
+];
+
+/// Halstead's metrics of a piece of code.
+#[derive(Debug, Default, PartialEq)]
+struct Halstead {
+    /// Length of the code times the logarithm of its vocabulary, i.e. its number of distinct operators and operands.
+    volume: f64,
+    /// Half the number of distinct operators times the average number of uses of the operands.
+    difficulty: f64,
+}
+
+/// Returns Halstead's metrics of the tokens of a subtree.
+///
+/// # Arguments
+///
+/// * `root` - The root of the subtree.
+/// * `source` - The source code of the file.
+fn halstead(root: &Node, source: &[u8]) -> Halstead {
+    let mut operators: HashSet<&str> = HashSet::new();
+    let mut operands: HashSet<&str> = HashSet::new();
+    let (mut total_operators, mut total_operands): (usize, usize) = (0, 0);
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        if OPERANDS.contains(&node.kind()) {
+            operands.insert(text(&node, source));
+            total_operands += 1;
+        } else if node.child_count() == 0 {
+            if !matches!(node.kind(), "comment" | ")" | "]" | "}") && !node.is_missing() {
+                operators.insert(node.kind());
+                total_operators += 1;
+            }
+        } else {
+            let mut cursor = node.walk();
+            stack.extend(node.children(&mut cursor));
+        }
+    }
+    let vocabulary: usize = operators.len() + operands.len();
+    Halstead {
+        volume: match vocabulary {
+            0 | 1 => 0.0,
+            _ => (total_operators + total_operands) as f64 * (vocabulary as f64).log2(),
+        },
+        difficulty: match operands.len() {
+            0 => 0.0,
+            distinct => operators.len() as f64 / 2.0 * total_operands as f64 / distinct as f64,
+        },
+    }
+}
+
+/// Returns the maintainability index of a piece of code, normalized between 0 and 100 as by Visual Studio:
+/// `max(0, (171 - 5.2 ln(volume) - 0.23 cyclomatic - 16.2 ln(lines)) * 100 / 171)`.
+fn maintainability(volume: f64, cyclomatic: usize, lines: usize) -> f64 {
+    let index: f64 = 171.0
+        - 5.2 * volume.max(1.0).ln()
+        - 0.23 * cyclomatic as f64
+        - 16.2 * (lines.max(1) as f64).ln();
+    (index * 100.0 / 171.0).max(0.0)
+}
+
+/// Metrics of a function or a method.
+#[derive(Debug, PartialEq)]
+struct FunctionMetrics {
+    /// Name of the function, qualified by the receiver type for a method.
+    name: String,
+    line: usize,
+    /// Number of lines of the declaration.
+    lines: usize,
+    /// Number of parameters, the receiver excluded.
+    params: usize,
+    statements: usize,
+    /// McCabe's cyclomatic complexity.
+    cyclomatic: usize,
+    /// Maximum depth of the nested control statements.
+    nesting: usize,
+    halstead: Halstead,
+    maintainability: f64,
+}
+
+/// Numbers of lines of a Go file, by content.
+#[derive(Debug, Default, PartialEq)]
+struct LineCounts {
+    /// Lines with a token other than a comment, or with C code of the cgo preamble.
+    code: usize,
+    /// Lines with comments only.
+    comments: usize,
+    /// Lines with whitespace only, or with an empty line of the cgo preamble.
+    blank: usize,
+    /// Lines of C code of the cgo preamble, also counted as code.
+    preamble: usize,
+}
+
+/// Metrics of a Go file.
+#[derive(Debug, PartialEq)]
+struct FileMetrics {
+    lines: usize,
+    lines_of: LineCounts,
+    functions: usize,
+    /// Sum of the cyclomatic complexities of the functions.
+    cyclomatic: usize,
+    halstead: Halstead,
+    maintainability: f64,
+}
+
+/// Whether a node is the else branch of an if statement, e.g. `else if`, which is not nested in it.
+fn is_else_if(node: &Node) -> bool {
+    node.kind() == "if_statement" && node.parent().is_some_and(|p| p.kind() == "if_statement")
+}
+
+/// Returns the number of parameters of a function, counting every name of the parameters sharing a type.
+fn parameter_count(function: &Node) -> usize {
+    let Some(parameters) = function.child_by_field_name("parameters") else {
+        return 0;
+    };
+    let mut cursor = parameters.walk();
+    let declarations: Vec<Node> = parameters.named_children(&mut cursor).collect();
+    declarations
+        .iter()
+        .filter(|declaration| declaration.kind() != "comment")
+        .map(|declaration| {
+            let mut cursor = declaration.walk();
+            declaration
+                .children_by_field_name("name", &mut cursor)
+                .count()
+                .max(1)
+        })
+        .sum()
+}
+
+/// Whether a node is a statement of its function.
+fn is_statement(node: &Node) -> bool {
+    STATEMENTS.contains(&node.kind())
+        && node.parent().is_some_and(|parent| {
+            STATEMENT_PARENTS.contains(&parent.kind())
+                // The send or receive statement of a select case is its condition.
+                && parent.child_by_field_name("communication") != Some(*node)
+        })
+}
+
+/// Returns the metrics of a function or method declaration. The function literals of its body are part of it.
+///
+/// # Arguments
+///
+/// * `function` - The declaration.
+/// * `source` - The source code of the file.
+fn measure(function: &Node, source: &[u8]) -> Option<FunctionMetrics> {
+    let name: String = enclosing_function(&function.child_by_field_name("name")?, source);
+    let body: Vec<Node> = function
+        .child_by_field_name("body")
+        .map(|body| nodes(&body))
+        .unwrap_or_default();
+
+    let decisions: usize = body
+        .iter()
+        .filter(|node| {
+            DECISIONS.contains(&node.kind())
+                || (node.kind() == "binary_expression"
+                    && node
+                        .child_by_field_name("operator")
+                        .is_some_and(|op| matches!(op.kind(), "&&" | "||")))
+        })
+        .count();
+
+    let nesting: usize = body
+        .iter()
+        .filter(|node| NESTED.contains(&node.kind()) && !is_else_if(node))
+        .map(|node| {
+            let mut depth: usize = 1;
+            let mut current: Option<Node> = node.parent();
+            while let Some(ancestor) = current.filter(|ancestor| ancestor != function) {
+                if NESTED.contains(&ancestor.kind()) && !is_else_if(&ancestor) {
+                    depth += 1;
+                }
+                current = ancestor.parent();
+            }
+            depth
+        })
+        .max()
+        .unwrap_or(0);
+
+    let lines: usize = function.end_position().row - function.start_position().row + 1;
+    let halstead: Halstead = halstead(function, source);
+    Some(FunctionMetrics {
+        name,
+        line: function.start_position().row + 1,
+        lines,
+        params: parameter_count(function),
+        statements: body.iter().filter(|node| is_statement(node)).count(),
+        cyclomatic: decisions + 1,
+        nesting,
+        maintainability: maintainability(halstead.volume, decisions + 1, lines),
+        halstead,
+    })
+}
+
+/// Returns the metrics of the functions and methods of a Go file, in the order of the file.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn function_metrics(root: &Node, source: &[u8]) -> Vec<FunctionMetrics> {
+    nodes(root)
+        .iter()
+        .filter(|node| matches!(node.kind(), "function_declaration" | "method_declaration"))
+        .filter_map(|function| measure(function, source))
+        .collect()
+}
+
+/// Returns the lines of the cgo preamble of a Go file, i.e. of the comments immediately preceding the import of "C",
+/// which hold C code rather than documentation.
+fn preamble_lines(root: &Node, source: &[u8]) -> HashSet<usize> {
+    let mut lines: HashSet<usize> = HashSet::new();
+    for spec in nodes(root)
+        .into_iter()
+        .filter(|node| node.kind() == "import_spec")
+        .filter(|spec| {
+            spec.child_by_field_name("path")
+                .is_some_and(|path| text(&path, source) == "\"C\"")
+        })
+    {
+        // The preamble of an import in parentheses precedes the import spec, the one of a single import the declaration.
+        let anchor: Node = match spec.parent() {
+            Some(declaration) if declaration.kind() == "import_declaration" => declaration,
+            _ => spec,
+        };
+        let mut next_line: usize = anchor.start_position().row;
+        let mut current: Option<Node> = anchor.prev_sibling();
+        while let Some(comment) =
+            current.filter(|c| c.kind() == "comment" && c.end_position().row + 1 >= next_line)
+        {
+            lines.extend(comment.start_position().row..=comment.end_position().row);
+            next_line = comment.start_position().row;
+            current = comment.prev_sibling();
+        }
+    }
+    lines
+}
+
+/// Returns the numbers of code, comment and blank lines of a Go file. A line with both code and a comment is a line of
+/// code, and the lines of a multi-line token, e.g. a raw string, are lines of code too.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn line_counts(root: &Node, source: &[u8]) -> LineCounts {
+    let mut lines: Vec<&[u8]> = source.split(|b| *b == b'\n').collect();
+    if source.is_empty() || source.ends_with(b"\n") {
+        lines.pop();
+    }
+
+    let mut code: HashSet<usize> = HashSet::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        if node.child_count() > 0 {
+            let mut cursor = node.walk();
+            stack.extend(node.children(&mut cursor));
+        } else if node.kind() != "comment" && !node.is_missing() {
+            code.extend(node.start_position().row..=node.end_position().row);
+        }
+    }
+    let preamble: HashSet<usize> = preamble_lines(root, source);
+
+    let mut counts = LineCounts::default();
+    for (row, line) in lines.iter().enumerate() {
+        let line = String::from_utf8_lossy(line);
+        let line: &str = line.trim();
+        if preamble.contains(&row) {
+            let c_code: &str = line
+                .trim_start_matches("//")
+                .trim_start_matches("/*")
+                .trim_end_matches("*/")
+                .trim();
+            if c_code.is_empty() {
+                counts.blank += 1;
+            } else {
+                counts.code += 1;
+                counts.preamble += 1;
+            }
+        } else if code.contains(&row) {
+            counts.code += 1;
+        } else if line.is_empty() {
+            counts.blank += 1;
+        } else {
+            counts.comments += 1;
+        }
+    }
+    counts
+}
+
+/// Returns the metrics of a Go file, given those of its functions.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+/// * `functions` - The metrics of the functions of the file.
+fn file_metrics(root: &Node, source: &[u8], functions: &[FunctionMetrics]) -> FileMetrics {
+    let lines_of: LineCounts = line_counts(root, source);
+    let lines: usize = lines_of.code + lines_of.comments + lines_of.blank;
+    let cyclomatic: usize = functions.iter().map(|f| f.cyclomatic).sum();
+    let halstead: Halstead = halstead(root, source);
+    FileMetrics {
+        lines,
+        lines_of,
+        functions: functions.len(),
+        cyclomatic,
+        maintainability: maintainability(halstead.volume, cyclomatic, lines),
+        halstead,
+    }
+}
+
+/// Computes the complexity, size and maintainability metrics of the functions and of the Go files of the projects
+/// listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the metrics of the functions. Defaults to the input path with ".metrics.csv" appended.
+/// * `files_path` - The optional path to the output CSV file storing the metrics of the files. Defaults to the input path with ".metrics_files.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    files_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.metrics.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_files_path = format!("{input_path}.metrics_files.csv");
+    let files_path = files_path.unwrap_or(&default_files_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(files_path, false, force)?;
+
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut packages: Vec<String> = Vec::new();
+    let mut functions: Vec<FunctionMetrics> = Vec::new();
+    let mut file_ids: Vec<Option<u32>> = Vec::new();
+    let mut file_paths: Vec<String> = Vec::new();
+    let mut file_packages: Vec<String> = Vec::new();
+    let mut files: Vec<FileMetrics> = Vec::new();
+    census::visit_go_files(input_path, |file| {
+        let root: Node = file.tree.root_node();
+        let metrics: Vec<FunctionMetrics> = function_metrics(&root, &file.source);
+        file_ids.push(file.id);
+        file_paths.push(file.path.clone());
+        file_packages.push(file.package.clone());
+        files.push(file_metrics(&root, &file.source, &metrics));
+        for function in metrics {
+            ids.push(file.id);
+            paths.push(file.path.clone());
+            packages.push(file.package.clone());
+            functions.push(function);
+        }
+        Ok(())
+    })?;
+    info!("Files measured: {}", files.len());
+    info!("Functions measured: {}", functions.len());
+
+    let column = |metric: fn(&FunctionMetrics) -> usize| -> Vec<u32> {
+        functions.iter().map(|f| metric(f) as u32).collect()
+    };
+    let mut metrics_df: DataFrame = df!(
+        "id" => ids,
+        "path" => paths,
+        "package" => packages,
+        "function" => functions.iter().map(|f| f.name.as_str()).collect::<Vec<&str>>(),
+        "line" => column(|f| f.line),
+        "lines" => column(|f| f.lines),
+        "params" => column(|f| f.params),
+        "statements" => column(|f| f.statements),
+        "cyclomatic" => column(|f| f.cyclomatic),
+        "nesting" => column(|f| f.nesting),
+        "volume" => functions.iter().map(|f| f.halstead.volume).collect::<Vec<f64>>(),
+        "difficulty" => functions.iter().map(|f| f.halstead.difficulty).collect::<Vec<f64>>(),
+        "maintainability" => functions.iter().map(|f| f.maintainability).collect::<Vec<f64>>(),
+    )?;
+    log_write_output(logger, output_path, &mut metrics_df, false)?;
+
+    let mut files_df: DataFrame = df!(
+        "id" => file_ids,
+        "path" => file_paths,
+        "package" => file_packages,
+        "lines" => files.iter().map(|f| f.lines as u32).collect::<Vec<u32>>(),
+        "code" => files.iter().map(|f| f.lines_of.code as u32).collect::<Vec<u32>>(),
+        "comments" => files.iter().map(|f| f.lines_of.comments as u32).collect::<Vec<u32>>(),
+        "blank" => files.iter().map(|f| f.lines_of.blank as u32).collect::<Vec<u32>>(),
+        "preamble" => files.iter().map(|f| f.lines_of.preamble as u32).collect::<Vec<u32>>(),
+        "comment_density" => files
+            .iter()
+            .map(|f| match f.lines_of.code + f.lines_of.comments {
+                0 => 0.0,
+                total => f.lines_of.comments as f64 / total as f64,
+            })
+            .collect::<Vec<f64>>(),
+        "functions" => files.iter().map(|f| f.functions as u32).collect::<Vec<u32>>(),
+        "cyclomatic" => files.iter().map(|f| f.cyclomatic as u32).collect::<Vec<u32>>(),
+        "volume" => files.iter().map(|f| f.halstead.volume).collect::<Vec<f64>>(),
+        "difficulty" => files.iter().map(|f| f.halstead.difficulty).collect::<Vec<f64>>(),
+        "maintainability" => files.iter().map(|f| f.maintainability).collect::<Vec<f64>>(),
+    )?;
+    log_write_output(logger, files_path, &mut files_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+
+    #[test]
+    fn metrics() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }\n\n\
+            func f(a, b int, xs ...string) int {\n\
+            \tif a > 0 && b > 0 {\n\
+            \t\tfor _, x := range xs {\n\
+            \t\t\tswitch x {\n\
+            \t\t\tcase \"a\", \"b\":\n\
+            \t\t\t\treturn 1\n\
+            \t\t\tdefault:\n\
+            \t\t\t}\n\
+            \t\t}\n\
+            \t} else if a < 0 {\n\
+            \t\tgo func() { a++ }()\n\
+            \t}\n\
+            \treturn 0\n\
+            }\n\n\
+            func asm(x int)\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let metrics: Vec<FunctionMetrics> = function_metrics(&tree.root_node(), source);
+        assert_eq!(
+            metrics
+                .iter()
+                .map(|f| (
+                    f.name.as_str(),
+                    f.line,
+                    f.lines,
+                    f.params,
+                    f.statements,
+                    f.cyclomatic,
+                    f.nesting
+                ))
+                .collect::<Vec<_>>(),
+            vec![
+                ("Stack.Push", 3, 1, 1, 1, 1, 0),
+                ("f", 5, 14, 3, 7, 6, 3),
+                ("asm", 20, 1, 1, 0, 1, 0),
+            ]
+        );
+        let file: FileMetrics = file_metrics(&tree.root_node(), source, &metrics);
+        assert_eq!((file.lines, file.functions, file.cyclomatic), (20, 3, 8));
+        assert!(file.maintainability < metrics[0].maintainability);
+        Ok(())
+    }
+
+    #[test]
+    fn halstead_metrics() -> Result<()> {
+        let source: &[u8] = b"package a\n\nfunc f(a int) int { return a + 1 }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let metrics: Vec<FunctionMetrics> = function_metrics(&tree.root_node(), source);
+        // Operators: func ( { return +, operands: f a int int a 1.
+        let volume: f64 = 11.0 * 9f64.log2();
+        assert_eq!(
+            metrics[0].halstead,
+            Halstead {
+                volume,
+                difficulty: 5.0 / 2.0 * 6.0 / 4.0,
+            }
+        );
+        assert_eq!(
+            metrics[0].maintainability,
+            (171.0 - 5.2 * volume.ln() - 0.23) * 100.0 / 171.0
+        );
+        assert_eq!(maintainability(0.0, 1, 0), (171.0 - 0.23) * 100.0 / 171.0);
+        Ok(())
+    }
+
+    #[test]
+    fn lines() -> Result<()> {
+        let source: &[u8] = b"// Package a wraps strlen.\n\
+            package a\n\n\
+            // #include <string.h>\n\
+            //\n\
+            // size_t length(char *s) { return strlen(s); }\n\
+            import \"C\"\n\n\
+            /*\n\
+            Length returns the length of s.\n\
+            */\n\
+            func Length(s *C.char) int {\n\
+            \treturn int(C.length(s)) // in bytes\n\
+            }\n\n\
+            const raw = `a\n\
+            \n\
+            b`\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        assert_eq!(
+            line_counts(&tree.root_node(), source),
+            LineCounts {
+                code: 10,
+                comments: 4,
+                blank: 4,
+                preamble: 2,
+            }
+        );
+        assert_eq!(line_counts(&tree.root_node(), b""), LineCounts::default());
+        Ok(())
+    }
+}
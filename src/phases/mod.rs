@@ -12,15 +12,35 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+pub mod api;
+pub mod assembly;
+pub mod cgo;
+pub mod complex;
+pub mod concurrency;
+pub mod curated;
+pub mod dead_code;
+pub mod defers;
 pub mod download;
 pub mod duplicate_files;
 pub mod duplicate_ids;
+pub mod errors;
 pub mod extract_benchmarks;
 pub mod filter_languages;
 pub mod filter_metadata;
+pub mod floats;
 pub mod forks;
+pub mod generics;
+pub mod gomod;
 pub mod ids;
+pub mod imports;
 pub mod languages;
 pub mod metadata;
+pub mod metrics;
+pub mod modules;
 pub mod parse;
 pub mod pull_request;
+pub mod reflection;
+pub mod search;
+pub mod ssa;
+pub mod syntax_errors;
+pub mod verify;
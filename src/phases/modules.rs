@@ -0,0 +1,318 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/modules.md")]
+
+use std::collections::HashMap;
+use std::io::Write;
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use tracing::{debug, info, warn};
+
+use crate::phases::download::parse_date_arg;
+use crate::utils::csv::*;
+use crate::utils::depsdev::DepsDev;
+use crate::utils::forge::{
+    index_modules, is_standard_library, Forge, Module, ModuleResolver, Provider,
+};
+use crate::utils::fs::{check_path, FileMode};
+use crate::utils::github::ToCSV;
+use crate::utils::logger::{log_output_file, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("modules")
+        .about("Resolves Go import paths to modules that can be downloaded.")
+        .long_about(include_str!("../docs/modules.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("IMPORT_PATHS.txt")
+                .help("Path to the file listing the import paths or module paths, one per line, optionally followed by a version \
+                       (e.g. the output of go list -deps or go list -m all).")
+                .required_unless_present("index")
+                .conflicts_with("index"),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output CSV file storing the modules. Defaults to the input file name with \".modules.csv\" appended.")
+                .required_unless_present("input"),
+        )
+        .arg(
+            Arg::new("index")
+                .long("index")
+                .help("Take the modules from the Go module index (index.golang.org) instead of an input file.")
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("since")
+                .long("since")
+                .value_name("DATE")
+                .help("Only take the modules with a version published since this date (YYYY-MM-DD) from the module index. Defaults to 30 days ago.")
+                .value_parser(parse_date_arg)
+                .requires("index"),
+        )
+        .arg(
+            Arg::new("top")
+                .long("top")
+                .value_name("NUMBER_OF_MODULES")
+                .help("Only keep the modules with the most dependents according to deps.dev.")
+                .value_parser(clap::value_parser!(usize)),
+        )
+        .arg(
+            Arg::new("host")
+                .long("host")
+                .value_name("HOST")
+                .help("Host of the Go module proxy. If not specified, the first HTTPS proxy of GOPROXY or proxy.golang.org is used."),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output file if it already exists.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Parses a line of the input file.
+///
+/// # Returns
+///
+/// The import path and the version given on the line, if any, or `None` if the line is empty, a comment (starting with '#'),
+/// or a package of the standard library.
+fn parse_line(line: &str) -> Option<(&str, Option<&str>)> {
+    let mut fields = line.split_whitespace();
+    let path: &str = fields.next().filter(|f| !f.starts_with('#'))?;
+    if is_standard_library(path) {
+        return None;
+    }
+    Some((path, fields.next().filter(|v| v.starts_with('v'))))
+}
+
+/// Resolves Go import paths to modules and writes them in a format that can be passed to the download subcommand.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the file listing the import paths. If not specified, the modules are taken from the module index.
+/// * `output_path` - The optional path to the output CSV file. Defaults to the input path with ".modules.csv" appended.
+/// * `host` - The host of the Go module proxy. If not specified, the proxy configured in the environment is used.
+/// * `since` - The date since which modules are taken from the module index (epoch). Defaults to 30 days ago.
+/// * `top` - The number of modules with the most dependents to keep. If not specified, all the modules are kept.
+/// * `force` - Whether to override the output file if it already exists.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// A result indicating success or failure of the operation.
+pub fn run(
+    input_path: Option<&str>,
+    output_path: Option<&str>,
+    host: Option<&str>,
+    since: Option<i64>,
+    top: Option<usize>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{}.modules.csv", input_path.unwrap_or_default());
+    let output_path = output_path.unwrap_or(&default_output_path);
+
+    if let Some(input_path) = input_path {
+        check_path(input_path)?;
+    }
+    log_output_file(output_path, false, force)?;
+
+    let content: String;
+    let listed: Vec<String>;
+    let imports: Vec<(&str, Option<&str>)> = match input_path {
+        Some(input_path) => {
+            content = std::fs::read_to_string(input_path)
+                .with_context(|| format!("Could not read {input_path}"))?;
+            let imports: Vec<(&str, Option<&str>)> =
+                content.lines().filter_map(parse_line).collect();
+            info!(
+                "{} import paths found outside of the standard library.",
+                imports.len()
+            );
+            imports
+        }
+        None => {
+            let since: i64 = since.unwrap_or(chrono::Utc::now().timestamp() - 30 * 24 * 3600);
+            listed = logger.run_task("Listing the modules of the module index", || {
+                index_modules(since, None)
+            })?;
+            info!("{} modules found in the module index.", listed.len());
+            listed.iter().map(|path| (path.as_str(), None)).collect()
+        }
+    };
+
+    let forge: Forge = Forge::new(Provider::GoProxy, host);
+    info!("Resolving import paths with {forge}");
+    let mut resolver: ModuleResolver = ModuleResolver::new(&forge)?;
+
+    let progress = ProgressBar::new(imports.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    // Modules in the order in which they are found, with the number of import paths resolved to them.
+    let mut modules: Vec<(Module, usize)> = Vec::new();
+    let mut index: HashMap<(String, String), usize> = HashMap::new();
+    let mut unresolved: usize = 0;
+    for (path, version) in imports {
+        match resolver.resolve(path, version)? {
+            Some(module) => {
+                let key = (module.path.clone(), module.version.clone());
+                match index.get(&key) {
+                    Some(&i) => modules[i].1 += 1,
+                    None => {
+                        debug!("{path} belongs to {}@{}", module.path, module.version);
+                        index.insert(key, modules.len());
+                        modules.push((module, 1));
+                    }
+                }
+            }
+            None => {
+                warn!("No module found for {path}");
+                unresolved += 1;
+            }
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+
+    info!("{} modules found.", modules.len());
+    info!("{} import paths could not be resolved.", unresolved);
+
+    let modules: Vec<(Module, usize, Option<u64>)> = match top {
+        Some(top) => rank_modules(modules, top)?,
+        None => modules.into_iter().map(|(m, i)| (m, i, None)).collect(),
+    };
+
+    logger.run_task(format!("Writing to {output_path}"), || {
+        let mut output_file = CSVFile::new(output_path, FileMode::Overwrite)?;
+        output_file.write_header(Module::header())?;
+        for (id, (module, imports, dependents)) in modules.iter().enumerate() {
+            writeln!(
+                &mut output_file,
+                "{}",
+                module.to_csv((id as u32 + 1, *imports, *dependents))
+            )?;
+        }
+        Ok(())
+    })
+}
+
+/// Ranks modules by their number of dependents on deps.dev, and keeps the most depended upon.
+/// Modules unknown to deps.dev are ranked last.
+///
+/// # Arguments
+///
+/// * `modules` - The modules, with the number of import paths resolved to them.
+/// * `top` - The number of modules to keep.
+///
+/// # Returns
+///
+/// The modules kept, from the most to the least depended upon, with their number of dependents.
+fn rank_modules(
+    modules: Vec<(Module, usize)>,
+    top: usize,
+) -> Result<Vec<(Module, usize, Option<u64>)>> {
+    info!("Counting the dependents of the modules on deps.dev");
+    let deps_dev: DepsDev = DepsDev::new();
+    let progress = ProgressBar::new(modules.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+    let mut ranked: Vec<(Module, usize, Option<u64>)> = Vec::with_capacity(modules.len());
+    for (module, imports) in modules {
+        let dependents: Option<u64> = deps_dev.dependents(&module.path, &module.version)?;
+        if dependents.is_none() {
+            debug!("{}@{} is unknown to deps.dev", module.path, module.version);
+        }
+        ranked.push((module, imports, dependents));
+        progress.inc(1);
+    }
+    progress.finish();
+    Ok(sort_by_dependents(ranked, top))
+}
+
+/// Sorts modules by decreasing number of dependents, modules without any count last, and keeps the first ones.
+/// The sort is stable, so that modules with the same number of dependents stay in the order in which they were found.
+fn sort_by_dependents(
+    mut modules: Vec<(Module, usize, Option<u64>)>,
+    top: usize,
+) -> Vec<(Module, usize, Option<u64>)> {
+    modules.sort_by_key(|(_, _, dependents)| std::cmp::Reverse(*dependents));
+    modules.truncate(top);
+    modules
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn parse_lines() {
+        assert_eq!(
+            parse_line("golang.org/x/tools/go/packages"),
+            Some(("golang.org/x/tools/go/packages", None))
+        );
+        assert_eq!(
+            parse_line("github.com/spf13/cobra v1.8.0"),
+            Some(("github.com/spf13/cobra", Some("v1.8.0")))
+        );
+        // go list -m all prints the replacements of the modules after an arrow.
+        assert_eq!(
+            parse_line("example.com/a v1.0.0 => ../a"),
+            Some(("example.com/a", Some("v1.0.0")))
+        );
+        assert_eq!(parse_line("net/http"), None);
+        assert_eq!(parse_line("  "), None);
+        assert_eq!(parse_line("# dependencies"), None);
+    }
+
+    #[test]
+    fn top_modules() {
+        let module = |path: &str| Module {
+            path: path.to_string(),
+            version: "v1.0.0".to_string(),
+            ..Default::default()
+        };
+        let ranked = sort_by_dependents(
+            vec![
+                (module("a"), 1, Some(10)),
+                (module("b"), 1, None),
+                (module("c"), 2, Some(100)),
+                (module("d"), 1, Some(10)),
+            ],
+            3,
+        );
+        assert_eq!(
+            ranked
+                .iter()
+                .map(|(m, _, _)| m.path.as_str())
+                .collect::<Vec<&str>>(),
+            vec!["c", "a", "d"]
+        );
+    }
+}
@@ -20,16 +20,36 @@ use polars::prelude::*;
 use rand::rngs::StdRng;
 use rand::seq::SliceRandom as _;
 use rand::SeedableRng;
+use regex::bytes::Regex;
 
 use anyhow::{anyhow, bail, ensure, Context, Error, Result};
 use std::iter::FromIterator as _;
+use std::time::{Duration, Instant};
 use std::vec;
-use std::{collections::HashSet, fmt::Write, io::Write as IOWrite, sync::Mutex};
-use tracing::info;
+use std::{
+    backtrace::Backtrace,
+    cell::{Cell, RefCell},
+    collections::{BTreeMap, HashMap, HashSet},
+    fmt::Write,
+    io::Write as IOWrite,
+    panic::AssertUnwindSafe,
+    path::{Path, PathBuf},
+    sync::atomic::{AtomicBool, AtomicUsize, Ordering},
+    sync::{Arc, Mutex, Once},
+};
+use tracing::{info, warn};
 use tree_sitter::{Language, Node, Parser, Tree};
 
+use crate::phases::download::parse_size_arg;
+use crate::utils::ast::store_tree;
+use crate::utils::constraints::{configurations, BuildConfig};
+use crate::utils::dataframes;
+use crate::utils::embed::{embed_patterns, embedded_files};
 use crate::utils::fs::*;
+use crate::utils::gomod::GoVersions;
+use crate::utils::json::{get_field, open_json_from_path};
 use crate::utils::regex::*;
+use crate::utils::visitors::{self, FileContext, Visitor};
 use crate::utils::{
     csv::*,
     logger::{log_output_file, log_seed, Logger},
@@ -115,16 +135,110 @@ pub fn cli() -> Command {
         .arg(
             Arg::new("threads")
                 .short('n')
-                .help("Number of threads to use.")
+                .long("parse-jobs")
+                .value_name("JOBS")
+                .help("Number of parsing workers, or 0 for one worker per available core.")
                 .default_value("1")
                 .value_parser(clap::value_parser!(usize))
         )
+        .arg(
+            Arg::new("distribution")
+            .long("distribution")
+            .value_name("UNIT")
+            .help("Unit of work distributed to the workers.\n\
+            file: every file is parsed by the next available worker\n\
+            package: all the files of a package (a directory of a project) are parsed one after the other by the same worker")
+            .default_value("file")
+            .value_parser(["file", "package"]),
+        )
+        .arg(
+            Arg::new("order")
+            .long("order")
+            .value_name("ORDER")
+            .help("Order of the rows in the output files.\n\
+            path: the files are parsed and written by project, package and file name, whatever the scheduling of the workers\n\
+            random: the files are parsed in a random order controlled by the seed, and written as soon as they are parsed")
+            .default_value("path")
+            .value_parser(["path", "random"]),
+        )
+        .arg(
+            Arg::new("ast-cache")
+            .long("ast-cache")
+            .value_name("DIR")
+            .help("Store the syntax tree of every parsed file in this directory, in a compact encoding keyed by the hash of the file, \
+                   so that later analyses can load it without parsing the file again."),
+        )
+        .arg(
+            Arg::new("tokens")
+            .long("tokens")
+            .help("Export the token stream of every parsed file, with the kind, text and position of every token, to a separate csv file, \
+                   named after the input file with the suffix '.tokens.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("comments")
+            .long("comments")
+            .help("Extract the comments of every parsed file, with the declarations they document, to a separate csv file, \
+                   named after the input file with the suffix '.comments.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("embeds")
+            .long("embeds")
+            .help("Extract the //go:embed directives of Go files, with the variables they initialize and their patterns, to a separate csv file, \
+                   named after the input file with the suffix '.embeds.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("verify-embeds")
+            .long("verify-embeds")
+            .help("Count the files matched by every pattern of the //go:embed directives, a pattern matching no file being invalid.")
+            .default_value("false")
+            .action(ArgAction::SetTrue)
+            .requires("embeds"),
+        )
+        .arg(
+            Arg::new("directives")
+            .long("directives")
+            .help("Extract the //go: compiler directives of Go files, such as noinline, linkname or generate, with their arguments and the declarations they apply to, \
+                   to a separate csv file, named after the input file with the suffix '.directives.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("unsafe")
+            .long("unsafe")
+            .help("Extract the uses of unsafe.Pointer and of the other functions of the unsafe package, the conversions to uintptr and the uses of reflect.SliceHeader \
+                   and reflect.StringHeader in Go files, with their enclosing function and whether cgo is involved, to a separate csv file, \
+                   named after the input file with the suffix '.unsafe.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("literals")
+            .long("literals")
+            .help("Extract the numeric, string and composite literals of Go files, with their inferred types and the constants or variables they initialize, \
+                   to a separate csv file, named after the input file with the suffix '.literals.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("features")
+            .long("features")
+            .help("Detect the language features used by Go files, such as generics, iterators, the min and max builtins or error wrapping, \
+                   with the Go version introducing them, to a separate csv file, named after the input file with the suffix '.features.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
         .arg(
             Arg::new("seed")
                 .short('s')
                 .long("seed")
                 .value_name("SEED")
-                .help("Seed used to randomly shuffle the input file.")
+                .help("Seed used to randomly shuffle the input file, with --order random.")
                 .default_value("8155495201244430235")
                 .value_parser(clap::value_parser!(u64)),
         )
@@ -147,6 +261,441 @@ pub fn cli() -> Command {
             .default_value("false")
             .action(ArgAction::SetTrue),
         )
+        .arg(
+            Arg::new("cgo")
+            .long("cgo")
+            .value_name("POLICY")
+            .help("Handling of the references to C (`C.name`) in Go files importing \"C\".\n\
+            ignore: parse them as regular Go identifiers\n\
+            record: count them in an additional cgo_refs column of the output file and a cgo column of the logs file\n\
+            mask: exclude them from keyword matching, in the body, parameter types and return type of the functions")
+            .default_value("ignore")
+            .value_parser(["ignore", "record", "mask"]),
+        )
+        .arg(
+            Arg::new("generics")
+            .long("generics")
+            .help("Extract the generic declarations of Go files and their instantiation sites to a separate csv file, named after the input file \
+                   with the suffix '.generics.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("syntax-errors")
+            .long("syntax-errors")
+            .help("List the syntax errors of every file in a separate csv file, named after the input file with the suffix '.syntax_errors.csv', \
+                   even if the file is skipped by the failure policy.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("generated")
+            .long("generated")
+            .value_name("POLICY")
+            .help("Handling of the machine-generated files, detected from their `Code generated ... DO NOT EDIT.` header or the similar markers of other generators.\n\
+            include: parse them as any other file\n\
+            tag: parse them and record their generator (protoc, stringer, mockgen, ...) in an additional generated column of both output files\n\
+            skip: do not extract any function from them and record them in the logs file with a 'generated' parse error")
+            .default_value("include")
+            .value_parser(["include", "tag", "skip"]),
+        )
+        .arg(
+            Arg::new("vendored")
+            .long("vendored")
+            .value_name("POLICY")
+            .help("Handling of the files in vendor/, third_party/ and testdata/ trees, which mostly contain the code of dependencies.\n\
+            parse: parse them as any other file\n\
+            skip: remove them from the input file\n\
+            tag: parse them and record the tree they belong to in an additional vendored column of both output files")
+            .default_value("parse")
+            .value_parser(["parse", "skip", "tag"]),
+        )
+        .arg(
+            Arg::new("snippets")
+            .long("snippets")
+            .help("Parse the Go files without a package clause, such as code fragments, within a synthetic package and imports scaffold, \
+                   and flag them in an additional snippet column of both output files.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("file-timeout")
+            .long("file-timeout")
+            .value_name("SECONDS")
+            .help("Time budget of every file. Files whose parsing and extraction take longer are skipped and recorded in the logs file \
+                   with a 'timeout' parse error.")
+            .value_parser(clap::value_parser!(u64).range(1..)),
+        )
+        .arg(
+            Arg::new("repo-timeout")
+            .long("repo-timeout")
+            .value_name("SECONDS")
+            .help("Time budget of every project, shared by all its files. Once it is exhausted, the remaining files of the project are skipped \
+                   and recorded in the logs file with a 'timeout' parse error.")
+            .value_parser(clap::value_parser!(u64).range(1..)),
+        )
+        .arg(
+            Arg::new("max-file-size")
+            .long("max-file-size")
+            .value_name("SIZE")
+            .help("Skip the files larger than this size, in bytes or with a unit (e.g. 500K, 10M), and record them in the logs file \
+                   with a 'too-large' parse error. Files larger than 1G are always skipped.")
+            .value_parser(parse_size_arg),
+        )
+        .arg(
+            Arg::new("max-memory")
+            .long("max-memory")
+            .value_name("SIZE")
+            .help("Bound the size of the results waiting to be written, in bytes or with a unit (e.g. 512M, 2G). Once it is reached, \
+                   the workers finish their current unit and wait for the results to be written before taking a new one.")
+            .value_parser(parse_size_arg),
+        )
+        .arg(
+            Arg::new("build-configs")
+            .long("build-configs")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("GOOS/GOARCH")
+            .help("Evaluate the build constraints of Go files for the given configurations (e.g. linux/amd64 windows/386), or for the \
+                   first-class ports of Go with 'all', and record the configurations in which every file is built."),
+        )
+        .arg(
+            Arg::new("tests")
+            .long("tests")
+            .value_name("POLICY")
+            .help("Handling of the Go test files, whose name ends with _test.go.\n\
+            include: parse them as any other file\n\
+            tag: parse them and record whether they belong to the package under test (internal) or to an external test package \
+            (external) in an additional test column of both output files\n\
+            skip: remove them from the input file\n\
+            only: remove the other files from the input file")
+            .default_value("include")
+            .value_parser(["include", "tag", "skip", "only"]),
+        )
+        .arg(
+            Arg::new("packages")
+            .long("packages")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("PATTERN")
+            .help("Only parse the files of the packages, i.e. of the directories, whose path matches one of the patterns. \
+                   Patterns are globs in which ** matches any number of directories (e.g. '*/math/**'), or regexes if they are prefixed with 're:'."),
+        )
+        .arg(
+            Arg::new("exclude-packages")
+            .long("exclude-packages")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("PATTERN")
+            .help("Do not parse the files of the packages whose path matches one of the patterns (e.g. '**/internal/**'), \
+                   with the same syntax as --packages."),
+        )
+        .arg(
+            Arg::new("paths")
+            .long("paths")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("PATTERN")
+            .help("Only parse the files whose path matches one of the patterns, with the same syntax as --packages \
+                   (e.g. '**/cmd/**' or 're:/pkg/')."),
+        )
+        .arg(
+            Arg::new("exclude-paths")
+            .long("exclude-paths")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("PATTERN")
+            .help("Do not parse the files whose path matches one of the patterns (e.g. '**/*.pb.go'), with the same syntax as --packages."),
+        )
+        .arg(
+            Arg::new("extensions")
+            .long("extensions")
+            .num_args(1..)
+            .action(ArgAction::Append)
+            .value_name("EXT")
+            .help("Only parse the files whose name ends with one of the extensions, with or without their leading dot (e.g. go or .pb.go)."),
+        )
+        .arg(
+            Arg::new("min-size")
+            .long("min-size")
+            .value_name("SIZE")
+            .help("Do not parse the files smaller than this size, in bytes or with a unit (e.g. 1K).")
+            .value_parser(parse_size_arg),
+        )
+        .arg(
+            Arg::new("max-size")
+            .long("max-size")
+            .value_name("SIZE")
+            .help("Do not parse the files larger than this size, in bytes or with a unit (e.g. 1M). Unlike with --max-file-size, \
+                   the files are removed from the input file and not recorded in the logs file.")
+            .value_parser(parse_size_arg),
+        )
+        .arg(
+            Arg::new("max-depth")
+            .long("max-depth")
+            .value_name("DEPTH")
+            .help("Do not parse the files nested in more than this number of directories within their project, \
+                   the files at the root of a project having depth 0.")
+            .value_parser(clap::value_parser!(usize)),
+        )
+        .arg(
+            Arg::new("symlinks")
+            .long("symlinks")
+            .value_name("POLICY")
+            .help("Policy for the files reached through symbolic links. In both cases, the paths are normalized and a file reached \
+                   through several paths is only parsed once, under its first path in the input file.\n\
+            follow-once: symbolic links are followed\n\
+            skip: the files whose path goes through a symbolic link are skipped")
+            .default_value("follow-once")
+            .value_parser(["follow-once", "skip"]),
+        )
+        .arg(
+            Arg::new("dedup-contents")
+            .long("dedup-contents")
+            .help("Parse the files having the same content only once, e.g. vendored copies and forks, under the first of their paths in the output order. \
+                   The other files are not written to the output files but recorded as aliases of the parsed one in a separate csv file, \
+                   named after the input file with the suffix '.aliases.csv', and reported in a csv file with the suffix '.dedup_report.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("dry-run")
+            .long("dry-run")
+            .help("Do not parse anything: apply the filters, report the number of projects, packages and files that would be parsed \
+                   and the number of files skipped by every filter, and list them in a csv file named after the input file with the \
+                   suffix '.dry_run.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("repo-stats")
+            .long("repo-stats")
+            .help("Write the statistics of every project (files parsed, skipped and reused, packages, lines, files with syntax errors \
+                   and time spent parsing) to a csv file named after the input file with the suffix '.repo_stats.csv'.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("resume")
+            .long("resume")
+            .help("Resume an interrupted run from its last checkpoint, keeping the rows of the files written before it and parsing \
+                   the other files. Runs in the path order save a checkpoint every minute, in a json file named after the input file \
+                   with the suffix '.checkpoint.json', which is removed once they complete. The run must have the same input and options.")
+            .default_value("false")
+            .action(ArgAction::SetTrue)
+            .conflicts_with_all(["incremental", "dry-run"]),
+        )
+        .arg(
+            Arg::new("go-versions")
+            .long("go-versions")
+            .help("Record the Go version of the module every Go file belongs to, read from the go directive of its go.mod file, \
+                   in an additional go_version column of both output files.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("encodings")
+            .long("encodings")
+            .help("Detect the encoding issues of every file before parsing it: UTF-16 files are transcoded to UTF-8, byte order marks \
+                   and NUL bytes are replaced by spaces, and invalid UTF-8 sequences are kept as they are. The encoding and the number of \
+                   NUL bytes of every file are recorded in additional encoding and nul_bytes columns of both output files.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("incremental")
+            .long("incremental")
+            .help("Record the hash of every file in an additional hash column of the logs file, and reuse the rows written by a previous \
+                   run with the same options for the files whose content has not changed since, instead of parsing them again.")
+            .default_value("false")
+            .action(ArgAction::SetTrue),
+        )
+}
+
+/// Options of the parse phase. The default options are those of the command line.
+#[derive(Debug, Clone)]
+pub struct Options<'a> {
+    /// Path to the output csv file storing the functions statistics. Defaults to the input path with ".functions.csv" appended.
+    pub output_path: Option<&'a str>,
+    /// Path to the output csv file storing the files statistics. Defaults to the input path with ".function_logs.csv" appended.
+    pub logs_path: Option<&'a str>,
+    /// Whether to interpret the keywords as regular expressions. If false, the keywords are interpreted as whole words to match.
+    pub regex_syntax: bool,
+    /// The policy to apply when a parse error is encountered. It can be one of the following:
+    /// * `ignore`: continue parsing and write the statistics of the file or function with parse error as if there was no error.
+    /// * `skip-file`: replace the file statistics with an error row in the output file, does not extract any function from the file.
+    /// * `skip-function`: replace the function statistics with an error row in the output file.
+    pub fail_policy: &'a str,
+    /// The number of parsing workers, or 0 for one worker per available core.
+    pub threads: usize,
+    /// The seed used to shuffle the work units.
+    pub seed: u64,
+    /// Whether to override the output file if it already exists.
+    pub force: bool,
+    /// Whether to ignore comments when extracting functions.
+    pub ignore_comments: bool,
+    /// The handling of the references to C in Go files importing "C". It can be one of the following:
+    /// * `ignore`: parse them as regular Go identifiers.
+    /// * `record`: count them in the output files.
+    /// * `mask`: exclude them from keyword matching.
+    pub cgo_policy: &'a str,
+    /// The handling of the machine-generated files. It can be one of the following:
+    /// * `include`: parse them as any other file.
+    /// * `tag`: parse them and record their generator.
+    /// * `skip`: do not extract any function from them.
+    pub generated_policy: &'a str,
+    /// The handling of the files in vendor/, third_party/ and testdata/ trees. It can be one of the following:
+    /// * `parse`: parse them as any other file.
+    /// * `skip`: do not parse them.
+    /// * `tag`: parse them and record the tree they belong to.
+    pub vendored_policy: &'a str,
+    /// Whether to parse the Go files without a package clause within a synthetic scaffold and flag them.
+    pub snippets: bool,
+    /// Optional list of build configurations (GOOS/GOARCH, or `all` for the first-class ports) in which the build constraints of Go files are evaluated.
+    pub build_configs: Option<Vec<&'a str>>,
+    /// The handling of the Go test files. It can be one of the following:
+    /// * `include`: parse them as any other file.
+    /// * `tag`: parse them and record whether they belong to an external test package.
+    /// * `skip`: do not parse them.
+    /// * `only`: parse only them.
+    pub tests_policy: &'a str,
+    /// Whether to only list the files that would be parsed and those skipped by the filters, without parsing them.
+    pub dry_run: bool,
+    /// Whether to resume an interrupted run from its last checkpoint.
+    pub resume: bool,
+    /// Whether to reuse the rows of the previous run for the files whose content has not changed.
+    pub incremental: bool,
+    /// The unit of work distributed to the workers, either `file` or `package`.
+    pub distribution: &'a str,
+    /// The order of the rows in the output files, either `path` or `random`.
+    pub order: &'a str,
+    /// Optional directory storing the syntax trees of the parsed files, keyed by the hash of their content.
+    pub ast_cache: Option<&'a str>,
+    /// The selection of the files to parse.
+    pub filters: Filters<'a>,
+    /// The time and memory budgets of the run.
+    pub limits: Limits,
+    /// The additional data extracted from the parsed files.
+    pub extractions: Extractions,
+}
+
+impl Default for Options<'_> {
+    fn default() -> Self {
+        Options {
+            output_path: None,
+            logs_path: None,
+            regex_syntax: false,
+            fail_policy: "ignore",
+            threads: 1,
+            seed: 8155495201244430235,
+            force: false,
+            ignore_comments: false,
+            cgo_policy: "ignore",
+            generated_policy: "include",
+            vendored_policy: "parse",
+            snippets: false,
+            build_configs: None,
+            tests_policy: "include",
+            dry_run: false,
+            resume: false,
+            incremental: false,
+            distribution: "file",
+            order: "path",
+            ast_cache: None,
+            filters: Filters::default(),
+            limits: Limits::default(),
+            extractions: Extractions::default(),
+        }
+    }
+}
+
+/// Selection of the files of the input file that are parsed. All the files are parsed by default.
+#[derive(Debug, Clone)]
+pub struct Filters<'a> {
+    /// Optional list of languages to parse. If not specified, all supported languages are parsed.
+    pub languages: Option<Vec<&'a str>>,
+    /// Optional patterns of the paths of the packages to parse, globs or regexes prefixed with `re:`.
+    pub packages: Option<Vec<&'a str>>,
+    /// Optional patterns of the paths of the packages not to parse.
+    pub excluded_packages: Option<Vec<&'a str>>,
+    /// Optional patterns of the paths of the files to parse.
+    pub paths: Option<Vec<&'a str>>,
+    /// Optional patterns of the paths of the files not to parse.
+    pub excluded_paths: Option<Vec<&'a str>>,
+    /// Optional extensions of the files to parse.
+    pub extensions: Option<Vec<&'a str>>,
+    /// Optional minimum size of the files to parse, in bytes.
+    pub min_size: Option<u64>,
+    /// Optional maximum size of the files to parse, in bytes.
+    pub max_size: Option<u64>,
+    /// Optional maximum number of directories in which the files to parse are nested within their project.
+    pub max_depth: Option<usize>,
+    /// Policy for the files reached through symbolic links (follow-once, skip).
+    pub symlinks: &'a str,
+    /// Whether to parse the files having the same content only once, recording the others as aliases.
+    pub dedup_contents: bool,
+}
+
+impl Default for Filters<'_> {
+    fn default() -> Self {
+        Filters {
+            languages: None,
+            packages: None,
+            excluded_packages: None,
+            paths: None,
+            excluded_paths: None,
+            extensions: None,
+            min_size: None,
+            max_size: None,
+            max_depth: None,
+            symlinks: "follow-once",
+            dedup_contents: false,
+        }
+    }
+}
+
+/// Time and memory budgets of a run. No budget is set by default.
+#[derive(Debug, Clone, Copy, Default)]
+pub struct Limits {
+    /// Optional time budget of every file, in seconds.
+    pub file_timeout: Option<u64>,
+    /// Optional time budget of every project, in seconds, shared by all its files.
+    pub repo_timeout: Option<u64>,
+    /// Optional maximum size of the files parsed, in bytes. Files larger than 1 GiB are never parsed.
+    pub max_file_size: Option<u64>,
+    /// Optional maximum size of the results waiting to be written, in bytes, above which the workers stop taking new units.
+    pub max_memory: Option<u64>,
+}
+
+/// Data extracted from the parsed files in addition to the functions statistics. Nothing is extracted by default.
+#[derive(Debug, Clone, Copy, Default)]
+pub struct Extractions {
+    /// Whether to extract the generic declarations of Go files and their instantiation sites.
+    pub generics: bool,
+    /// Whether to list the syntax errors of every file.
+    pub syntax_errors: bool,
+    /// Whether to write the statistics of every project.
+    pub repo_stats: bool,
+    /// Whether to record the Go version of the module of every Go file.
+    pub go_versions: bool,
+    /// Whether to sanitize the encoding of every file and record it.
+    pub encodings: bool,
+    /// Whether to export the token stream of every parsed file.
+    pub tokens: bool,
+    /// Whether to extract the comments of every parsed file.
+    pub comments: bool,
+    /// Whether to extract the `//go:embed` directives of Go files.
+    pub embeds: bool,
+    /// Whether to count the files matched by the patterns of the `//go:embed` directives.
+    pub verify_embeds: bool,
+    /// Whether to extract the `//go:` directives of Go files.
+    pub directives: bool,
+    /// Whether to extract the unsafe uses of Go files.
+    pub unsafe_uses: bool,
+    /// Whether to extract the literals of Go files.
+    pub literals: bool,
+    /// Whether to detect the language features used by Go files.
+    pub features: bool,
 }
 
 /// Entry point of the program
@@ -154,34 +703,81 @@ pub fn cli() -> Command {
 /// # Arguments
 ///
 /// * `input_path` - Path to the input csv file to use.
-/// * `output_path` - Path to the output csv file storing the functions statistics.
-/// * `logs_path` - Path to the output csv file storing the files statistics.
 /// * `keywords_file_paths` - Paths to the files containing the list of extensions and keywords to use.
-/// * `regex_syntax` - Whether to interpret the keywords as regular expressions. If false, the keywords are interpreted as whole words to match.
-/// * `opt_languages` - Optional list of languages to parse. If not specified, all supported languages are parsed.
-/// * `fail_policy` - The policy to apply when a parse error is encountered. It can be one of the following:
-///   * `ignore`: continue parsing and write the statistics of the file or function with parse error as if there was no error.
-///   * `skip-file`: replace the file statistics with an error row in the output file, does not extract any function from the file.
-///   * `skip-function`: replace the function statistics with an error row in the output file.
-/// * `threads` - The number of threads to use.
-/// * `seed` - The seed used to shuffle the input file.
-/// * `force` - Whether to override the output file if it already exists.
-/// * `ignore_comments` - Whether to ignore comments when extracting functions.
+/// * `options` - The options of the run.
 /// * `logger` - The logger to use to display information about the progress of the program.
 pub fn run(
     input_path: &str,
-    output_path: Option<&str>,
-    logs_path: Option<&str>,
     keywords_file_paths: &[&str],
-    regex_syntax: bool,
-    opt_languages: Option<Vec<&str>>,
-    fail_policy: &str,
-    threads: usize,
-    seed: u64,
-    force: bool,
-    ignore_comments: bool,
+    options: Options,
     logger: &Logger,
 ) -> Result<()> {
+    let Options {
+        output_path,
+        logs_path,
+        regex_syntax,
+        fail_policy,
+        threads,
+        seed,
+        force,
+        ignore_comments,
+        cgo_policy,
+        generated_policy,
+        vendored_policy,
+        snippets,
+        build_configs,
+        tests_policy,
+        dry_run,
+        resume,
+        incremental,
+        distribution,
+        order,
+        ast_cache,
+        filters:
+            Filters {
+                languages: opt_languages,
+                packages,
+                excluded_packages,
+                paths,
+                excluded_paths,
+                extensions,
+                min_size,
+                max_size,
+                max_depth,
+                symlinks,
+                dedup_contents,
+            },
+        limits:
+            Limits {
+                file_timeout,
+                repo_timeout,
+                max_file_size,
+                max_memory,
+            },
+        extractions:
+            Extractions {
+                generics,
+                syntax_errors,
+                repo_stats,
+                go_versions,
+                encodings,
+                tokens,
+                comments,
+                embeds,
+                verify_embeds,
+                directives,
+                unsafe_uses,
+                literals,
+                features,
+            },
+    } = options;
+    let threads: usize = if threads == 0 {
+        std::thread::available_parallelism()?.get()
+    } else {
+        threads
+    };
+    info!("Parsing workers: {threads}");
+
     let supported_languages: HashSet<&'static str> = vec![
         "c",
         "c++",
@@ -215,22 +811,139 @@ pub fn run(
 
     info!("Selected languages: {}", languages.join(", "));
 
-    let languages_series = Series::new(
-        "language_filter".into(),
-        languages
-            .iter()
-            .map(|x| x.to_string())
-            .collect::<Vec<String>>(),
-    );
+    let build_configs: Option<Vec<BuildConfig>> = match build_configs {
+        Some(configs) if configs.contains(&"all") => Some(BuildConfig::first_class_ports()),
+        Some(configs) => Some(
+            configs
+                .into_iter()
+                .map(|c| c.parse())
+                .collect::<Result<Vec<BuildConfig>>>()?,
+        ),
+        None => None,
+    };
+    if let Some(configs) = &build_configs {
+        info!(
+            "Build configurations: {}",
+            configs
+                .iter()
+                .map(|c| c.to_string())
+                .collect::<Vec<String>>()
+                .join(", ")
+        );
+    }
+
+    // The output files of an interrupted run are written again from its last checkpoint when it is resumed.
+    let check_output = |path: &str| -> Result<()> {
+        if resume {
+            Ok(())
+        } else {
+            log_output_file(path, dry_run, force)
+        }
+    };
 
     let default_output_path: String = format!("{input_path}.functions.csv");
     let output_path: &str = output_path.unwrap_or(&default_output_path);
-    log_output_file(output_path, false, force)?;
+    check_output(output_path)?;
 
     let default_logs_path: String = format!("{input_path}.function_logs.csv");
     let logs_path: &str = logs_path.unwrap_or(&default_logs_path);
 
-    log_output_file(logs_path, false, force)?;
+    check_output(logs_path)?;
+
+    let generics_path: String = format!("{input_path}.generics.csv");
+    if generics {
+        check_output(&generics_path)?;
+    }
+
+    let syntax_errors_path: String = format!("{input_path}.syntax_errors.csv");
+    if syntax_errors {
+        check_output(&syntax_errors_path)?;
+    }
+
+    let tokens_path: String = format!("{input_path}.tokens.csv");
+    if tokens {
+        check_output(&tokens_path)?;
+    }
+
+    let comments_path: String = format!("{input_path}.comments.csv");
+    if comments {
+        check_output(&comments_path)?;
+    }
+
+    let embeds_path: String = format!("{input_path}.embeds.csv");
+    if embeds {
+        check_output(&embeds_path)?;
+    }
+
+    let directives_path: String = format!("{input_path}.directives.csv");
+    if directives {
+        check_output(&directives_path)?;
+    }
+
+    let unsafe_path: String = format!("{input_path}.unsafe.csv");
+    if unsafe_uses {
+        check_output(&unsafe_path)?;
+    }
+
+    let literals_path: String = format!("{input_path}.literals.csv");
+    if literals {
+        check_output(&literals_path)?;
+    }
+
+    let features_path: String = format!("{input_path}.features.csv");
+    if features {
+        check_output(&features_path)?;
+    }
+
+    // The visitors registered by the programs using scyros as a library, each writing its rows to its own file.
+    let visitors: Vec<Arc<dyn Visitor>> = visitors::registered();
+    let visitor_paths: Vec<String> = visitors
+        .iter()
+        .map(|visitor| format!("{input_path}.{}.csv", visitor.name()))
+        .collect();
+    for path in &visitor_paths {
+        check_output(path)?;
+    }
+
+    let aliases_path: String = format!("{input_path}.aliases.csv");
+    let dedup_report_path: String = format!("{input_path}.dedup_report.csv");
+    if dedup_contents {
+        check_output(&aliases_path)?;
+        check_output(&dedup_report_path)?;
+    }
+
+    // The output files whose length is recorded by the checkpoints, i.e. those written while parsing.
+    let mut output_paths: Vec<&str> = vec![output_path, logs_path];
+    for (enabled, path) in [
+        (generics, &generics_path),
+        (syntax_errors, &syntax_errors_path),
+        (tokens, &tokens_path),
+        (comments, &comments_path),
+        (embeds, &embeds_path),
+        (directives, &directives_path),
+        (unsafe_uses, &unsafe_path),
+        (literals, &literals_path),
+        (features, &features_path),
+    ] {
+        if enabled {
+            output_paths.push(path);
+        }
+    }
+    output_paths.extend(visitor_paths.iter().map(String::as_str));
+
+    let repo_stats_path: String = format!("{input_path}.repo_stats.csv");
+    if repo_stats {
+        check_output(&repo_stats_path)?;
+    }
+
+    let dry_run_path: String = format!("{input_path}.dry_run.csv");
+    if dry_run {
+        log_output_file(&dry_run_path, false, force)?;
+    }
+
+    let keyword_files: KeywordFiles = logger.run_task("Loading keywords", || {
+        KeywordFiles::new(regex_syntax).add_files(keywords_file_paths, true)
+    })?;
 
     let mut input_file = open_csv(
         input_path,
@@ -242,6 +955,11 @@ pub fn run(
         Some(vec!["id", "name", "language"]),
     )?;
 
+    let archives: usize = expand_archives(&mut input_file, &keyword_files.extensions_to_language)?;
+    if archives > 0 {
+        info!("  {archives} archives replaced by the files they contain");
+    }
+
     let n_files_before = input_file.height();
 
     info!(
@@ -249,11 +967,151 @@ pub fn run(
         n_files_before
     );
 
+    // The files removed from the input file with the filter removing them, listed in the work plan of a dry run.
+    let mut skipped_files: Option<Vec<SkippedFile>> = dry_run.then(Vec::new);
+
     // Keep only the files written in the selected languages
-    input_file = input_file
-        .lazy()
-        .filter(col("language").is_in(lit(languages_series)))
-        .collect()?;
+    let skipped: Vec<Option<&str>> = dataframes::str(&input_file, "language")?
+        .into_iter()
+        .map(|language| (!languages.contains(&language)).then_some("language"))
+        .collect();
+    skip_files(&mut input_file, &skipped, skipped_files.as_mut())?;
+
+    if vendored_policy == "skip" {
+        let skipped: Vec<Option<&str>> = dataframes::str(&input_file, "name")?
+            .into_iter()
+            .map(|path| vendored_tree(path).map(|_| "vendored"))
+            .collect();
+        info!(
+            "  {} files skipped in vendored trees",
+            skip_files(&mut input_file, &skipped, skipped_files.as_mut())?
+        );
+    }
+
+    if tests_policy == "skip" || tests_policy == "only" {
+        let skipped: Vec<Option<&str>> = dataframes::str(&input_file, "name")?
+            .into_iter()
+            .map(|path| (is_test_file(path) != (tests_policy == "only")).then_some("test"))
+            .collect();
+        info!(
+            "  {} {} files skipped",
+            skip_files(&mut input_file, &skipped, skipped_files.as_mut())?,
+            if tests_policy == "skip" {
+                "test"
+            } else {
+                "non-test"
+            }
+        );
+    }
+
+    if packages.is_some() || excluded_packages.is_some() {
+        let matchers = |patterns: Vec<&str>| -> Result<Vec<Regex>> {
+            patterns.into_iter().map(path_matcher).collect()
+        };
+        let included: Option<Vec<Regex>> = packages.map(matchers).transpose()?;
+        let excluded: Vec<Regex> = matchers(excluded_packages.unwrap_or_default())?;
+        let skipped: Vec<Option<&str>> = dataframes::str(&input_file, "name")?
+            .into_iter()
+            .map(|path| {
+                let package: &[u8] = package_of(path).as_bytes();
+                let kept: bool = included
+                    .as_ref()
+                    .is_none_or(|included| included.iter().any(|re| re.is_match(package)))
+                    && !excluded.iter().any(|re| re.is_match(package));
+                (!kept).then_some("package")
+            })
+            .collect();
+        info!(
+            "  {} files skipped in filtered out packages",
+            skip_files(&mut input_file, &skipped, skipped_files.as_mut())?
+        );
+    }
+
+    if paths.is_some()
+        || excluded_paths.is_some()
+        || extensions.is_some()
+        || min_size.is_some()
+        || max_size.is_some()
+        || max_depth.is_some()
+    {
+        let filter: FileFilter = FileFilter::new(
+            paths,
+            excluded_paths,
+            extensions,
+            min_size,
+            max_size,
+            max_depth,
+        )?;
+        let skipped: Vec<Option<&str>> = dataframes::u32(&input_file, "id")?
+            .into_iter()
+            .zip(dataframes::str(&input_file, "name")?)
+            .map(|(id, path)| filter.skipped_by(id, path))
+            .collect();
+        for reason in FILE_FILTERS {
+            info!(
+                "  {} files skipped by the {reason} filters",
+                skipped.iter().filter(|r| **r == Some(reason)).count()
+            );
+        }
+        skip_files(&mut input_file, &skipped, skipped_files.as_mut())?;
+    }
+
+    let resolved: ResolvedPaths =
+        resolve_paths(&dataframes::str(&input_file, "name")?, symlinks == "skip");
+    input_file.with_column(Column::new("name".into(), resolved.names))?;
+    skip_files(&mut input_file, &resolved.skipped, skipped_files.as_mut())?;
+    if symlinks == "skip" {
+        info!(
+            "  {} files skipped behind symbolic links",
+            resolved.symlinks
+        );
+    }
+    info!(
+        "  {} files skipped behind broken or looping symbolic links",
+        resolved.broken
+    );
+    info!(
+        "  {} files skipped as already listed under another path",
+        resolved.duplicates
+    );
+
+    if dedup_contents {
+        let names: Vec<&str> = dataframes::str(&input_file, "name")?;
+        let ids: Vec<u32> = dataframes::u32(&input_file, "id")?;
+        let aliases: Vec<(usize, usize, String)> =
+            logger.run_task("Hashing the files", || Ok(content_aliases(&names, threads)))?;
+        // Nothing is written by a dry run, the aliases being listed in its work plan.
+        let mut aliases_file: Option<CSVFile> = if dry_run {
+            None
+        } else {
+            let mut file = CSVFile::new(&aliases_path, FileMode::Overwrite)?;
+            file.write_header(&["id", "path", "original_id", "original_path", "hash"])?;
+            Some(file)
+        };
+        let mut skipped: Vec<Option<&str>> = vec![None; names.len()];
+        for (alias, original, hash) in &aliases {
+            skipped[*alias] = Some("alias");
+            if let Some(file) = aliases_file.as_mut() {
+                writeln!(
+                    file,
+                    "{},{},{},{},{}",
+                    ids[*alias], names[*alias], ids[*original], names[*original], hash
+                )?;
+            }
+        }
+        let groups: Vec<DuplicateGroup> = duplicate_groups(&ids, &aliases);
+        if !dry_run {
+            write_dedup_report(&dedup_report_path, &ids, &names, &groups)?;
+        }
+        skip_files(&mut input_file, &skipped, skipped_files.as_mut())?;
+        let within: usize = groups.iter().map(|group| group.within).sum();
+        info!(
+            "  {} files skipped as aliases of files with the same content ({} within their project, {} across projects)",
+            aliases.len(),
+            within,
+            aliases.len() - within
+        );
+    }
 
     let n_files = input_file.height();
 
@@ -267,18 +1125,52 @@ pub fn run(
         }
     );
 
-    log_seed(seed);
+    if let Some(skipped_files) = skipped_files {
+        return write_work_plan(&input_file, &skipped_files, &dry_run_path);
+    }
+
+    // The files written before the last checkpoint of an interrupted run are not parsed again when it is resumed.
+    let checkpoint_path: String = format!("{input_path}.checkpoint.json");
+    let checkpoint: Option<Checkpoint> = if resume {
+        ensure!(
+            order == "path",
+            "Only the runs in the path order can be resumed"
+        );
+        let checkpoint: Checkpoint = Checkpoint::read(&checkpoint_path)?;
+        ensure!(
+            checkpoint.total == n_files,
+            "The checkpoint {checkpoint_path} was saved by a run parsing {} files instead of {n_files}",
+            checkpoint.total
+        );
+        ensure!(
+            !repo_stats || checkpoint.stats.is_some(),
+            "The checkpoint {checkpoint_path} was saved by a run without the statistics of the projects"
+        );
+        info!(
+            "  Resuming from the checkpoint {checkpoint_path}, after {} files",
+            checkpoint.files
+        );
+        Some(checkpoint)
+    } else {
+        None
+    };
+    let done: usize = checkpoint.as_ref().map_or(0, |checkpoint| checkpoint.files);
 
-    let mut shuffled_idx = (0..input_file.height()).collect::<Vec<usize>>();
+    if order == "random" {
+        log_seed(seed);
+    }
 
-    // Load the ids from the input file in random order.
-    logger.run_task("Loading files in random order", || {
-        let mut rng: StdRng = SeedableRng::seed_from_u64(seed);
-        shuffled_idx.shuffle(&mut rng);
-        Ok(())
-    })?;
+    // The rank of every file in the output files, ordered by the directories of its path, i.e. by project and package,
+    // and then by name.
+    let names: Vec<&str> = dataframes::str(&input_file, "name")?;
+    let mut ranks: Vec<usize> = vec![0; names.len()];
+    let mut sorted_idx: Vec<usize> = (0..names.len()).collect();
+    sorted_idx.sort_by_key(|&idx| output_order_key(names[idx]));
+    for (rank, idx) in sorted_idx.into_iter().enumerate() {
+        ranks[idx] = rank;
+    }
 
-    let shuffled_rows = shuffled_idx.into_iter().map(|idx| {
+    let parse_row = |idx: usize| {
         let row = input_file.get_row(idx).unwrap().0;
         match (row[0].clone(), row[1].clone(), row[2].clone()) {
             (AnyValue::UInt32(id), AnyValue::String(path), AnyValue::String(lang)) => Ok((
@@ -289,29 +1181,145 @@ pub fn run(
             )),
             _ => Err(idx),
         }
-    });
+    };
+
+    // The work units distributed to the workers, either single files or all the files of a package,
+    // i.e. of a directory of a project, which are then parsed one after the other by the same worker.
+    // Every file comes with its rank in the output files.
+    let mut units: Vec<Vec<(usize, Result<(u32, String, &str), usize>)>> =
+        if distribution == "package" {
+            let mut units: Vec<Vec<(usize, Result<(u32, String, &str), usize>)>> = Vec::new();
+            let mut packages: HashMap<(u32, String), usize> = HashMap::new();
+            for idx in 0..input_file.height() {
+                let row = parse_row(idx);
+                match &row {
+                    Ok((id, path, _)) => {
+                        let dir: String = Path::new(path)
+                            .parent()
+                            .map(|dir| dir.to_string_lossy().to_string())
+                            .unwrap_or_default();
+                        let unit: usize = *packages.entry((*id, dir)).or_insert_with(|| {
+                            units.push(Vec::new());
+                            units.len() - 1
+                        });
+                        units[unit].push((ranks[idx], row));
+                    }
+                    Err(_) => units.push(vec![(ranks[idx], row)]),
+                }
+            }
+            info!("  {} packages found", units.len());
+            units
+        } else {
+            (0..input_file.height())
+                .map(|idx| vec![(ranks[idx], parse_row(idx))])
+                .collect()
+        };
+
+    if order == "random" {
+        // Load the ids from the input file in random order.
+        logger.run_task("Loading files in random order", || {
+            let mut rng: StdRng = SeedableRng::seed_from_u64(seed);
+            units.shuffle(&mut rng);
+            Ok(())
+        })?;
+    } else {
+        // The units are parsed in the order of the output files, so that few results wait for the files parsed before them.
+        for unit in units.iter_mut() {
+            unit.sort_by_key(|(rank, _)| *rank);
+        }
+        units.sort_by_key(|unit| unit.first().map(|(rank, _)| *rank));
+    }
+    if done > 0 {
+        for unit in units.iter_mut() {
+            unit.retain(|(rank, _)| *rank >= done);
+        }
+        units.retain(|unit| !unit.is_empty());
+    }
 
     // Number of columns in the output file.
     const OUTPUT_COLS: usize = 18;
     const LOGS_COLS: usize = 7;
 
-    let keyword_files: KeywordFiles = logger.run_task("Loading keywords", || {
-        KeywordFiles::new(regex_syntax).add_files(keywords_file_paths, true)
-    })?;
-
     let keyword_match_headers: String = keyword_files.paths.join(",");
 
     let word_counter: Matcher = Matcher::words_matcher();
 
-    // Open the log file for the projects or create it if it does not exist.
-    let mut output_file = CSVFile::new(output_path, FileMode::Overwrite)?;
-
-    // Write the header.
-    let header: [&str; OUTPUT_COLS] = [
-        "id",
-        "path",
-        "name",
-        "position",
+    // The output files of the previous run are read before being overwritten.
+    let previous_content = |path: &str| -> Result<String> {
+        if incremental && Path::new(path).is_file() {
+            Ok(std::fs::read_to_string(path)?)
+        } else {
+            Ok(String::new())
+        }
+    };
+    let previous_output: String = previous_content(output_path)?;
+    let previous_logs: String = previous_content(logs_path)?;
+    let previous_generics: String = if generics {
+        previous_content(&generics_path)?
+    } else {
+        String::new()
+    };
+    let previous_errors: String = if syntax_errors {
+        previous_content(&syntax_errors_path)?
+    } else {
+        String::new()
+    };
+    let previous_tokens: String = if tokens {
+        previous_content(&tokens_path)?
+    } else {
+        String::new()
+    };
+    let previous_comments: String = if comments {
+        previous_content(&comments_path)?
+    } else {
+        String::new()
+    };
+    let previous_embeds: String = if embeds {
+        previous_content(&embeds_path)?
+    } else {
+        String::new()
+    };
+    let previous_directives: String = if directives {
+        previous_content(&directives_path)?
+    } else {
+        String::new()
+    };
+    let previous_unsafe: String = if unsafe_uses {
+        previous_content(&unsafe_path)?
+    } else {
+        String::new()
+    };
+    let previous_literals: String = if literals {
+        previous_content(&literals_path)?
+    } else {
+        String::new()
+    };
+    let previous_features: String = if features {
+        previous_content(&features_path)?
+    } else {
+        String::new()
+    };
+    let previous_visitors: Vec<String> = visitor_paths
+        .iter()
+        .map(|path| previous_content(path))
+        .collect::<Result<Vec<String>>>()?;
+
+    // The output files of a resumed run are truncated to their length at the checkpoint and appended to.
+    let mode: FileMode = if resume {
+        FileMode::Append
+    } else {
+        FileMode::Overwrite
+    };
+
+    // Open the log file for the projects or create it if it does not exist.
+    let mut output_file = CSVFile::new(output_path, mode)?;
+
+    // Write the header.
+    let header: [&str; OUTPUT_COLS] = [
+        "id",
+        "path",
+        "name",
+        "position",
         "language",
         "loc",
         "words",
@@ -327,10 +1335,35 @@ pub fn run(
         "return_kw_match",
         "parse_error",
     ];
+    let mut header: Vec<&str> = header.to_vec();
+    if cgo_policy == "record" {
+        header.push("cgo_refs");
+    }
+    if generated_policy == "tag" {
+        header.push("generated");
+    }
+    if vendored_policy == "tag" {
+        header.push("vendored");
+    }
+    if snippets {
+        header.push("snippet");
+    }
+    if build_configs.is_some() {
+        header.push("configurations");
+    }
+    if tests_policy == "tag" {
+        header.push("test");
+    }
+    if go_versions {
+        header.push("go_version");
+    }
+    if encodings {
+        header.extend(["encoding", "nul_bytes"]);
+    }
 
     output_file.write_header(&header)?;
 
-    let mut logs_file = CSVFile::new(logs_path, FileMode::Overwrite)?;
+    let mut logs_file = CSVFile::new(logs_path, mode)?;
 
     // Write the header.
     let logs_header: [&str; LOGS_COLS] = [
@@ -342,61 +1375,365 @@ pub fn run(
         &keyword_match_headers,
         "parse_error",
     ];
+    let mut logs_header: Vec<&str> = logs_header.to_vec();
+    if cgo_policy == "record" {
+        logs_header.push("cgo");
+    }
+    if generated_policy == "tag" {
+        logs_header.push("generated");
+    }
+    if vendored_policy == "tag" {
+        logs_header.push("vendored");
+    }
+    if snippets {
+        logs_header.push("snippet");
+    }
+    if build_configs.is_some() {
+        logs_header.push("configurations");
+    }
+    if tests_policy == "tag" {
+        logs_header.push("test");
+    }
+    if go_versions {
+        logs_header.push("go_version");
+    }
+    if encodings {
+        logs_header.extend(["encoding", "nul_bytes"]);
+    }
+    if incremental {
+        logs_header.push("hash");
+    }
+
+    // The columns of the output files, which identify the options of a run when it is resumed.
+    let columns: String = format!("{}\n{}", header.join(","), logs_header.join(","));
+    if let Some(checkpoint) = &checkpoint {
+        checkpoint.restore(&columns, &output_paths)?;
+    }
+
+    // The rows of the previous run are only reused if it wrote the same columns, i.e. if it ran with the same keywords and options.
+    let previous: HashMap<&str, PreviousRows> = if previous_logs.lines().next()
+        == Some(logs_header.join(",").as_str())
+        && previous_output.lines().next() == Some(header.join(",").as_str())
+        // Files parsed before a visitor was registered were not visited.
+        && previous_visitors.iter().all(|content| !content.is_empty())
+    {
+        previous_rows(
+            &previous_logs,
+            &previous_output,
+            &previous_generics,
+            &previous_errors,
+            &previous_tokens,
+            &previous_comments,
+            &previous_embeds,
+            &previous_directives,
+            &previous_unsafe,
+            &previous_literals,
+            &previous_features,
+            &previous_visitors,
+        )
+    } else {
+        if incremental && !previous_logs.is_empty() {
+            warn!("The output files of the previous run have different columns, all files are parsed again");
+        }
+        HashMap::new()
+    };
+    let reused: AtomicUsize = AtomicUsize::new(0);
+    let module_versions: GoVersions = GoVersions::new();
 
     logs_file.write_header(&logs_header)?;
 
-    let iter = Mutex::new(shuffled_rows.into_iter());
+    let mut generics_file: Option<CSVFile> = if generics {
+        let mut file = CSVFile::new(&generics_path, mode)?;
+        file.write_header(&["id", "path", "kind", "name", "position", "types"])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut syntax_errors_file: Option<CSVFile> = if syntax_errors {
+        let mut file = CSVFile::new(&syntax_errors_path, mode)?;
+        file.write_header(&["id", "path", "kind", "start", "end", "function", "text"])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut tokens_file: Option<CSVFile> = if tokens {
+        let mut file = CSVFile::new(&tokens_path, mode)?;
+        file.write_header(&[
+            "id", "path", "index", "kind", "named", "text", "start", "end",
+        ])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut comments_file: Option<CSVFile> = if comments {
+        let mut file = CSVFile::new(&comments_path, mode)?;
+        file.write_header(&[
+            "id",
+            "path",
+            "kind",
+            "target",
+            "target_kind",
+            "start",
+            "end",
+            "text",
+        ])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut embeds_file: Option<CSVFile> = if embeds {
+        let mut file = CSVFile::new(&embeds_path, mode)?;
+        let mut header: Vec<&str> = vec!["id", "path", "position", "variable", "pattern"];
+        if verify_embeds {
+            header.push("files");
+        }
+        file.write_header(&header)?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut directives_file: Option<CSVFile> = if directives {
+        let mut file = CSVFile::new(&directives_path, mode)?;
+        file.write_header(&[
+            "id",
+            "path",
+            "position",
+            "directive",
+            "arguments",
+            "target",
+            "target_kind",
+        ])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut unsafe_file: Option<CSVFile> = if unsafe_uses {
+        let mut file = CSVFile::new(&unsafe_path, mode)?;
+        file.write_header(&[
+            "id",
+            "path",
+            "position",
+            "kind",
+            "expression",
+            "function",
+            "cgo",
+        ])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut literals_file: Option<CSVFile> = if literals {
+        let mut file = CSVFile::new(&literals_path, mode)?;
+        file.write_header(&[
+            "id",
+            "path",
+            "position",
+            "kind",
+            "value",
+            "elements",
+            "type",
+            "inferred_from",
+            "name",
+        ])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut features_file: Option<CSVFile> = if features {
+        let mut file = CSVFile::new(&features_path, mode)?;
+        file.write_header(&["id", "path", "feature", "go_version", "uses", "position"])?;
+        Some(file)
+    } else {
+        None
+    };
+
+    let mut visitor_files: Vec<CSVFile> = visitors
+        .iter()
+        .zip(&visitor_paths)
+        .map(|(visitor, path)| {
+            let mut file = CSVFile::new(path, mode)?;
+            let columns: Vec<String> = visitor.columns();
+            let mut header: Vec<&str> = vec!["id", "path"];
+            header.extend(columns.iter().map(String::as_str));
+            file.write_header(&header)?;
+            Ok(file)
+        })
+        .collect::<Result<Vec<CSVFile>>>()?;
+
+    let units = Mutex::new(units.into_iter());
+
+    // Files are loaded in memory entirely, hence the hard limit.
+    let max_file_size: u64 = max_file_size.map_or(MEMORY_LIMIT, |size| size.min(MEMORY_LIMIT));
+    let file_timeout: Option<Duration> = file_timeout.map(Duration::from_secs);
+    let repo_timeout: Option<Duration> = repo_timeout.map(Duration::from_secs);
+    // Time spent on the files of every project, shared by the threads since the files are shuffled.
+    let repo_time: Mutex<HashMap<u32, Duration>> = Mutex::new(HashMap::new());
+
+    // Size of the results sent by the workers and not written yet, in bytes.
+    let buffered: AtomicUsize = AtomicUsize::new(0);
+    let max_memory: usize = max_memory.map_or(usize::MAX, |size| size as usize);
+
+    // Set when a worker fails or the results cannot be written, so that the other workers stop.
+    let aborted: AtomicBool = AtomicBool::new(false);
+
+    // Rank of the next file to write in the path order. The files ranked too far after it are not parsed yet,
+    // so that the results waiting for the files ranked before them are bounded.
+    let next_written: AtomicUsize = AtomicUsize::new(done);
+    let max_pending: usize = threads * PENDING_RESULTS_PER_WORKER;
+
+    // Parses a file, or reuses the rows of the previous run if it has not changed.
+    let process = |row: Result<(u32, String, &str), usize>| -> Result<_> {
+        let (project_id, file_name, language) =
+            row.map_err(|row_nr| anyhow!("Could not parse row {row_nr}"))?;
+        let hash: Option<String> = if incremental {
+            Some(content_hash(&file_name)?)
+        } else {
+            None
+        };
+        if let Some(rows) = hash.as_ref().and_then(|hash| {
+            previous
+                .get(escape_path(&file_name).as_str())
+                .filter(|rows| rows.hash == *hash)
+        }) {
+            reused.fetch_add(1, Ordering::Relaxed);
+            return Ok(FileRows {
+                stats: FileStats {
+                    project_id,
+                    package: package_of(&file_name).to_string(),
+                    reused: true,
+                    ..Default::default()
+                },
+                output: rows.output.to_string(),
+                log: Some(rows.log.to_string()),
+                generics: rows.generics.to_string(),
+                errors: rows.errors.to_string(),
+                tokens: rows.tokens.to_string(),
+                comments: rows.comments.to_string(),
+                embeds: rows.embeds.to_string(),
+                directives: rows.directives.to_string(),
+                unsafe_uses: rows.unsafe_uses.to_string(),
+                literals: rows.literals.to_string(),
+                features: rows.features.to_string(),
+                visitors: rows.visitors.clone(),
+            });
+        }
+        // The functions extracted from a previous version of the file are stale.
+        if hash.is_some() {
+            delete_dir(format!("{file_name}.functions"), true)?;
+        }
+        // The budget of the file is bounded by the time left to its project.
+        let start: Instant = Instant::now();
+        let spent: Duration = repo_time
+            .lock()
+            .unwrap()
+            .get(&project_id)
+            .copied()
+            .unwrap_or_default();
+        let budget: Option<Duration> =
+            [file_timeout, repo_timeout.map(|t| t.saturating_sub(spent))]
+                .into_iter()
+                .flatten()
+                .min();
+        let mut rows: FileRows = analyze_file(
+            project_id,
+            &file_name,
+            language,
+            &keyword_files,
+            fail_policy,
+            ignore_comments,
+            &word_counter,
+            cgo_policy,
+            generics,
+            syntax_errors,
+            generated_policy,
+            vendored_policy == "tag",
+            snippets,
+            build_configs.as_deref(),
+            tests_policy == "tag",
+            go_versions.then_some(&module_versions),
+            encodings,
+            ast_cache,
+            tokens,
+            comments,
+            embeds,
+            verify_embeds,
+            directives,
+            unsafe_uses,
+            literals,
+            features,
+            &visitors,
+            budget.map(|b| start + b),
+            max_file_size,
+        )?;
+        if let Some(hash) = &hash {
+            rows.log = rows.log.map(|log| format!("{log},{hash}"));
+        }
+        rows.stats.project_id = project_id;
+        rows.stats.package = package_of(&file_name).to_string();
+        rows.stats.time = start.elapsed();
+        *repo_time.lock().unwrap().entry(project_id).or_default() += rows.stats.time;
+        Ok(rows)
+    };
 
     // Every thread comes with a sender channel.
     // The sender channel is used to send information about the extracted functions back to the main thread.
     // The receiver channel is used by the main thread to collect and write the information to the log file.
+    // The channel is bounded, so that the memory taken by the results waiting to be written is bounded for every worker.
     let (tx, rx) =
-        crossbeam_channel::unbounded::<Option<Result<(String, Option<String>), Error>>>();
+        crossbeam_channel::bounded::<Option<(usize, Result<FileRows, Error>)>>(max_pending);
 
     crossbeam::thread::scope(|s| {
         for _ in 0..threads {
             s.spawn(|_| {
                 let my_tx = tx.clone();
                 // The main loop of the thread.
-                // Download the repositories until the iterator is empty.
-                loop {
-                    // Lock the repository iterator and retrieve the next item.
-                    let next_item: Option<Result<(u32, String, &str), usize>> = {
-                        let mut iter_guard = iter.lock().unwrap();
-                        iter_guard.next()
+                // Parse the work units until the iterator is empty or a thread fails.
+                'units: while !aborted.load(Ordering::Relaxed) {
+                    // Wait for the results waiting to be written to fit in the memory budget before taking a new unit.
+                    // The units are taken in the order of the output files, so the unit of the next file to write is
+                    // already taken and its worker keeps sending results until the writer catches up.
+                    while buffered.load(Ordering::Relaxed) > max_memory {
+                        if aborted.load(Ordering::Relaxed) {
+                            break 'units;
+                        }
+                        std::thread::sleep(BUFFER_POLL_INTERVAL);
+                    }
+                    // Lock the unit iterator and retrieve the next unit.
+                    let Some(unit) = units.lock().unwrap().next() else {
+                        break;
                     };
-
-                    match next_item {
-                        Some(row) => match row {
-                            Ok((project_id, file_name, language)) => match analyze_file(
-                                project_id,
-                                &file_name,
-                                language,
-                                &keyword_files,
-                                fail_policy,
-                                ignore_comments,
-                                &word_counter,
-                            ) {
-                                Ok(s) => {
-                                    my_tx.send(Some(Ok(s))).unwrap();
-                                }
-                                Err(e) => {
-                                    my_tx.send(Some(Err(e))).unwrap();
-                                    break;
-                                }
-                            },
-                            Err(row_nr) => {
-                                let _ =
-                                    my_tx.send(Some(Err(anyhow!("Could not parse row {row_nr}"))));
+                    for (rank, row) in unit {
+                        // The file ranked next is always parsed, so that the writer keeps catching up.
+                        while order != "random"
+                            && rank >= next_written.load(Ordering::Relaxed) + max_pending
+                        {
+                            if aborted.load(Ordering::Relaxed) {
+                                break 'units;
                             }
-                        },
-                        None => {
-                            // When the iterator is empty, sends a None message to the main thread to signal the end of the thread.
-                            my_tx.send(None).unwrap();
-                            break;
+                            std::thread::sleep(BUFFER_POLL_INTERVAL);
+                        }
+                        let res = process(row);
+                        let failed: bool = res.is_err();
+                        if let Ok(rows) = &res {
+                            buffered.fetch_add(rows.size(), Ordering::Relaxed);
+                        }
+                        my_tx.send(Some((rank, res))).unwrap();
+                        if failed {
+                            aborted.store(true, Ordering::Relaxed);
+                            break 'units;
                         }
                     }
                 }
+                // Sends a None message to the main thread to signal the end of the thread.
+                my_tx.send(None).unwrap();
             });
         }
 
@@ -406,18 +1743,126 @@ pub fn run(
         progress.set_style(
             indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
         );
-
-        // Writes received messages to the log file.
-        // The order is therefore non-deterministic although the list of projects is.
+        progress.set_position(done as u64);
+
+        // Writes received messages to the output files.
+        // With the path order, the rows of a file wait until the files ranked before it have been written.
+        // After an error, the messages of the other workers are drained until they stop, so that none of them blocks on the channel.
+        let mut error: Option<Error> = None;
+        let mut pending: BTreeMap<usize, FileRows> = BTreeMap::new();
+        let mut next_rank: usize = done;
+        let mut last_checkpoint: Instant = Instant::now();
+        // The statistics of a resumed run start from those of the files written before its checkpoint.
+        let mut project_stats: Option<BTreeMap<u32, RepoStats>> = repo_stats.then(|| {
+            checkpoint
+                .as_ref()
+                .and_then(|checkpoint| checkpoint.stats.clone())
+                .unwrap_or_default()
+        });
+        // Writes the rows of a file, and saves a checkpoint from time to time if the number of files written so far is given.
+        let mut write_rows = |rows: FileRows, written: Option<usize>| -> Result<()> {
+            buffered.fetch_sub(rows.size(), Ordering::Relaxed);
+            if let Some(project_stats) = project_stats.as_mut() {
+                project_stats
+                    .entry(rows.stats.project_id)
+                    .or_default()
+                    .add(rows.stats);
+            }
+            write!(&mut output_file, "{}", rows.output)?;
+            if let Some(file) = generics_file.as_mut() {
+                write!(file, "{}", rows.generics)?;
+            }
+            if let Some(file) = syntax_errors_file.as_mut() {
+                write!(file, "{}", rows.errors)?;
+            }
+            if let Some(file) = tokens_file.as_mut() {
+                write!(file, "{}", rows.tokens)?;
+            }
+            if let Some(file) = comments_file.as_mut() {
+                write!(file, "{}", rows.comments)?;
+            }
+            if let Some(file) = embeds_file.as_mut() {
+                write!(file, "{}", rows.embeds)?;
+            }
+            if let Some(file) = directives_file.as_mut() {
+                write!(file, "{}", rows.directives)?;
+            }
+            if let Some(file) = unsafe_file.as_mut() {
+                write!(file, "{}", rows.unsafe_uses)?;
+            }
+            if let Some(file) = literals_file.as_mut() {
+                write!(file, "{}", rows.literals)?;
+            }
+            if let Some(file) = features_file.as_mut() {
+                write!(file, "{}", rows.features)?;
+            }
+            for (file, rows) in visitor_files.iter_mut().zip(&rows.visitors) {
+                write!(file, "{rows}")?;
+            }
+            if let Some(log) = rows.log {
+                writeln!(&mut logs_file, "{log}")?;
+            }
+            if let Some(written) = written {
+                if last_checkpoint.elapsed() >= CHECKPOINT_INTERVAL {
+                    output_file.flush()?;
+                    logs_file.flush()?;
+                    for file in [
+                        &mut generics_file,
+                        &mut syntax_errors_file,
+                        &mut tokens_file,
+                        &mut comments_file,
+                        &mut embeds_file,
+                        &mut directives_file,
+                        &mut unsafe_file,
+                        &mut literals_file,
+                        &mut features_file,
+                    ]
+                    .into_iter()
+                    .flatten()
+                    {
+                        file.flush()?;
+                    }
+                    for file in visitor_files.iter_mut() {
+                        file.flush()?;
+                    }
+                    Checkpoint::new(
+                        written,
+                        n_files,
+                        &columns,
+                        &output_paths,
+                        project_stats.as_ref(),
+                    )?
+                    .write(&checkpoint_path)?;
+                    last_checkpoint = Instant::now();
+                }
+            }
+            Ok(())
+        };
         while let Ok(msg) = rx.recv() {
             match msg {
-                Some(msg_content) => {
-                    let (output, opt_log) = msg_content?;
-                    write!(&mut output_file, "{output}")?;
-                    if let Some(log) = opt_log {
-                        writeln!(&mut logs_file, "{log}")?;
+                Some((rank, msg_content)) => {
+                    if error.is_some() {
+                        continue;
+                    }
+                    let written = msg_content.and_then(|rows| -> Result<()> {
+                        if order == "random" {
+                            return write_rows(rows, None);
+                        }
+                        pending.insert(rank, rows);
+                        while let Some(rows) = pending.remove(&next_rank) {
+                            next_rank += 1;
+                            write_rows(rows, Some(next_rank))?;
+                            next_written.store(next_rank, Ordering::Relaxed);
+                        }
+                        Ok(())
+                    });
+                    match written {
+                        Ok(()) => progress.inc(1),
+                        Err(e) => {
+                            aborted.store(true, Ordering::Relaxed);
+                            error = Some(e);
+                        }
                     }
-                    progress.inc(1);
                 }
                 None => {
                     // When a None message is received, the sender thread is considered finished.
@@ -430,961 +1875,3801 @@ pub fn run(
             }
         }
         progress.finish();
+        if let Some(e) = error {
+            return Err(e);
+        }
+        if let Some(project_stats) = &project_stats {
+            write_repo_stats(&repo_stats_path, project_stats)?;
+        }
+        if incremental {
+            info!(
+                "  {} files unchanged since the previous run",
+                reused.load(Ordering::Relaxed)
+            );
+        }
         Ok(())
     })
-    .map_err(|e| anyhow!("Error in thread pool: {e:?}"))?
+    .map_err(|e| anyhow!("Error in thread pool: {e:?}"))??;
+
+    // The run is complete and cannot be resumed anymore.
+    if Path::new(&checkpoint_path).exists() {
+        std::fs::remove_file(&checkpoint_path)
+            .with_context(|| format!("Could not remove {checkpoint_path}"))?;
+    }
+    Ok(())
 }
 
-/// Analyze a file and extract the functions whose body contains one of the provided keywords.
-/// Returns statistics about the functions.
-///
-/// # Arguments
-///
-/// * `project_id` - The id of the project to which the file belongs.
-/// * `path` - The path to the file to analyze.
-/// * `language` - The language of the file.
-/// * `keywords_files` - The files containing the list of keywords to search for in the functions.
-/// * `fail_policy` - The policy to apply when a parse error is encountered.
-/// * `ignore_comments` - Whether to ignore comments when extracting functions, in addition to ignoring them during keyword matching.
-/// * `word_counter` - The matcher to use to count the words in the functions.
-/// # Returns
-///
-/// A string containing the statistics of the functions in the file. Specifically:
-/// * The path to the file containing the function.
-/// * The number of lines of code.
-/// * The number of words.
-/// * The number of keywords matched.
-/// * The number of loops.
-/// * The maximum loop nesting level.
-/// * The number of conditional statements.
-/// * The maximum conditional nesting level.
-///
-fn analyze_file(
-    project_id: u32,
-    path: &str,
-    language: &str,
-    keywords_files: &KeywordFiles,
-    fail_policy: &str,
-    ignore_comments: bool,
-    word_counter: &Matcher,
-) -> Result<(String, Option<String>)> {
-    let grammar = language_to_grammar(language)
-        .with_context(|| format!("Unsupported language: {language}"))?;
-    // Initializes the parser
-    let mut parser: Parser = Parser::new();
-    parser.set_language(&grammar.lang)?;
-    match load_file(path, 1024 * 1024 * 1024)? {
-        Ok(source_code) => {
-            // Creates a folder to store the functions of the file
-            let target_folder: String = format!("{path}.functions");
-            create_dir(&target_folder)?;
-
-            // Parses the source code of the file
-            let tree: Tree = parser
-                .parse(&source_code, None)
-                .with_context(|| format!("Failed to parse file {path}"))?;
-
-            let file_has_parse_error: bool = tree.root_node().has_error();
-
-            if file_has_parse_error && fail_policy == "skip-file" {
-                Ok((String::new(), None))
-            } else if file_has_parse_error && fail_policy == "abort" {
-                bail!("Parse error in file {path}")
-            } else {
-                let root: Node<'_> = tree.root_node();
-                let (output, total_functions, functions_with_kw, functions_with_specific_kw) =
-                    extract_functions(
-                        project_id,
-                        &root,
-                        &target_folder,
-                        language,
-                        &grammar,
-                        &source_code,
-                        keywords_files,
-                        fail_policy,
-                        ignore_comments,
-                        word_counter,
-                        &mut parser,
-                    )?;
+/// Progress of a run in the path order, saved from time to time so that it can be resumed if it is interrupted.
+#[derive(Debug, PartialEq, Eq)]
+struct Checkpoint {
+    /// The number of files written, which are the first ones in the output order.
+    files: usize,
+    /// The number of files of the run.
+    total: usize,
+    /// The columns of the output and logs files, which identify the options of the run.
+    columns: String,
+    /// The length of every output file, in bytes, once the rows of the files written have been flushed.
+    lengths: BTreeMap<String, u64>,
+    /// The statistics of the projects of the files written, if the run writes them.
+    stats: Option<BTreeMap<u32, RepoStats>>,
+}
 
-                let error_position: String = if file_has_parse_error {
-                    position_to_string(find_first_error_position(&root))
-                } else {
-                    "none".to_string()
-                };
+impl Checkpoint {
+    /// Creates a checkpoint from the current length of the output files, whose rows must have been flushed.
+    ///
+    /// # Arguments
+    ///
+    /// * `files` - The number of files written.
+    /// * `total` - The number of files of the run.
+    /// * `columns` - The columns of the output and logs files.
+    /// * `paths` - The paths of the output files.
+    /// * `stats` - The statistics of the projects of the files written, if the run writes them.
+    fn new(
+        files: usize,
+        total: usize,
+        columns: &str,
+        paths: &[&str],
+        stats: Option<&BTreeMap<u32, RepoStats>>,
+    ) -> Result<Self> {
+        Ok(Checkpoint {
+            files,
+            total,
+            columns: columns.to_string(),
+            lengths: paths
+                .iter()
+                .map(|path| {
+                    let length: u64 = std::fs::metadata(path)
+                        .with_context(|| format!("Could not fetch metadata for file {path}"))?
+                        .len();
+                    Ok((path.to_string(), length))
+                })
+                .collect::<Result<_>>()?,
+            stats: stats.cloned(),
+        })
+    }
 
-                Ok((
-                    output,
-                    Some(format!(
-                        "{},{},{},{},{},{},{}",
-                        project_id,
-                        path.replace(",", "-was_comma-")
-                            .replace("\"", "-was_quote-"),
-                        language,
-                        total_functions,
-                        functions_with_kw,
-                        functions_with_specific_kw
-                            .iter()
-                            .map(|x| x.to_string())
-                            .collect::<Vec<String>>()
-                            .join(","),
-                        error_position,
-                    )),
-                ))
+    /// Reads a checkpoint from a JSON file.
+    fn read(path: &str) -> Result<Self> {
+        let checkpoint: json::JsonValue = open_json_from_path(path)?;
+        Ok(Checkpoint {
+            files: get_field::<u64>(&checkpoint, "files")? as usize,
+            total: get_field::<u64>(&checkpoint, "total")? as usize,
+            columns: get_field::<String>(&checkpoint, "columns")?,
+            lengths: checkpoint["lengths"]
+                .entries()
+                .map(|(file, length)| {
+                    let length: u64 = length
+                        .as_u64()
+                        .with_context(|| format!("Invalid length of {file} in {path}"))?;
+                    Ok((file.to_string(), length))
+                })
+                .collect::<Result<_>>()?,
+            stats: if checkpoint["stats"].is_null() {
+                None
+            } else {
+                Some(
+                    checkpoint["stats"]
+                        .entries()
+                        .map(|(id, stats)| {
+                            let id: u32 = id
+                                .parse()
+                                .with_context(|| format!("Invalid project id {id} in {path}"))?;
+                            Ok((id, RepoStats::from_json(stats)?))
+                        })
+                        .collect::<Result<_>>()?,
+                )
+            },
+        })
+    }
+
+    /// Writes the checkpoint to a JSON file. The file is replaced atomically, so that the previous checkpoint is kept
+    /// if the run is interrupted while it is written.
+    fn write(&self, path: &str) -> Result<()> {
+        let mut lengths = json::JsonValue::new_object();
+        for (file, length) in &self.lengths {
+            lengths[file.as_str()] = (*length).into();
+        }
+        let mut checkpoint = json::object! {
+            files: self.files,
+            total: self.total,
+            columns: self.columns.as_str(),
+            lengths: lengths,
+        };
+        if let Some(stats) = &self.stats {
+            let mut projects = json::JsonValue::new_object();
+            for (id, stats) in stats {
+                projects[id.to_string().as_str()] = stats.to_json();
             }
+            checkpoint["stats"] = projects;
         }
+        let tmp_path: String = format!("{path}.tmp");
+        write_file(&tmp_path, json::stringify(checkpoint))?;
+        std::fs::rename(&tmp_path, path).with_context(|| format!("Could not replace {path}"))
+    }
 
-        // If the file is too large, return an error row
-        Err(_) => Ok((
-            String::new(),
-            Some(file_error_row(
-                project_id,
-                path,
-                language,
-                keywords_files,
-                "none",
-            )),
-        )),
+    /// Truncates the output files to their length at the checkpoint, removing the rows of the files written after it.
+    ///
+    /// # Arguments
+    ///
+    /// * `columns` - The columns of the output and logs files of the resumed run.
+    /// * `paths` - The paths of the output files of the resumed run.
+    fn restore(&self, columns: &str, paths: &[&str]) -> Result<()> {
+        ensure!(
+            self.columns == columns
+                && self.lengths.len() == paths.len()
+                && paths.iter().all(|path| self.lengths.contains_key(*path)),
+            "The checkpoint was saved by a run with other options or output files"
+        );
+        for (path, length) in &self.lengths {
+            let file: std::fs::File = std::fs::OpenOptions::new()
+                .write(true)
+                .open(path)
+                .with_context(|| format!("Could not open {path}"))?;
+            ensure!(
+                file.metadata()?.len() >= *length,
+                "{path} is shorter than when the checkpoint was saved"
+            );
+            file.set_len(*length)
+                .with_context(|| format!("Could not truncate {path}"))?;
+        }
+        Ok(())
     }
 }
 
-fn file_error_row(
+/// Kinds of filters selecting the files to parse, in the order in which they are evaluated.
+const FILE_FILTERS: [&str; 4] = ["path", "extension", "depth", "size"];
+
+/// Filters selecting the files to parse in the input file, evaluated before any file is parsed.
+struct FileFilter {
+    /// Patterns of the paths of the files to parse, if they are restricted.
+    included: Option<Vec<Regex>>,
+    /// Patterns of the paths of the files not to parse.
+    excluded: Vec<Regex>,
+    /// Suffixes of the names of the files to parse, made of a dot and an extension, if they are restricted.
+    extensions: Option<Vec<String>>,
+    /// Minimum size of the files to parse, in bytes.
+    min_size: u64,
+    /// Maximum size of the files to parse, in bytes.
+    max_size: u64,
+    /// Maximum number of directories in which the files to parse are nested within their project.
+    max_depth: usize,
+}
+
+impl FileFilter {
+    /// Creates the filters from the options of the command line.
+    ///
+    /// # Arguments
+    ///
+    /// * `paths` - Optional patterns of the paths of the files to parse, globs or regexes prefixed with `re:`.
+    /// * `excluded_paths` - Optional patterns of the paths of the files not to parse.
+    /// * `extensions` - Optional extensions of the files to parse, with or without their leading dot.
+    /// * `min_size` - Optional minimum size of the files to parse, in bytes.
+    /// * `max_size` - Optional maximum size of the files to parse, in bytes.
+    /// * `max_depth` - Optional maximum depth of the files to parse within their project.
+    fn new(
+        paths: Option<Vec<&str>>,
+        excluded_paths: Option<Vec<&str>>,
+        extensions: Option<Vec<&str>>,
+        min_size: Option<u64>,
+        max_size: Option<u64>,
+        max_depth: Option<usize>,
+    ) -> Result<Self> {
+        let matchers = |patterns: Vec<&str>| -> Result<Vec<Regex>> {
+            patterns.into_iter().map(path_matcher).collect()
+        };
+        Ok(FileFilter {
+            included: paths.map(matchers).transpose()?,
+            excluded: matchers(excluded_paths.unwrap_or_default())?,
+            extensions: extensions.map(|extensions| {
+                extensions
+                    .into_iter()
+                    .map(|ext| format!(".{}", ext.trim_start_matches('.')))
+                    .collect()
+            }),
+            min_size: min_size.unwrap_or(0),
+            max_size: max_size.unwrap_or(u64::MAX),
+            max_depth: max_depth.unwrap_or(usize::MAX),
+        })
+    }
+
+    /// Returns the kind of the first filter not matched by a file (see `FILE_FILTERS`), or None if the file is kept.
+    /// The size of the file is only read if it matches the other filters. Files whose size cannot be read are kept.
+    fn skipped_by(&self, project_id: u32, path: &str) -> Option<&'static str> {
+        let name: &str = path.rsplit_once('/').map_or(path, |(_, name)| name);
+        if !self
+            .included
+            .as_ref()
+            .is_none_or(|included| included.iter().any(|re| re.is_match(path.as_bytes())))
+            || self.excluded.iter().any(|re| re.is_match(path.as_bytes()))
+        {
+            Some("path")
+        } else if !self.extensions.as_ref().is_none_or(|extensions| {
+            extensions
+                .iter()
+                .any(|ext| name.len() > ext.len() && name.ends_with(ext.as_str()))
+        }) {
+            Some("extension")
+        } else if project_depth(project_id, path) > self.max_depth {
+            Some("depth")
+        } else if (self.min_size > 0 || self.max_size < u64::MAX)
+            && std::fs::metadata(path)
+                .is_ok_and(|metadata| !(self.min_size..=self.max_size).contains(&metadata.len()))
+        {
+            Some("size")
+        } else {
+            None
+        }
+    }
+}
+
+/// Returns the number of directories in which a file is nested within its project.
+/// The directory of a project is the first directory of the path named after its id followed by a dash, as created by
+/// the download subcommand (e.g. `dl/0/42-abcdef`). The depth of the paths without such a directory is their number of directories.
+fn project_depth(project_id: u32, path: &str) -> usize {
+    let prefix: String = format!("{project_id}-");
+    let dirs: Vec<&str> = path
+        .split('/')
+        .filter(|dir| !dir.is_empty() && *dir != ".")
+        .collect();
+    let dirs: &[&str] = dirs.split_last().map_or(&[], |(_, dirs)| dirs);
+    let root: usize = dirs
+        .iter()
+        .position(|dir| dir.starts_with(&prefix))
+        .map_or(0, |idx| idx + 1);
+    dirs.len() - root
+}
+
+/// Rows written for a file to the output files.
+#[derive(Debug, Default)]
+struct FileRows {
+    /// The rows of the functions of the file, each terminated by a newline.
+    output: String,
+    /// The row of the file in the logs file, if it is recorded.
+    log: Option<String>,
+    /// The rows of the generic declarations and instantiation sites of the file, if they are extracted.
+    generics: String,
+    /// The rows of the syntax errors of the file, if they are listed.
+    errors: String,
+    /// The rows of the tokens of the file, if they are exported.
+    tokens: String,
+    /// The rows of the comments of the file, if they are extracted.
+    comments: String,
+    /// The rows of the `//go:embed` directives of the file, if they are extracted.
+    embeds: String,
+    /// The rows of the `//go:` directives of the file, if they are extracted.
+    directives: String,
+    /// The rows of the unsafe uses of the file, if they are extracted.
+    unsafe_uses: String,
+    /// The rows of the literals of the file, if they are extracted.
+    literals: String,
+    /// The rows of the language features used by the file, if they are detected.
+    features: String,
+    /// The rows of every registered visitor for the file, empty if the file was not visited.
+    visitors: Vec<String>,
+    /// The statistics of the file, aggregated by project.
+    stats: FileStats,
+}
+
+/// Statistics of a file, aggregated with those of the other files of its project.
+#[derive(Debug, Default, PartialEq, Eq)]
+struct FileStats {
+    /// The id of the project of the file.
     project_id: u32,
-    path: &str,
-    language: &str,
-    keyword_files: &KeywordFiles,
-    parse_error: &str,
-) -> String {
-    format!(
-        "{},{},{},-1,-1,{},{}",
-        project_id,
-        path.replace(",", "-was_comma-")
-            .replace("\"", "-was_quote-"),
-        language,
-        keyword_files
-            .paths
-            .iter()
-            .map(|_| "-1".to_string())
-            .collect::<Vec<String>>()
-            .join(","),
-        parse_error,
-    )
+    /// The package of the file, i.e. its directory.
+    package: String,
+    /// Whether the file was not parsed, or its functions not extracted (e.g. because of a timeout or a syntax error).
+    skipped: bool,
+    /// Whether the rows of the file were reused from the previous run.
+    reused: bool,
+    /// Whether the file has syntax errors.
+    parse_error: bool,
+    /// The number of lines of the file, if it was parsed.
+    loc: usize,
+    /// The time spent on the file.
+    time: Duration,
 }
 
-/// Extracts the functions from a subtree of a source file and writes them to individual files
-/// if they contain one of the provided keywords. Returns statistics about all the functions
-/// in the subtree.
-///
+/// Statistics of the files of a project.
+#[derive(Debug, Default, Clone, PartialEq, Eq)]
+struct RepoStats {
+    /// The number of files of the project.
+    files: usize,
+    /// The number of files skipped.
+    skipped: usize,
+    /// The number of files whose rows were reused from the previous run.
+    reused: usize,
+    /// The packages of the project.
+    packages: HashSet<String>,
+    /// The number of lines of the files parsed.
+    loc: usize,
+    /// The number of files with syntax errors.
+    parse_errors: usize,
+    /// The time spent on the files of the project.
+    time: Duration,
+}
+
+impl RepoStats {
+    /// Adds the statistics of a file of the project.
+    fn add(&mut self, file: FileStats) {
+        self.files += 1;
+        self.skipped += usize::from(file.skipped);
+        self.reused += usize::from(file.reused);
+        self.loc += file.loc;
+        self.parse_errors += usize::from(file.parse_error);
+        self.time += file.time;
+        self.packages.insert(file.package);
+    }
+
+    /// Converts the statistics to JSON, to save them in a checkpoint. The time is recorded in nanoseconds.
+    fn to_json(&self) -> json::JsonValue {
+        let mut packages: Vec<&str> = self.packages.iter().map(String::as_str).collect();
+        packages.sort_unstable();
+        json::object! {
+            files: self.files,
+            skipped: self.skipped,
+            reused: self.reused,
+            packages: packages,
+            loc: self.loc,
+            parse_errors: self.parse_errors,
+            time: self.time.as_nanos() as u64,
+        }
+    }
+
+    /// Reads the statistics saved in a checkpoint.
+    fn from_json(stats: &json::JsonValue) -> Result<Self> {
+        Ok(RepoStats {
+            files: get_field::<u64>(stats, "files")? as usize,
+            skipped: get_field::<u64>(stats, "skipped")? as usize,
+            reused: get_field::<u64>(stats, "reused")? as usize,
+            packages: stats["packages"]
+                .members()
+                .map(|package| {
+                    package
+                        .as_str()
+                        .map(str::to_string)
+                        .with_context(|| format!("Invalid package {package}"))
+                })
+                .collect::<Result<_>>()?,
+            loc: get_field::<u64>(stats, "loc")? as usize,
+            parse_errors: get_field::<u64>(stats, "parse_errors")? as usize,
+            time: Duration::from_nanos(get_field::<u64>(stats, "time")?),
+        })
+    }
+}
+
+/// Writes the statistics of every project to a CSV file, ordered by project id.
+fn write_repo_stats(path: &str, projects: &BTreeMap<u32, RepoStats>) -> Result<()> {
+    let mut file = CSVFile::new(path, FileMode::Overwrite)?;
+    file.write_header(&[
+        "id",
+        "files",
+        "parsed",
+        "skipped",
+        "reused",
+        "packages",
+        "loc",
+        "parse_errors",
+        "time",
+    ])?;
+    for (id, stats) in projects {
+        writeln!(
+            file,
+            "{id},{},{},{},{},{},{},{},{:.3}",
+            stats.files,
+            stats.files - stats.skipped - stats.reused,
+            stats.skipped,
+            stats.reused,
+            stats.packages.len(),
+            stats.loc,
+            stats.parse_errors,
+            stats.time.as_secs_f64()
+        )?;
+    }
+    Ok(())
+}
+
+/// Files having the same content, parsed once under the path of the original.
+#[derive(Debug, PartialEq, Eq)]
+struct DuplicateGroup {
+    /// The index of the parsed file in the input file.
+    original: usize,
+    /// The hash of the content of the files.
+    hash: String,
+    /// The number of aliases of the original.
+    aliases: usize,
+    /// The number of aliases in the project of the original.
+    within: usize,
+    /// The number of other projects having an alias of the original.
+    projects: usize,
+}
+
+/// Groups the aliases of the files having the same content by their original, the most duplicated files first
+/// and then in the output order of their first alias.
 ///
 /// # Arguments
 ///
-/// * project_id - The id of the project to which the file belongs.
-/// * `root` - The root node of the subtree.
-/// * `target_folder` - The folder where the functions are stored.
-/// * `language` - The language of the source file.
-/// * `grammar` - The grammar of the language.
-/// * `source` - The source code of the source file.
-/// * `keyword_files` - The keyword files containing the keywords to search for in the functions.
-/// * `fail_policy` - The policy to apply when a parse error is encountered.
-/// * `ignore_comments` - Whether to ignore comments when extracting functions, in addition to ignoring them during keyword matching.
-/// * `word_counter` - The matcher to use to count the words in the functions.
-/// * `parser` - The parser to use to parse the functions.
-///
-/// # Returns
-///
-/// A tuple containing the statistics of the functions in the file and the function number after processing the file node
-///
-fn extract_functions(
-    project_id: u32,
-    root: &Node,
-    target_folder: &str,
-    language: &str,
-    grammar: &Grammar,
-    source: &[u8],
-    keyword_files: &KeywordFiles,
-    fail_policy: &str,
-    ignore_comments: bool,
-    word_counter: &Matcher,
-    parser: &mut Parser,
-) -> Result<(String, usize, usize, Vec<usize>), Error> {
-    // Initializes the builder to store the statistics of the functions in the file
-    let mut builder: String = String::new();
-    let mut functions: usize = 0;
-    let mut functions_with_kw: usize = 0;
-    let mut functions_with_specific_kw: Vec<usize> = vec![0; keyword_files.paths.len()];
-
-    // Simulating call stack
-    let mut call_stack: Vec<Node> = Vec::new();
-    call_stack.push(*root);
-    let mut cursor = root.walk();
-
-    while let Some(node) = call_stack.pop() {
-        if grammar.function_nodes.contains(node.kind()) {
-            let has_error: bool = node.has_error();
-
-            if (has_error && fail_policy == "skip-function")
-                || (language == "java" && find_fields(&node, "body").is_empty())
-            {
-                continue;
-            } else {
-                // Function source code
-                let function_source_code: &[u8] = node_source_code(&node, source);
-                let function_position: (usize, usize) = (
-                    node.start_position().row + 1,
-                    node.start_position().column + 1,
-                );
-
-                let error_position: String = if has_error {
-                    position_to_string(find_first_error_position(&node).map(|(row, col)| {
-                        let error_row = row - function_position.0 + 1;
-                        if row == function_position.0 {
-                            (error_row, col - function_position.1 + 1)
-                        } else {
-                            (error_row, col)
-                        }
-                    }))
-                } else {
-                    "none".to_string()
-                };
-
-                // Fetch the code of the function and remove comments from it
-                let function_code_with_strings: &Vec<u8> =
-                    &remove_kind_from_source(function_source_code, &node, &grammar.comment_nodes);
-                // Re parse the function without comments to get the correct tree
-                let tree_without_comments: Tree = parser
-                    .parse(function_code_with_strings, None)
-                    .with_context(|| {
-                        format!("Error parsing code for function {target_folder}/{functions}")
-                    })?;
-
-                // Remove string literals from the function code
-                let function_code = &remove_kind_from_source(
-                    function_code_with_strings,
-                    &tree_without_comments.root_node(),
-                    &grammar.string_literal_nodes,
-                );
+/// * `ids` - The project ids of the files.
+/// * `aliases` - The index of every alias with the index of its original and their hash, as returned by `content_aliases`.
+fn duplicate_groups(ids: &[u32], aliases: &[(usize, usize, String)]) -> Vec<DuplicateGroup> {
+    let mut groups: Vec<DuplicateGroup> = Vec::new();
+    // The index of the group of every original, and the other projects having one of its aliases.
+    let mut group_of: HashMap<usize, (usize, HashSet<u32>)> = HashMap::new();
+    for (alias, original, hash) in aliases {
+        let (group, projects) = group_of.entry(*original).or_insert_with(|| {
+            groups.push(DuplicateGroup {
+                original: *original,
+                hash: hash.clone(),
+                aliases: 0,
+                within: 0,
+                projects: 0,
+            });
+            (groups.len() - 1, HashSet::new())
+        });
+        let group: &mut DuplicateGroup = &mut groups[*group];
+        group.aliases += 1;
+        if ids[*alias] == ids[*original] {
+            group.within += 1;
+        } else if projects.insert(ids[*alias]) {
+            group.projects += 1;
+        }
+    }
+    // The sort is stable, hence groups with the same number of aliases stay in the output order.
+    groups.sort_by_key(|group| std::cmp::Reverse(group.aliases));
+    groups
+}
 
-                let matches: Vec<usize> =
-                    keyword_files.count_matches_in_text(language, function_code);
+/// Writes the files having the same content as another one, one row per parsed file, the most duplicated files first.
+fn write_dedup_report(
+    path: &str,
+    ids: &[u32],
+    names: &[&str],
+    groups: &[DuplicateGroup],
+) -> Result<()> {
+    let mut file = CSVFile::new(path, FileMode::Overwrite)?;
+    file.write_header(&[
+        "id", "path", "hash", "aliases", "within", "across", "projects",
+    ])?;
+    for group in groups {
+        writeln!(
+            file,
+            "{},{},{},{},{},{},{}",
+            ids[group.original],
+            names[group.original],
+            group.hash,
+            group.aliases,
+            group.within,
+            group.aliases - group.within,
+            group.projects
+        )?;
+    }
+    Ok(())
+}
 
-                if matches.iter().any(|x| *x > 0) {
-                    let function_path: String = format!(
-                        "{}/{}-{}",
-                        target_folder, function_position.0, function_position.1
-                    );
+/// Returns the package of a file, i.e. the directory containing it.
+fn package_of(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
 
-                    std::fs::write(
-                        &function_path,
-                        if ignore_comments {
-                            function_code_with_strings
-                        } else {
-                            function_source_code
-                        },
-                    )?;
+impl FileRows {
+    /// Returns the size of the rows, in bytes.
+    fn size(&self) -> usize {
+        [
+            &self.output,
+            &self.generics,
+            &self.errors,
+            &self.tokens,
+            &self.comments,
+            &self.embeds,
+            &self.directives,
+            &self.unsafe_uses,
+            &self.literals,
+            &self.features,
+        ]
+        .iter()
+        .map(|rows| rows.len())
+        .sum::<usize>()
+            + self.visitors.iter().map(String::len).sum::<usize>()
+            + self.log.as_ref().map_or(0, |log| log.len())
+    }
+}
 
-                    // Count the number of loops, conditionals and parameters if the function
-                    let (loops, loop_nesting) = count_nodes_of_kind(&node, &grammar.loop_nodes);
-                    let (conditionals, conditional_nesting) =
-                        count_nodes_of_kind(&node, &grammar.cond_nodes);
-                    let (calls, calls_nesting) =
-                        count_nodes_of_kind(&node, &grammar.function_call_nodes);
+/// Rows written by a previous run for a file, reused if its content has not changed.
+#[derive(Debug, Default, PartialEq, Eq)]
+struct PreviousRows<'a> {
+    /// The hash of the content of the file, recorded in the last column of its log row.
+    hash: &'a str,
+    /// The log row of the file.
+    log: &'a str,
+    /// The rows of the functions of the file, each terminated by a newline.
+    output: String,
+    /// The rows of the generic declarations and instantiation sites of the file, each terminated by a newline.
+    generics: String,
+    /// The rows of the syntax errors of the file, each terminated by a newline.
+    errors: String,
+    /// The rows of the tokens of the file, each terminated by a newline.
+    tokens: String,
+    /// The rows of the comments of the file, each terminated by a newline.
+    comments: String,
+    /// The rows of the `//go:embed` directives of the file, each terminated by a newline.
+    embeds: String,
+    /// The rows of the `//go:` directives of the file, each terminated by a newline.
+    directives: String,
+    /// The rows of the unsafe uses of the file, each terminated by a newline.
+    unsafe_uses: String,
+    /// The rows of the literals of the file, each terminated by a newline.
+    literals: String,
+    /// The rows of the language features used by the file, each terminated by a newline.
+    features: String,
+    /// The rows of every registered visitor for the file, each terminated by a newline.
+    visitors: Vec<String>,
+}
 
-                    let params_vec: Vec<Node<'_>> =
-                        find_first_node_of_kind(&node, &grammar.param_seq_nodes, true);
+/// Groups the rows of the output files of a previous run by the file they belong to.
+/// Only the files recorded in the logs file are kept, the others are parsed again.
+///
+/// # Arguments
+///
+/// * `logs` - The content of the logs file, whose rows end with the hash of the file.
+/// * `output` - The content of the functions file, whose rows refer to the file through the path of the function.
+/// * `generics` - The content of the generics file, empty if generics were not extracted.
+/// * `errors` - The content of the syntax errors file, empty if syntax errors were not listed.
+/// * `tokens` - The content of the tokens file, empty if tokens were not exported.
+/// * `comments` - The content of the comments file, empty if comments were not extracted.
+/// * `embeds` - The content of the embeds file, empty if `//go:embed` directives were not extracted.
+/// * `directives` - The content of the directives file, empty if `//go:` directives were not extracted.
+/// * `unsafe_uses` - The content of the unsafe file, empty if unsafe uses were not extracted.
+/// * `literals` - The content of the literals file, empty if literals were not extracted.
+/// * `features` - The content of the features file, empty if language features were not detected.
+/// * `visitors` - The content of the file of every registered visitor.
+///
+/// # Returns
+///
+/// The rows of every file, indexed by its path as written in the rows.
+fn previous_rows<'a>(
+    logs: &'a str,
+    output: &str,
+    generics: &str,
+    errors: &str,
+    tokens: &str,
+    comments: &str,
+    embeds: &str,
+    directives: &str,
+    unsafe_uses: &str,
+    literals: &str,
+    features: &str,
+    visitors: &[String],
+) -> HashMap<&'a str, PreviousRows<'a>> {
+    // All rows start with the id of the project and a path.
+    fn path_of(line: &str) -> Option<&str> {
+        line.split(',').nth(1)
+    }
+    let mut rows: HashMap<&str, PreviousRows> = logs
+        .lines()
+        .skip(1)
+        .filter_map(|log| {
+            let path: &str = path_of(log)?;
+            let (_, hash) = log.rsplit_once(',')?;
+            Some((
+                path,
+                PreviousRows {
+                    hash,
+                    log,
+                    ..Default::default()
+                },
+            ))
+        })
+        .collect();
+    for line in output.lines().skip(1) {
+        if let Some(file) = path_of(line)
+            .and_then(|function_path| function_path.rsplit_once(".functions/"))
+            .and_then(|(path, _)| rows.get_mut(path))
+        {
+            writeln!(file.output, "{line}").unwrap();
+        }
+    }
+    for line in generics.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.generics, "{line}").unwrap();
+        }
+    }
+    for line in errors.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.errors, "{line}").unwrap();
+        }
+    }
+    for line in tokens.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.tokens, "{line}").unwrap();
+        }
+    }
+    for line in comments.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.comments, "{line}").unwrap();
+        }
+    }
+    for line in embeds.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.embeds, "{line}").unwrap();
+        }
+    }
+    for line in directives.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.directives, "{line}").unwrap();
+        }
+    }
+    for line in unsafe_uses.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.unsafe_uses, "{line}").unwrap();
+        }
+    }
+    for line in literals.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.literals, "{line}").unwrap();
+        }
+    }
+    for line in features.lines().skip(1) {
+        if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+            writeln!(file.features, "{line}").unwrap();
+        }
+    }
+    for file in rows.values_mut() {
+        file.visitors = vec![String::new(); visitors.len()];
+    }
+    for (idx, content) in visitors.iter().enumerate() {
+        for line in content.lines().skip(1) {
+            if let Some(file) = path_of(line).and_then(|path| rows.get_mut(path)) {
+                writeln!(file.visitors[idx], "{line}").unwrap();
+            }
+        }
+    }
+    rows
+}
 
-                    let mut name: String = String::from_utf8_lossy(
-                        find_first_field(&node, grammar.name_field)
-                            .map(|n| node_source_code(&n, source))
-                            .unwrap_or(b""),
-                    )
-                    .to_string();
-                    if let Some(idx) = name.find('(') {
-                        name.truncate(idx);
-                    }
-                    name = name.chars().filter(|c| !c.is_whitespace()).collect();
+/// A file removed from the input file: its project id, its path, its language and the filter removing it.
+type SkippedFile = (u32, String, String, &'static str);
 
-                    let mut n_param: usize = 0;
-                    let mut param_match: usize = 0;
-                    for params in params_vec {
-                        let matches = match grammar.param_type_field {
-                            Some(field) => {
-                                // Safe unwrap: whole source code was read as utf8 before
-                                // Safe unwrap: the pattern is already checked above
-                                find_fields(&params, field)
-                                    .into_iter()
-                                    .map(|x| node_source_code(&x, source))
-                                    .filter(|x| keyword_files.has_matches_in_text(language, x))
-                                    .count()
-                            }
-                            None => 0,
-                        };
+/// Removes the files skipped by a filter from the input file and returns their number.
+///
+/// # Arguments
+///
+/// * `input_file` - The input file.
+/// * `skipped` - The filter skipping every file of the input file, if it is skipped.
+/// * `skipped_files` - The list of the skipped files, if they are recorded.
+fn skip_files(
+    input_file: &mut DataFrame,
+    skipped: &[Option<&'static str>],
+    skipped_files: Option<&mut Vec<SkippedFile>>,
+) -> Result<usize> {
+    if let Some(skipped_files) = skipped_files {
+        let ids: Vec<u32> = dataframes::u32(input_file, "id")?;
+        let names: Vec<&str> = dataframes::str(input_file, "name")?;
+        let languages: Vec<&str> = dataframes::str(input_file, "language")?;
+        for (idx, reason) in skipped.iter().enumerate() {
+            if let Some(reason) = reason {
+                skipped_files.push((
+                    ids[idx],
+                    names[idx].to_string(),
+                    languages[idx].to_string(),
+                    reason,
+                ));
+            }
+        }
+    }
+    let kept: BooleanChunked = skipped.iter().map(Option::is_none).collect();
+    let n_files: usize = input_file.height();
+    *input_file = input_file.filter(&kept)?;
+    Ok(n_files - input_file.height())
+}
 
-                        n_param += count_nodes_of_kind(&params, &grammar.param_nodes).0;
-                        param_match += matches;
-                    }
+/// Writes the work plan of a dry run, i.e. the files that would be parsed followed by the files skipped by the filters,
+/// and reports the number of projects, packages and files that would be parsed.
+///
+/// # Arguments
+///
+/// * `input_file` - The files that would be parsed.
+/// * `skipped_files` - The files skipped by the filters.
+/// * `path` - The path of the file to write the work plan to.
+fn write_work_plan(
+    input_file: &DataFrame,
+    skipped_files: &[SkippedFile],
+    path: &str,
+) -> Result<()> {
+    let ids: Vec<u32> = dataframes::u32(input_file, "id")?;
+    let names: Vec<&str> = dataframes::str(input_file, "name")?;
+    let languages: Vec<&str> = dataframes::str(input_file, "language")?;
+    let packages: HashSet<(u32, &str)> = ids
+        .iter()
+        .zip(&names)
+        .map(|(id, name)| (*id, package_of(name)))
+        .collect();
+    info!(
+        "  {} files in {} packages of {} projects would be parsed",
+        names.len(),
+        packages.len(),
+        ids.iter().collect::<HashSet<_>>().len()
+    );
+    let mut skipped: BTreeMap<&str, usize> = BTreeMap::new();
+    for (_, _, _, reason) in skipped_files {
+        *skipped.entry(reason).or_default() += 1;
+    }
+    for (reason, count) in skipped {
+        info!("  {count} files would be skipped by the {reason} filter");
+    }
 
-                    let return_type_match = match grammar.return_type_field {
-                        Some(field) => {
-                            // Safe unwrap: whole source code was read as utf8 before
-                            // Safe unwrap: the pattern is already checked above
-                            find_first_field(&node, field)
-                                .map(|x| node_source_code(&x, source))
-                                .filter(|x| keyword_files.has_matches_in_text(language, x))
-                                .map(|_| 1)
-                                .unwrap_or(0)
-                        }
-                        None => 0,
-                    };
+    let mut plan = CSVFile::new(path, FileMode::Overwrite)?;
+    plan.write_header(&["id", "name", "language", "status"])?;
+    for idx in 0..names.len() {
+        writeln!(plan, "{},{},{},parse", ids[idx], names[idx], languages[idx])?;
+    }
+    for (id, name, language, reason) in skipped_files {
+        writeln!(plan, "{id},{name},{language},{reason}")?;
+    }
+    Ok(())
+}
 
-                    writeln!(
-                        &mut builder,
-                        "{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{}",
-                        project_id,
-                        &function_path
-                            .replace(",", "-was_comma-")
-                            .replace("\"", "-was_quote-"),
-                        name.replace(",", "-was_comma-")
-                            .replace("\"", "-was_quote-"),
-                        position_to_string(Some(function_position)),
-                        language,
-                        count_text_lines(function_code_with_strings),
-                        word_counter.count_matches_in_text(function_code_with_strings),
-                        matches
-                            .iter()
-                            .map(|x| x.to_string())
-                            .collect::<Vec<String>>()
-                            .join(","),
-                        loops,
-                        loop_nesting,
-                        conditionals,
-                        conditional_nesting,
-                        calls,
-                        calls_nesting,
-                        n_param,
-                        param_match,
-                        return_type_match,
-                        error_position,
-                    )?;
-                    functions_with_kw += 1;
-                    for (i, m) in matches.iter().enumerate() {
-                        if *m > 0 {
-                            functions_with_specific_kw[i] += 1;
-                        }
+/// Replaces the archives listed in the input file by the files they contain, which are read from the archives when they
+/// are parsed instead of being extracted. The path of every file is the path of its archive followed by
+/// `ARCHIVE_ENTRY_SEPARATOR` and its path in the archive. Only the files with an extension of the language of the archive
+/// are kept. Archives which cannot be read are skipped with a warning.
+///
+/// # Arguments
+///
+/// * `input_file` - The input file, with `id`, `name` and `language` columns.
+/// * `extensions_to_language` - The language of every extension, without its leading dot.
+///
+/// # Returns
+///
+/// The number of archives replaced.
+fn expand_archives(
+    input_file: &mut DataFrame,
+    extensions_to_language: &HashMap<String, String>,
+) -> Result<usize> {
+    let names: Vec<&str> = dataframes::str(input_file, "name")?;
+    if !names.iter().any(|name| {
+        !name.contains(ARCHIVE_ENTRY_SEPARATOR) && ArchiveFormat::of_path(name).is_some()
+    }) {
+        return Ok(0);
+    }
+    let ids: Vec<u32> = dataframes::u32(input_file, "id")?;
+    let languages: Vec<&str> = dataframes::str(input_file, "language")?;
+    let mut archives: usize = 0;
+    let (mut new_ids, mut new_names, mut new_languages): (Vec<u32>, Vec<String>, Vec<&str>) =
+        (Vec::new(), Vec::new(), Vec::new());
+    for ((id, name), language) in ids.into_iter().zip(names).zip(languages) {
+        let format: Option<ArchiveFormat> = if name.contains(ARCHIVE_ENTRY_SEPARATOR) {
+            None
+        } else {
+            ArchiveFormat::of_path(name)
+        };
+        let Some(format) = format else {
+            new_ids.push(id);
+            new_names.push(name.to_string());
+            new_languages.push(language);
+            continue;
+        };
+        let path: String = name
+            .replace("-was_comma-", ",")
+            .replace("-was_quote-", "\"");
+        match archive_entries(&path, format) {
+            Ok(entries) => {
+                archives += 1;
+                for (entry, _) in entries {
+                    let entry_language: Option<&String> = Path::new(&entry)
+                        .extension()
+                        .and_then(|ext| extensions_to_language.get(&*ext.to_string_lossy()));
+                    if entry_language.is_some_and(|l| l == language) {
+                        new_ids.push(id);
+                        new_names.push(format!(
+                            "{name}{ARCHIVE_ENTRY_SEPARATOR}{}",
+                            escape_path(&entry)
+                        ));
+                        new_languages.push(language);
                     }
                 }
-                functions += 1;
-            }
-        } else {
-            for c in node
-                .children(&mut cursor)
-                .collect::<Vec<_>>()
-                .into_iter()
-                .rev()
-            {
-                call_stack.push(c);
             }
+            Err(e) => warn!("Could not read archive {path}: {e}"),
         }
     }
-    Ok((
-        builder,
-        functions,
-        functions_with_kw,
-        functions_with_specific_kw,
-    ))
+    *input_file = DataFrame::new(vec![
+        Column::new("id".into(), new_ids),
+        Column::new("name".into(), new_names),
+        Column::new("language".into(), new_languages),
+    ])?;
+    Ok(archives)
 }
 
-/// Returns the source code of a node in the parse tree
+/// Paths of the input files after normalization and deduplication.
+#[derive(Debug, Default, PartialEq)]
+struct ResolvedPaths {
+    /// The normalized paths, in the order of the input file.
+    names: Vec<String>,
+    /// The reason why every file is skipped, if it is: `symlink`, `broken-symlink` or `duplicate`.
+    skipped: Vec<Option<&'static str>>,
+    /// The number of files skipped because their path goes through a symbolic link.
+    symlinks: usize,
+    /// The number of files skipped because they are broken or looping symbolic links.
+    broken: usize,
+    /// The number of files skipped because they were already listed under another path.
+    duplicates: usize,
+}
+
+/// Normalizes the paths of the input files and keeps a single path for every file, the first one in the input file.
+/// Files are identified by their canonical path, symbolic links resolved, and paths differing only by their case
+/// are compared on the file system, which identifies them if it is case-insensitive. Missing files are kept, to be
+/// reported when they are parsed. Entries of archives are never symbolic links.
 ///
 /// # Arguments
 ///
-/// * `n` - The node to extract the source code from.
-/// * `source` - The source code of the whole file.
-fn node_source_code<'a>(n: &Node, source: &'a [u8]) -> &'a [u8] {
-    &source[n.start_byte()..n.end_byte()]
+/// * `names` - The paths of the input files, as escaped in the input file.
+/// * `skip_symlinks` - Whether to skip the files whose path goes through a symbolic link.
+fn resolve_paths(names: &[&str], skip_symlinks: bool) -> ResolvedPaths {
+    let mut resolved = ResolvedPaths::default();
+    let mut symlinks: HashMap<PathBuf, bool> = HashMap::new();
+    let mut canonical_paths: HashSet<PathBuf> = HashSet::new();
+    // The canonical paths of the kept files, by their lowercase version.
+    let mut case_folded: HashMap<String, Vec<PathBuf>> = HashMap::new();
+    for name in names {
+        let name: String = normalize_path(name);
+        let path: PathBuf = PathBuf::from(
+            name.replace("-was_comma-", ",")
+                .replace("-was_quote-", "\""),
+        );
+        let skipped: Option<&str> = if skip_symlinks && has_symlink(&path, &mut symlinks) {
+            resolved.symlinks += 1;
+            Some("symlink")
+        } else {
+            // The entries of an archive are identified by the canonical path of the archive.
+            let canonical = match path.to_str().and_then(split_archive_entry) {
+                Some((archive, _, entry)) => std::fs::canonicalize(archive).map(|archive| {
+                    PathBuf::from(format!(
+                        "{}{ARCHIVE_ENTRY_SEPARATOR}{entry}",
+                        archive.display()
+                    ))
+                }),
+                None => std::fs::canonicalize(&path),
+            };
+            match canonical {
+                Ok(canonical) => {
+                    let same_case: &mut Vec<PathBuf> = case_folded
+                        .entry(canonical.to_string_lossy().to_lowercase())
+                        .or_default();
+                    if !canonical_paths.insert(canonical.clone())
+                        || same_case.iter().any(|other| same_file(other, &canonical))
+                    {
+                        resolved.duplicates += 1;
+                        Some("duplicate")
+                    } else {
+                        same_case.push(canonical);
+                        None
+                    }
+                }
+                Err(_) if path.symlink_metadata().is_ok() => {
+                    resolved.broken += 1;
+                    Some("broken-symlink")
+                }
+                Err(_) => None,
+            }
+        };
+        resolved.names.push(name);
+        resolved.skipped.push(skipped);
+    }
+    resolved
 }
 
-/// Grammar of a programming language.
-struct Grammar {
-    /// The programming language the grammar belongs to.
-    lang: Language,
-
+/// Finds the files having the same content as another one, which are aliases of the first of them in the output order.
+/// The files are hashed in parallel. Files which cannot be read are never aliases, so that their errors are reported when they are parsed.
+///
+/// # Arguments
+///
+/// * `names` - The paths of the files, as escaped in the input file.
+/// * `threads` - The number of threads hashing the files.
+///
+/// # Returns
+///
+/// The index of every alias with the index of the file it is an alias of and their hash, in the output order of the aliases.
+fn content_aliases(names: &[&str], threads: usize) -> Vec<(usize, usize, String)> {
+    let chunk_size: usize = names.len().div_ceil(threads.max(1)).max(1);
+    let hashes: Vec<Option<String>> = std::thread::scope(|scope| {
+        let handles: Vec<_> = names
+            .chunks(chunk_size)
+            .map(|chunk| {
+                scope.spawn(move || {
+                    chunk
+                        .iter()
+                        .map(|name| {
+                            content_hash(
+                                &name
+                                    .replace("-was_comma-", ",")
+                                    .replace("-was_quote-", "\""),
+                            )
+                            .ok()
+                        })
+                        .collect::<Vec<Option<String>>>()
+                })
+            })
+            .collect();
+        handles
+            .into_iter()
+            .flat_map(|handle| handle.join().unwrap())
+            .collect()
+    });
+    let mut sorted_idx: Vec<usize> = (0..names.len()).collect();
+    sorted_idx.sort_by_key(|&idx| output_order_key(names[idx]));
+    let mut originals: HashMap<&str, usize> = HashMap::new();
+    let mut aliases: Vec<(usize, usize, String)> = Vec::new();
+    for idx in sorted_idx {
+        if let Some(hash) = &hashes[idx] {
+            match originals.get(hash.as_str()) {
+                Some(original) => aliases.push((idx, *original, hash.clone())),
+                None => {
+                    originals.insert(hash, idx);
+                }
+            }
+        }
+    }
+    aliases
+}
+
+/// Returns the rows of the comments of a file, in the order of the file.
+/// Comments on consecutive lines are grouped together. A group is a doc comment if it ends on the line right above a declaration,
+/// or on the line where it starts, and is not the trailing comment of a previous line of code. The other groups are free-floating.
+/// The comments of the scaffold of snippets are skipped.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root of the syntax tree of the file.
+/// * `grammar` - The grammar of the language of the file.
+/// * `source` - The source code of the file.
+/// * `source_len` - The length of the source code of the file, without the scaffold of snippets.
+fn file_comment_rows(
+    project_id: u32,
+    path: &str,
+    root: &Node,
+    grammar: &Grammar,
+    source: &[u8],
+    source_len: usize,
+) -> Result<String> {
+    // The start byte of every group, with its row.
+    let mut groups: Vec<(usize, String)> = Vec::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.children(&mut cursor).collect();
+        let mut i: usize = 0;
+        while i < children.len() {
+            let first: Node = children[i];
+            if !grammar.comment_nodes.contains(first.kind()) {
+                stack.push(first);
+                i += 1;
+                continue;
+            }
+            let mut last: Node = first;
+            i += 1;
+            while i < children.len()
+                && grammar.comment_nodes.contains(children[i].kind())
+                && children[i].start_position().row <= last.end_position().row + 1
+            {
+                last = children[i];
+                i += 1;
+            }
+            if first.start_byte() >= source_len {
+                continue;
+            }
+            let trailing: bool = first
+                .prev_sibling()
+                .is_some_and(|previous| previous.end_position().row == first.start_position().row);
+            let target: Option<Node> = children
+                .get(i)
+                .copied()
+                .filter(|next| next.start_position().row <= last.end_position().row + 1)
+                .filter(|next| !trailing && is_declaration(next, grammar));
+            let text: String = children
+                .iter()
+                .filter(|comment| {
+                    comment.start_byte() >= first.start_byte()
+                        && comment.end_byte() <= last.end_byte()
+                })
+                .map(|comment| String::from_utf8_lossy(node_source_code(comment, source)))
+                .collect::<Vec<_>>()
+                .join("\n");
+            groups.push((
+                first.start_byte(),
+                format!(
+                    "{},{},{},{},{},{},{},{}\n",
+                    project_id,
+                    escape_path(path),
+                    if target.is_some() { "doc" } else { "free" },
+                    target
+                        .and_then(|t| declaration_name(&t, source))
+                        .map_or(String::new(), |name| escape_text(&name)),
+                    target.map_or("", |t| t.kind()),
+                    position_to_string(Some((
+                        first.start_position().row + 1,
+                        first.start_position().column + 1
+                    ))),
+                    position_to_string(Some((
+                        last.end_position().row + 1,
+                        last.end_position().column + 1
+                    ))),
+                    escape_text(&text),
+                ),
+            ));
+        }
+    }
+    groups.sort_by_key(|(start, _)| *start);
+    Ok(groups.into_iter().map(|(_, row)| row).collect())
+}
+
+/// Whether a node declares a function, a type, a variable or a package, and can therefore be documented.
+fn is_declaration(node: &Node, grammar: &Grammar) -> bool {
+    let kind: &str = node.kind();
+    grammar.function_nodes.contains(kind)
+        || kind.ends_with("declaration")
+        || kind.ends_with("definition")
+        || kind.ends_with("_item")
+        || kind == "package_clause"
+}
+
+/// Returns the name of a declaration, i.e. its name field, the name of its first specification for grouped declarations,
+/// the name of its declarator in C and C++, or its first identifier otherwise.
+fn declaration_name(node: &Node, source: &[u8]) -> Option<String> {
+    let mut declarator: Node = *node;
+    while let Some(inner) = declarator.child_by_field_name("declarator") {
+        declarator = inner;
+    }
+    let mut cursor = node.walk();
+    let children: Vec<Node> = node.named_children(&mut cursor).collect();
+    node.child_by_field_name("name")
+        .or_else(|| (declarator != *node).then_some(declarator))
+        .or_else(|| {
+            children
+                .iter()
+                .find_map(|child| child.child_by_field_name("name"))
+        })
+        .or_else(|| {
+            children
+                .iter()
+                .find(|child| child.kind().ends_with("identifier"))
+                .copied()
+        })
+        .map(|name| String::from_utf8_lossy(node_source_code(&name, source)).to_string())
+}
+
+/// Returns the rows of the tokens of a file, i.e. of the leaves of its syntax tree, in the order of the file.
+/// String literals are single tokens, although Tree-sitter splits some of them into their delimiters, contents and escape sequences.
+/// Missing nodes, which are inserted by the parser to recover from syntax errors, and the tokens of the scaffold of snippets are skipped.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root of the syntax tree of the file.
+/// * `grammar` - The grammar of the language of the file.
+/// * `source` - The source code of the file.
+/// * `source_len` - The length of the source code of the file, without the scaffold of snippets.
+fn file_token_rows(
+    project_id: u32,
+    path: &str,
+    root: &Node,
+    grammar: &Grammar,
+    source: &[u8],
+    source_len: usize,
+) -> Result<String> {
+    let mut builder: String = String::new();
+    let mut index: usize = 0;
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        if node.start_byte() >= source_len {
+            continue;
+        }
+        if node.child_count() > 0 && !grammar.string_literal_nodes.contains(node.kind()) {
+            let mut cursor = node.walk();
+            let children: Vec<Node> = node.children(&mut cursor).collect();
+            stack.extend(children.into_iter().rev());
+        } else if !node.is_missing() {
+            writeln!(
+                &mut builder,
+                "{},{},{},{},{},{},{},{}",
+                project_id,
+                escape_path(path),
+                index,
+                escape_text(node.kind()),
+                node.is_named(),
+                escape_text(&String::from_utf8_lossy(node_source_code(&node, source))),
+                position_to_string(Some((
+                    node.start_position().row + 1,
+                    node.start_position().column + 1
+                ))),
+                position_to_string(Some((
+                    node.end_position().row + 1,
+                    node.end_position().column + 1
+                ))),
+            )?;
+            index += 1;
+        }
+    }
+    Ok(builder)
+}
+
+/// Returns the key ordering the files in the output files: the directories of their path, i.e. their project and package,
+/// and then their name.
+fn output_order_key(path: &str) -> (Vec<&str>, &str) {
+    match path.rsplit_once('/') {
+        Some((dir, name)) => (dir.split('/').collect(), name),
+        None => (Vec::new(), path),
+    }
+}
+
+/// Escapes the commas, quotes and line breaks of a text, so that it fits in a single field of the output files.
+fn escape_text(text: &str) -> String {
+    escape_path(text)
+        .replace("\n", "-was_newline-")
+        .replace("\r", "-was_return-")
+}
+
+/// Escapes the commas and quotes of a path, as in the rows of the output files.
+fn escape_path(path: &str) -> String {
+    path.replace(",", "-was_comma-")
+        .replace("\"", "-was_quote-")
+}
+
+/// Returns the hexadecimal representation of the BLAKE3 hash of the content of a file, which may be an entry of an archive.
+fn content_hash(path: &str) -> Result<String> {
+    let mut hasher = blake3::Hasher::new();
+    if let Some((archive, format, entry)) = split_archive_entry(path) {
+        if let Ok(content) = load_archive_entry(archive, format, entry, u64::MAX)? {
+            hasher.update(&content);
+        }
+        return Ok(hasher.finalize().to_hex().to_string());
+    }
+    hasher
+        .update_reader(std::fs::File::open(path)?)
+        .with_context(|| format!("Could not read file {path}"))?;
+    Ok(hasher.finalize().to_hex().to_string())
+}
+
+/// Analyze a file and extract the functions whose body contains one of the provided keywords.
+/// Returns statistics about the functions.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file to analyze.
+/// * `language` - The language of the file.
+/// * `keywords_files` - The files containing the list of keywords to search for in the functions.
+/// * `fail_policy` - The policy to apply when a parse error is encountered.
+/// * `ignore_comments` - Whether to ignore comments when extracting functions, in addition to ignoring them during keyword matching.
+/// * `word_counter` - The matcher to use to count the words in the functions.
+/// * `cgo_policy` - The handling of the references to C in Go files importing "C".
+/// * `generics` - Whether to extract the generic declarations and instantiation sites of Go files.
+/// * `syntax_errors` - Whether to list the syntax errors of the file.
+/// * `generated_policy` - The handling of the file if it is machine-generated.
+/// * `tag_vendored` - Whether to record the vendored tree the file belongs to.
+/// * `snippets` - Whether to parse the file within a synthetic scaffold if it is a Go file without a package clause.
+/// * `build_configs` - The build configurations in which the build constraints of Go files are evaluated, if any.
+/// * `tag_tests` - Whether to record whether the file is a test file of the package under test or of an external test package.
+/// * `go_versions` - The Go versions of the modules, if the version of the module of the file is recorded.
+/// * `encodings` - Whether to sanitize the encoding of the file and record it.
+/// * `ast_cache` - The directory storing the syntax tree of the file, if any.
+/// * `tokens` - Whether to export the tokens of the file.
+/// * `comments` - Whether to extract the comments of the file.
+/// * `embeds` - Whether to extract the `//go:embed` directives of Go files.
+/// * `verify_embeds` - Whether to count the files matched by the patterns of the `//go:embed` directives.
+/// * `directives` - Whether to extract the `//go:` directives of Go files.
+/// * `unsafe_uses` - Whether to extract the unsafe uses of Go files.
+/// * `literals` - Whether to extract the literals of Go files.
+/// * `features` - Whether to detect the language features used by Go files.
+/// * `visitors` - The registered visitors, run on the file if they accept its language.
+/// * `deadline` - The time after which the file is skipped, if any.
+/// * `max_file_size` - The maximum size of the file, in bytes, above which it is skipped.
+/// # Returns
+///
+/// A string containing the statistics of the functions in the file. Specifically:
+/// * The path to the file containing the function.
+/// * The number of lines of code.
+/// * The number of words.
+/// * The number of keywords matched.
+/// * The number of loops.
+/// * The maximum loop nesting level.
+/// * The number of conditional statements.
+/// * The maximum conditional nesting level.
+/// * Whether the file uses cgo, if the `record` cgo policy is selected.
+/// * The generator of the file, if generated files are tagged.
+/// * The vendored tree the file belongs to, if vendored files are tagged.
+/// * Whether the file is a snippet, if snippets are parsed within a scaffold.
+/// * The configurations in which the file is built, if build configurations are given.
+/// * The kind of test file of the file, if test files are tagged.
+/// * The Go version of the module of the file, if Go versions are recorded.
+/// * The encoding of the file and its number of NUL bytes, if encodings are recorded.
+///
+/// And the generic declarations and instantiation sites, the syntax errors, the tokens, the comments, the `//go:embed` directives,
+/// the `//go:` directives, the unsafe uses, the literals and the language features of the file, if they are extracted,
+/// and the rows of every registered visitor.
+///
+fn analyze_file(
+    project_id: u32,
+    path: &str,
+    language: &str,
+    keywords_files: &KeywordFiles,
+    fail_policy: &str,
+    ignore_comments: bool,
+    word_counter: &Matcher,
+    cgo_policy: &str,
+    generics: bool,
+    syntax_errors: bool,
+    generated_policy: &str,
+    tag_vendored: bool,
+    snippets: bool,
+    build_configs: Option<&[BuildConfig]>,
+    tag_tests: bool,
+    go_versions: Option<&GoVersions>,
+    encodings: bool,
+    ast_cache: Option<&str>,
+    tokens: bool,
+    comments: bool,
+    embeds: bool,
+    verify_embeds: bool,
+    directives: bool,
+    unsafe_uses: bool,
+    literals: bool,
+    features: bool,
+    visitors: &[Arc<dyn Visitor>],
+    deadline: Option<Instant>,
+    max_file_size: u64,
+) -> Result<FileRows> {
+    let grammar = language_to_grammar(language)
+        .with_context(|| format!("Unsupported language: {language}"))?;
+
+    // Log row of a file that is not parsed, whose statistics are unknown.
+    let unparsed_row = |parse_error: &str| -> Result<String> {
+        let mut row: String =
+            file_error_row(project_id, path, language, keywords_files, parse_error);
+        if cgo_policy == "record" {
+            row.push_str(",-1");
+        }
+        if generated_policy == "tag" {
+            row.push_str(",-1");
+        }
+        if tag_vendored {
+            write!(row, ",{}", vendored_tree(path).unwrap_or("none"))?;
+        }
+        if snippets {
+            row.push_str(",-1");
+        }
+        if let Some(configs) = build_configs {
+            write!(row, ",{}", join_configurations(configs.iter()))?;
+        }
+        // Whether a test file belongs to an external test package is only known once it is parsed.
+        if tag_tests {
+            row.push_str(if is_test_file(path) { ",-1" } else { ",none" });
+        }
+        if let Some(versions) = go_versions {
+            write!(row, ",{}", go_version(path, language, versions))?;
+        }
+        // The encoding of a file is only known once it is loaded.
+        if encodings {
+            row.push_str(",-1,-1");
+        }
+        Ok(row)
+    };
+    let timed_out = || -> Result<FileRows> {
+        Ok(FileRows {
+            log: Some(unparsed_row("timeout")?),
+            stats: FileStats {
+                skipped: true,
+                ..Default::default()
+            },
+            ..Default::default()
+        })
+    };
+
+    if deadline.is_some_and(|d| Instant::now() >= d) {
+        return timed_out();
+    }
+
+    // A panic raised while processing the file, e.g. by a grammar or an extraction, only skips the file.
+    let analyzed = isolate(|| -> Result<FileRows> {
+        // Initializes the parser
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&grammar.lang)?;
+        match load_file(path, max_file_size)? {
+            Ok(source_code) => {
+                // The cached tree is keyed by the content of the file, before any scaffold is added.
+                let source_hash: Option<String> =
+                    ast_cache.map(|_| blake3::hash(&source_code).to_hex().to_string());
+
+                let (source_code, encoding, nul_bytes) = if encodings {
+                    sanitize_source(source_code)
+                } else {
+                    (source_code, "utf-8", 0)
+                };
+
+                // Creates a folder to store the functions of the file
+                let target_folder: String = format!("{path}.functions");
+                create_dir(&target_folder)?;
+
+                // Parses the source code of the file
+                let Some(mut tree) = parse_before(&mut parser, &source_code, deadline)
+                    .with_context(|| format!("Failed to parse file {path}"))?
+                else {
+                    delete_dir(&target_folder, true)?;
+                    return timed_out();
+                };
+
+                // Go files without a package clause are parsed again within a synthetic scaffold.
+                // The scaffold is appended to the snippet, which Tree-sitter accepts, so that positions still refer to the original file.
+                let snippet: bool =
+                    snippets && language == "go" && !has_package_clause(&tree.root_node());
+                let source_len: usize = source_code.len();
+                let source_code: Vec<u8> = if snippet {
+                    let scaffold: &str =
+                        if cgo_references(&tree.root_node(), &source_code).is_empty() {
+                            "\npackage snippet\n"
+                        } else {
+                            "\npackage snippet\n\nimport \"C\"\n"
+                        };
+                    let scaffolded: Vec<u8> =
+                        [source_code.as_slice(), scaffold.as_bytes()].concat();
+                    match parse_before(&mut parser, &scaffolded, deadline)
+                        .with_context(|| format!("Failed to parse file {path}"))?
+                    {
+                        Some(scaffolded_tree) => tree = scaffolded_tree,
+                        None => {
+                            delete_dir(&target_folder, true)?;
+                            return timed_out();
+                        }
+                    }
+                    scaffolded
+                } else {
+                    source_code
+                };
+
+                if let (Some(cache), Some(hash)) = (ast_cache, &source_hash) {
+                    store_tree(cache, hash, &tree)?;
+                }
+
+                let file_has_parse_error: bool = tree.root_node().has_error();
+                let stats: FileStats = FileStats {
+                    parse_error: file_has_parse_error,
+                    loc: count_text_lines(&source_code[..source_len]),
+                    ..Default::default()
+                };
+
+                // Syntax errors are listed before applying the failure policy, so that skipped files are listed as well.
+                let error_rows: String = if syntax_errors && file_has_parse_error {
+                    syntax_error_rows(project_id, path, &tree.root_node(), &grammar, &source_code)?
+                } else {
+                    String::new()
+                };
+
+                let generator: Option<&str> = generator(&source_code);
+
+                let token_rows: String = if tokens {
+                    file_token_rows(
+                        project_id,
+                        path,
+                        &tree.root_node(),
+                        &grammar,
+                        &source_code,
+                        source_len,
+                    )?
+                } else {
+                    String::new()
+                };
+
+                let comment_rows: String = if comments {
+                    file_comment_rows(
+                        project_id,
+                        path,
+                        &tree.root_node(),
+                        &grammar,
+                        &source_code,
+                        source_len,
+                    )?
+                } else {
+                    String::new()
+                };
+
+                // The generator of the file, its vendored tree, whether it is a snippet, the configurations in which it is built
+                // and its kind of test file, appended to every row of the file.
+                let mut suffix: String = String::new();
+                if generated_policy == "tag" {
+                    write!(suffix, ",{}", generator.unwrap_or("none"))?;
+                }
+                if tag_vendored {
+                    write!(suffix, ",{}", vendored_tree(path).unwrap_or("none"))?;
+                }
+                if snippets {
+                    write!(suffix, ",{snippet}")?;
+                }
+                if let Some(configs) = build_configs {
+                    write!(
+                        suffix,
+                        ",{}",
+                        build_configurations(path, language, &source_code, configs)
+                    )?;
+                }
+                if tag_tests {
+                    write!(
+                        suffix,
+                        ",{}",
+                        test_file_kind(path, language, &tree.root_node(), &source_code)
+                    )?;
+                }
+                if let Some(versions) = go_versions {
+                    write!(suffix, ",{}", go_version(path, language, versions))?;
+                }
+                if encodings {
+                    write!(suffix, ",{encoding},{nul_bytes}")?;
+                }
+
+                if generator.is_some() && generated_policy == "skip" {
+                    let mut row: String =
+                        file_error_row(project_id, path, language, keywords_files, "generated");
+                    if cgo_policy == "record" {
+                        row.push_str(",-1");
+                    }
+                    row.push_str(&suffix);
+                    Ok(FileRows {
+                        log: Some(row),
+                        errors: error_rows,
+                        stats: FileStats {
+                            skipped: true,
+                            ..stats
+                        },
+                        ..Default::default()
+                    })
+                } else if file_has_parse_error && fail_policy == "skip-file" {
+                    Ok(FileRows {
+                        errors: error_rows,
+                        tokens: token_rows,
+                        comments: comment_rows,
+                        stats: FileStats {
+                            skipped: true,
+                            ..stats
+                        },
+                        ..Default::default()
+                    })
+                } else if file_has_parse_error && fail_policy == "abort" {
+                    bail!("Parse error in file {path}")
+                } else {
+                    let root: Node<'_> = tree.root_node();
+                    let cgo: bool = language == "go" && imports_c(&root, &source_code);
+                    let Some((
+                        output,
+                        total_functions,
+                        functions_with_kw,
+                        functions_with_specific_kw,
+                    )) = extract_functions(
+                        project_id,
+                        &root,
+                        &target_folder,
+                        language,
+                        &grammar,
+                        &source_code,
+                        keywords_files,
+                        fail_policy,
+                        ignore_comments,
+                        word_counter,
+                        cgo_policy,
+                        cgo,
+                        &mut parser,
+                        deadline,
+                    )?
+                    else {
+                        delete_dir(&target_folder, true)?;
+                        return timed_out();
+                    };
+                    let output: String = output
+                        .lines()
+                        .map(|line| format!("{line}{suffix}\n"))
+                        .collect();
+
+                    let generic_rows: String = if generics && language == "go" {
+                        extract_generics(project_id, path, &root, &source_code)?
+                    } else {
+                        String::new()
+                    };
+
+                    let embed_rows: String = if embeds && language == "go" {
+                        extract_embeds(project_id, path, &root, &source_code, verify_embeds)?
+                    } else {
+                        String::new()
+                    };
+
+                    let directive_rows: String = if directives && language == "go" {
+                        extract_directives(project_id, path, &root, &grammar, &source_code)?
+                    } else {
+                        String::new()
+                    };
+
+                    let unsafe_rows: String = if unsafe_uses && language == "go" {
+                        extract_unsafe_uses(project_id, path, &root, &source_code)?
+                    } else {
+                        String::new()
+                    };
+
+                    let literal_rows: String = if literals && language == "go" {
+                        extract_literals(project_id, path, &root, &source_code)?
+                    } else {
+                        String::new()
+                    };
+
+                    let feature_rows: String = if features && language == "go" {
+                        extract_features(project_id, path, &root, &source_code)?
+                    } else {
+                        String::new()
+                    };
+
+                    let visitor_rows: Vec<String> = if visitors.is_empty() {
+                        Vec::new()
+                    } else {
+                        let go_version: Option<String> =
+                            go_versions.map(|versions| go_version(path, language, versions));
+                        let context: FileContext = FileContext {
+                            project_id,
+                            path,
+                            language,
+                            package: package_of(path),
+                            generator,
+                            vendored: vendored_tree(path),
+                            test_kind: test_file_kind(path, language, &root, &source_code),
+                            go_version: go_version.as_deref(),
+                            parse_error: file_has_parse_error,
+                        };
+                        visitors
+                            .iter()
+                            .map(|visitor| {
+                                visitor_rows(visitor.as_ref(), &context, &root, &source_code)
+                            })
+                            .collect::<Result<Vec<String>>>()?
+                    };
+
+                    let error_position: String = if file_has_parse_error {
+                        position_to_string(find_first_error_position(&root))
+                    } else {
+                        "none".to_string()
+                    };
+
+                    Ok(FileRows {
+                        output,
+                        log: Some(format!(
+                            "{},{},{},{},{},{},{}{}{}",
+                            project_id,
+                            path.replace(",", "-was_comma-")
+                                .replace("\"", "-was_quote-"),
+                            language,
+                            total_functions,
+                            functions_with_kw,
+                            functions_with_specific_kw
+                                .iter()
+                                .map(|x| x.to_string())
+                                .collect::<Vec<String>>()
+                                .join(","),
+                            error_position,
+                            if cgo_policy == "record" {
+                                format!(",{cgo}")
+                            } else {
+                                String::new()
+                            },
+                            suffix,
+                        )),
+                        generics: generic_rows,
+                        errors: error_rows,
+                        tokens: token_rows,
+                        comments: comment_rows,
+                        embeds: embed_rows,
+                        directives: directive_rows,
+                        unsafe_uses: unsafe_rows,
+                        literals: literal_rows,
+                        features: feature_rows,
+                        visitors: visitor_rows,
+                        stats,
+                    })
+                }
+            }
+
+            // If the file is too large, return an error row
+            Err(_) => Ok(FileRows {
+                log: Some(unparsed_row("too-large")?),
+                stats: FileStats {
+                    skipped: true,
+                    ..Default::default()
+                },
+                ..Default::default()
+            }),
+        }
+    });
+    match analyzed {
+        Ok(rows) => rows,
+        Err(trace) => {
+            warn!("Panic while parsing {path}: {trace}");
+            delete_dir(format!("{path}.functions"), true)?;
+            Ok(FileRows {
+                log: Some(unparsed_row("panic")?),
+                stats: FileStats {
+                    skipped: true,
+                    ..Default::default()
+                },
+                ..Default::default()
+            })
+        }
+    }
+}
+
+/// Maximum size of the files loaded in memory to be parsed, in bytes.
+const MEMORY_LIMIT: u64 = 1024 * 1024 * 1024;
+
+/// Maximum number of results of every worker waiting to be written to the output files, both in the channel to the writer
+/// and, in the path order, for the files ranked before them. A worker holds one file in memory at a time, so that its memory
+/// is bounded along with the size of the files.
+const PENDING_RESULTS_PER_WORKER: usize = 16;
+
+/// Minimum interval between two checkpoints of a run.
+const CHECKPOINT_INTERVAL: Duration = Duration::from_secs(60);
+
+/// Interval at which a worker checks whether the results waiting to be written fit in the memory budget or the bound of
+/// pending results again.
+const BUFFER_POLL_INTERVAL: Duration = Duration::from_millis(10);
+
+/// Makes source code parseable where it can be done safely, and returns it with its encoding and its number of NUL bytes.
+/// UTF-16 files, recognized by their byte order mark, are transcoded to UTF-8. The byte order mark of UTF-8 files and NUL bytes
+/// are replaced by spaces, so that the positions of the rest of the file do not change. Other invalid UTF-8 sequences, such as
+/// Latin-1 characters in comments, are kept as they are since their encoding cannot be known for sure.
+///
+/// The encoding is one of `utf-8`, `utf-8-bom`, `utf-16le`, `utf-16be` or `invalid-utf-8`.
+fn sanitize_source(mut source: Vec<u8>) -> (Vec<u8>, &'static str, usize) {
+    let mut encoding: &str = "utf-8";
+    let big_endian: Option<bool> = match source.get(..2) {
+        Some([0xFF, 0xFE]) => Some(false),
+        Some([0xFE, 0xFF]) => Some(true),
+        _ => None,
+    };
+    if let Some(big_endian) = big_endian {
+        let units = source[2..].chunks(2).map(|unit| {
+            let unit: [u8; 2] = [unit[0], unit.get(1).copied().unwrap_or_default()];
+            if big_endian {
+                u16::from_be_bytes(unit)
+            } else {
+                u16::from_le_bytes(unit)
+            }
+        });
+        source = char::decode_utf16(units)
+            .map(|c| c.unwrap_or(char::REPLACEMENT_CHARACTER))
+            .collect::<String>()
+            .into_bytes();
+        encoding = if big_endian { "utf-16be" } else { "utf-16le" };
+    } else if source.starts_with(UTF8_BOM) {
+        source[..UTF8_BOM.len()].fill(b' ');
+        encoding = "utf-8-bom";
+    }
+    let mut nul_bytes: usize = 0;
+    for byte in source.iter_mut().filter(|byte| **byte == 0) {
+        *byte = b' ';
+        nul_bytes += 1;
+    }
+    if std::str::from_utf8(&source).is_err() {
+        encoding = "invalid-utf-8";
+    }
+    (source, encoding, nul_bytes)
+}
+
+/// Byte order mark of UTF-8 files.
+const UTF8_BOM: &[u8] = b"\xEF\xBB\xBF";
+
+thread_local! {
+    /// Whether the panics of the thread are raised while processing a file, and recorded instead of printed.
+    static ISOLATED: Cell<bool> = const { Cell::new(false) };
+    /// The message and the stack trace of the last panic raised by the thread while processing a file.
+    static PANIC: RefCell<Option<String>> = const { RefCell::new(None) };
+}
+
+/// Runs a closure processing a file, catching the panics it raises so that they do not terminate the run.
+/// The message and the stack trace of these panics are recorded by a panic hook, installed on the first call,
+/// while the other panics are reported by the previous hook.
+///
+/// # Returns
+///
+/// The result of the closure, or the message and the stack trace of its panic.
+fn isolate<T>(f: impl FnOnce() -> T) -> Result<T, String> {
+    static HOOK: Once = Once::new();
+    HOOK.call_once(|| {
+        let previous = std::panic::take_hook();
+        std::panic::set_hook(Box::new(move |info| {
+            if ISOLATED.with(Cell::get) {
+                let trace: Backtrace = Backtrace::force_capture();
+                PANIC.with(|panic| *panic.borrow_mut() = Some(format!("{info}\n{trace}")));
+            } else {
+                previous(info);
+            }
+        }));
+    });
+    ISOLATED.with(|isolated| isolated.set(true));
+    let result = std::panic::catch_unwind(AssertUnwindSafe(f));
+    ISOLATED.with(|isolated| isolated.set(false));
+    result.map_err(|_| {
+        PANIC
+            .with(|panic| panic.borrow_mut().take())
+            .unwrap_or_else(|| "unknown panic".to_string())
+    })
+}
+
+/// Parses source code within the time left before a deadline, if any.
+/// Returns None if the deadline is reached before the end of the parsing.
+fn parse_before(
+    parser: &mut Parser,
+    source: &[u8],
+    deadline: Option<Instant>,
+) -> Result<Option<Tree>> {
+    match deadline {
+        Some(deadline) => {
+            let left: Duration = deadline.saturating_duration_since(Instant::now());
+            if left.is_zero() {
+                return Ok(None);
+            }
+            // A timeout of zero disables the timeout.
+            #[allow(deprecated)]
+            parser.set_timeout_micros((left.as_micros() as u64).max(1));
+            Ok(parser.parse(source, None))
+        }
+        None => parser
+            .parse(source, None)
+            .map(Some)
+            .context("Parsing failed"),
+    }
+}
+
+/// Directories whose trees contain code that is not part of the project itself, such as dependencies or test fixtures.
+const VENDORED_TREES: &[&str] = &["vendor", "third_party", "testdata"];
+
+/// Returns the vendored tree a file belongs to, i.e. the first of its parent directories named after one in [`VENDORED_TREES`].
+fn vendored_tree(path: &str) -> Option<&'static str> {
+    let parent: &str = path.rsplit_once('/').map_or("", |(parent, _)| parent);
+    parent
+        .split('/')
+        .find_map(|dir| VENDORED_TREES.iter().find(|&&tree| tree == dir).copied())
+}
+
+/// Number of lines at the beginning of a file in which generation markers are searched.
+const GENERATED_HEADER_LINES: usize = 20;
+
+/// Generators recognized in the header of generated files, with the name recorded for them.
+/// Markers are matched in order on the lowercase header.
+const GENERATORS: &[(&str, &str)] = &[
+    ("protoc-gen-", "protoc"),
+    ("protocol buffer compiler", "protoc"),
+    ("stringer", "stringer"),
+    ("mockgen", "mockgen"),
+    ("cmd/cgo", "cgo"),
+    ("go-bindata", "go-bindata"),
+    ("goyacc", "goyacc"),
+    ("thrift", "thrift"),
+];
+
+/// Returns the generator of a machine-generated file, or None if the file is not generated.
+/// Generated files are detected from the `Code generated ... DO NOT EDIT.` header of Go, or from the `@generated` and
+/// `<auto-generated>` markers and the header of the protocol buffer compiler of other languages. Generators that are
+/// not recognized are recorded as `unknown`.
+fn generator(source: &[u8]) -> Option<&'static str> {
+    let header: String = source
+        .split(|&b| b == b'\n')
+        .take(GENERATED_HEADER_LINES)
+        .map(|line| String::from_utf8_lossy(line).to_lowercase())
+        .collect::<Vec<String>>()
+        .join("\n");
+    let generated: bool = header.lines().any(|line| {
+        (line.contains("code generated") && line.contains("do not edit"))
+            || line.contains("@generated")
+            || line.contains("<auto-generated")
+            || line.contains("generated by the protocol buffer compiler")
+    });
+    generated.then(|| {
+        GENERATORS
+            .iter()
+            .find(|(marker, _)| header.contains(marker))
+            .map_or("unknown", |(_, name)| *name)
+    })
+}
+
+/// Returns the configurations in which a file is built, separated by semicolons.
+/// Files in other languages than Go are built in all the configurations, Go files whose
+/// constraint is built in none are recorded as `none` and files with a malformed constraint as `invalid`.
+fn build_configurations(
+    path: &str,
+    language: &str,
+    source_code: &[u8],
+    configs: &[BuildConfig],
+) -> String {
+    if language != "go" {
+        return join_configurations(configs.iter());
+    }
+    let file_name: &str = path.rsplit('/').next().unwrap_or(path);
+    match configurations(file_name, &String::from_utf8_lossy(source_code), configs) {
+        Ok(built) if built.is_empty() => "none".to_string(),
+        Ok(built) => join_configurations(built.into_iter()),
+        Err(_) => "invalid".to_string(),
+    }
+}
+
+fn join_configurations<'a>(configs: impl Iterator<Item = &'a BuildConfig>) -> String {
+    configs
+        .map(|c| c.to_string())
+        .collect::<Vec<String>>()
+        .join(";")
+}
+
+fn file_error_row(
+    project_id: u32,
+    path: &str,
+    language: &str,
+    keyword_files: &KeywordFiles,
+    parse_error: &str,
+) -> String {
+    format!(
+        "{},{},{},-1,-1,{},{}",
+        project_id,
+        path.replace(",", "-was_comma-")
+            .replace("\"", "-was_quote-"),
+        language,
+        keyword_files
+            .paths
+            .iter()
+            .map(|_| "-1".to_string())
+            .collect::<Vec<String>>()
+            .join(","),
+        parse_error,
+    )
+}
+
+/// Extracts the functions from a subtree of a source file and writes them to individual files
+/// if they contain one of the provided keywords. Returns statistics about all the functions
+/// in the subtree.
+///
+///
+/// # Arguments
+///
+/// * project_id - The id of the project to which the file belongs.
+/// * `root` - The root node of the subtree.
+/// * `target_folder` - The folder where the functions are stored.
+/// * `language` - The language of the source file.
+/// * `grammar` - The grammar of the language.
+/// * `source` - The source code of the source file.
+/// * `keyword_files` - The keyword files containing the keywords to search for in the functions.
+/// * `fail_policy` - The policy to apply when a parse error is encountered.
+/// * `ignore_comments` - Whether to ignore comments when extracting functions, in addition to ignoring them during keyword matching.
+/// * `word_counter` - The matcher to use to count the words in the functions.
+/// * `cgo_policy` - The handling of the references to C in Go files importing "C".
+/// * `cgo` - Whether the file is a Go file importing "C".
+/// * `parser` - The parser to use to parse the functions.
+/// * `deadline` - The time after which the extraction is interrupted, if any.
+///
+/// # Returns
+///
+/// A tuple containing the statistics of the functions in the file and the function number after processing the file node,
+/// or None if the deadline is reached.
+///
+fn extract_functions(
+    project_id: u32,
+    root: &Node,
+    target_folder: &str,
+    language: &str,
+    grammar: &Grammar,
+    source: &[u8],
+    keyword_files: &KeywordFiles,
+    fail_policy: &str,
+    ignore_comments: bool,
+    word_counter: &Matcher,
+    cgo_policy: &str,
+    cgo: bool,
+    parser: &mut Parser,
+    deadline: Option<Instant>,
+) -> Result<Option<(String, usize, usize, Vec<usize>)>, Error> {
+    let mask_cgo: bool = cgo && cgo_policy == "mask";
+    let type_identifier: HashSet<&str> = HashSet::from(["type_identifier"]);
+    // Initializes the builder to store the statistics of the functions in the file
+    let mut builder: String = String::new();
+    let mut functions: usize = 0;
+    let mut functions_with_kw: usize = 0;
+    let mut functions_with_specific_kw: Vec<usize> = vec![0; keyword_files.paths.len()];
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+    let mut cursor = root.walk();
+
+    while let Some(node) = call_stack.pop() {
+        if deadline.is_some_and(|d| Instant::now() >= d) {
+            return Ok(None);
+        }
+        if grammar.function_nodes.contains(node.kind()) {
+            let has_error: bool = node.has_error();
+
+            if (has_error && fail_policy == "skip-function")
+                || (language == "java" && find_fields(&node, "body").is_empty())
+            {
+                continue;
+            } else {
+                // Function source code
+                let function_source_code: &[u8] = node_source_code(&node, source);
+                let function_position: (usize, usize) = (
+                    node.start_position().row + 1,
+                    node.start_position().column + 1,
+                );
+
+                let error_position: String = if has_error {
+                    position_to_string(find_first_error_position(&node).map(|(row, col)| {
+                        let error_row = row - function_position.0 + 1;
+                        if row == function_position.0 {
+                            (error_row, col - function_position.1 + 1)
+                        } else {
+                            (error_row, col)
+                        }
+                    }))
+                } else {
+                    "none".to_string()
+                };
+
+                // Fetch the code of the function and remove comments from it
+                let function_code_with_strings: &Vec<u8> =
+                    &remove_kind_from_source(function_source_code, &node, &grammar.comment_nodes);
+                // Re parse the function without comments to get the correct tree
+                let Some(tree_without_comments) =
+                    parse_before(parser, function_code_with_strings, deadline).with_context(
+                        || format!("Error parsing code for function {target_folder}/{functions}"),
+                    )?
+                else {
+                    return Ok(None);
+                };
+
+                // Remove string literals, and references to C if they are masked, from the function code
+                let root_without_comments: Node<'_> = tree_without_comments.root_node();
+                let mut hidden_nodes: Vec<Node<'_>> =
+                    find_kind(&root_without_comments, &grammar.string_literal_nodes);
+                if mask_cgo {
+                    hidden_nodes.extend(cgo_references(
+                        &root_without_comments,
+                        function_code_with_strings,
+                    ));
+                }
+                let function_code = &remove_nodes_from_source(
+                    function_code_with_strings,
+                    &root_without_comments,
+                    hidden_nodes,
+                );
+
+                let matches: Vec<usize> =
+                    keyword_files.count_matches_in_text(language, function_code);
+
+                if matches.iter().any(|x| *x > 0) {
+                    let function_path: String = format!(
+                        "{}/{}-{}",
+                        target_folder, function_position.0, function_position.1
+                    );
+
+                    std::fs::write(
+                        &function_path,
+                        if ignore_comments {
+                            function_code_with_strings
+                        } else {
+                            function_source_code
+                        },
+                    )?;
+
+                    // Count the number of loops, conditionals and parameters if the function
+                    let (loops, loop_nesting) = count_nodes_of_kind(&node, &grammar.loop_nodes);
+                    let (conditionals, conditional_nesting) =
+                        count_nodes_of_kind(&node, &grammar.cond_nodes);
+                    let (calls, calls_nesting) =
+                        count_nodes_of_kind(&node, &grammar.function_call_nodes);
+
+                    let params_vec: Vec<Node<'_>> =
+                        find_first_node_of_kind(&node, &grammar.param_seq_nodes, true);
+
+                    let mut name: String = String::from_utf8_lossy(
+                        find_first_field(&node, grammar.name_field)
+                            .map(|n| node_source_code(&n, source))
+                            .unwrap_or(b""),
+                    )
+                    .to_string();
+                    if let Some(idx) = name.find('(') {
+                        name.truncate(idx);
+                    }
+                    name = name.chars().filter(|c| !c.is_whitespace()).collect();
+
+                    // A type matches a keyword if its source code does, or if it uses a type parameter of the function whose constraint does,
+                    // e.g. T in func Sum[T float32 | float64](xs []T) T.
+                    let type_parameters: Vec<(&[u8], &[u8])> =
+                        type_parameter_constraints(&node, source);
+                    let type_matches = |t: &Node| {
+                        keyword_files
+                            .has_matches_in_text(language, &type_source_code(t, source, mask_cgo))
+                            || type_parameters.iter().any(|(name, constraint)| {
+                                keyword_files.has_matches_in_text(language, constraint)
+                                    && find_kind(t, &type_identifier)
+                                        .iter()
+                                        .any(|id| node_source_code(id, source) == *name)
+                            })
+                    };
+
+                    let mut n_param: usize = 0;
+                    let mut param_match: usize = 0;
+                    for params in params_vec {
+                        let matches = match grammar.param_type_field {
+                            Some(field) => {
+                                // Safe unwrap: whole source code was read as utf8 before
+                                // Safe unwrap: the pattern is already checked above
+                                find_fields(&params, field)
+                                    .into_iter()
+                                    .filter(|x| type_matches(x))
+                                    .count()
+                            }
+                            None => 0,
+                        };
+
+                        n_param += count_nodes_of_kind(&params, &grammar.param_nodes).0;
+                        param_match += matches;
+                    }
+
+                    let return_type_match = match grammar.return_type_field {
+                        Some(field) => {
+                            // Safe unwrap: whole source code was read as utf8 before
+                            // Safe unwrap: the pattern is already checked above
+                            find_first_field(&node, field)
+                                .filter(|x| type_matches(x))
+                                .map(|_| 1)
+                                .unwrap_or(0)
+                        }
+                        None => 0,
+                    };
+
+                    writeln!(
+                        &mut builder,
+                        "{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{},{}{}",
+                        project_id,
+                        &function_path
+                            .replace(",", "-was_comma-")
+                            .replace("\"", "-was_quote-"),
+                        name.replace(",", "-was_comma-")
+                            .replace("\"", "-was_quote-"),
+                        position_to_string(Some(function_position)),
+                        language,
+                        count_text_lines(function_code_with_strings),
+                        word_counter.count_matches_in_text(function_code_with_strings),
+                        matches
+                            .iter()
+                            .map(|x| x.to_string())
+                            .collect::<Vec<String>>()
+                            .join(","),
+                        loops,
+                        loop_nesting,
+                        conditionals,
+                        conditional_nesting,
+                        calls,
+                        calls_nesting,
+                        n_param,
+                        param_match,
+                        return_type_match,
+                        error_position,
+                        if cgo_policy == "record" {
+                            format!(",{}", cgo_references(&node, source).len())
+                        } else {
+                            String::new()
+                        },
+                    )?;
+                    functions_with_kw += 1;
+                    for (i, m) in matches.iter().enumerate() {
+                        if *m > 0 {
+                            functions_with_specific_kw[i] += 1;
+                        }
+                    }
+                }
+                functions += 1;
+            }
+        } else {
+            for c in node
+                .children(&mut cursor)
+                .collect::<Vec<_>>()
+                .into_iter()
+                .rev()
+            {
+                call_stack.push(c);
+            }
+        }
+    }
+    Ok(Some((
+        builder,
+        functions,
+        functions_with_kw,
+        functions_with_specific_kw,
+    )))
+}
+
+/// Returns the source code of a node in the parse tree
+///
+/// # Arguments
+///
+/// * `n` - The node to extract the source code from.
+/// * `source` - The source code of the whole file.
+fn node_source_code<'a>(n: &Node, source: &'a [u8]) -> &'a [u8] {
+    &source[n.start_byte()..n.end_byte()]
+}
+
+/// Grammar of a programming language.
+struct Grammar {
+    /// The programming language the grammar belongs to.
+    lang: Language,
+
     /// Nodes representing comments.
     comment_nodes: HashSet<&'static str>,
 
-    /// Nodes representing string literals.
-    string_literal_nodes: HashSet<&'static str>,
+    /// Nodes representing string literals.
+    string_literal_nodes: HashSet<&'static str>,
+
+    /// Nodes representing loops.
+    loop_nodes: HashSet<&'static str>,
+
+    /// Nodes representing conditional statements.
+    cond_nodes: HashSet<&'static str>,
+
+    /// Nodes representing functions or methods.
+    function_nodes: HashSet<&'static str>,
+
+    /// Nodes representing function or method calls.
+    function_call_nodes: HashSet<&'static str>,
+
+    /// Nodes representing a sequence of parameters of a function or method.  
+    param_seq_nodes: HashSet<&'static str>,
+
+    /// Nodes representing a parameter of a function or method.
+    param_nodes: HashSet<&'static str>,
+
+    /// The field name of the parameter type.
+    param_type_field: Option<&'static str>,
+
+    /// The field name of the return type.
+    return_type_field: Option<&'static str>,
+
+    /// The field name of the function or method name.
+    name_field: &'static str,
+}
+
+/// Returns the grammar for the C programming language.
+fn c_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_c::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
+        loop_nodes: vec!["for_statement", "while_statement", "do_statement"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_definition"].into_iter().collect(),
+        function_call_nodes: vec!["call_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
+        param_nodes: vec!["parameter_declaration"].into_iter().collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("type"),
+        name_field: "declarator",
+    }
+}
+
+/// Returns the grammar for the C++ programming language.
+fn cpp_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_cpp::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
+        loop_nodes: vec!["for_range_loop", "for_statement", "while_statement"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_definition", "template_declaration"]
+            .into_iter()
+            .collect(),
+        function_call_nodes: vec!["call_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
+        param_nodes: vec!["parameter_declaration", "variadic_parameter_declaration"]
+            .into_iter()
+            .collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("type"),
+        name_field: "declarator",
+    }
+}
+
+/// Returns the grammar for the C# programming language.
+fn cs_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_c_sharp::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec![
+            "string_literal",
+            "verbatim_string_literal",
+            "raw_string_literal",
+        ]
+        .into_iter()
+        .collect(),
+        loop_nodes: vec!["for_statement", "while_statement", "do_statement"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec![
+            "method_declaration",
+            "constructor_declaration",
+            "operator_declaration",
+        ]
+        .into_iter()
+        .collect(),
+        function_call_nodes: vec!["invocation_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
+        param_nodes: vec!["parameter"].into_iter().collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("returns"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the TypeScript programming language.
+fn ts_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_typescript::LANGUAGE_TYPESCRIPT.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_fragment"].into_iter().collect(),
+        loop_nodes: vec!["for_statement", "for_in_statement", "while_statement"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_statement", "switch_statement", "ternary_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_declaration", "method_definition"]
+            .into_iter()
+            .collect(),
+        function_call_nodes: vec![
+            "new_expression",
+            "call_expression",
+            "decorator_call_expression",
+        ]
+        .into_iter()
+        .collect(),
+        param_seq_nodes: vec!["formal_parameters"].into_iter().collect(),
+        param_nodes: vec!["required_parameter", "optional_parameter"]
+            .into_iter()
+            .collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("return_type"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Go programming language.
+fn go_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_go::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["raw_string_literal", "interpreted_string_literal"]
+            .into_iter()
+            .collect(),
+        loop_nodes: vec!["for_statement"].into_iter().collect(),
+        cond_nodes: vec![
+            "if_statement",
+            "type_switch_statement",
+            "expression_switch_statement",
+        ]
+        .into_iter()
+        .collect(),
+        function_nodes: vec!["function_declaration", "method_declaration"]
+            .into_iter()
+            .collect(),
+        function_call_nodes: vec!["call_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
+        param_nodes: vec!["parameter_declaration", "variadic_parameter_declaration"]
+            .into_iter()
+            .collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("result"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Java programming language.
+fn java_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_java::LANGUAGE.into(),
+        comment_nodes: vec!["line_comment", "block_comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
+        loop_nodes: vec![
+            "for_statement",
+            "enhanced_for_statement",
+            "while_statement",
+            "do_statement",
+        ]
+        .into_iter()
+        .collect(),
+        cond_nodes: vec!["if_statement", "ternary_expression", "switch_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["method_declaration", "compact_constructor_declaration"]
+            .into_iter()
+            .collect(),
+        function_call_nodes: vec!["method_invocation", "explicit_constructor_invocation"]
+            .into_iter()
+            .collect(),
+        param_seq_nodes: vec!["formal_parameters"].into_iter().collect(),
+        param_nodes: vec!["formal_parameter"].into_iter().collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("type"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Scala programming language.
+fn scala_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_scala::LANGUAGE.into(),
+        comment_nodes: vec!["comment", "block_comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string"].into_iter().collect(),
+        loop_nodes: vec!["for_expression", "while_expression", "do_while_expression"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_expression", "match_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_definition"].into_iter().collect(),
+        function_call_nodes: vec!["call_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameters"].into_iter().collect(),
+        param_nodes: vec!["parameter"].into_iter().collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("return_type"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Fortran programming language.
+fn fortran_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_fortran::LANGUAGE.into(),
+        comment_nodes: vec!["preproc_comment", "comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
+        loop_nodes: vec![
+            "loop_control_expression",
+            "where_statement",
+            "forall_statement",
+            "concurrent_statement",
+            "while_statement",
+        ]
+        .into_iter()
+        .collect(),
+        cond_nodes: vec![
+            "if_statement",
+            "arithmetic_if_statement",
+            "select_case_statement",
+            "select_rank_statement",
+            "select_type_statement",
+        ]
+        .into_iter()
+        .collect(),
+        function_nodes: vec!["function", "subroutine"].into_iter().collect(),
+        function_call_nodes: vec!["call_expression", "subroutine_call"]
+            .into_iter()
+            .collect(),
+        param_seq_nodes: vec!["parameters"].into_iter().collect(),
+        param_nodes: vec!["identifier"].into_iter().collect(),
+        param_type_field: None,
+        return_type_field: None,
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Python programming language.
+fn python_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_python::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string"].into_iter().collect(),
+        loop_nodes: vec!["for_statement", "while_statement"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_statement", "conditional_expression", "match_statement"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_definition", "lambda"].into_iter().collect(),
+        function_call_nodes: vec!["call"].into_iter().collect(),
+        param_seq_nodes: vec!["parameters"].into_iter().collect(),
+        param_nodes: vec!["parameter"].into_iter().collect(),
+        param_type_field: None,
+        return_type_field: None,
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar for the Rust programming language.
+fn rust_grammar() -> Grammar {
+    Grammar {
+        lang: tree_sitter_rust::LANGUAGE.into(),
+        comment_nodes: vec!["comment"].into_iter().collect(),
+        string_literal_nodes: vec!["string_literal", "raw_string_literal"]
+            .into_iter()
+            .collect(),
+        loop_nodes: vec!["for_expression", "loop", "while_expression"]
+            .into_iter()
+            .collect(),
+        cond_nodes: vec!["if_expression", "let_condition", "match_expression"]
+            .into_iter()
+            .collect(),
+        function_nodes: vec!["function_item", "closure_expression"]
+            .into_iter()
+            .collect(),
+        function_call_nodes: vec!["call_expression"].into_iter().collect(),
+        param_seq_nodes: vec!["parameters", "closure_parameters"]
+            .into_iter()
+            .collect(),
+        param_nodes: vec!["parameter"].into_iter().collect(),
+        param_type_field: Some("type"),
+        return_type_field: Some("return_type"),
+        name_field: "name",
+    }
+}
+
+/// Returns the grammar corresponding to the given language.
+///
+/// # Arguments
+///
+/// * `language` - The language of the file.
+///
+/// # Returns
+///
+/// The grammar corresponding to the language or `None` if the language is not supported.
+fn language_to_grammar(lang: &str) -> Option<Grammar> {
+    match lang.to_lowercase().as_str() {
+        "c" => Some(c_grammar()),
+        "c++" => Some(cpp_grammar()),
+        "c#" => Some(cs_grammar()),
+        "java" => Some(java_grammar()),
+        "fortran" => Some(fortran_grammar()),
+        "python" => Some(python_grammar()),
+        "typescript" => Some(ts_grammar()),
+        "go" => Some(go_grammar()),
+        "scala" => Some(scala_grammar()),
+        "rust" => Some(rust_grammar()),
+        _ => None,
+    }
+}
+
+/// Counts the number of nodes of given kinds in a tree.
+///
+/// # Arguments
+///
+/// * `node` - The root node of the tree.
+/// * `kind` - The kinds of nodes to count.
+///
+/// # Returns
+///
+/// A tuple containing the number of nodes of the given kind and the maximum nesting level of these nodes.
+///
+/// # Example
+///
+/// The function applied to a node representing the following code will return `(2, 2)` if the kind is `if_statement`:
+///
+/// ```c
+/// int main(int a, int b) {
+///     if (b > 0) {
+///         if (a > b) {
+///             return a;
+///         } else {
+///             return b;
+///         }
+///     }
+///     return 0;
+///  }
+/// ```
+///
+fn count_nodes_of_kind(root: &Node, kinds: &HashSet<&str>) -> (usize, usize) {
+    let mut node_count = 0;
+    let mut max_nesting = 0;
+
+    let mut cursor = root.walk();
 
-    /// Nodes representing loops.
-    loop_nodes: HashSet<&'static str>,
+    // Simulating call stack
+    let mut call_stack: Vec<(Node, usize)> = Vec::new();
+    call_stack.push((*root, 1));
 
-    /// Nodes representing conditional statements.
-    cond_nodes: HashSet<&'static str>,
+    while let Some((node, depth)) = call_stack.pop() {
+        let is_of_kind = kinds.contains(node.kind());
 
-    /// Nodes representing functions or methods.
-    function_nodes: HashSet<&'static str>,
+        if is_of_kind {
+            node_count += 1;
+            max_nesting = max_nesting.max(depth);
+        }
 
-    /// Nodes representing function or method calls.
-    function_call_nodes: HashSet<&'static str>,
+        // We don't reverse nodes for performance (yields the same result)
+        for child in node.children(&mut cursor) {
+            call_stack.push((child, if is_of_kind { depth + 1 } else { depth }));
+        }
+    }
 
-    /// Nodes representing a sequence of parameters of a function or method.  
-    param_seq_nodes: HashSet<&'static str>,
+    (node_count, max_nesting)
+}
 
-    /// Nodes representing a parameter of a function or method.
-    param_nodes: HashSet<&'static str>,
+fn find_first_node<'a>(
+    node: &Node<'a>,
+    pred: &dyn Fn(&Node) -> bool,
+    breadth: bool,
+) -> Vec<Node<'a>> {
+    let mut cursor = node.walk();
+    let mut call_stack: Vec<(Node, usize)> = Vec::new();
+    call_stack.push((*node, 0));
 
-    /// The field name of the parameter type.
-    param_type_field: Option<&'static str>,
+    let mut res: Vec<Node<'a>> = Vec::new();
+    let mut max_depth: Option<usize> = None;
 
-    /// The field name of the return type.
-    return_type_field: Option<&'static str>,
+    while let Some((node, depth)) = call_stack.pop() {
+        if max_depth.filter(|&d| depth > d).is_some() {
+            return res;
+        } else if pred(&node) {
+            if breadth {
+                res.push(node);
+                if max_depth.is_none() {
+                    max_depth = Some(depth);
+                }
+            } else {
+                return vec![node];
+            }
+        } else if breadth {
+            let mut end_queue: Vec<(Node, usize)> =
+                node.children(&mut cursor).map(|c| (c, depth + 1)).collect();
+            end_queue.extend(call_stack);
+            call_stack = end_queue;
+        } else {
+            for c in node
+                .children(&mut cursor)
+                .collect::<Vec<_>>()
+                .into_iter()
+                .rev()
+            {
+                call_stack.push((c, 0));
+            }
+        }
+    }
+    vec![]
+}
 
-    /// The field name of the function or method name.
-    name_field: &'static str,
+fn find_first_node_of_kind<'a>(
+    root: &Node<'a>,
+    kind: &HashSet<&str>,
+    breadth: bool,
+) -> Vec<Node<'a>> {
+    find_first_node(root, &|n: &Node| kind.contains(n.kind()), breadth)
 }
 
-/// Returns the grammar for the C programming language.
-fn c_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_c::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
-        loop_nodes: vec!["for_statement", "while_statement", "do_statement"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_definition"].into_iter().collect(),
-        function_call_nodes: vec!["call_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
-        param_nodes: vec!["parameter_declaration"].into_iter().collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("type"),
-        name_field: "declarator",
+/// Finds the first error node in the tree
+///
+/// # Arguments
+///
+/// * `root` - The root node of the tree.
+///
+/// # Returns
+///
+/// The first error node found in the tree, or `None` if no error node is found.
+fn find_first_error_node<'a>(root: &Node<'a>) -> Option<Node<'a>> {
+    find_first_node(root, &|n: &Node| n.is_error() || n.is_missing(), false)
+        .into_iter()
+        .next()
+}
+
+/// Lists the syntax errors of a subtree, i.e. the nodes Tree-sitter could not parse and the nodes it inserted to recover.
+/// Errors nested in another error are part of it and not listed separately.
+fn find_error_nodes<'a>(root: &Node<'a>) -> Vec<Node<'a>> {
+    let mut res: Vec<Node<'a>> = Vec::new();
+    let mut cursor = root.walk();
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+
+    while let Some(node) = call_stack.pop() {
+        if node.is_error() || node.is_missing() {
+            res.push(node);
+        } else if node.has_error() {
+            for c in node
+                .children(&mut cursor)
+                .collect::<Vec<_>>()
+                .into_iter()
+                .rev()
+            {
+                call_stack.push(c);
+            }
+        }
     }
+    res
 }
 
-/// Returns the grammar for the C++ programming language.
-fn cpp_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_cpp::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
-        loop_nodes: vec!["for_range_loop", "for_statement", "while_statement"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_definition", "template_declaration"]
-            .into_iter()
-            .collect(),
-        function_call_nodes: vec!["call_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
-        param_nodes: vec!["parameter_declaration", "variadic_parameter_declaration"]
-            .into_iter()
-            .collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("type"),
-        name_field: "declarator",
+/// Returns the syntax errors of a source file, one CSV row each, with:
+/// * The kind of the error: `error` for code that could not be parsed, `missing` for a node inserted to recover.
+/// * The start and end positions of the error.
+/// * The position of the function containing the error, as in the functions output file, or none.
+/// * The code that could not be parsed, or the kind of the missing node.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `grammar` - The grammar of the language of the file.
+/// * `source` - The source code of the file.
+fn syntax_error_rows(
+    project_id: u32,
+    path: &str,
+    root: &Node,
+    grammar: &Grammar,
+    source: &[u8],
+) -> Result<String> {
+    let mut builder: String = String::new();
+    for node in find_error_nodes(root) {
+        let mut function: Option<Node<'_>> = node.parent();
+        while let Some(f) = function.filter(|f| !grammar.function_nodes.contains(f.kind())) {
+            function = f.parent();
+        }
+        let (kind, text): (&str, String) = if node.is_missing() {
+            ("missing", node.kind().to_string())
+        } else {
+            (
+                "error",
+                String::from_utf8_lossy(node_source_code(&node, source))
+                    .split_whitespace()
+                    .collect::<Vec<&str>>()
+                    .join(" ")
+                    .chars()
+                    .take(80)
+                    .collect(),
+            )
+        };
+        writeln!(
+            &mut builder,
+            "{},{},{},{},{},{},{}",
+            project_id,
+            path.replace(",", "-was_comma-")
+                .replace("\"", "-was_quote-"),
+            kind,
+            position_to_string(Some((
+                node.start_position().row + 1,
+                node.start_position().column + 1
+            ))),
+            position_to_string(Some((
+                node.end_position().row + 1,
+                node.end_position().column + 1
+            ))),
+            position_to_string(
+                function.map(|f| (f.start_position().row + 1, f.start_position().column + 1))
+            )
+            .replace("not-found", "none"),
+            text.replace(",", "-was_comma-")
+                .replace("\"", "-was_quote-"),
+        )?;
     }
+    Ok(builder)
 }
 
-/// Returns the grammar for the C# programming language.
-fn cs_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_c_sharp::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec![
-            "string_literal",
-            "verbatim_string_literal",
-            "raw_string_literal",
-        ]
-        .into_iter()
-        .collect(),
-        loop_nodes: vec!["for_statement", "while_statement", "do_statement"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_statement", "switch_statement", "conditional_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec![
-            "method_declaration",
-            "constructor_declaration",
-            "operator_declaration",
-        ]
-        .into_iter()
-        .collect(),
-        function_call_nodes: vec!["invocation_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
-        param_nodes: vec!["parameter"].into_iter().collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("returns"),
-        name_field: "name",
+fn find_first_error_position(root: &Node) -> Option<(usize, usize)> {
+    find_first_error_node(root).map(|n| (n.start_position().row + 1, n.start_position().column + 1))
+}
+
+fn position_to_string(position: Option<(usize, usize)>) -> String {
+    match position {
+        Some((row, col)) => format!("{row}:{col}"),
+        None => "not-found".to_string(),
     }
 }
 
-/// Returns the grammar for the TypeScript programming language.
-fn ts_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_typescript::LANGUAGE_TYPESCRIPT.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_fragment"].into_iter().collect(),
-        loop_nodes: vec!["for_statement", "for_in_statement", "while_statement"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_statement", "switch_statement", "ternary_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_declaration", "method_definition"]
-            .into_iter()
-            .collect(),
-        function_call_nodes: vec![
-            "new_expression",
-            "call_expression",
-            "decorator_call_expression",
-        ]
-        .into_iter()
-        .collect(),
-        param_seq_nodes: vec!["formal_parameters"].into_iter().collect(),
-        param_nodes: vec!["required_parameter", "optional_parameter"]
+fn find_fields<'a>(root: &Node<'a>, field: &str) -> Vec<Node<'a>> {
+    let mut res: Vec<Node<'a>> = Vec::new();
+    let mut ids: HashSet<usize> = HashSet::new();
+
+    let mut cursor = root.walk();
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+
+    while let Some(node) = call_stack.pop() {
+        for c in node.children_by_field_name(field, &mut node.walk()) {
+            res.push(c);
+            ids.insert(c.id());
+        }
+
+        // We don't reverse nodes for performance (yields the same result)
+        for c in node
+            .children(&mut cursor)
+            .collect::<Vec<_>>()
             .into_iter()
-            .collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("return_type"),
-        name_field: "name",
+            .rev()
+        {
+            if !ids.contains(&c.id()) {
+                call_stack.push(c);
+            }
+        }
     }
+
+    res
 }
 
-/// Returns the grammar for the Go programming language.
-fn go_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_go::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["raw_string_literal", "interpreted_string_literal"]
-            .into_iter()
-            .collect(),
-        loop_nodes: vec!["for_statement"].into_iter().collect(),
-        cond_nodes: vec![
-            "if_statement",
-            "type_switch_statement",
-            "expression_switch_statement",
-        ]
-        .into_iter()
-        .collect(),
-        function_nodes: vec!["function_declaration", "method_declaration"]
-            .into_iter()
-            .collect(),
-        function_call_nodes: vec!["call_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameter_list"].into_iter().collect(),
-        param_nodes: vec!["parameter_declaration", "variadic_parameter_declaration"]
+/// Finds the first field with the given name in the tree
+///
+/// # Arguments
+///
+/// * `root` - The root node of the tree.
+/// * `field` - The name of the field to find.
+///
+/// # Returns
+///
+/// The first node found with the given field name, or `None` if no such node is found.
+fn find_first_field<'a>(root: &Node<'a>, field: &str) -> Option<Node<'a>> {
+    let mut cursor = root.walk();
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+
+    while let Some(node) = call_stack.pop() {
+        if let Some(c) = node.child_by_field_name(field) {
+            return Some(c);
+        }
+
+        // We don't reverse nodes for performance (yields the same result)
+        for c in node
+            .children(&mut cursor)
+            .collect::<Vec<_>>()
             .into_iter()
-            .collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("result"),
-        name_field: "name",
+            .rev()
+        {
+            call_stack.push(c);
+        }
     }
+
+    None
 }
 
-/// Returns the grammar for the Java programming language.
-fn java_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_java::LANGUAGE.into(),
-        comment_nodes: vec!["line_comment", "block_comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
-        loop_nodes: vec![
-            "for_statement",
-            "enhanced_for_statement",
-            "while_statement",
-            "do_statement",
-        ]
-        .into_iter()
-        .collect(),
-        cond_nodes: vec!["if_statement", "ternary_expression", "switch_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["method_declaration", "compact_constructor_declaration"]
-            .into_iter()
-            .collect(),
-        function_call_nodes: vec!["method_invocation", "explicit_constructor_invocation"]
-            .into_iter()
-            .collect(),
-        param_seq_nodes: vec!["formal_parameters"].into_iter().collect(),
-        param_nodes: vec!["formal_parameter"].into_iter().collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("type"),
-        name_field: "name",
+fn find_kind<'a>(root: &Node<'a>, kinds: &HashSet<&str>) -> Vec<Node<'a>> {
+    let mut res: Vec<Node<'a>> = Vec::new();
+
+    let mut cursor = root.walk();
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+
+    while let Some(node) = call_stack.pop() {
+        if kinds.contains(node.kind()) {
+            res.push(node);
+        } else {
+            // We don't reverse nodes for performance (yields the same result)
+            for c in node.children(&mut cursor) {
+                call_stack.push(c);
+            }
+        }
     }
+
+    res
 }
 
-/// Returns the grammar for the Scala programming language.
-fn scala_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_scala::LANGUAGE.into(),
-        comment_nodes: vec!["comment", "block_comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string"].into_iter().collect(),
-        loop_nodes: vec!["for_expression", "while_expression", "do_while_expression"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_expression", "match_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_definition"].into_iter().collect(),
-        function_call_nodes: vec!["call_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameters"].into_iter().collect(),
-        param_nodes: vec!["parameter"].into_iter().collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("return_type"),
-        name_field: "name",
+fn remove_kind_from_source(source: &[u8], root: &Node, kinds: &HashSet<&str>) -> Vec<u8> {
+    remove_nodes_from_source(source, root, find_kind(root, kinds))
+}
+
+/// Removes non-overlapping nodes of a subtree from its source code.
+fn remove_nodes_from_source(source: &[u8], root: &Node, mut nodes: Vec<Node>) -> Vec<u8> {
+    nodes.sort_by_key(|b| std::cmp::Reverse(b.start_byte()));
+    // Disable mutability
+    let nodes = nodes;
+
+    let root_start = root.start_byte();
+    let mut new_source = source.to_vec();
+    for n in nodes {
+        new_source.drain(n.start_byte() - root_start..n.end_byte() - root_start);
     }
+    new_source
 }
 
-/// Returns the grammar for the Fortran programming language.
-fn fortran_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_fortran::LANGUAGE.into(),
-        comment_nodes: vec!["preproc_comment", "comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_literal"].into_iter().collect(),
-        loop_nodes: vec![
-            "loop_control_expression",
-            "where_statement",
-            "forall_statement",
-            "concurrent_statement",
-            "while_statement",
-        ]
-        .into_iter()
-        .collect(),
-        cond_nodes: vec![
-            "if_statement",
-            "arithmetic_if_statement",
-            "select_case_statement",
-            "select_rank_statement",
-            "select_type_statement",
-        ]
-        .into_iter()
-        .collect(),
-        function_nodes: vec!["function", "subroutine"].into_iter().collect(),
-        function_call_nodes: vec!["call_expression", "subroutine_call"]
-            .into_iter()
-            .collect(),
-        param_seq_nodes: vec!["parameters"].into_iter().collect(),
-        param_nodes: vec!["identifier"].into_iter().collect(),
-        param_type_field: None,
-        return_type_field: None,
-        name_field: "name",
+/// Whether a Go source file has a package clause. Files without one are code fragments rather than complete files.
+fn has_package_clause(root: &Node) -> bool {
+    let mut cursor = root.walk();
+    let has_package_clause: bool = root
+        .children(&mut cursor)
+        .any(|c| c.kind() == "package_clause");
+    has_package_clause
+}
+
+/// Whether a file is a Go test file, i.e. its name ends with _test.go.
+fn is_test_file(path: &str) -> bool {
+    path.ends_with("_test.go")
+}
+
+/// Returns the kind of test file of a file: "external" for the test files of an external test package, whose name
+/// ends with _test, "internal" for the other test files, which belong to the package under test, and "none" for the
+/// files that are not Go test files.
+fn test_file_kind(path: &str, language: &str, root: &Node, source: &[u8]) -> &'static str {
+    if language != "go" || !is_test_file(path) {
+        return "none";
+    }
+    let mut cursor = root.walk();
+    let external: bool = root
+        .children(&mut cursor)
+        .filter(|c| c.kind() == "package_clause")
+        .filter_map(|c| c.named_child(0))
+        .any(|name| node_source_code(&name, source).ends_with(b"_test"));
+    if external {
+        "external"
+    } else {
+        "internal"
     }
 }
 
-/// Returns the grammar for the Python programming language.
-fn python_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_python::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string"].into_iter().collect(),
-        loop_nodes: vec!["for_statement", "while_statement"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_statement", "conditional_expression", "match_statement"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_definition", "lambda"].into_iter().collect(),
-        function_call_nodes: vec!["call"].into_iter().collect(),
-        param_seq_nodes: vec!["parameters"].into_iter().collect(),
-        param_nodes: vec!["parameter"].into_iter().collect(),
-        param_type_field: None,
-        return_type_field: None,
-        name_field: "name",
+/// Returns the Go version of the module a Go file belongs to, or "none" for the files of other languages
+/// and the Go files outside of any module.
+fn go_version(path: &str, language: &str, versions: &GoVersions) -> String {
+    if language != "go" {
+        return "none".to_string();
     }
+    versions
+        .of_file(Path::new(path))
+        .map_or("none".to_string(), |version| escape_path(&version))
 }
 
-/// Returns the grammar for the Rust programming language.
-fn rust_grammar() -> Grammar {
-    Grammar {
-        lang: tree_sitter_rust::LANGUAGE.into(),
-        comment_nodes: vec!["comment"].into_iter().collect(),
-        string_literal_nodes: vec!["string_literal", "raw_string_literal"]
-            .into_iter()
-            .collect(),
-        loop_nodes: vec!["for_expression", "loop", "while_expression"]
-            .into_iter()
-            .collect(),
-        cond_nodes: vec!["if_expression", "let_condition", "match_expression"]
-            .into_iter()
-            .collect(),
-        function_nodes: vec!["function_item", "closure_expression"]
-            .into_iter()
-            .collect(),
-        function_call_nodes: vec!["call_expression"].into_iter().collect(),
-        param_seq_nodes: vec!["parameters", "closure_parameters"]
-            .into_iter()
-            .collect(),
-        param_nodes: vec!["parameter"].into_iter().collect(),
-        param_type_field: Some("type"),
-        return_type_field: Some("return_type"),
-        name_field: "name",
+/// Whether a Go source file imports the pseudo-package "C", i.e. uses cgo.
+fn imports_c(root: &Node, source: &[u8]) -> bool {
+    find_kind(root, &HashSet::from(["import_spec"]))
+        .iter()
+        .any(|spec| {
+            spec.child_by_field_name("path")
+                .is_some_and(|path| node_source_code(&path, source) == b"\"C\"")
+        })
+}
+
+/// Returns the references to C (`C.name`) in a subtree of a Go source file, in expressions and in types.
+/// The preamble of cgo files is a comment and is therefore never part of the references.
+fn cgo_references<'a>(root: &Node<'a>, source: &[u8]) -> Vec<Node<'a>> {
+    let mut res: Vec<Node<'a>> = Vec::new();
+
+    let mut cursor = root.walk();
+
+    // Simulating call stack
+    let mut call_stack: Vec<Node> = Vec::new();
+    call_stack.push(*root);
+
+    while let Some(node) = call_stack.pop() {
+        let qualifier: Option<Node<'_>> = match node.kind() {
+            "selector_expression" => node.child_by_field_name("operand"),
+            "qualified_type" => node.child_by_field_name("package"),
+            _ => None,
+        };
+        if qualifier.is_some_and(|q| node_source_code(&q, source) == b"C") {
+            res.push(node);
+        } else {
+            for c in node.children(&mut cursor) {
+                call_stack.push(c);
+            }
+        }
     }
+
+    res
 }
 
-/// Returns the grammar corresponding to the given language.
-///
-/// # Arguments
-///
-/// * `language` - The language of the file.
-///
-/// # Returns
-///
-/// The grammar corresponding to the language or `None` if the language is not supported.
-fn language_to_grammar(lang: &str) -> Option<Grammar> {
-    match lang.to_lowercase().as_str() {
-        "c" => Some(c_grammar()),
-        "c++" => Some(cpp_grammar()),
-        "c#" => Some(cs_grammar()),
-        "java" => Some(java_grammar()),
-        "fortran" => Some(fortran_grammar()),
-        "python" => Some(python_grammar()),
-        "typescript" => Some(ts_grammar()),
-        "go" => Some(go_grammar()),
-        "scala" => Some(scala_grammar()),
-        "rust" => Some(rust_grammar()),
-        _ => None,
+/// Returns the names of the type parameters of a Go function and the source code of their constraints.
+/// Functions of other languages and non-generic functions have no type parameters.
+fn type_parameter_constraints<'a>(function: &Node, source: &'a [u8]) -> Vec<(&'a [u8], &'a [u8])> {
+    let mut res: Vec<(&[u8], &[u8])> = Vec::new();
+    if let Some(list) = function.child_by_field_name("type_parameters") {
+        for declaration in find_kind(&list, &HashSet::from(["type_parameter_declaration"])) {
+            if let Some(constraint) = declaration.child_by_field_name("type") {
+                let mut cursor = declaration.walk();
+                for name in declaration.children_by_field_name("name", &mut cursor) {
+                    res.push((
+                        node_source_code(&name, source),
+                        node_source_code(&constraint, source),
+                    ));
+                }
+            }
+        }
     }
+    res
 }
 
-/// Counts the number of nodes of given kinds in a tree.
+/// Extracts the `//go:embed` directives of a Go source file, one CSV row for every pattern of every directive.
+/// A directive applies to the variable declared right after it, possibly separated by other comments.
+/// Malformed directives are skipped with a warning.
 ///
 /// # Arguments
 ///
-/// * `node` - The root node of the tree.
-/// * `kind` - The kinds of nodes to count.
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+/// * `verify` - Whether to count the files matched by every pattern, relative to the directory of the file.
+fn extract_embeds(
+    project_id: u32,
+    path: &str,
+    root: &Node,
+    source: &[u8],
+    verify: bool,
+) -> Result<String> {
+    let mut builder: String = String::new();
+    let dir: &Path = Path::new(path).parent().unwrap_or(Path::new(""));
+    for comment in find_kind(root, &HashSet::from(["comment"])) {
+        let text = String::from_utf8_lossy(node_source_code(&comment, source));
+        let patterns: Vec<String> = match embed_patterns(&text) {
+            Ok(Some(patterns)) => patterns,
+            Ok(None) => continue,
+            Err(e) => {
+                warn!("Invalid //go:embed directive in {path}: {e}");
+                continue;
+            }
+        };
+        let mut next: Option<Node> = comment.next_named_sibling();
+        while let Some(node) = next.filter(|n| n.kind() == "comment") {
+            next = node.next_named_sibling();
+        }
+        // The directive either precedes a var declaration or a specification of a var block.
+        let variable: String = next
+            .and_then(|n| match n.kind() {
+                "var_declaration" => n.named_child(0),
+                _ => Some(n),
+            })
+            // Blocks wrap their specifications in a list in recent versions of the grammar.
+            .and_then(|n| match n.kind() {
+                "var_spec_list" => n.named_child(0),
+                _ => Some(n),
+            })
+            .filter(|spec| spec.kind() == "var_spec")
+            .and_then(|spec| spec.child_by_field_name("name"))
+            .map_or(String::new(), |name| {
+                String::from_utf8_lossy(node_source_code(&name, source)).to_string()
+            });
+        for pattern in patterns {
+            write!(
+                &mut builder,
+                "{},{},{},{},{}",
+                project_id,
+                escape_path(path),
+                position_to_string(Some((
+                    comment.start_position().row + 1,
+                    comment.start_position().column + 1
+                ))),
+                variable,
+                escape_text(&pattern),
+            )?;
+            if verify {
+                write!(&mut builder, ",{}", embedded_files(dir, &pattern)?)?;
+            }
+            builder.push('\n');
+        }
+    }
+    Ok(builder)
+}
+
+/// Splits a `//go:` directive into its name and its arguments.
+/// As for the Go toolchain, there is no space between the slashes and the name.
 ///
 /// # Returns
 ///
-/// A tuple containing the number of nodes of the given kind and the maximum nesting level of these nodes.
-///
-/// # Example
-///
-/// The function applied to a node representing the following code will return `(2, 2)` if the kind is `if_statement`:
+/// The name and the arguments of the directive, or `None` if the comment is not a `//go:` directive.
+fn go_directive(comment: &str) -> Option<(&str, &str)> {
+    let directive: &str = comment.strip_prefix("//go:")?.trim_end();
+    let (name, arguments) = directive
+        .split_once(char::is_whitespace)
+        .unwrap_or((directive, ""));
+    (!name.is_empty()).then_some((name, arguments.trim()))
+}
+
+/// Extracts the `//go:` directives of a Go source file, such as noinline, linkname or generate, one CSV row each.
+/// Only comments starting a line are directives. A directive applies to the declaration starting on the line right after it,
+/// possibly separated by other comments, and to no declaration otherwise, which is the case of file-level directives such as
+/// `//go:build` or `//go:generate`.
 ///
-/// ```c
-/// int main(int a, int b) {
-///     if (b > 0) {
-///         if (a > b) {
-///             return a;
-///         } else {
-///             return b;
-///         }
-///     }
-///     return 0;
-///  }
-/// ```
+/// # Arguments
 ///
-fn count_nodes_of_kind(root: &Node, kinds: &HashSet<&str>) -> (usize, usize) {
-    let mut node_count = 0;
-    let mut max_nesting = 0;
-
-    let mut cursor = root.walk();
-
-    // Simulating call stack
-    let mut call_stack: Vec<(Node, usize)> = Vec::new();
-    call_stack.push((*root, 1));
-
-    while let Some((node, depth)) = call_stack.pop() {
-        let is_of_kind = kinds.contains(node.kind());
-
-        if is_of_kind {
-            node_count += 1;
-            max_nesting = max_nesting.max(depth);
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `grammar` - The grammar of the Go language.
+/// * `source` - The source code of the file.
+fn extract_directives(
+    project_id: u32,
+    path: &str,
+    root: &Node,
+    grammar: &Grammar,
+    source: &[u8],
+) -> Result<String> {
+    let mut builder: String = String::new();
+    for comment in find_kind(root, &HashSet::from(["comment"])) {
+        let text = String::from_utf8_lossy(node_source_code(&comment, source));
+        let Some((name, arguments)) = go_directive(&text) else {
+            continue;
+        };
+        let line_start: usize = source[..comment.start_byte()]
+            .iter()
+            .rposition(|b| *b == b'\n')
+            .map_or(0, |i| i + 1);
+        if !source[line_start..comment.start_byte()]
+            .iter()
+            .all(u8::is_ascii_whitespace)
+        {
+            continue;
         }
-
-        // We don't reverse nodes for performance (yields the same result)
-        for child in node.children(&mut cursor) {
-            call_stack.push((child, if is_of_kind { depth + 1 } else { depth }));
+        // The directive may be followed by other comments on the next lines, e.g. a doc comment.
+        let mut last: Node = comment;
+        let mut next: Option<Node> = comment.next_named_sibling();
+        while let Some(node) = next.filter(|n| {
+            n.kind() == "comment" && n.start_position().row == last.end_position().row + 1
+        }) {
+            last = node;
+            next = node.next_named_sibling();
         }
+        let target: Option<Node> = next.filter(|n| {
+            is_declaration(n, grammar) && n.start_position().row == last.end_position().row + 1
+        });
+        writeln!(
+            &mut builder,
+            "{},{},{},{},{},{},{}",
+            project_id,
+            escape_path(path),
+            position_to_string(Some((
+                comment.start_position().row + 1,
+                comment.start_position().column + 1
+            ))),
+            escape_text(name),
+            escape_text(arguments),
+            target
+                .and_then(|t| declaration_name(&t, source))
+                .map_or(String::new(), |name| escape_text(&name)),
+            target.map_or("", |t| t.kind()),
+        )?;
     }
+    Ok(builder)
+}
 
-    (node_count, max_nesting)
+/// Returns the name under which a Go file imports a package, if it imports it.
+/// Blank and dot imports have no name under which the package can be referred to.
+fn import_name(root: &Node, source: &[u8], package: &str) -> Option<String> {
+    find_kind(root, &HashSet::from(["import_spec"]))
+        .iter()
+        .find(|spec| {
+            spec.child_by_field_name("path").is_some_and(|path| {
+                node_source_code(&path, source) == format!("\"{package}\"").as_bytes()
+            })
+        })
+        .and_then(|spec| match spec.child_by_field_name("name") {
+            Some(name) => {
+                let name = String::from_utf8_lossy(node_source_code(&name, source)).to_string();
+                (name != "_" && name != ".").then_some(name)
+            }
+            None => package.rsplit('/').next().map(str::to_string),
+        })
 }
 
-fn find_first_node<'a>(
-    node: &Node<'a>,
-    pred: &dyn Fn(&Node) -> bool,
-    breadth: bool,
-) -> Vec<Node<'a>> {
-    let mut cursor = node.walk();
-    let mut call_stack: Vec<(Node, usize)> = Vec::new();
-    call_stack.push((*node, 0));
+/// Returns the package and the name of a qualified identifier, either a selector expression or a qualified type.
+fn qualified_name<'a>(node: &Node, source: &'a [u8]) -> Option<(&'a [u8], &'a [u8])> {
+    let (package, name) = match node.kind() {
+        "selector_expression" => (
+            node.child_by_field_name("operand")?,
+            node.child_by_field_name("field")?,
+        ),
+        "qualified_type" => (
+            node.child_by_field_name("package")?,
+            node.child_by_field_name("name")?,
+        ),
+        _ => return None,
+    };
+    (package.kind() == "identifier" || package.kind() == "package_identifier").then(|| {
+        (
+            node_source_code(&package, source),
+            node_source_code(&name, source),
+        )
+    })
+}
 
-    let mut res: Vec<Node<'a>> = Vec::new();
-    let mut max_depth: Option<usize> = None;
+/// Extracts the unsafe uses of a Go source file, one CSV row each, in the order of the file:
+/// * `unsafe.<name>`: a use of a member of the unsafe package, such as unsafe.Pointer or unsafe.Add. For calls and conversions,
+///   the expression is the whole call.
+/// * `uintptr`: a conversion to uintptr.
+/// * `reflect.SliceHeader`, `reflect.StringHeader`: a use of the slice and string headers of the reflect package.
+///
+/// Every use is recorded with its enclosing function, and with whether cgo is involved: `expression` if the outermost expression
+/// containing the use refers to the C pseudo-package, `file` if only the file imports it, and `none` otherwise.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn extract_unsafe_uses(project_id: u32, path: &str, root: &Node, source: &[u8]) -> Result<String> {
+    let unsafe_name: Option<String> = import_name(root, source, "unsafe");
+    let reflect_name: Option<String> = import_name(root, source, "reflect");
+    let file_cgo: bool = imports_c(root, source);
+
+    // Whether a node refers to the C pseudo-package.
+    let refers_to_c = |node: &Node| -> bool {
+        let mut stack: Vec<Node> = vec![*node];
+        while let Some(n) = stack.pop() {
+            if qualified_name(&n, source).is_some_and(|(package, _)| package == b"C") {
+                return true;
+            }
+            let mut cursor = n.walk();
+            stack.extend(n.named_children(&mut cursor));
+        }
+        false
+    };
 
-    while let Some((node, depth)) = call_stack.pop() {
-        if max_depth.filter(|&d| depth > d).is_some() {
-            return res;
-        } else if pred(&node) {
-            if breadth {
-                res.push(node);
-                if max_depth.is_none() {
-                    max_depth = Some(depth);
+    let mut builder: String = String::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+
+        let use_of: Option<(String, Node)> = match qualified_name(&node, source) {
+            Some((package, name)) if unsafe_name.as_deref().map(str::as_bytes) == Some(package) => {
+                // Calls and conversions are recorded as a whole.
+                let call: Node = node
+                    .parent()
+                    .filter(|p| {
+                        p.kind() == "call_expression"
+                            && p.child_by_field_name("function") == Some(node)
+                    })
+                    .unwrap_or(node);
+                Some((format!("unsafe.{}", String::from_utf8_lossy(name)), call))
+            }
+            Some((package, name))
+                if reflect_name.as_deref().map(str::as_bytes) == Some(package)
+                    && (name == b"SliceHeader" || name == b"StringHeader") =>
+            {
+                Some((format!("reflect.{}", String::from_utf8_lossy(name)), node))
+            }
+            _ if node.kind() == "call_expression"
+                && node
+                    .child_by_field_name("function")
+                    .is_some_and(|f| node_source_code(&f, source) == b"uintptr") =>
+            {
+                Some(("uintptr".to_string(), node))
+            }
+            _ => None,
+        };
+        let Some((kind, expression)) = use_of else {
+            continue;
+        };
+
+        let mut outermost: Node = expression;
+        let mut function: String = String::new();
+        let mut ancestor: Option<Node> = expression.parent();
+        while let Some(a) = ancestor {
+            if function.is_empty()
+                && (a.kind() == "function_declaration" || a.kind() == "method_declaration")
+            {
+                if let Some(name) = a.child_by_field_name("name") {
+                    function = String::from_utf8_lossy(node_source_code(&name, source)).to_string();
                 }
-            } else {
-                return vec![node];
             }
-        } else if breadth {
-            let mut end_queue: Vec<(Node, usize)> =
-                node.children(&mut cursor).map(|c| (c, depth + 1)).collect();
-            end_queue.extend(call_stack);
-            call_stack = end_queue;
-        } else {
-            for c in node
-                .children(&mut cursor)
-                .collect::<Vec<_>>()
-                .into_iter()
-                .rev()
+            if outermost.parent() == Some(a)
+                && (a.kind().ends_with("_expression")
+                    || a.kind().ends_with("_type")
+                    || a.kind() == "argument_list"
+                    || a.kind() == "expression_list")
             {
-                call_stack.push((c, 0));
+                outermost = a;
             }
+            ancestor = a.parent();
         }
+        let cgo: &str = if refers_to_c(&outermost) {
+            "expression"
+        } else if file_cgo {
+            "file"
+        } else {
+            "none"
+        };
+        writeln!(
+            &mut builder,
+            "{},{},{},{},{},{},{}",
+            project_id,
+            escape_path(path),
+            position_to_string(Some((
+                expression.start_position().row + 1,
+                expression.start_position().column + 1
+            ))),
+            kind,
+            escape_text(&String::from_utf8_lossy(node_source_code(
+                &expression,
+                source
+            ))),
+            function,
+            cgo,
+        )?;
     }
-    vec![]
+    Ok(builder)
 }
 
-fn find_first_node_of_kind<'a>(
-    root: &Node<'a>,
-    kind: &HashSet<&str>,
-    breadth: bool,
-) -> Vec<Node<'a>> {
-    find_first_node(root, &|n: &Node| kind.contains(n.kind()), breadth)
+/// Predeclared types of Go to which a constant can be converted.
+const BASIC_TYPES: [&str; 19] = [
+    "bool",
+    "byte",
+    "complex64",
+    "complex128",
+    "float32",
+    "float64",
+    "int",
+    "int8",
+    "int16",
+    "int32",
+    "int64",
+    "rune",
+    "string",
+    "uint",
+    "uint8",
+    "uint16",
+    "uint32",
+    "uint64",
+    "uintptr",
+];
+
+/// Returns the kind of a literal and the default type of the untyped constant it denotes, if the node is a basic literal.
+fn basic_literal(node: &Node) -> Option<(&'static str, &'static str)> {
+    match node.kind() {
+        "int_literal" => Some(("int", "int")),
+        "float_literal" => Some(("float", "float64")),
+        "imaginary_literal" => Some(("imaginary", "complex128")),
+        "rune_literal" => Some(("rune", "rune")),
+        "interpreted_string_literal" | "raw_string_literal" => Some(("string", "string")),
+        _ => None,
+    }
 }
 
-/// Finds the first error node in the tree
-///
-/// # Arguments
+/// Infers the type of a basic literal from its context, and returns it with its origin:
+/// * `declaration`: the type of the constant or variable declaration the literal is the value of.
+/// * `conversion`: the predeclared type the literal is converted to, e.g. float32 in `float32(1e-9)`.
+/// * `default`: the default type of the untyped constant, e.g. float64 for 1e-9.
 ///
-/// * `root` - The root node of the tree.
+/// The name of the constant or variable the literal is the value of is returned too, if any.
+fn infer_literal_type(node: &Node, default: &str, source: &[u8]) -> (String, &'static str, String) {
+    let text = |n: &Node| String::from_utf8_lossy(node_source_code(n, source)).to_string();
+    // The literal may be negated or parenthesized.
+    let mut value: Node = *node;
+    while let Some(parent) = value
+        .parent()
+        .filter(|p| p.kind() == "unary_expression" || p.kind() == "parenthesized_expression")
+    {
+        value = parent;
+    }
+    let Some(parent) = value.parent() else {
+        return (default.to_string(), "default", String::new());
+    };
+    if parent.kind() == "argument_list" {
+        let conversion = parent
+            .parent()
+            .filter(|call| call.kind() == "call_expression")
+            .and_then(|call| call.child_by_field_name("function"))
+            .map(|function| text(&function))
+            .filter(|function| BASIC_TYPES.contains(&function.as_str()));
+        if let Some(conversion) = conversion {
+            return (conversion, "conversion", String::new());
+        }
+    }
+    if parent.kind() == "expression_list" {
+        let mut cursor = parent.walk();
+        let index: Option<usize> = parent.named_children(&mut cursor).position(|n| n == value);
+        if let (Some(index), Some(declaration)) = (index, parent.parent()) {
+            let names: Vec<Node> = match declaration.kind() {
+                "const_spec" | "var_spec" => {
+                    let mut cursor = declaration.walk();
+                    declaration
+                        .children_by_field_name("name", &mut cursor)
+                        .collect()
+                }
+                "short_var_declaration"
+                    if declaration.child_by_field_name("right") == Some(parent) =>
+                {
+                    let mut cursor = declaration.walk();
+                    declaration
+                        .child_by_field_name("left")
+                        .map(|left| left.named_children(&mut cursor).collect())
+                        .unwrap_or_default()
+                }
+                _ => Vec::new(),
+            };
+            let name: String = names.get(index).map(&text).unwrap_or_default();
+            if let Some(declared) = declaration.child_by_field_name("type") {
+                return (text(&declared), "declaration", name);
+            }
+            return (default.to_string(), "default", name);
+        }
+    }
+    (default.to_string(), "default", String::new())
+}
+
+/// Extracts the literals of a Go source file, one CSV row each, in the order of the file:
+/// the numeric, rune and string literals, with the type inferred from their context, and the composite literals,
+/// with their type and number of elements. The elements of a composite literal are recorded too.
+/// Composite literals nested in another one may elide their type, which is then left empty.
 ///
-/// # Returns
+/// # Arguments
 ///
-/// The first error node found in the tree, or `None` if no error node is found.
-fn find_first_error_node<'a>(root: &Node<'a>) -> Option<Node<'a>> {
-    find_first_node(root, &|n: &Node| n.is_error() || n.is_missing(), false)
-        .into_iter()
-        .next()
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn extract_literals(project_id: u32, path: &str, root: &Node, source: &[u8]) -> Result<String> {
+    let mut builder: String = String::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.named_children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+
+        let (kind, value, elements, literal_type, inferred_from, name) =
+            if let Some((kind, default)) = basic_literal(&node) {
+                let (literal_type, inferred_from, name) =
+                    infer_literal_type(&node, default, source);
+                let value: String =
+                    String::from_utf8_lossy(node_source_code(&node, source)).to_string();
+                (
+                    kind,
+                    value,
+                    String::new(),
+                    literal_type,
+                    inferred_from,
+                    name,
+                )
+            } else if node.kind() == "composite_literal"
+                || (node.kind() == "literal_value"
+                    && node.parent().is_some_and(|p| p.kind() == "literal_element"))
+            {
+                let body: Option<Node> = if node.kind() == "literal_value" {
+                    Some(node)
+                } else {
+                    node.child_by_field_name("body")
+                };
+                let elements: usize = body.map_or(0, |body| {
+                    let mut cursor = body.walk();
+                    body.named_children(&mut cursor)
+                        .filter(|n| n.kind() != "comment")
+                        .count()
+                });
+                let (literal_type, inferred_from) = match node.child_by_field_name("type") {
+                    Some(t) => (
+                        String::from_utf8_lossy(node_source_code(&t, source)).to_string(),
+                        "literal",
+                    ),
+                    None => (String::new(), "elided"),
+                };
+                (
+                    "composite",
+                    String::new(),
+                    elements.to_string(),
+                    literal_type,
+                    inferred_from,
+                    String::new(),
+                )
+            } else {
+                continue;
+            };
+        writeln!(
+            &mut builder,
+            "{},{},{},{},{},{},{},{},{}",
+            project_id,
+            escape_path(path),
+            position_to_string(Some((
+                node.start_position().row + 1,
+                node.start_position().column + 1
+            ))),
+            kind,
+            escape_text(&value),
+            elements,
+            escape_text(&literal_type),
+            inferred_from,
+            name,
+        )?;
+    }
+    Ok(builder)
 }
 
-fn find_first_error_position(root: &Node) -> Option<(usize, usize)> {
-    find_first_error_node(root).map(|n| (n.start_position().row + 1, n.start_position().column + 1))
+/// Runs a registered visitor on a file and formats its rows, prefixed with the id of the project and the path of the file.
+/// Visitors which do not accept the language of the file have no rows.
+fn visitor_rows(
+    visitor: &dyn Visitor,
+    context: &FileContext,
+    root: &Node,
+    source: &[u8],
+) -> Result<String> {
+    if !visitor.accepts(context.language) {
+        return Ok(String::new());
+    }
+    let columns: usize = visitor.columns().len();
+    let mut builder: String = String::new();
+    for row in visitor
+        .visit(context, root, source)
+        .with_context(|| format!("Visitor {} failed on file {}", visitor.name(), context.path))?
+    {
+        ensure!(
+            row.len() == columns,
+            "Visitor {} returned a row of {} values instead of {columns}",
+            visitor.name(),
+            row.len()
+        );
+        let mut values: Vec<String> =
+            vec![context.project_id.to_string(), escape_path(context.path)];
+        values.extend(row.iter().map(|value| escape_text(value)));
+        writeln!(&mut builder, "{}", values.join(","))?;
+    }
+    Ok(builder)
 }
 
-fn position_to_string(position: Option<(usize, usize)>) -> String {
-    match position {
-        Some((row, col)) => format!("{row}:{col}"),
-        None => "not-found".to_string(),
+/// Language features detected in Go files, with the Go version introducing them, in the order of the features file.
+const GO_FEATURES: [(&str, &str); 11] = [
+    ("number_literals", "1.13"),
+    ("error_wrapping", "1.13"),
+    ("embed", "1.16"),
+    ("generics", "1.18"),
+    ("any", "1.18"),
+    ("error_join", "1.20"),
+    ("min_max", "1.21"),
+    ("clear", "1.21"),
+    ("range_over_int", "1.22"),
+    ("range_over_func", "1.23"),
+    ("iterators", "1.23"),
+];
+
+/// Functions of the standard library returning an iterator, ranged over with range-over-func loops.
+const ITERATOR_FUNCTIONS: &[(&str, &[&str])] = &[
+    ("slices", &["All", "Backward", "Chunk", "Values"]),
+    ("maps", &["All", "Keys", "Values"]),
+    (
+        "strings",
+        &[
+            "FieldsFuncSeq",
+            "FieldsSeq",
+            "Lines",
+            "SplitAfterSeq",
+            "SplitSeq",
+        ],
+    ),
+    (
+        "bytes",
+        &[
+            "FieldsFuncSeq",
+            "FieldsSeq",
+            "Lines",
+            "SplitAfterSeq",
+            "SplitSeq",
+        ],
+    ),
+];
+
+/// Returns the language feature used by a node of a Go file, if any (see `GO_FEATURES`).
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+/// * `imports` - The name under which the file imports every package of the standard library, if it imports it.
+/// * `declared` - The names of the functions declared in the file, which shadow the builtins of the same name.
+fn go_feature(
+    node: &Node,
+    source: &[u8],
+    imports: &HashMap<&str, String>,
+    declared: &HashSet<&[u8]>,
+) -> Option<&'static str> {
+    // Whether a qualified identifier refers to one of the given members of a package of the standard library.
+    let refers_to = |n: &Node, package: &str, members: &[&str]| {
+        qualified_name(n, source).is_some_and(|(p, name)| {
+            imports
+                .get(package)
+                .is_some_and(|imported| imported.as_bytes() == p)
+                && members.iter().any(|m| m.as_bytes() == name)
+        })
+    };
+    // The name of the builtin called by a call expression, unless a function of the file shadows it.
+    let builtin = |n: &Node| {
+        n.child_by_field_name("function")
+            .filter(|f| f.kind() == "identifier")
+            .map(|f| node_source_code(&f, source))
+            .filter(|name| !declared.contains(name))
+    };
+    match node.kind() {
+        "int_literal" | "float_literal" | "imaginary_literal" => {
+            let literal: String =
+                String::from_utf8_lossy(node_source_code(node, source)).to_lowercase();
+            (literal.starts_with("0b")
+                || literal.starts_with("0o")
+                || literal.contains('_')
+                || (literal.starts_with("0x") && literal.contains('p')))
+            .then_some("number_literals")
+        }
+        "comment" => node_source_code(node, source)
+            .starts_with(b"//go:embed")
+            .then_some("embed"),
+        "type_parameter_list" => Some("generics"),
+        "type_identifier" => (node_source_code(node, source) == b"any").then_some("any"),
+        "qualified_type" => refers_to(node, "iter", &["Seq", "Seq2"]).then_some("iterators"),
+        "call_expression" => {
+            let function: Node = node.child_by_field_name("function")?;
+            if refers_to(&function, "errors", &["Is", "As", "Unwrap"]) {
+                Some("error_wrapping")
+            } else if refers_to(&function, "errors", &["Join"]) {
+                Some("error_join")
+            } else if refers_to(&function, "fmt", &["Errorf"]) {
+                let format: Node = node.child_by_field_name("arguments")?.named_child(0)?;
+                node_source_code(&format, source)
+                    .windows(2)
+                    .any(|w| w == b"%w")
+                    .then_some("error_wrapping")
+            } else {
+                match builtin(node)? {
+                    b"min" | b"max" => Some("min_max"),
+                    b"clear" => Some("clear"),
+                    _ => None,
+                }
+            }
+        }
+        "range_clause" => {
+            let range: Node = node.child_by_field_name("right")?;
+            match range.kind() {
+                "int_literal" => Some("range_over_int"),
+                "func_literal" => Some("range_over_func"),
+                "call_expression" => {
+                    let function: Node = range.child_by_field_name("function")?;
+                    if matches!(builtin(&range), Some(b"len" | b"cap")) {
+                        Some("range_over_int")
+                    } else if ITERATOR_FUNCTIONS
+                        .iter()
+                        .any(|(package, members)| refers_to(&function, package, members))
+                    {
+                        Some("range_over_func")
+                    } else {
+                        None
+                    }
+                }
+                _ => None,
+            }
+        }
+        _ => None,
     }
 }
 
-fn find_fields<'a>(root: &Node<'a>, field: &str) -> Vec<Node<'a>> {
-    let mut res: Vec<Node<'a>> = Vec::new();
-    let mut ids: HashSet<usize> = HashSet::new();
-
-    let mut cursor = root.walk();
-
-    // Simulating call stack
-    let mut call_stack: Vec<Node> = Vec::new();
-    call_stack.push(*root);
-
-    while let Some(node) = call_stack.pop() {
-        for c in node.children_by_field_name(field, &mut node.walk()) {
-            res.push(c);
-            ids.insert(c.id());
+/// Detects the language features used by a Go source file, one CSV row per feature used, in the order of `GO_FEATURES`,
+/// with the number of uses and the position of the first one. Features are detected syntactically:
+/// * `number_literals`: binary, octal and hexadecimal floating-point literals, and digit separators.
+/// * `error_wrapping`: the `%w` verb of `fmt.Errorf`, and `errors.Is`, `errors.As` and `errors.Unwrap`.
+/// * `embed`: the `//go:embed` directives.
+/// * `generics`: the type parameter lists of generic functions and types.
+/// * `any`: the `any` alias of the empty interface.
+/// * `error_join`: `errors.Join`.
+/// * `min_max`, `clear`: the calls to the `min`, `max` and `clear` builtins, unless the file declares a function of the same name.
+/// * `range_over_int`: range clauses over an integer literal or the length of a value.
+/// * `range_over_func`: range clauses over a function literal or an iterator of the standard library, e.g. `maps.Keys(m)`.
+///   Iterators returned by other functions cannot be recognized without type information.
+/// * `iterators`: the `iter.Seq` and `iter.Seq2` types.
+///
+/// # Arguments
+///
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn extract_features(project_id: u32, path: &str, root: &Node, source: &[u8]) -> Result<String> {
+    let mut imports: HashMap<&str, String> = HashMap::new();
+    for package in [
+        "bytes", "errors", "fmt", "iter", "maps", "slices", "strings",
+    ] {
+        if let Some(name) = import_name(root, source, package) {
+            imports.insert(package, name);
         }
+    }
+    let declared: HashSet<&[u8]> = find_kind(root, &HashSet::from(["function_declaration"]))
+        .iter()
+        .filter_map(|f| f.child_by_field_name("name"))
+        .map(|name| node_source_code(&name, source))
+        .collect();
+
+    // The number of uses of every feature and the position of the first one.
+    let mut uses: HashMap<&str, (usize, (usize, usize))> = HashMap::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+        if let Some(feature) = go_feature(&node, source, &imports, &declared) {
+            uses.entry(feature)
+                .or_insert((
+                    0,
+                    (
+                        node.start_position().row + 1,
+                        node.start_position().column + 1,
+                    ),
+                ))
+                .0 += 1;
+        }
+    }
 
-        // We don't reverse nodes for performance (yields the same result)
-        for c in node
-            .children(&mut cursor)
-            .collect::<Vec<_>>()
-            .into_iter()
-            .rev()
-        {
-            if !ids.contains(&c.id()) {
-                call_stack.push(c);
-            }
+    let mut builder: String = String::new();
+    for (feature, version) in GO_FEATURES {
+        if let Some((count, position)) = uses.get(feature) {
+            writeln!(
+                &mut builder,
+                "{},{},{},{},{},{}",
+                project_id,
+                escape_path(path),
+                feature,
+                version,
+                count,
+                position_to_string(Some(*position)),
+            )?;
         }
     }
-
-    res
+    Ok(builder)
 }
 
-/// Finds the first field with the given name in the tree
+/// Extracts the generic declarations of a Go source file and their instantiation sites, one CSV row each:
+/// * `function`, `type`: a generic function or type, with its type parameters.
+/// * `method`: a method of a generic type, with the type parameters of its receiver.
+/// * `instantiation`: an explicit instantiation of a generic function or type, with its type arguments.
+/// * `inferred`: a call without type arguments to a generic function declared in the same file.
 ///
 /// # Arguments
 ///
-/// * `root` - The root node of the tree.
-/// * `field` - The name of the field to find.
-///
-/// # Returns
-///
-/// The first node found with the given field name, or `None` if no such node is found.
-fn find_first_field<'a>(root: &Node<'a>, field: &str) -> Option<Node<'a>> {
-    let mut cursor = root.walk();
+/// * `project_id` - The id of the project to which the file belongs.
+/// * `path` - The path to the file.
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn extract_generics(project_id: u32, path: &str, root: &Node, source: &[u8]) -> Result<String> {
+    let mut builder: String = String::new();
+
+    // Generic functions declared in the file, whose calls without type arguments are instantiated implicitly.
+    let generic_functions: HashSet<&[u8]> =
+        find_kind(root, &HashSet::from(["function_declaration"]))
+            .into_iter()
+            .filter(|f| f.child_by_field_name("type_parameters").is_some())
+            .filter_map(|f| f.child_by_field_name("name"))
+            .map(|name| node_source_code(&name, source))
+            .collect();
 
     // Simulating call stack
     let mut call_stack: Vec<Node> = Vec::new();
     call_stack.push(*root);
+    let mut cursor = root.walk();
 
     while let Some(node) = call_stack.pop() {
-        if let Some(c) = node.child_by_field_name(field) {
-            return Some(c);
+        // The receiver of a method of a generic type is not an instantiation of the type.
+        let receiver: Option<Node<'_>> = match node.kind() {
+            "method_declaration" => node.child_by_field_name("receiver"),
+            _ => None,
+        };
+        let generic: Option<(&str, Option<Node<'_>>, Option<Node<'_>>)> = match node.kind() {
+            "function_declaration" => node
+                .child_by_field_name("type_parameters")
+                .map(|params| ("function", node.child_by_field_name("name"), Some(params))),
+            "type_spec" => node
+                .child_by_field_name("type_parameters")
+                .map(|params| ("type", node.child_by_field_name("name"), Some(params))),
+            "method_declaration" => receiver
+                .and_then(|r| {
+                    find_kind(&r, &HashSet::from(["generic_type"]))
+                        .into_iter()
+                        .next()
+                })
+                .map(|t| {
+                    (
+                        "method",
+                        node.child_by_field_name("name"),
+                        t.child_by_field_name("type_arguments"),
+                    )
+                }),
+            "generic_type" => Some((
+                "instantiation",
+                node.child_by_field_name("type"),
+                node.child_by_field_name("type_arguments"),
+            )),
+            "call_expression" => {
+                let function: Option<Node<'_>> = node.child_by_field_name("function");
+                let is_generic = |f: &Node| {
+                    f.kind() == "identifier"
+                        && generic_functions.contains(node_source_code(f, source))
+                };
+                match (node.child_by_field_name("type_arguments"), function) {
+                    (Some(args), _) => Some(("instantiation", function, Some(args))),
+                    // A single type argument is parsed as an index, e.g. Sum[float32](xs).
+                    (None, Some(f))
+                        if f.kind() == "index_expression"
+                            && f.child_by_field_name("operand")
+                                .is_some_and(|o| is_generic(&o)) =>
+                    {
+                        Some((
+                            "instantiation",
+                            f.child_by_field_name("operand"),
+                            f.child_by_field_name("index"),
+                        ))
+                    }
+                    (None, Some(f)) if is_generic(&f) => Some(("inferred", function, None)),
+                    _ => None,
+                }
+            }
+            _ => None,
+        };
+
+        if let Some((kind, name, types)) = generic {
+            let text = |n: Option<Node<'_>>| {
+                n.map(|n| {
+                    String::from_utf8_lossy(node_source_code(&n, source))
+                        .split_whitespace()
+                        .collect::<Vec<&str>>()
+                        .join(" ")
+                        .replace(",", "-was_comma-")
+                        .replace("\"", "-was_quote-")
+                })
+                .unwrap_or_default()
+            };
+            writeln!(
+                &mut builder,
+                "{},{},{},{},{},{}",
+                project_id,
+                path.replace(",", "-was_comma-")
+                    .replace("\"", "-was_quote-"),
+                kind,
+                text(name),
+                position_to_string(Some((
+                    node.start_position().row + 1,
+                    node.start_position().column + 1,
+                ))),
+                text(types),
+            )?;
         }
 
-        // We don't reverse nodes for performance (yields the same result)
         for c in node
             .children(&mut cursor)
             .collect::<Vec<_>>()
             .into_iter()
             .rev()
         {
-            call_stack.push(c);
-        }
-    }
-
-    None
-}
-
-fn find_kind<'a>(root: &Node<'a>, kinds: &HashSet<&str>) -> Vec<Node<'a>> {
-    let mut res: Vec<Node<'a>> = Vec::new();
-
-    let mut cursor = root.walk();
-
-    // Simulating call stack
-    let mut call_stack: Vec<Node> = Vec::new();
-    call_stack.push(*root);
-
-    while let Some(node) = call_stack.pop() {
-        if kinds.contains(node.kind()) {
-            res.push(node);
-        } else {
-            // We don't reverse nodes for performance (yields the same result)
-            for c in node.children(&mut cursor) {
+            if Some(c) != receiver {
                 call_stack.push(c);
             }
         }
     }
-
-    res
+    Ok(builder)
 }
 
-fn remove_kind_from_source(source: &[u8], root: &Node, kinds: &HashSet<&str>) -> Vec<u8> {
-    let mut nodes = find_kind(root, kinds);
-    nodes.sort_by_key(|b| std::cmp::Reverse(b.start_byte()));
-    // Disable mutability
-    let nodes = nodes;
-
-    let root_start = root.start_byte();
-    let mut new_source = source.to_vec();
-    for n in nodes {
-        new_source.drain(n.start_byte() - root_start..n.end_byte() - root_start);
+/// Returns the source code of a type node, without its references to C if they are masked.
+fn type_source_code(n: &Node, source: &[u8], mask_cgo: bool) -> Vec<u8> {
+    let code: &[u8] = node_source_code(n, source);
+    if mask_cgo {
+        remove_nodes_from_source(code, n, cgo_references(n, source))
+    } else {
+        code.to_vec()
     }
-    new_source
 }
 
 #[cfg(test)]
@@ -1426,21 +5711,18 @@ mod tests {
             delete_dir(format!("{path}.functions"), true)?;
         }
 
-        if should_pass {
-            run(
-                input_file_path,
-                None,
-                None,
-                keywords,
-                false,
+        let options = Options {
+            threads: 8,
+            seed: 0,
+            ignore_comments,
+            filters: Filters {
                 languages,
-                "ignore",
-                8,
-                0,
-                false,
-                ignore_comments,
-                test_logger(),
-            )?;
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        if should_pass {
+            run(input_file_path, keywords, options, test_logger())?;
 
             let logs_df = open_csv(&logs_file_path, None, None)?;
             ensure!(
@@ -1502,21 +5784,7 @@ mod tests {
                 );
             }
         } else {
-            ensure!(run(
-                input_file_path,
-                None,
-                None,
-                keywords,
-                false,
-                languages,
-                "ignore",
-                8,
-                0,
-                false,
-                ignore_comments,
-                test_logger()
-            )
-            .is_err());
+            ensure!(run(input_file_path, keywords, options, test_logger()).is_err());
         }
 
         delete_file(&output_file_path, true)?;
@@ -1606,4 +5874,947 @@ mod tests {
 
         test_parse(&input_file_path, &keywords, None, true, true)
     }
+
+    #[test]
+    fn cgo_refs() -> Result<()> {
+        let source: &[u8] = b"package gtk\n\n// #include <gtk/gtk.h>\nimport \"C\"\n\nfunc (ps *PrintSettings) GetDouble(key string, def C.gdouble) float64 {\n\tcstr := C.CString(key)\n\treturn float64(C.gtk_print_settings_get_double(ps.native(), (*C.gchar)(cstr), def))\n}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let root: Node<'_> = tree.root_node();
+        ensure!(imports_c(&root, source));
+        assert_eq!(cgo_references(&root, source).len(), 4);
+
+        let masked: Vec<u8> =
+            remove_nodes_from_source(source, &root, cgo_references(&root, source));
+        ensure!(!String::from_utf8_lossy(&masked).contains("gdouble"));
+
+        let tree: Tree = parser
+            .parse(b"package main\n\nimport \"fmt\"\n", None)
+            .context("Failed to parse")?;
+        ensure!(!imports_c(
+            &tree.root_node(),
+            b"package main\n\nimport \"fmt\"\n"
+        ));
+        Ok(())
+    }
+
+    #[test]
+    fn embeds_go() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/embeds";
+        delete_dir(dir, true)?;
+        create_dir(&format!("{dir}/static"))?;
+        std::fs::write(format!("{dir}/static/index.html"), "")?;
+        let path: String = format!("{dir}/main.go");
+        let source: &[u8] = b"package main\n\nimport \"embed\"\n\n\
+                               //go:embed static/*.html \"missing.txt\"\nvar content embed.FS\n\n\
+                               var (\n\t// The version.\n\t//go:embed static\n\tversion string\n)\n\n\
+                               //go:embed \"unterminated\nvar broken string\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+
+        let rows: String = extract_embeds(1, &path, &tree.root_node(), source, true)?;
+        assert_eq!(
+            rows.lines().collect::<Vec<&str>>(),
+            vec![
+                format!("1,{path},5:1,content,static/*.html,1"),
+                format!("1,{path},5:1,content,missing.txt,0"),
+                format!("1,{path},10:2,version,static,1"),
+            ]
+        );
+        let rows: String = extract_embeds(1, &path, &tree.root_node(), source, false)?;
+        ensure!(rows.starts_with(&format!("1,{path},5:1,content,static/*.html\n")));
+        Ok(())
+    }
+
+    #[test]
+    fn directives_go() -> Result<()> {
+        let source: &[u8] = b"//go:build linux\n\n//go:generate stringer -type=Kind\npackage unsafe_ops\n\n\
+                               import _ \"unsafe\"\n\n\
+                               //go:noinline\n// Add adds.\nfunc Add(a, b int) int { return a + b } //go:nosplit\n\n\
+                               //go:linkname now runtime.nanotime\nfunc now() int64\n\n\
+                               // go:noescape is not a directive\n//go:noescape\n\nfunc far()\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+
+        let rows: String = extract_directives(1, "a.go", &tree.root_node(), &go_grammar(), source)?;
+        assert_eq!(
+            rows.lines().collect::<Vec<&str>>(),
+            vec![
+                "1,a.go,1:1,build,linux,,",
+                "1,a.go,3:1,generate,stringer -type=Kind,unsafe_ops,package_clause",
+                "1,a.go,8:1,noinline,,Add,function_declaration",
+                "1,a.go,12:1,linkname,now runtime.nanotime,now,function_declaration",
+                "1,a.go,16:1,noescape,,,",
+            ]
+        );
+        assert_eq!(go_directive("//go:embed a b"), Some(("embed", "a b")));
+        assert_eq!(go_directive("// go:noinline"), None);
+        assert_eq!(go_directive("//go:"), None);
+        Ok(())
+    }
+
+    #[test]
+    fn unsafe_go() -> Result<()> {
+        let source: &[u8] = b"package mem\n\n// #include <stdlib.h>\nimport \"C\"\n\n\
+                               import (\n\tu \"unsafe\"\n\t\"reflect\"\n)\n\n\
+                               var size = u.Sizeof(0)\n\n\
+                               func Bytes(s string) []byte {\n\
+                               \th := (*reflect.StringHeader)(u.Pointer(&s))\n\
+                               \treturn u.Slice((*byte)(u.Pointer(h.Data)), h.Len)\n}\n\n\
+                               func Free(p *C.char) {\n\tC.free(u.Pointer(p))\n\t_ = uintptr(0)\n}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        ensure!(!tree.root_node().has_error());
+
+        let rows: String = extract_unsafe_uses(1, "mem.go", &tree.root_node(), source)?;
+        let uses: Vec<(&str, &str, &str)> = rows
+            .lines()
+            .map(|row| {
+                let fields: Vec<&str> = row.split(',').collect();
+                (fields[3], fields[5], fields[6])
+            })
+            .collect();
+        assert_eq!(
+            uses,
+            vec![
+                ("unsafe.Sizeof", "", "file"),
+                ("reflect.StringHeader", "Bytes", "file"),
+                ("unsafe.Pointer", "Bytes", "file"),
+                ("unsafe.Slice", "Bytes", "file"),
+                ("unsafe.Pointer", "Bytes", "file"),
+                ("unsafe.Pointer", "Free", "expression"),
+                ("uintptr", "Free", "file"),
+            ]
+        );
+        ensure!(rows.contains(",19:9,unsafe.Pointer,u.Pointer(p),Free,expression\n"));
+        ensure!(import_name(&tree.root_node(), source, "net/http").is_none());
+        Ok(())
+    }
+
+    #[test]
+    fn literals_go() -> Result<()> {
+        let source: &[u8] = b"package num\n\n\
+                               const eps, tol float32 = 1e-9, 1e-6\n\n\
+                               func f() {\n\
+                               \tx, s := -0x10, \"a,b\"\n\
+                               \t_ = float32(2.5)\n\
+                               \t_ = [][]int{{1, 2}, {}}\n\
+                               \t_ = 'a' + 2i\n}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        ensure!(!tree.root_node().has_error());
+
+        let rows: String = extract_literals(1, "num.go", &tree.root_node(), source)?;
+        assert_eq!(
+            rows.lines().collect::<Vec<&str>>(),
+            vec![
+                "1,num.go,3:26,float,1e-9,,float32,declaration,eps",
+                "1,num.go,3:32,float,1e-6,,float32,declaration,tol",
+                "1,num.go,6:11,int,0x10,,int,default,x",
+                "1,num.go,6:17,string,-was_quote-a-was_comma-b-was_quote-,,string,default,s",
+                "1,num.go,7:14,float,2.5,,float32,conversion,",
+                "1,num.go,8:6,composite,,2,[][]int,literal,",
+                "1,num.go,8:14,composite,,2,,elided,",
+                "1,num.go,8:15,int,1,,int,default,",
+                "1,num.go,8:18,int,2,,int,default,",
+                "1,num.go,8:22,composite,,0,,elided,",
+                "1,num.go,9:6,rune,'a',,rune,default,",
+                "1,num.go,9:12,imaginary,2i,,complex128,default,",
+            ]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn features_go() -> Result<()> {
+        let source: &[u8] = b"package feat\n\n\
+                               import (\n\t\"errors\"\n\t\"fmt\"\n\t\"iter\"\n\t\"maps\"\n)\n\n\
+                               func Keys[K comparable, V any](m map[K]V) iter.Seq[K] {\n\
+                               \tfor k := range maps.Keys(m) {\n\
+                               \t\t_ = k\n\
+                               \t}\n\
+                               \treturn maps.Keys(m)\n}\n\n\
+                               func f(err error) error {\n\
+                               \tfor i := range 10 {\n\
+                               \t\t_ = max(i, 1_000)\n\
+                               \t}\n\
+                               \tif errors.Is(err, nil) {\n\
+                               \t\treturn fmt.Errorf(\"f: %w\", err)\n\
+                               \t}\n\
+                               \treturn fmt.Errorf(\"f: %v\", err)\n}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        ensure!(!tree.root_node().has_error());
+
+        let rows: String = extract_features(1, "feat.go", &tree.root_node(), source)?;
+        assert_eq!(
+            rows.lines().collect::<Vec<&str>>(),
+            vec![
+                "1,feat.go,number_literals,1.13,1,19:14",
+                "1,feat.go,error_wrapping,1.13,2,21:5",
+                "1,feat.go,generics,1.18,1,10:10",
+                "1,feat.go,any,1.18,1,10:27",
+                "1,feat.go,min_max,1.21,1,19:7",
+                "1,feat.go,range_over_int,1.22,1,18:6",
+                "1,feat.go,range_over_func,1.23,1,11:6",
+                "1,feat.go,iterators,1.23,1,10:43",
+            ]
+        );
+
+        // Functions of the file shadow the builtins of the same name.
+        let source: &[u8] = b"package feat\n\n\
+                               func max(a, b int) int { return a }\n\n\
+                               var m = max(1, 2)\n";
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        assert_eq!(
+            extract_features(1, "feat.go", &tree.root_node(), source)?,
+            ""
+        );
+        Ok(())
+    }
+
+    /// A visitor listing the functions of Go files with their package.
+    struct FunctionLister;
+
+    impl Visitor for FunctionLister {
+        fn name(&self) -> &str {
+            "functions_list"
+        }
+
+        fn columns(&self) -> Vec<String> {
+            vec!["package".to_string(), "function".to_string()]
+        }
+
+        fn accepts(&self, language: &str) -> bool {
+            language == "go"
+        }
+
+        fn visit(
+            &self,
+            context: &FileContext,
+            root: &Node,
+            source: &[u8],
+        ) -> Result<Vec<Vec<String>>> {
+            let mut functions: Vec<Node> =
+                find_kind(root, &HashSet::from(["function_declaration"]));
+            functions.sort_by_key(|f| f.start_byte());
+            Ok(functions
+                .iter()
+                .filter_map(|f| declaration_name(f, source))
+                .map(|name| vec![context.package.to_string(), name])
+                .collect())
+        }
+    }
+
+    #[test]
+    fn visitors_go() -> Result<()> {
+        let source: &[u8] = b"package a\n\nfunc f() {}\n\nfunc g() {}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let context: FileContext = FileContext {
+            project_id: 1,
+            path: "1-x/a,b/a.go",
+            language: "go",
+            package: "1-x/a,b",
+            generator: None,
+            vendored: None,
+            test_kind: "none",
+            go_version: None,
+            parse_error: false,
+        };
+        assert_eq!(
+            visitor_rows(&FunctionLister, &context, &tree.root_node(), source)?,
+            "1,1-x/a-was_comma-b/a.go,1-x/a-was_comma-b,f\n1,1-x/a-was_comma-b/a.go,1-x/a-was_comma-b,g\n"
+        );
+        assert_eq!(
+            visitor_rows(
+                &FunctionLister,
+                &FileContext {
+                    language: "c",
+                    ..context
+                },
+                &tree.root_node(),
+                source
+            )?,
+            ""
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn isolation() {
+        assert_eq!(isolate(|| 1), Ok(1));
+        let trace: String = isolate(|| -> u32 { panic!("malformed node") }).unwrap_err();
+        assert!(trace.contains("malformed node"));
+        // The panic of a previous file is not reported for the next one.
+        assert_eq!(isolate(|| 2), Ok(2));
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn resolved_paths() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/symlinks";
+        delete_dir(dir, true)?;
+        write_file(format!("{dir}/pkg/a.go"), "package pkg\n")?;
+        std::os::unix::fs::symlink("pkg", format!("{dir}/link"))?;
+        std::os::unix::fs::symlink("loop", format!("{dir}/loop"))?;
+        let names: Vec<String> = vec![
+            format!("{dir}/./pkg/a.go"),
+            format!("{dir}/link/a.go"),
+            format!("{dir}/pkg/../pkg/a.go"),
+            format!("{dir}/loop"),
+            format!("{dir}/missing.go"),
+        ];
+        let names: Vec<&str> = names.iter().map(String::as_str).collect();
+
+        let resolved: ResolvedPaths = resolve_paths(&names, false);
+        assert_eq!(resolved.names[0], format!("{dir}/pkg/a.go"));
+        assert_eq!(
+            resolved.skipped,
+            vec![
+                None,
+                Some("duplicate"),
+                Some("duplicate"),
+                Some("broken-symlink"),
+                None
+            ]
+        );
+        assert_eq!(
+            (resolved.symlinks, resolved.broken, resolved.duplicates),
+            (0, 1, 2)
+        );
+
+        let resolved: ResolvedPaths = resolve_paths(&names[1..], true);
+        assert_eq!(
+            resolved.skipped,
+            vec![Some("symlink"), None, Some("symlink"), None]
+        );
+        assert_eq!(
+            (resolved.symlinks, resolved.broken, resolved.duplicates),
+            (2, 0, 0)
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn repo_stats() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/repo_stats";
+        delete_dir(dir, true)?;
+        let mut projects: BTreeMap<u32, RepoStats> = BTreeMap::new();
+        for (id, package, skipped, parse_error, loc) in [
+            (2, "2-b", false, false, 10),
+            (1, "1-a/cmd", false, true, 20),
+            (1, "1-a/cmd", true, false, 0),
+            (1, "1-a", false, false, 5),
+        ] {
+            projects.entry(id).or_default().add(FileStats {
+                project_id: id,
+                package: package.to_string(),
+                skipped,
+                parse_error,
+                loc,
+                time: Duration::from_millis(1500),
+                ..Default::default()
+            });
+        }
+        write_repo_stats(&format!("{dir}/stats.csv"), &projects)?;
+        assert_eq!(
+            std::fs::read_to_string(format!("{dir}/stats.csv"))?,
+            "id,files,parsed,skipped,reused,packages,loc,parse_errors,time\n\
+             1,3,2,1,0,2,25,1,4.500\n\
+             2,1,1,0,0,1,10,0,1.500\n"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn checkpoints() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/checkpoint";
+        delete_dir(dir, true)?;
+        let output: String = format!("{dir}/input.csv.functions.csv");
+        let logs: String = format!("{dir}/input.csv.function_logs.csv");
+        write_file(&output, "id,path\n1,a.go\n")?;
+        write_file(&logs, "id,name\n1,a.go\n")?;
+        let paths: Vec<&str> = vec![output.as_str(), logs.as_str()];
+
+        let checkpoint: Checkpoint = Checkpoint::new(1, 3, "id,path\nid,name", &paths, None)?;
+        assert_eq!(checkpoint.lengths[&output], 15);
+        checkpoint.write(&format!("{dir}/input.csv.checkpoint.json"))?;
+        let read: Checkpoint = Checkpoint::read(&format!("{dir}/input.csv.checkpoint.json"))?;
+        assert_eq!(read, checkpoint);
+
+        // The statistics of the projects are saved with the checkpoint.
+        let mut stats: BTreeMap<u32, RepoStats> = BTreeMap::new();
+        stats.entry(1).or_default().add(FileStats {
+            project_id: 1,
+            package: "1-a".to_string(),
+            loc: 12,
+            time: Duration::from_nanos(1_234_567_891),
+            ..Default::default()
+        });
+        let with_stats: Checkpoint =
+            Checkpoint::new(1, 3, "id,path\nid,name", &paths, Some(&stats))?;
+        with_stats.write(&format!("{dir}/stats.checkpoint.json"))?;
+        assert_eq!(
+            Checkpoint::read(&format!("{dir}/stats.checkpoint.json"))?,
+            with_stats
+        );
+
+        write_file(&output, "id,path\n1,a.go\n2,b.go\n")?;
+        ensure!(read.restore("id,path,cgo\nid,name", &paths).is_err());
+        ensure!(read.restore("id,path\nid,name", &paths[..1]).is_err());
+        read.restore("id,path\nid,name", &paths)?;
+        assert_eq!(std::fs::read_to_string(&output)?, "id,path\n1,a.go\n");
+
+        write_file(&logs, "")?;
+        ensure!(read.restore("id,path\nid,name", &paths).is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn resume_repo_stats() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/resume";
+        delete_dir(dir, true)?;
+        let files: [String; 3] = [
+            format!("{dir}/1/a.c"),
+            format!("{dir}/1/b.c"),
+            format!("{dir}/2/c.c"),
+        ];
+        for file in &files {
+            write_file(file, "double half(double x) {\n    return x / 2;\n}\n")?;
+        }
+        let input: String = format!("{dir}/input.csv");
+        write_file(
+            &input,
+            format!(
+                "id,name,language\n1,{},c\n1,{},c\n2,{},c\n",
+                files[0], files[1], files[2]
+            ),
+        )?;
+        let partial: String = format!("{dir}/partial.csv");
+        write_file(
+            &partial,
+            format!("id,name,language\n1,{},c\n1,{},c\n", files[0], files[1]),
+        )?;
+        let output: String = format!("{input}.functions.csv");
+        let logs: String = format!("{input}.function_logs.csv");
+        let parse = |input: &str, resume: bool| {
+            run(
+                input,
+                &["tests/data/keywords/c_float.json"],
+                Options {
+                    output_path: Some(output.as_str()),
+                    logs_path: Some(logs.as_str()),
+                    force: true,
+                    resume,
+                    extractions: Extractions {
+                        repo_stats: true,
+                        ..Default::default()
+                    },
+                    ..Default::default()
+                },
+                test_logger(),
+            )
+        };
+        // The times differ from a run to another.
+        let without_time = |path: &str| -> Result<Vec<String>> {
+            Ok(std::fs::read_to_string(path)?
+                .lines()
+                .map(|line| {
+                    line.rsplit_once(',')
+                        .map_or(line, |(row, _)| row)
+                        .to_string()
+                })
+                .collect())
+        };
+        let stats_path: String = format!("{input}.repo_stats.csv");
+        parse(&input, false)?;
+        let expected: Vec<String> = without_time(&stats_path)?;
+        delete_file(&stats_path, false)?;
+
+        // A run interrupted after the files of the first project, which are the first ones in the path order.
+        parse(&partial, false)?;
+        let row: Vec<usize> = without_time(&format!("{partial}.repo_stats.csv"))?[1]
+            .split(',')
+            .map(str::parse)
+            .collect::<Result<_, _>>()?;
+        let stats: BTreeMap<u32, RepoStats> = BTreeMap::from([(
+            1,
+            RepoStats {
+                files: row[1],
+                skipped: row[3],
+                reused: row[4],
+                packages: HashSet::from([package_of(&files[0]).to_string()]),
+                loc: row[6],
+                parse_errors: row[7],
+                time: Duration::ZERO,
+            },
+        )]);
+        let header = |path: &str| -> Result<String> {
+            Ok(std::fs::read_to_string(path)?
+                .lines()
+                .next()
+                .unwrap_or_default()
+                .to_string())
+        };
+        let columns: String = format!("{}\n{}", header(&output)?, header(&logs)?);
+        Checkpoint::new(
+            2,
+            3,
+            &columns,
+            &[output.as_str(), logs.as_str()],
+            Some(&stats),
+        )?
+        .write(&format!("{input}.checkpoint.json"))?;
+
+        // The resumed run counts the files written before the checkpoint.
+        parse(&input, true)?;
+        assert_eq!(without_time(&stats_path)?, expected);
+        delete_dir(dir, false)
+    }
+
+    #[test]
+    fn work_plan() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/dry_run";
+        delete_dir(dir, true)?;
+        create_dir(dir)?;
+        let mut input_file: DataFrame = polars::df!(
+            "id" => [1u32, 1, 2],
+            "name" => ["1-a/main.go", "1-a/vendor/x/x.go", "2-b/cmd/main.go"],
+            "language" => ["go", "go", "go"],
+        )?;
+        let mut skipped_files: Vec<SkippedFile> = Vec::new();
+        assert_eq!(
+            skip_files(
+                &mut input_file,
+                &[None, Some("vendored"), None],
+                Some(&mut skipped_files)
+            )?,
+            1
+        );
+        assert_eq!(input_file.height(), 2);
+        write_work_plan(&input_file, &skipped_files, &format!("{dir}/plan.csv"))?;
+        assert_eq!(
+            std::fs::read_to_string(format!("{dir}/plan.csv"))?,
+            "id,name,language,status\n1,1-a/main.go,go,parse\n2,2-b/cmd/main.go,go,parse\n1,1-a/vendor/x/x.go,go,vendored\n"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn archives() -> Result<()> {
+        use std::io::Write;
+
+        let dir: &str = "target/tests/phases/parse/archives";
+        delete_dir(dir, true)?;
+        create_dir(dir)?;
+        let zip_path: String = format!("{dir}/1-mod.zip");
+        let mut zip = zip::ZipWriter::new(std::fs::File::create(&zip_path)?);
+        for (name, content) in [
+            ("mod@v1.0.0/a.go", "package mod"),
+            ("mod@v1.0.0/README.md", "# mod"),
+        ] {
+            zip.start_file(name, zip::write::SimpleFileOptions::default())?;
+            zip.write_all(content.as_bytes())?;
+        }
+        zip.finish()?;
+
+        let mut input_file: DataFrame = polars::df!(
+            "id" => [1u32, 2, 3],
+            "name" => [zip_path.as_str(), "2-b/main.go", "3-missing.zip"],
+            "language" => ["go", "go", "go"],
+        )?;
+        let extensions: HashMap<String, String> = HashMap::from([
+            ("go".to_string(), "go".to_string()),
+            ("md".to_string(), "markdown".to_string()),
+        ]);
+        assert_eq!(expand_archives(&mut input_file, &extensions)?, 1);
+        let entry: String = format!("{zip_path}!/mod@v1.0.0/a.go");
+        assert_eq!(
+            dataframes::str(&input_file, "name")?,
+            vec![entry.as_str(), "2-b/main.go"]
+        );
+        assert_eq!(dataframes::u32(&input_file, "id")?, vec![1, 2]);
+
+        assert_eq!(
+            content_hash(&entry)?,
+            blake3::hash(b"package mod").to_hex().to_string()
+        );
+        let resolved: ResolvedPaths = resolve_paths(&[&entry, &entry], false);
+        assert_eq!(resolved.skipped, vec![None, Some("duplicate")]);
+        Ok(())
+    }
+
+    #[test]
+    fn aliases() -> Result<()> {
+        let dir: &str = "target/tests/phases/parse/aliases";
+        delete_dir(dir, true)?;
+        write_file(format!("{dir}/2/vendor/lib/a.go"), "package lib\n")?;
+        write_file(format!("{dir}/1/lib/a.go"), "package lib\n")?;
+        write_file(format!("{dir}/1/lib/b.go"), "package lib\n\nfunc B() {}\n")?;
+        write_file(format!("{dir}/1/lib/a,copy.go"), "package lib\n")?;
+        let names: Vec<String> = vec![
+            format!("{dir}/2/vendor/lib/a.go"),
+            format!("{dir}/1/lib/b.go"),
+            format!("{dir}/1/lib/a-was_comma-copy.go"),
+            format!("{dir}/1/lib/a.go"),
+            format!("{dir}/missing.go"),
+            format!("{dir}/missing.go"),
+        ];
+        let names: Vec<&str> = names.iter().map(String::as_str).collect();
+        let hash: String = content_hash(&format!("{dir}/1/lib/a.go"))?;
+        let aliases: Vec<(usize, usize, String)> = content_aliases(&names, 2);
+        assert_eq!(aliases, vec![(3, 2, hash.clone()), (0, 2, hash.clone())]);
+
+        assert_eq!(
+            duplicate_groups(&[2, 1, 1, 1, 3, 3], &aliases),
+            vec![DuplicateGroup {
+                original: 2,
+                hash: hash.clone(),
+                aliases: 2,
+                within: 1,
+                projects: 1,
+            }]
+        );
+        let aliases: Vec<(usize, usize, String)> = vec![
+            (1, 0, "a".to_string()),
+            (2, 3, "b".to_string()),
+            (4, 3, "b".to_string()),
+            (5, 3, "b".to_string()),
+        ];
+        assert_eq!(
+            duplicate_groups(&[1, 2, 3, 2, 2, 4], &aliases)
+                .iter()
+                .map(|group| (group.original, group.aliases, group.within, group.projects))
+                .collect::<Vec<_>>(),
+            vec![(3, 3, 1, 2), (0, 1, 0, 1)]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn generics_go() -> Result<()> {
+        let source: &[u8] = b"package list\n\ntype List[T any] struct {\n\titems []T\n}\n\nfunc (l *List[T]) Push(x T) {\n\tl.items = append(l.items, x)\n}\n\nfunc Sum[T float32 | float64](xs []T) T {\n\tvar s T\n\treturn s\n}\n\nfunc main() {\n\tl := List[float64]{}\n\tSum[float32](nil)\n\tSum(l.items)\n}\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let root: Node<'_> = tree.root_node();
+        ensure!(!root.has_error());
+
+        let rows: String = extract_generics(0, "list.go", &root, source)?;
+        let kinds: Vec<(&str, &str)> = rows
+            .lines()
+            .map(|row| {
+                let fields: Vec<&str> = row.split(',').collect();
+                (fields[2], fields[3])
+            })
+            .collect();
+        assert_eq!(
+            kinds,
+            vec![
+                ("type", "List"),
+                ("method", "Push"),
+                ("function", "Sum"),
+                ("instantiation", "List"),
+                ("instantiation", "Sum"),
+                ("inferred", "Sum"),
+            ]
+        );
+        ensure!(rows.contains("[T float32 | float64]"));
+
+        let sum: Node<'_> = find_kind(&root, &HashSet::from(["function_declaration"]))
+            .into_iter()
+            .find(|f| f.child_by_field_name("type_parameters").is_some())
+            .context("Generic function not found")?;
+        assert_eq!(
+            type_parameter_constraints(&sum, source),
+            vec![(&b"T"[..], &b"float32 | float64"[..])]
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn syntax_errors() -> Result<()> {
+        let source: &[u8] = b"int f(int x) {\n    return x +;\n}\n\nint g() {\n    return 0;\n}\n";
+        let grammar: Grammar = c_grammar();
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&grammar.lang)?;
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let root: Node<'_> = tree.root_node();
+
+        let errors: Vec<Node<'_>> = find_error_nodes(&root);
+        ensure!(!errors.is_empty());
+        assert_eq!(
+            errors.first().map(|n| n.start_position().row + 1),
+            find_first_error_position(&root).map(|(row, _)| row)
+        );
+
+        // Every error is in the first function, the second one is parsed correctly.
+        let rows: String = syntax_error_rows(0, "f.c", &root, &grammar, source)?;
+        ensure!(rows.lines().all(|row| row.split(',').nth(5) == Some("1:1")));
+        Ok(())
+    }
+
+    #[test]
+    fn snippets() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+
+        let source: Vec<u8> = std::fs::read(format!("{TEST_DATA}/weird.go"))?;
+        let tree: Tree = parser.parse(&source, None).context("Failed to parse")?;
+        ensure!(!has_package_clause(&tree.root_node()));
+        ensure!(!cgo_references(&tree.root_node(), &source).is_empty());
+
+        let tree: Tree = parser
+            .parse(b"package main\n\nfunc main() {}\n", None)
+            .context("Failed to parse")?;
+        ensure!(has_package_clause(&tree.root_node()));
+        Ok(())
+    }
+
+    #[test]
+    fn generated_files() {
+        assert_eq!(
+            generator(b"// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: api.proto\n\npackage api\n"),
+            Some("protoc")
+        );
+        assert_eq!(
+            generator(
+                b"// Code generated by \"stringer -type=Pill\"; DO NOT EDIT.\n\npackage pill\n"
+            ),
+            Some("stringer")
+        );
+        assert_eq!(
+            generator(b"// Code generated by MockGen. DO NOT EDIT.\n// Source: store.go\n\npackage mocks\n"),
+            Some("mockgen")
+        );
+        assert_eq!(
+            generator(b"// Code generated by hand-rolled tool. DO NOT EDIT.\npackage x\n"),
+            Some("unknown")
+        );
+        assert_eq!(generator(b"package main\n\nfunc main() {}\n"), None);
+    }
+
+    #[test]
+    fn file_filters() -> Result<()> {
+        assert_eq!(project_depth(42, "dl/0/42-abcdef/main.go"), 0);
+        assert_eq!(project_depth(42, "dl/0/42-abcdef/cmd/tool/main.go"), 2);
+        assert_eq!(project_depth(42, "./src/main.go"), 1);
+        assert_eq!(project_depth(7, "dl/0/42-abcdef/main.go"), 3);
+
+        let filter: FileFilter = FileFilter::new(
+            None,
+            Some(vec!["**/*.pb.go"]),
+            Some(vec!["go", ".proto"]),
+            None,
+            None,
+            Some(1),
+        )?;
+        assert_eq!(filter.skipped_by(1, "1-abc/api/api.go"), None);
+        assert_eq!(filter.skipped_by(1, "1-abc/api/api.proto"), None);
+        assert_eq!(filter.skipped_by(1, "1-abc/api/api.pb.go"), Some("path"));
+        assert_eq!(filter.skipped_by(1, "1-abc/README.md"), Some("extension"));
+        assert_eq!(filter.skipped_by(1, "1-abc/.go"), Some("extension"));
+        assert_eq!(filter.skipped_by(1, "1-abc/a/b/main.go"), Some("depth"));
+
+        let filter: FileFilter =
+            FileFilter::new(Some(vec!["re:/cmd/"]), None, None, Some(1), None, None)?;
+        assert_eq!(filter.skipped_by(1, "1-abc/main.go"), Some("path"));
+        assert_eq!(filter.skipped_by(1, "1-abc/cmd/missing.go"), None);
+        Ok(())
+    }
+
+    #[test]
+    fn encodings() {
+        assert_eq!(
+            sanitize_source(b"package main\n".to_vec()),
+            (b"package main\n".to_vec(), "utf-8", 0)
+        );
+        assert_eq!(
+            sanitize_source(b"\xEF\xBB\xBFpackage main\n".to_vec()),
+            (b"   package main\n".to_vec(), "utf-8-bom", 0)
+        );
+        assert_eq!(
+            sanitize_source(b"\xFF\xFEp\0k\0\n\0".to_vec()),
+            (b"pk\n".to_vec(), "utf-16le", 0)
+        );
+        assert_eq!(
+            sanitize_source(b"\xFE\xFF\0p\0k".to_vec()),
+            (b"pk".to_vec(), "utf-16be", 0)
+        );
+        assert_eq!(
+            sanitize_source(b"package\0main\0".to_vec()),
+            (b"package main ".to_vec(), "utf-8", 2)
+        );
+        assert_eq!(
+            sanitize_source(b"// caf\xE9\npackage main\n".to_vec()),
+            (b"// caf\xE9\npackage main\n".to_vec(), "invalid-utf-8", 0)
+        );
+    }
+
+    #[test]
+    fn output_order() {
+        let mut paths: Vec<&str> = vec![
+            "2-b/main.go",
+            "1-a/pkg/util/b.go",
+            "1-a/pkg-x/a.go",
+            "1-a/pkg/z.go",
+            "1-a/main.go",
+            "1-a/pkg/a.go",
+        ];
+        paths.sort_by_key(|path| output_order_key(path));
+        assert_eq!(
+            paths,
+            vec![
+                "1-a/main.go",
+                "1-a/pkg/a.go",
+                "1-a/pkg/z.go",
+                "1-a/pkg/util/b.go",
+                "1-a/pkg-x/a.go",
+                "2-b/main.go",
+            ]
+        );
+    }
+
+    #[test]
+    fn vendored_trees() {
+        assert_eq!(
+            vendored_tree("1-abcdef/vendor/github.com/pkg/errors/errors.go"),
+            Some("vendor")
+        );
+        assert_eq!(
+            vendored_tree("1-abcdef/internal/third_party/vendor/x.c"),
+            Some("third_party")
+        );
+        assert_eq!(
+            vendored_tree("1-abcdef/parser/testdata/bad.go"),
+            Some("testdata")
+        );
+        assert_eq!(vendored_tree("1-abcdef/cmd/vendor.go"), None);
+        assert_eq!(vendored_tree("vendor"), None);
+    }
+
+    #[test]
+    fn test_files() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+
+        let mut kind = |path: &str, source: &[u8]| -> Result<&'static str> {
+            let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+            Ok(test_file_kind(path, "go", &tree.root_node(), source))
+        };
+        assert_eq!(kind("a/sort_test.go", b"package sort_test\n")?, "external");
+        assert_eq!(kind("a/sort_test.go", b"package sort\n")?, "internal");
+        assert_eq!(kind("a/sort.go", b"package sort_test\n")?, "none");
+        ensure!(!is_test_file("a/test.go"));
+        Ok(())
+    }
+
+    #[test]
+    fn token_streams() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        let grammar: Grammar = go_grammar();
+        parser.set_language(&grammar.lang)?;
+        let source: &[u8] = b"package main\n\nfunc f() string { return \"a,b\" } // c\n";
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let rows: String =
+            file_token_rows(1, "x.go", &tree.root_node(), &grammar, source, source.len())?;
+        let rows: Vec<&str> = rows.lines().collect();
+        assert_eq!(rows[0], "1,x.go,0,package,false,package,1:1,1:8");
+        assert_eq!(rows[1], "1,x.go,1,package_identifier,true,main,1:9,1:13");
+        // String literals are single tokens.
+        ensure!(rows.iter().any(|row| row.ends_with(
+            ",interpreted_string_literal,true,-was_quote-a-was_comma-b-was_quote-,3:26,3:31"
+        )));
+        ensure!(rows
+            .iter()
+            .any(|row| row.ends_with(",comment,true,// c,3:34,3:38")));
+
+        // The tokens of a scaffold are not part of the file.
+        let rows: String = file_token_rows(1, "x.go", &tree.root_node(), &grammar, source, 12)?;
+        assert_eq!(rows.lines().count(), 2);
+        Ok(())
+    }
+
+    #[test]
+    fn comments() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        let grammar: Grammar = go_grammar();
+        parser.set_language(&grammar.lang)?;
+        let source: &[u8] = b"// Package main does things.\npackage main\n\n\
+                               // f returns a, b.\n// It never fails.\nfunc f() {\n\t// free\n\tg()\n}\n\n\
+                               // T is a type.\ntype T struct{}\n\n\
+                               var x = 1 // trailing\nvar y = 2\n\n// detached\n\nfunc g() {}\n";
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+        let rows: String =
+            file_comment_rows(1, "x.go", &tree.root_node(), &grammar, source, source.len())?;
+        let rows: Vec<&str> = rows.lines().collect();
+        assert_eq!(
+            rows,
+            vec![
+                "1,x.go,doc,main,package_clause,1:1,1:29,// Package main does things.",
+                "1,x.go,doc,f,function_declaration,4:1,5:19,// f returns a-was_comma- b.-was_newline-// It never fails.",
+                "1,x.go,free,,,7:2,7:9,// free",
+                "1,x.go,doc,T,type_declaration,11:1,11:16,// T is a type.",
+                "1,x.go,free,,,14:11,14:22,// trailing",
+                "1,x.go,free,,,17:1,17:12,// detached",
+            ]
+        );
+
+        // The comments of a scaffold are not part of the file.
+        let rows: String = file_comment_rows(1, "x.go", &tree.root_node(), &grammar, source, 10)?;
+        assert_eq!(rows.lines().count(), 1);
+        Ok(())
+    }
+
+    #[test]
+    fn previous_runs() {
+        let logs = "id,name,language,functions,functions_with_kw,kw.json,parse_error,hash\n\
+                    1,a/x.go,go,2,1,1,none,abc\n\
+                    1,a/y-was_comma-z.go,go,0,0,0,none,def\n";
+        let output = "id,path,name\n\
+                      1,a/x.go.functions/3-1,f\n\
+                      1,a/x.go.functions/7-1,g\n\
+                      2,b/w.go.functions/1-1,h\n";
+        let errors = "id,path,kind\n1,a/y-was_comma-z.go,missing\n";
+        let rows = previous_rows(logs, output, "", errors, "", "", "", "", "", "", "", &[]);
+        assert_eq!(rows.len(), 2);
+        assert_eq!(
+            rows["a/x.go"],
+            PreviousRows {
+                hash: "abc",
+                log: "1,a/x.go,go,2,1,1,none,abc",
+                output: "1,a/x.go.functions/3-1,f\n1,a/x.go.functions/7-1,g\n".to_string(),
+                ..Default::default()
+            }
+        );
+        assert_eq!(
+            rows[escape_path("a/y,z.go").as_str()].errors,
+            "1,a/y-was_comma-z.go,missing\n"
+        );
+    }
+
+    #[test]
+    fn time_budget() -> Result<()> {
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&go_grammar().lang)?;
+        let source: &[u8] = b"package main\n\nfunc main() {}\n";
+
+        ensure!(parse_before(&mut parser, source, None)?.is_some());
+        ensure!(parse_before(&mut parser, source, Some(Instant::now()))?.is_none());
+        ensure!(parse_before(
+            &mut parser,
+            source,
+            Some(Instant::now() + Duration::from_secs(60))
+        )?
+        .is_some());
+        Ok(())
+    }
 }
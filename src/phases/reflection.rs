@@ -0,0 +1,285 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/reflection.md")]
+
+use std::collections::HashMap;
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use tree_sitter::Node;
+
+use crate::utils::census::{
+    self, called_function, imported_packages, nodes, qualified_name, text, Occurrence,
+};
+use crate::utils::logger::Logger;
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("reflection")
+        .about("Inventories the uses of the reflect and unsafe packages in the Go files of the downloaded projects")
+        .long_about(include_str!("../docs/reflection.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the uses of the reflect and unsafe packages of every Go file.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("census")
+                .long("census")
+                .value_name("CENSUS_FILE.csv")
+                .help("Path to the output csv file storing the number of uses of the reflect and unsafe packages of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Categories of the uses, in the order of the columns of the census.
+const CATEGORIES: [&str; 6] = [
+    "type_of",
+    "value_of",
+    "struct_tag",
+    "by_name",
+    "unsafe",
+    "reflect",
+];
+
+/// Methods of reflect.Type and reflect.Value looking up a method or a field by its name.
+const BY_NAME_METHODS: [&str; 3] = ["MethodByName", "FieldByName", "FieldByNameFunc"];
+
+/// Returns the function or the type converting a node, if the node is the argument of a call or of a conversion.
+fn converted_by<'a>(node: &Node<'a>) -> Option<Node<'a>> {
+    let parent: Node = node.parent()?;
+    match parent.kind() {
+        "argument_list" => parent.parent()?.child_by_field_name("function"),
+        "type_conversion_expression" => parent.child_by_field_name("type"),
+        _ => None,
+    }
+}
+
+/// Returns the pattern of a call of unsafe.Pointer: converted to a pointer type, e.g. `(*T)(unsafe.Pointer(p))`,
+/// converted to an integer, e.g. `uintptr(unsafe.Pointer(p))`, computed with pointer arithmetic, e.g.
+/// `unsafe.Pointer(uintptr(p) + offset)`, or another conversion to unsafe.Pointer.
+fn pointer_pattern(call: &Node, source: &[u8]) -> &'static str {
+    let conversion: Option<&str> = converted_by(call).map(|function| text(&function, source));
+    match conversion {
+        Some(function) if function.starts_with("(*") || function.starts_with('*') => {
+            "pointer-conversion"
+        }
+        Some("uintptr") => "uintptr-conversion",
+        _ if call
+            .child_by_field_name("arguments")
+            .and_then(|arguments| arguments.named_child(0))
+            .is_some_and(|argument| argument.kind() == "binary_expression") =>
+        {
+            "pointer-arithmetic"
+        }
+        _ => "unsafe.Pointer",
+    }
+}
+
+/// Returns the use of the reflect or unsafe package at a node, if any.
+///
+/// # Arguments
+///
+/// * `node` - The node.
+/// * `source` - The source code of the file.
+/// * `imports` - The packages imported by the file.
+fn occurrence(node: &Node, source: &[u8], imports: &HashMap<String, String>) -> Option<Occurrence> {
+    match node.kind() {
+        "call_expression" => {
+            if let Some((package, name)) = called_function(node, source, imports) {
+                return match (package, name) {
+                    ("reflect", "TypeOf" | "TypeFor") => {
+                        Some(Occurrence::new("type_of", format!("reflect.{name}"), node))
+                    }
+                    ("reflect", "ValueOf" | "Indirect") => {
+                        Some(Occurrence::new("value_of", format!("reflect.{name}"), node))
+                    }
+                    ("reflect", "StructTag") => {
+                        Some(Occurrence::new("struct_tag", "reflect.StructTag", node))
+                    }
+                    ("reflect", _) => {
+                        Some(Occurrence::new("reflect", format!("reflect.{name}"), node))
+                    }
+                    ("unsafe", "Pointer") => Some(Occurrence::new(
+                        "unsafe",
+                        pointer_pattern(node, source),
+                        node,
+                    )),
+                    ("unsafe", _) => {
+                        Some(Occurrence::new("unsafe", format!("unsafe.{name}"), node))
+                    }
+                    _ => None,
+                };
+            }
+            // The methods of the values of the reflect package are only looked for in the files importing it.
+            if !imports.values().any(|path| path == "reflect") {
+                return None;
+            }
+            let function: Node = node.child_by_field_name("function")?;
+            if function.kind() != "selector_expression" {
+                return None;
+            }
+            let method: &str = text(&function.child_by_field_name("field")?, source);
+            let operand: Node = function.child_by_field_name("operand")?;
+            if BY_NAME_METHODS.contains(&method) {
+                Some(Occurrence::new("by_name", method, node))
+            } else if matches!(method, "Get" | "Lookup")
+                && operand.kind() == "selector_expression"
+                && operand
+                    .child_by_field_name("field")
+                    .is_some_and(|field| text(&field, source) == "Tag")
+            {
+                Some(Occurrence::new("struct_tag", format!("Tag.{method}"), node))
+            } else {
+                None
+            }
+        }
+        // References other than calls, e.g. the reflect.Value or unsafe.Pointer types.
+        "selector_expression" | "qualified_type" => {
+            if node.parent().is_some_and(|call| {
+                call.kind() == "call_expression"
+                    && call.child_by_field_name("function") == Some(*node)
+            }) {
+                return None;
+            }
+            let (package, name) = qualified_name(node, source, imports)?;
+            match (package, name) {
+                ("reflect", "StructTag") => {
+                    Some(Occurrence::new("struct_tag", "reflect.StructTag", node))
+                }
+                ("reflect", _) => Some(Occurrence::new("reflect", format!("reflect.{name}"), node)),
+                ("unsafe", _) => Some(Occurrence::new("unsafe", format!("unsafe.{name}"), node)),
+                _ => None,
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Returns the uses of the reflect and unsafe packages of a Go file, in the order of the file.
+///
+/// # Arguments
+///
+/// * `root` - The root node of the file.
+/// * `source` - The source code of the file.
+fn reflection_occurrences(root: &Node, source: &[u8]) -> Vec<Occurrence> {
+    let imports: HashMap<String, String> = imported_packages(root, source);
+    nodes(root)
+        .iter()
+        .filter_map(|node| occurrence(node, source, &imports))
+        .collect()
+}
+
+/// Inventories the uses of the reflect and unsafe packages in the Go files of the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the uses. Defaults to the input path with ".reflection.csv" appended.
+/// * `census_path` - The optional path to the output CSV file storing the census of the packages. Defaults to the input path with ".reflection_census.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    census_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.reflection.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_census_path = format!("{input_path}.reflection_census.csv");
+    let census_path = census_path.unwrap_or(&default_census_path);
+
+    census::run(
+        input_path,
+        output_path,
+        census_path,
+        &CATEGORIES,
+        reflection_occurrences,
+        force,
+        logger,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::Context;
+    use tree_sitter::Parser;
+
+    use super::*;
+
+    #[test]
+    fn occurrences() -> Result<()> {
+        let source: &[u8] = b"package a\n\n\
+            import (\n\t\"reflect\"\n\t\"unsafe\"\n)\n\n\
+            func f(x any, p *int) {\n\
+            \tt := reflect.TypeOf(x)\n\
+            \tvar v reflect.Value = reflect.ValueOf(x)\n\
+            \t_ = t.Field(0).Tag.Get(\"json\")\n\
+            \tv.MethodByName(\"String\").Call(nil)\n\
+            \tq := (*int64)(unsafe.Pointer(p))\n\
+            \tu := uintptr(unsafe.Pointer(q))\n\
+            \t_ = unsafe.Pointer(u + unsafe.Sizeof(*p))\n\
+            }\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let found: Vec<(&str, String, usize)> = reflection_occurrences(&tree.root_node(), source)
+            .into_iter()
+            .map(|o| (o.category, o.construct, o.line))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("type_of", "reflect.TypeOf".to_string(), 9),
+                ("reflect", "reflect.Value".to_string(), 10),
+                ("value_of", "reflect.ValueOf".to_string(), 10),
+                ("struct_tag", "Tag.Get".to_string(), 11),
+                ("by_name", "MethodByName".to_string(), 12),
+                ("unsafe", "pointer-conversion".to_string(), 13),
+                ("unsafe", "uintptr-conversion".to_string(), 14),
+                ("unsafe", "pointer-arithmetic".to_string(), 15),
+                ("unsafe", "unsafe.Sizeof".to_string(), 15),
+            ]
+        );
+        Ok(())
+    }
+}
@@ -0,0 +1,297 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/search.md")]
+
+use std::io::Write;
+
+use anyhow::{Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use tracing::info;
+
+use crate::utils::csv::*;
+use crate::utils::forge::{Forge, ForgeProject, Provider};
+use crate::utils::fs::FileMode;
+use crate::utils::github::ToCSV;
+use crate::utils::logger::{log_output_file, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("search")
+        .about("Searches a code hosting platform for projects matching a query.")
+        .long_about(include_str!("../docs/search.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output CSV file storing the ids, the names, the latest commits and the metadata of the projects.")
+                .required(true)
+        )
+        .arg(
+            Arg::new("query")
+                .short('q')
+                .long("query")
+                .value_name("QUERY")
+                .help("Search query, in the syntax of the provider.")
+                .required_unless_present("namespace")
+        )
+        .arg(
+            Arg::new("namespace")
+                .long("namespace")
+                .alias("workspace")
+                .visible_alias("org")
+                .value_name("NAMESPACE")
+                .help("User, organization, group (GitLab) or workspace (Bitbucket) the search is restricted to. \
+                       Required for SourceHut, which has no global search. \
+                       If no query is given, all the projects of the namespace are collected.")
+        )
+        .arg(
+            Arg::new("provider")
+                .long("provider")
+                .value_name("PROVIDER")
+                .help("Code hosting platform to search.")
+                .default_value("github")
+                .value_parser(Provider::NAMES),
+        )
+        .arg(
+            Arg::new("host")
+                .long("host")
+                .value_name("HOST")
+                .help("Host of a self-hosted instance of the provider (e.g. gitlab.example.com). \
+                       If not specified, the public instance of the provider is used."),
+        )
+        .arg(
+            Arg::new("tokens")
+                .short('t')
+                .long("tokens")
+                .value_name("TOKENS_FILE.csv")
+                .help("Path to the file containing the tokens to use. It must be a valid CSV file with one column named 'token'. \
+                       Only the first token is used. If not specified, the token is read from the environment variable of the provider \
+                       (GITHUB_TOKEN or GH_TOKEN for GitHub, GITLAB_TOKEN for GitLab, BITBUCKET_TOKEN for Bitbucket). \
+                       Bitbucket app passwords must be written as username:app_password."),
+        )
+        .arg(
+            Arg::new("number")
+                .short('n')
+                .long("number")
+                .value_name("NUMBER_OF_PROJECTS")
+                .help("Maximum number of projects to collect. If not specified, all results are collected.")
+                .value_parser(clap::value_parser!(usize))
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output file if it already exists.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Searches a forge for projects matching a query.
+///
+/// # Arguments
+///
+/// * `output_path` - Path to the output CSV file.
+/// * `query` - The search query. If not specified, all the projects of the namespace are collected.
+/// * `namespace` - The user, organization, group or workspace the search is restricted to, if any.
+/// * `provider` - The name of the code hosting platform to search.
+/// * `host` - The host of a self-hosted instance of the provider. If not specified, the public instance is used.
+/// * `tokens_file` - Path to the file containing the tokens. If not specified, the token is read from the environment.
+/// * `n` - Maximum number of projects to collect. If not specified, all results are collected.
+/// * `force` - Whether to override the output file if it already exists.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// A result indicating success or failure of the operation.
+pub fn run(
+    output_path: &str,
+    query: Option<&str>,
+    namespace: Option<&str>,
+    provider: &str,
+    host: Option<&str>,
+    tokens_file: Option<&str>,
+    n: Option<usize>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let forge: Forge = Forge::new(provider.parse()?, host);
+
+    log_output_file(output_path, false, force)?;
+
+    let token: String = forge
+        .load_tokens(tokens_file, logger)?
+        .into_iter()
+        .next()
+        .context("No token available")?;
+
+    let mut output_file = CSVFile::new(output_path, FileMode::Overwrite)?;
+    output_file.write_header(ForgeProject::header())?;
+
+    match (query, namespace) {
+        (Some(q), Some(ns)) => info!("Searching {forge} for \"{q}\" in {ns}..."),
+        (Some(q), None) => info!("Searching {forge} for \"{q}\"..."),
+        (None, _) => info!(
+            "Listing the projects of {} on {forge}...",
+            namespace.unwrap_or_default()
+        ),
+    }
+
+    let progress: ProgressBar = match n {
+        Some(n) => ProgressBar::new(n as u64),
+        None => ProgressBar::new_spinner(),
+    };
+    if n.is_some() {
+        progress.set_style(
+            indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+        )
+    }
+
+    let found: usize = forge.search(&token, query, namespace, n, |project: ForgeProject| {
+        write_project(&mut output_file, &project)?;
+        progress.inc(1);
+        Ok(())
+    })?;
+    progress.finish();
+
+    info!("{} projects found.", found);
+
+    Ok(())
+}
+
+/// Writes a project found by the search as a row of the output file.
+///
+/// # Arguments
+///
+/// * `output_file` - The output CSV file.
+/// * `project` - The project to write.
+fn write_project(output_file: &mut CSVFile, project: &ForgeProject) -> Result<()> {
+    writeln!(output_file, "{}", project.to_csv(()))?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::ensure;
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn query() -> Result<()> {
+        let github: Forge = Forge::new(Provider::GitHub, Some("github.com"));
+        assert_eq!(
+            github
+                .search_url(Some("language:go"), Some("org"))?
+                .as_str(),
+            "https://api.github.com/search/repositories?q=language%3Ago+user%3Aorg&per_page=100"
+        );
+        assert_eq!(
+            github.search_url(None, Some("org"))?.as_str(),
+            "https://api.github.com/search/repositories?q=user%3Aorg&per_page=100"
+        );
+        assert_eq!(
+            Forge::new(Provider::GitLab, Some("gitlab.example.org"))
+                .search_url(Some("parser"), Some("group/sub"))?
+                .as_str(),
+            "https://gitlab.example.org/api/v4/groups/group%2Fsub/projects?include_subgroups=true&search=parser&order_by=id&sort=asc&per_page=100"
+        );
+        assert_eq!(
+            Forge::new(Provider::Bitbucket, None)
+                .search_url(Some("name ~ \"go\""), Some("workspace"))?
+                .as_str(),
+            "https://api.bitbucket.org/2.0/repositories/workspace?q=name+%7E+%22go%22&pagelen=100"
+        );
+        assert_eq!(
+            Forge::new(Provider::Gitea, Some("gitea.example.org"))
+                .search_url(Some("parser"), None)?
+                .as_str(),
+            "https://gitea.example.org/api/v1/repos/search?q=parser&sort=id&order=asc&limit=100"
+        );
+        // SourceHut is queried with GraphQL.
+        ensure!(Forge::new(Provider::SourceHut, None)
+            .search_url(None, Some("~user"))
+            .is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn output_rows() -> Result<()> {
+        let output: &str = "target/tests/search/projects.csv";
+        let mut output_file: CSVFile = CSVFile::new(output, FileMode::Overwrite)?;
+        output_file.write_header(ForgeProject::header())?;
+        write_project(
+            &mut output_file,
+            &ForgeProject {
+                id: 42,
+                name: "owner/repo".to_string(),
+                latest_commit: "abc".to_string(),
+                language: "Go".to_string(),
+                created: 1577836800,
+                pushed: 1577923200,
+                archived: true,
+                stars: Some(3),
+                size: Some(2048),
+                license: "MIT License".to_string(),
+                default_branch: "main".to_string(),
+                ..Default::default()
+            },
+        )?;
+        write_project(
+            &mut output_file,
+            &ForgeProject {
+                id: 7,
+                name: "owner/other".to_string(),
+                latest_commit: "def".to_string(),
+                language: "C, C++".to_string(),
+                fork: true,
+                license: "unknown".to_string(),
+                default_branch: "trunk".to_string(),
+                ..Default::default()
+            },
+        )?;
+        drop(output_file);
+        assert_eq!(
+            std::fs::read_to_string(output)?,
+            "id,name,latest_commit,language,created,pushed,fork,archived,stars,forks,size,license,default_branch\n\
+             42,owner/repo,abc,Go,1577836800,1577923200,false,true,3,,2048,MIT License,main\n\
+             7,owner/other,def,C  C++,0,0,true,false,,,,unknown,trunk\n"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn missing_query() -> Result<()> {
+        // Either a query or a namespace is needed, which is checked before any request is sent.
+        // The Go module proxy needs no token, so that nothing is sent to load one either.
+        ensure!(run(
+            "target/tests/search/missing_query.csv",
+            None,
+            None,
+            "goproxy",
+            None,
+            None,
+            None,
+            true,
+            test_logger(),
+        )
+        .is_err());
+        Ok(())
+    }
+}
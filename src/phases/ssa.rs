@@ -0,0 +1,874 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/ssa.md")]
+
+use std::path::{Path, PathBuf};
+use std::process::{Command, Output};
+
+use anyhow::{bail, Context, Result};
+use clap::{Arg, ArgAction, Command as Cli};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::{info, warn};
+
+use crate::phases::gomod::go_mod_files;
+use crate::utils::fs::*;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Source of the Go helper building the SSA form of the packages.
+const HELPER_SOURCE: &str = include_str!("ssa/main.go");
+
+/// Version of golang.org/x/tools the helper is built with by default.
+const DEFAULT_TOOLS_VERSION: &str = "v0.29.0";
+
+/// Command line arguments parsing.
+pub fn cli() -> Cli {
+    Cli::new("ssa")
+        .about("Builds the SSA form of the type-checked Go packages of the downloaded projects and summarizes their functions")
+        .long_about(include_str!("../docs/ssa.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the summary of every function.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("packages")
+                .short('p')
+                .long("packages")
+                .value_name("PACKAGES_FILE.csv")
+                .help("Path to the output csv file storing the status of every package.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("cfg")
+                .long("cfg")
+                .help("Write the control flow graph of every function, with its basic blocks and the edges between them.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("call-graph")
+                .long("call-graph")
+                .value_name("ALGORITHM")
+                .help("Write the call graph of the functions, built with class hierarchy analysis (cha) or rapid type analysis (rta).")
+                .value_parser(["cha", "rta"])
+                .required(false),
+        )
+        .arg(
+            Arg::new("types-info")
+                .long("types-info")
+                .value_name("MAPS")
+                .help("Write the given maps of the type information of the packages, among defs, uses and types.")
+                .value_parser(["defs", "uses", "types"])
+                .num_args(1..)
+                .action(ArgAction::Append)
+                .required(false),
+        )
+        .arg(
+            Arg::new("interfaces")
+                .long("interfaces")
+                .help("Write the interfaces implemented by the named types of the packages.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("go")
+                .long("go")
+                .value_name("GO_BINARY")
+                .help("Path to the go command building the helper and loading the packages.")
+                .default_value("go"),
+        )
+        .arg(
+            Arg::new("tools-version")
+                .long("tools-version")
+                .value_name("VERSION")
+                .help("Version of golang.org/x/tools the helper is built with.")
+                .default_value(DEFAULT_TOOLS_VERSION),
+        )
+        .arg(
+            Arg::new("helper")
+                .long("helper")
+                .value_name("HELPER_DIR")
+                .help("Directory in which the helper is built. Defaults to the input path with '.ssa_helper' appended.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Summary of the SSA form of a function, as written by the helper.
+#[derive(Debug, PartialEq)]
+struct FunctionSummary {
+    package: String,
+    name: String,
+    file: String,
+    line: u32,
+    /// Number of parameters, free variables, basic blocks, instructions, phi nodes, calls, goroutines,
+    /// deferred calls, heap allocations and panics, followed by the cyclomatic complexity, as listed in [`COUNTS`].
+    counts: [u32; COUNTS.len()],
+}
+
+/// Status of a package loaded by the helper.
+#[derive(Debug, PartialEq)]
+struct PackageStatus {
+    package: String,
+    status: String,
+    errors: u32,
+    error: String,
+}
+
+/// Basic block of the control flow graph of a function.
+#[derive(Debug, PartialEq)]
+struct Block {
+    package: String,
+    function: String,
+    index: u32,
+    /// Kind of the block given by the SSA builder, e.g. "entry", "if.then" or "for.body".
+    comment: String,
+    instructions: u32,
+    /// Line of the first instruction having a position, 0 if there is none.
+    line: u32,
+}
+
+/// Edge of the control flow graph of a function, between two of its blocks.
+#[derive(Debug, PartialEq)]
+struct Edge {
+    package: String,
+    function: String,
+    from: u32,
+    to: u32,
+    /// "true" or "false" for the branches of a conditional jump, "jump" otherwise.
+    kind: String,
+}
+
+/// Edge of the call graph, from a call site of a function to a function it may call.
+#[derive(Debug, PartialEq)]
+struct Call {
+    package: String,
+    function: String,
+    /// Import path of the package of the callee, empty for functions synthesized by the SSA builder.
+    callee_package: String,
+    callee: String,
+    line: u32,
+    /// "static", "dynamic" for calls of function values or "interface" for calls of interface methods.
+    kind: String,
+}
+
+/// Entry of a map of the type information of a package, from an identifier or an expression to what it resolves to.
+#[derive(Debug, PartialEq)]
+struct TypeEntry {
+    /// "defs", "uses" or "types".
+    map: String,
+    package: String,
+    file: String,
+    line: u32,
+    column: u32,
+    /// Identifier, or source of the expression for the types map.
+    name: String,
+    /// Kind of the object for the defs and uses maps, mode of the expression for the types map.
+    kind: String,
+    /// Type qualified with the full paths of its packages, empty if there is none.
+    r#type: String,
+    /// Value of a constant expression, empty otherwise.
+    value: String,
+    object_package: String,
+    object_file: String,
+    /// Line of the declaration of the object, 0 if it has none.
+    object_line: u32,
+}
+
+/// Edge of the interface satisfaction graph, from a named type to an interface it implements.
+#[derive(Debug, PartialEq)]
+struct Implementation {
+    package: String,
+    r#type: String,
+    interface_package: String,
+    interface: String,
+    /// "value" if the type implements the interface, "pointer" if only pointers to it do.
+    receiver: String,
+}
+
+/// Records written by the helper for a module.
+#[derive(Debug, Default)]
+struct HelperRecords {
+    packages: Vec<PackageStatus>,
+    functions: Vec<FunctionSummary>,
+    blocks: Vec<Block>,
+    edges: Vec<Edge>,
+    calls: Vec<Call>,
+    types: Vec<TypeEntry>,
+    implementations: Vec<Implementation>,
+}
+
+/// Names of the counts of a function summary, in the order of the helper.
+const COUNTS: [&str; 11] = [
+    "params",
+    "free_vars",
+    "blocks",
+    "instructions",
+    "phis",
+    "calls",
+    "goroutines",
+    "defers",
+    "allocations",
+    "panics",
+    "cyclomatic",
+];
+
+/// Runs the go command or the helper in a directory.
+///
+/// # Arguments
+///
+/// * `program` - The go command or the path to the helper.
+/// * `dir` - The directory in which the command is run.
+/// * `args` - The arguments of the command.
+///
+/// # Returns
+///
+/// The standard output of the command, or an error containing its standard error if it could not be run or failed.
+fn execute(program: &str, dir: &Path, args: &[&str]) -> Result<Vec<u8>> {
+    let output: Output = Command::new(program)
+        .current_dir(dir)
+        .args(args)
+        // The helper runs the go command too. Both use the installed toolchain rather than
+        // downloading the one requested by the go.mod files.
+        .env("GOTOOLCHAIN", "local")
+        .output()
+        .with_context(|| format!("Could not run {program}, is Go installed?"))?;
+    if !output.status.success() {
+        bail!(
+            "{program} {} failed: {}",
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+    Ok(output.stdout)
+}
+
+/// Writes the helper and its go.mod file to a directory and builds it.
+///
+/// # Arguments
+///
+/// * `go_binary` - The go command.
+/// * `dir` - The directory in which the helper is built.
+/// * `tools_version` - The version of golang.org/x/tools the helper depends on.
+///
+/// # Returns
+///
+/// The absolute path of the helper binary.
+fn build_helper(go_binary: &str, dir: &Path, tools_version: &str) -> Result<PathBuf> {
+    write_file(
+        dir.join("go.mod"),
+        format!("module scyros/ssa\n\ngo 1.22\n\nrequire golang.org/x/tools {tools_version}\n"),
+    )?;
+    write_file(dir.join("main.go"), HELPER_SOURCE)?;
+    // The go.sum file is completed with the checksums of the dependencies, which are downloaded if needed.
+    execute(
+        go_binary,
+        dir,
+        &["build", "-mod=mod", "-o", "ssa_helper", "."],
+    )?;
+    Ok(std::fs::canonicalize(dir)?.join("ssa_helper"))
+}
+
+/// Parses the records written by the helper.
+///
+/// # Returns
+///
+/// The status of every package, the summary of every function and, if requested, their control flow graphs,
+/// call graph, type information and implemented interfaces, or an error if a record is malformed.
+fn helper_records(stdout: &[u8]) -> Result<HelperRecords> {
+    let mut reader = ::csv::ReaderBuilder::new()
+        .has_headers(false)
+        .flexible(true)
+        .from_reader(stdout);
+    let mut records = HelperRecords::default();
+    for record in reader.records() {
+        let record = record?;
+        let field = |i: usize| -> Result<&str> {
+            record
+                .get(i)
+                .with_context(|| format!("Missing field {i} in helper record {record:?}"))
+        };
+        match field(0)? {
+            "package" => records.packages.push(PackageStatus {
+                package: field(1)?.to_string(),
+                status: field(2)?.to_string(),
+                errors: field(3)?.parse()?,
+                error: field(4)?.to_string(),
+            }),
+            "function" => {
+                let mut counts: [u32; COUNTS.len()] = [0; COUNTS.len()];
+                for (i, count) in counts.iter_mut().enumerate() {
+                    *count = field(5 + i)?.parse()?;
+                }
+                records.functions.push(FunctionSummary {
+                    package: field(1)?.to_string(),
+                    name: field(2)?.to_string(),
+                    file: field(3)?.to_string(),
+                    line: field(4)?.parse()?,
+                    counts,
+                });
+            }
+            "block" => records.blocks.push(Block {
+                package: field(1)?.to_string(),
+                function: field(2)?.to_string(),
+                index: field(3)?.parse()?,
+                comment: field(4)?.to_string(),
+                instructions: field(5)?.parse()?,
+                line: field(6)?.parse()?,
+            }),
+            "edge" => records.edges.push(Edge {
+                package: field(1)?.to_string(),
+                function: field(2)?.to_string(),
+                from: field(3)?.parse()?,
+                to: field(4)?.parse()?,
+                kind: field(5)?.to_string(),
+            }),
+            "call" => records.calls.push(Call {
+                package: field(1)?.to_string(),
+                function: field(2)?.to_string(),
+                callee_package: field(3)?.to_string(),
+                callee: field(4)?.to_string(),
+                line: field(5)?.parse()?,
+                kind: field(6)?.to_string(),
+            }),
+            "type" => records.types.push(TypeEntry {
+                map: field(1)?.to_string(),
+                package: field(2)?.to_string(),
+                file: field(3)?.to_string(),
+                line: field(4)?.parse()?,
+                column: field(5)?.parse()?,
+                name: field(6)?.to_string(),
+                kind: field(7)?.to_string(),
+                r#type: field(8)?.to_string(),
+                value: field(9)?.to_string(),
+                object_package: field(10)?.to_string(),
+                object_file: field(11)?.to_string(),
+                object_line: field(12)?.parse()?,
+            }),
+            "implements" => records.implementations.push(Implementation {
+                package: field(1)?.to_string(),
+                r#type: field(2)?.to_string(),
+                interface_package: field(3)?.to_string(),
+                interface: field(4)?.to_string(),
+                receiver: field(5)?.to_string(),
+            }),
+            kind => bail!("Unknown helper record {kind}"),
+        }
+    }
+    Ok(records)
+}
+
+/// Returns the path of a file or directory relative to a root directory, "." for the root itself.
+fn relative_path(path: &Path, root: &Path) -> String {
+    match path.strip_prefix(root) {
+        Ok(relative) if relative.as_os_str().is_empty() => ".".to_string(),
+        Ok(relative) => relative.to_string_lossy().to_string(),
+        Err(_) => path.to_string_lossy().to_string(),
+    }
+}
+
+/// Returns the scope of an edge of the interface satisfaction graph: "package" if the type and the interface are
+/// declared in the same package, "module" if they are declared in different packages of the module, and "external"
+/// if the interface is declared outside the module, e.g. in the standard library.
+///
+/// # Arguments
+///
+/// * `implementation` - The edge.
+/// * `module_packages` - The import paths of the packages of the module.
+fn satisfaction_scope(implementation: &Implementation, module_packages: &[&str]) -> &'static str {
+    if implementation.interface_package == implementation.package {
+        "package"
+    } else if module_packages.contains(&implementation.interface_package.as_str()) {
+        "module"
+    } else {
+        "external"
+    }
+}
+
+/// Builds the SSA form of the Go packages of the projects listed in a manifest and summarizes their functions.
+/// The SSA form is built by a Go helper using golang.org/x/tools/go/ssa, which is built before processing the projects.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file storing the functions. Defaults to the input path with ".ssa.csv" appended.
+/// * `packages_path` - The optional path to the output CSV file storing the packages. Defaults to the input path with ".ssa_packages.csv" appended.
+/// * `cfg` - Whether to write the control flow graphs of the functions, to the input path with ".ssa_blocks.csv" and ".ssa_edges.csv" appended.
+/// * `call_graph` - The algorithm building the call graph, cha or rta, if it is written to the input path with ".ssa_calls.csv" appended.
+/// * `types_info` - The maps of the type information written to the input path with ".ssa_types.csv" appended, among defs, uses and types, if any.
+/// * `interfaces` - Whether to write the interfaces implemented by the named types, to the input path with ".ssa_interfaces.csv" appended.
+/// * `go_binary` - The go command.
+/// * `tools_version` - The version of golang.org/x/tools the helper is built with.
+/// * `helper_dir` - The optional directory in which the helper is built. Defaults to the input path with ".ssa_helper" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the helper could not be built, or if the manifest or the output files could not be read or written.
+#[allow(clippy::too_many_arguments)]
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    packages_path: Option<&str>,
+    cfg: bool,
+    call_graph: Option<&str>,
+    types_info: Option<Vec<&str>>,
+    interfaces: bool,
+    go_binary: &str,
+    tools_version: &str,
+    helper_dir: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.ssa.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_packages_path = format!("{input_path}.ssa_packages.csv");
+    let packages_path = packages_path.unwrap_or(&default_packages_path);
+    let default_helper_dir = format!("{input_path}.ssa_helper");
+    let helper_dir = helper_dir.unwrap_or(&default_helper_dir);
+    let blocks_path = format!("{input_path}.ssa_blocks.csv");
+    let edges_path = format!("{input_path}.ssa_edges.csv");
+    let calls_path = format!("{input_path}.ssa_calls.csv");
+    let types_path = format!("{input_path}.ssa_types.csv");
+    let interfaces_path = format!("{input_path}.ssa_interfaces.csv");
+
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(packages_path, false, force)?;
+    if cfg {
+        log_output_file(&blocks_path, false, force)?;
+        log_output_file(&edges_path, false, force)?;
+    }
+    if call_graph.is_some() {
+        log_output_file(&calls_path, false, force)?;
+    }
+    if types_info.is_some() {
+        log_output_file(&types_path, false, force)?;
+    }
+    if interfaces {
+        log_output_file(&interfaces_path, false, force)?;
+    }
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    info!("Building the SSA helper in {helper_dir}");
+    let helper: PathBuf = build_helper(go_binary, Path::new(helper_dir), tools_version)
+        .context("Cannot build the SSA helper")?;
+    let helper: &str = helper.to_str().context("Invalid helper path")?;
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    let mut package_ids: Vec<Option<u32>> = Vec::new();
+    let mut package_modules: Vec<String> = Vec::new();
+    let mut package_paths: Vec<String> = Vec::new();
+    let mut statuses: Vec<String> = Vec::new();
+    let mut errors: Vec<u32> = Vec::new();
+    let mut messages: Vec<String> = Vec::new();
+
+    let mut ids: Vec<Option<u32>> = Vec::new();
+    let mut modules: Vec<String> = Vec::new();
+    let mut packages: Vec<String> = Vec::new();
+    let mut names: Vec<String> = Vec::new();
+    let mut paths: Vec<String> = Vec::new();
+    let mut lines: Vec<u32> = Vec::new();
+    let mut counts: Vec<Vec<u32>> = vec![Vec::new(); COUNTS.len()];
+
+    // The blocks and edges of the control flow graphs, with the project and module of their function.
+    let mut blocks: Vec<(Option<u32>, String, Block)> = Vec::new();
+    let mut edges: Vec<(Option<u32>, String, Edge)> = Vec::new();
+    let mut calls: Vec<(Option<u32>, String, Call)> = Vec::new();
+    let mut types: Vec<(Option<u32>, String, TypeEntry)> = Vec::new();
+    // The edges of the interface satisfaction graph, with their scope.
+    let mut implementations: Vec<(Option<u32>, String, Implementation, &str)> = Vec::new();
+    let mut helper_args: Vec<String> = Vec::new();
+    if cfg {
+        helper_args.push("-cfg".to_string());
+    }
+    if let Some(algorithm) = call_graph {
+        helper_args.push(format!("-callgraph={algorithm}"));
+    }
+    if let Some(maps) = &types_info {
+        helper_args.push(format!("-types={}", maps.join(",")));
+    }
+    if interfaces {
+        helper_args.push("-interfaces".to_string());
+    }
+    helper_args.push("./...".to_string());
+    let helper_args: Vec<&str> = helper_args.iter().map(String::as_str).collect();
+
+    for entry in &entries {
+        let project_path: &str = entry["path"]
+            .as_str()
+            .context("Manifest entry without path")?;
+        let id: Option<u32> = entry["id"].as_u32();
+        // The helper reports absolute paths, which are made relative to the root of the project.
+        let root: PathBuf = match std::fs::canonicalize(project_path) {
+            Ok(root) => root,
+            Err(e) => {
+                warn!("Cannot open {project_path}: {e}");
+                progress.inc(1);
+                continue;
+            }
+        };
+        for go_mod_path in go_mod_files(project_path) {
+            let module_dir: PathBuf = std::fs::canonicalize(&go_mod_path)?
+                .parent()
+                .map(Path::to_path_buf)
+                .unwrap_or_default();
+            let module: String = relative_path(&module_dir, &root);
+            match execute(helper, &module_dir, &helper_args)
+                .and_then(|stdout| helper_records(&stdout))
+            {
+                Ok(records) => {
+                    let module_packages: Vec<&str> = records
+                        .packages
+                        .iter()
+                        .map(|package| package.package.as_str())
+                        .collect();
+                    implementations.extend(records.implementations.into_iter().map(
+                        |implementation| {
+                            let scope: &str = satisfaction_scope(&implementation, &module_packages);
+                            (id, module.clone(), implementation, scope)
+                        },
+                    ));
+                    for package in records.packages {
+                        package_ids.push(id);
+                        package_modules.push(module.clone());
+                        package_paths.push(package.package);
+                        statuses.push(package.status);
+                        errors.push(package.errors);
+                        messages.push(package.error);
+                    }
+                    for function in records.functions {
+                        ids.push(id);
+                        modules.push(module.clone());
+                        packages.push(function.package);
+                        names.push(function.name);
+                        paths.push(relative_path(Path::new(&function.file), &root));
+                        lines.push(function.line);
+                        for (column, count) in counts.iter_mut().zip(function.counts) {
+                            column.push(count);
+                        }
+                    }
+                    blocks.extend(
+                        records
+                            .blocks
+                            .into_iter()
+                            .map(|block| (id, module.clone(), block)),
+                    );
+                    edges.extend(
+                        records
+                            .edges
+                            .into_iter()
+                            .map(|edge| (id, module.clone(), edge)),
+                    );
+                    calls.extend(
+                        records
+                            .calls
+                            .into_iter()
+                            .map(|call| (id, module.clone(), call)),
+                    );
+                    // Declarations outside the project, e.g. in the standard library, keep their absolute path.
+                    types.extend(records.types.into_iter().map(|mut entry| {
+                        entry.file = relative_path(Path::new(&entry.file), &root);
+                        if !entry.object_file.is_empty() {
+                            entry.object_file = relative_path(Path::new(&entry.object_file), &root);
+                        }
+                        (id, module.clone(), entry)
+                    }));
+                }
+                // Modules whose packages cannot be listed, e.g. because of a malformed go.mod file, are recorded as failed.
+                Err(e) => {
+                    warn!(
+                        "Cannot build the SSA form of {}: {e:#}",
+                        module_dir.display()
+                    );
+                    package_ids.push(id);
+                    package_modules.push(module.clone());
+                    package_paths.push(String::new());
+                    statuses.push("failed".to_string());
+                    errors.push(1);
+                    messages.push(format!("{e:#}"));
+                }
+            }
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+
+    info!("Packages loaded: {}", package_paths.len());
+    for status in ["ok", "ill-typed", "failed"] {
+        info!(
+            "  {status}: {}",
+            statuses.iter().filter(|s| *s == status).count()
+        );
+    }
+    info!("Functions summarized: {}", names.len());
+
+    let mut packages_df: DataFrame = df!(
+        "id" => package_ids,
+        "module" => package_modules,
+        "package" => package_paths,
+        "status" => statuses,
+        "errors" => errors,
+        "error" => messages,
+    )?;
+    log_write_output(logger, packages_path, &mut packages_df, false)?;
+
+    let mut functions_df: DataFrame = df!(
+        "id" => ids,
+        "module" => modules,
+        "package" => packages,
+        "function" => names,
+        "path" => paths,
+        "line" => lines,
+    )?;
+    for (name, column) in COUNTS.iter().zip(counts) {
+        functions_df.with_column(polars::prelude::Column::new((*name).into(), column))?;
+    }
+    log_write_output(logger, output_path, &mut functions_df, false)?;
+
+    if cfg {
+        info!("Basic blocks: {}", blocks.len());
+        info!("Edges: {}", edges.len());
+        let mut blocks_df: DataFrame = df!(
+            "id" => blocks.iter().map(|(id, _, _)| *id).collect::<Vec<Option<u32>>>(),
+            "module" => blocks.iter().map(|(_, module, _)| module.as_str()).collect::<Vec<&str>>(),
+            "package" => blocks.iter().map(|(_, _, b)| b.package.as_str()).collect::<Vec<&str>>(),
+            "function" => blocks.iter().map(|(_, _, b)| b.function.as_str()).collect::<Vec<&str>>(),
+            "block" => blocks.iter().map(|(_, _, b)| b.index).collect::<Vec<u32>>(),
+            "comment" => blocks.iter().map(|(_, _, b)| b.comment.as_str()).collect::<Vec<&str>>(),
+            "instructions" => blocks.iter().map(|(_, _, b)| b.instructions).collect::<Vec<u32>>(),
+            "line" => blocks.iter().map(|(_, _, b)| b.line).collect::<Vec<u32>>(),
+        )?;
+        log_write_output(logger, &blocks_path, &mut blocks_df, false)?;
+        let mut edges_df: DataFrame = df!(
+            "id" => edges.iter().map(|(id, _, _)| *id).collect::<Vec<Option<u32>>>(),
+            "module" => edges.iter().map(|(_, module, _)| module.as_str()).collect::<Vec<&str>>(),
+            "package" => edges.iter().map(|(_, _, e)| e.package.as_str()).collect::<Vec<&str>>(),
+            "function" => edges.iter().map(|(_, _, e)| e.function.as_str()).collect::<Vec<&str>>(),
+            "from" => edges.iter().map(|(_, _, e)| e.from).collect::<Vec<u32>>(),
+            "to" => edges.iter().map(|(_, _, e)| e.to).collect::<Vec<u32>>(),
+            "kind" => edges.iter().map(|(_, _, e)| e.kind.as_str()).collect::<Vec<&str>>(),
+        )?;
+        log_write_output(logger, &edges_path, &mut edges_df, false)?;
+    }
+
+    if call_graph.is_some() {
+        info!("Call graph edges: {}", calls.len());
+        let mut calls_df: DataFrame = df!(
+            "id" => calls.iter().map(|(id, _, _)| *id).collect::<Vec<Option<u32>>>(),
+            "module" => calls.iter().map(|(_, module, _)| module.as_str()).collect::<Vec<&str>>(),
+            "package" => calls.iter().map(|(_, _, c)| c.package.as_str()).collect::<Vec<&str>>(),
+            "function" => calls.iter().map(|(_, _, c)| c.function.as_str()).collect::<Vec<&str>>(),
+            "callee_package" => calls.iter().map(|(_, _, c)| c.callee_package.as_str()).collect::<Vec<&str>>(),
+            "callee" => calls.iter().map(|(_, _, c)| c.callee.as_str()).collect::<Vec<&str>>(),
+            "line" => calls.iter().map(|(_, _, c)| c.line).collect::<Vec<u32>>(),
+            "kind" => calls.iter().map(|(_, _, c)| c.kind.as_str()).collect::<Vec<&str>>(),
+        )?;
+        log_write_output(logger, &calls_path, &mut calls_df, false)?;
+    }
+
+    if types_info.is_some() {
+        info!("Type information entries: {}", types.len());
+        let mut types_df: DataFrame = df!(
+            "id" => types.iter().map(|(id, _, _)| *id).collect::<Vec<Option<u32>>>(),
+            "module" => types.iter().map(|(_, module, _)| module.as_str()).collect::<Vec<&str>>(),
+            "package" => types.iter().map(|(_, _, t)| t.package.as_str()).collect::<Vec<&str>>(),
+            "map" => types.iter().map(|(_, _, t)| t.map.as_str()).collect::<Vec<&str>>(),
+            "path" => types.iter().map(|(_, _, t)| t.file.as_str()).collect::<Vec<&str>>(),
+            "line" => types.iter().map(|(_, _, t)| t.line).collect::<Vec<u32>>(),
+            "column" => types.iter().map(|(_, _, t)| t.column).collect::<Vec<u32>>(),
+            "name" => types.iter().map(|(_, _, t)| t.name.as_str()).collect::<Vec<&str>>(),
+            "kind" => types.iter().map(|(_, _, t)| t.kind.as_str()).collect::<Vec<&str>>(),
+            "type" => types.iter().map(|(_, _, t)| t.r#type.as_str()).collect::<Vec<&str>>(),
+            "value" => types.iter().map(|(_, _, t)| t.value.as_str()).collect::<Vec<&str>>(),
+            "object_package" => types.iter().map(|(_, _, t)| t.object_package.as_str()).collect::<Vec<&str>>(),
+            "object_path" => types.iter().map(|(_, _, t)| t.object_file.as_str()).collect::<Vec<&str>>(),
+            "object_line" => types.iter().map(|(_, _, t)| t.object_line).collect::<Vec<u32>>(),
+        )?;
+        log_write_output(logger, &types_path, &mut types_df, false)?;
+    }
+
+    if interfaces {
+        info!("Interface implementations: {}", implementations.len());
+        let mut interfaces_df: DataFrame = df!(
+            "id" => implementations.iter().map(|(id, _, _, _)| *id).collect::<Vec<Option<u32>>>(),
+            "module" => implementations.iter().map(|(_, module, _, _)| module.as_str()).collect::<Vec<&str>>(),
+            "package" => implementations.iter().map(|(_, _, i, _)| i.package.as_str()).collect::<Vec<&str>>(),
+            "type" => implementations.iter().map(|(_, _, i, _)| i.r#type.as_str()).collect::<Vec<&str>>(),
+            "interface_package" => implementations.iter().map(|(_, _, i, _)| i.interface_package.as_str()).collect::<Vec<&str>>(),
+            "interface" => implementations.iter().map(|(_, _, i, _)| i.interface.as_str()).collect::<Vec<&str>>(),
+            "receiver" => implementations.iter().map(|(_, _, i, _)| i.receiver.as_str()).collect::<Vec<&str>>(),
+            "scope" => implementations.iter().map(|(_, _, _, scope)| *scope).collect::<Vec<&str>>(),
+        )?;
+        log_write_output(logger, &interfaces_path, &mut interfaces_df, false)?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn records() -> Result<()> {
+        let stdout: &[u8] = b"package,example.com/a,ok,0,\n\
+            package,example.com/a/b,ill-typed,1,\"undefined: x, y\"\n\
+            function,example.com/a,main,/p/1/main.go,3,0,0,4,12,1,2,1,0,1,0,2\n\
+            block,example.com/a,main,0,entry,3,4\n\
+            edge,example.com/a,main,0,1,true\n\
+            call,example.com/a,main,fmt,Println,5,static\n\
+            type,uses,example.com/a,/p/1/main.go,5,6,Println,func,\"func(a ...any) (n int, err error)\",,fmt,/go/src/fmt/print.go,313\n\
+            type,types,example.com/a,/p/1/main.go,5,14,1 << 2,constant,untyped int,4,,,0\n\
+            implements,example.com/a,Buffer,io,Writer,pointer\n\
+            implements,example.com/a,Square,example.com/a/b,Shape,value\n";
+        let records: HelperRecords = helper_records(stdout)?;
+        assert_eq!(records.packages.len(), 2);
+        assert_eq!(
+            records.packages[1],
+            PackageStatus {
+                package: "example.com/a/b".to_string(),
+                status: "ill-typed".to_string(),
+                errors: 1,
+                error: "undefined: x, y".to_string(),
+            }
+        );
+        assert_eq!(
+            records.functions,
+            vec![FunctionSummary {
+                package: "example.com/a".to_string(),
+                name: "main".to_string(),
+                file: "/p/1/main.go".to_string(),
+                line: 3,
+                counts: [0, 0, 4, 12, 1, 2, 1, 0, 1, 0, 2],
+            }]
+        );
+        assert_eq!(
+            records.blocks,
+            vec![Block {
+                package: "example.com/a".to_string(),
+                function: "main".to_string(),
+                index: 0,
+                comment: "entry".to_string(),
+                instructions: 3,
+                line: 4,
+            }]
+        );
+        assert_eq!(
+            records.edges,
+            vec![Edge {
+                package: "example.com/a".to_string(),
+                function: "main".to_string(),
+                from: 0,
+                to: 1,
+                kind: "true".to_string(),
+            }]
+        );
+        assert_eq!(
+            records.calls,
+            vec![Call {
+                package: "example.com/a".to_string(),
+                function: "main".to_string(),
+                callee_package: "fmt".to_string(),
+                callee: "Println".to_string(),
+                line: 5,
+                kind: "static".to_string(),
+            }]
+        );
+        assert_eq!(records.types.len(), 2);
+        assert_eq!(
+            records.types[0],
+            TypeEntry {
+                map: "uses".to_string(),
+                package: "example.com/a".to_string(),
+                file: "/p/1/main.go".to_string(),
+                line: 5,
+                column: 6,
+                name: "Println".to_string(),
+                kind: "func".to_string(),
+                r#type: "func(a ...any) (n int, err error)".to_string(),
+                value: String::new(),
+                object_package: "fmt".to_string(),
+                object_file: "/go/src/fmt/print.go".to_string(),
+                object_line: 313,
+            }
+        );
+        assert_eq!(records.types[1].value, "4");
+        assert_eq!(records.types[1].object_line, 0);
+        assert_eq!(
+            records.implementations[0],
+            Implementation {
+                package: "example.com/a".to_string(),
+                r#type: "Buffer".to_string(),
+                interface_package: "io".to_string(),
+                interface: "Writer".to_string(),
+                receiver: "pointer".to_string(),
+            }
+        );
+        let module_packages: Vec<&str> = records
+            .packages
+            .iter()
+            .map(|package| package.package.as_str())
+            .collect();
+        assert_eq!(
+            records
+                .implementations
+                .iter()
+                .map(|i| satisfaction_scope(i, &module_packages))
+                .collect::<Vec<&str>>(),
+            vec!["external", "module"]
+        );
+        assert!(helper_records(b"function,example.com/a,main\n").is_err());
+        assert!(helper_records(b"method,example.com/a\n").is_err());
+
+        assert_eq!(
+            relative_path(Path::new("/p/1/a/b.go"), Path::new("/p/1")),
+            "a/b.go"
+        );
+        assert_eq!(relative_path(Path::new("/p/1"), Path::new("/p/1")), ".");
+        Ok(())
+    }
+}
@@ -0,0 +1,456 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Helper of the ssa subcommand. It loads the packages matching the patterns given as arguments,
+// builds the SSA form of those which type-check and writes to the standard output, as CSV records,
+// one "package" record per package and one "function" record per function. With -cfg, the control
+// flow graph of every function is written too, as "block" and "edge" records, and with -callgraph,
+// the edges of the call graph built by the given algorithm whose callers are in these packages, as
+// "call" records, with -types, the entries of the given maps of the type information of these
+// packages, as "type" records, and with -interfaces, the interfaces satisfied by their named types, as
+// "implements" records.
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// summary of the SSA form of a function.
+type summary struct {
+	blocks, edges, instructions, phis, calls, goroutines, defers, allocations, panics int
+}
+
+func summarize(fn *ssa.Function) summary {
+	s := summary{blocks: len(fn.Blocks)}
+	for _, b := range fn.Blocks {
+		s.edges += len(b.Succs)
+		for _, instr := range b.Instrs {
+			s.instructions++
+			switch instr := instr.(type) {
+			case *ssa.Phi:
+				s.phis++
+			case *ssa.Call:
+				s.calls++
+			case *ssa.Go:
+				s.goroutines++
+			case *ssa.Defer:
+				s.defers++
+			case *ssa.Alloc:
+				if instr.Heap {
+					s.allocations++
+				}
+			case *ssa.Panic:
+				s.panics++
+			}
+		}
+	}
+	return s
+}
+
+// writeCFG writes the basic blocks of a function and the edges between them.
+func writeCFG(out *csv.Writer, prog *ssa.Program, fn *ssa.Function) {
+	pkg, name := fn.Pkg.Pkg.Path(), fn.RelString(fn.Pkg.Pkg)
+	for _, b := range fn.Blocks {
+		line := 0
+		for _, instr := range b.Instrs {
+			if instr.Pos().IsValid() {
+				line = prog.Fset.Position(instr.Pos()).Line
+				break
+			}
+		}
+		out.Write([]string{"block", pkg, name, strconv.Itoa(b.Index), b.Comment, strconv.Itoa(len(b.Instrs)), strconv.Itoa(line)})
+		conditional := false
+		if n := len(b.Instrs); n > 0 {
+			_, conditional = b.Instrs[n-1].(*ssa.If)
+		}
+		for i, succ := range b.Succs {
+			kind := "jump"
+			if conditional && i == 0 {
+				kind = "true"
+			} else if conditional {
+				kind = "false"
+			}
+			out.Write([]string{"edge", pkg, name, strconv.Itoa(b.Index), strconv.Itoa(succ.Index), kind})
+		}
+	}
+}
+
+// buildCallGraph builds the call graph of a program with class hierarchy analysis (cha) or rapid type
+// analysis (rta). The roots of rta are the main and init functions of the main packages or, if there
+// are none, all the non-generic functions of the packages, as for a library.
+func buildCallGraph(algorithm string, prog *ssa.Program, initial map[*ssa.Package]bool, fns []*ssa.Function) (*callgraph.Graph, error) {
+	switch algorithm {
+	case "cha":
+		return cha.CallGraph(prog), nil
+	case "rta":
+		var roots []*ssa.Function
+		for pkg := range initial {
+			if pkg.Pkg.Name() == "main" {
+				for _, name := range []string{"init", "main"} {
+					if fn := pkg.Func(name); fn != nil {
+						roots = append(roots, fn)
+					}
+				}
+			}
+		}
+		if len(roots) == 0 {
+			for _, fn := range fns {
+				if fn.TypeParams().Len() == 0 {
+					roots = append(roots, fn)
+				}
+			}
+		}
+		if len(roots) == 0 {
+			return callgraph.New(nil), nil
+		}
+		return rta.Analyze(roots, true).CallGraph, nil
+	}
+	return nil, fmt.Errorf("unknown call graph algorithm %s", algorithm)
+}
+
+// writeCallGraph writes the edges of a call graph whose callers are functions of the initial packages.
+func writeCallGraph(out *csv.Writer, prog *ssa.Program, graph *callgraph.Graph, initial map[*ssa.Package]bool) {
+	var records [][]string
+	callgraph.GraphVisitEdges(graph, func(e *callgraph.Edge) error {
+		caller, callee := e.Caller.Func, e.Callee.Func
+		if e.Site == nil || caller == nil || callee == nil || caller.Pkg == nil || !initial[caller.Pkg] || caller.Synthetic != "" {
+			return nil
+		}
+		kind := "dynamic"
+		if common := e.Site.Common(); common.IsInvoke() {
+			kind = "interface"
+		} else if common.StaticCallee() != nil {
+			kind = "static"
+		}
+		calleePkg, calleeName := "", callee.String()
+		if callee.Pkg != nil {
+			calleePkg, calleeName = callee.Pkg.Pkg.Path(), callee.RelString(callee.Pkg.Pkg)
+		}
+		line := 0
+		if e.Site.Pos().IsValid() {
+			line = prog.Fset.Position(e.Site.Pos()).Line
+		}
+		records = append(records, []string{"call", caller.Pkg.Pkg.Path(), caller.RelString(caller.Pkg.Pkg), calleePkg, calleeName, strconv.Itoa(line), kind})
+		return nil
+	})
+	slices.SortFunc(records, func(a, b []string) int { return slices.Compare(a, b) })
+	for _, record := range records {
+		out.Write(record)
+	}
+}
+
+// objectKind returns the kind of the object an identifier denotes, empty if it denotes none.
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Func:
+		return "func"
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		return "type"
+	case *types.PkgName:
+		return "package"
+	case *types.Label:
+		return "label"
+	case *types.Builtin:
+		return "builtin"
+	case *types.Nil:
+		return "nil"
+	}
+	return ""
+}
+
+// valueMode returns the mode of an expression: void, type, builtin, nil, constant, variable, commaok or value.
+func valueMode(tv types.TypeAndValue) string {
+	switch {
+	case tv.IsVoid():
+		return "void"
+	case tv.IsType():
+		return "type"
+	case tv.IsBuiltin():
+		return "builtin"
+	case tv.IsNil():
+		return "nil"
+	case tv.Value != nil:
+		return "constant"
+	case tv.Addressable():
+		return "variable"
+	case tv.HasOk():
+		return "commaok"
+	}
+	return "value"
+}
+
+// typeString returns a type qualified with the full paths of its packages, empty if there is none.
+func typeString(t types.Type) string {
+	if t == nil {
+		return ""
+	}
+	return types.TypeString(t, nil)
+}
+
+// typeEntry is an entry of a map of the type information of a package.
+type typeEntry struct {
+	pos    token.Position
+	fields []string
+}
+
+// writeTypesInfo writes the entries of the given maps of the type information of the packages, among defs,
+// uses and types, sorted by position so that the records are stable across runs. The identifiers of defs and uses
+// are written with the object they denote and its declaration, and the expressions of types with their
+// mode and constant value.
+func writeTypesInfo(out *csv.Writer, pkgs []*packages.Package, maps []string) {
+	for _, p := range pkgs {
+		if p.TypesInfo == nil {
+			continue
+		}
+		var entries []typeEntry
+		add := func(kind string, pos token.Pos, name, mode, typ, value string, obj types.Object) {
+			objPkg, objFile, objLine := "", "", "0"
+			if obj != nil {
+				if obj.Pkg() != nil {
+					objPkg = obj.Pkg().Path()
+				}
+				if obj.Pos().IsValid() {
+					decl := p.Fset.Position(obj.Pos())
+					objFile, objLine = decl.Filename, strconv.Itoa(decl.Line)
+				}
+			}
+			position := p.Fset.Position(pos)
+			entries = append(entries, typeEntry{position, []string{
+				"type", kind, p.PkgPath, position.Filename, strconv.Itoa(position.Line), strconv.Itoa(position.Column),
+				name, mode, typ, value, objPkg, objFile, objLine,
+			}})
+		}
+		for _, m := range maps {
+			switch m {
+			case "defs":
+				for id, obj := range p.TypesInfo.Defs {
+					typ := ""
+					if obj != nil {
+						typ = typeString(obj.Type())
+					}
+					add("defs", id.Pos(), id.Name, objectKind(obj), typ, "", obj)
+				}
+			case "uses":
+				for id, obj := range p.TypesInfo.Uses {
+					add("uses", id.Pos(), id.Name, objectKind(obj), typeString(obj.Type()), "", obj)
+				}
+			case "types":
+				for expr, tv := range p.TypesInfo.Types {
+					value := ""
+					if tv.Value != nil {
+						value = tv.Value.ExactString()
+					}
+					add("types", expr.Pos(), types.ExprString(expr), valueMode(tv), typeString(tv.Type), value, nil)
+				}
+			}
+		}
+		slices.SortFunc(entries, func(a, b typeEntry) int {
+			return cmp.Or(
+				cmp.Compare(a.pos.Filename, b.pos.Filename),
+				cmp.Compare(a.pos.Line, b.pos.Line),
+				cmp.Compare(a.pos.Column, b.pos.Column),
+				slices.Compare(a.fields, b.fields),
+			)
+		})
+		for _, entry := range entries {
+			out.Write(entry.fields)
+		}
+	}
+}
+
+// writeInterfaces writes the interfaces implemented by the named types declared in the packages which type-check,
+// either by their values or only by pointers to them. The interfaces are those declared in these packages and in the
+// packages they import, except the empty ones and the constraints, which cannot be implemented by a method set.
+// Generic types and interfaces are left out, since they are only implemented once instantiated.
+func writeInterfaces(out *csv.Writer, pkgs []*packages.Package) {
+	named := func(p *types.Package) []*types.Named {
+		var res []*types.Named
+		for _, name := range p.Scope().Names() {
+			obj, ok := p.Scope().Lookup(name).(*types.TypeName)
+			if !ok || obj.IsAlias() {
+				continue
+			}
+			if t, ok := obj.Type().(*types.Named); ok && t.TypeParams().Len() == 0 {
+				res = append(res, t)
+			}
+		}
+		return res
+	}
+
+	var concrete []*types.Named
+	var interfaces []*types.Named
+	seen := make(map[*types.Package]bool)
+	addInterfaces := func(p *types.Package) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		for _, t := range named(p) {
+			if iface, ok := t.Underlying().(*types.Interface); ok && iface.NumMethods() > 0 && iface.IsMethodSet() {
+				interfaces = append(interfaces, t)
+			}
+		}
+	}
+	for _, p := range pkgs {
+		if p.Types == nil || p.IllTyped {
+			continue
+		}
+		for _, t := range named(p.Types) {
+			if !types.IsInterface(t) {
+				concrete = append(concrete, t)
+			}
+		}
+		addInterfaces(p.Types)
+		for _, imported := range p.Types.Imports() {
+			addInterfaces(imported)
+		}
+	}
+
+	var records [][]string
+	for _, t := range concrete {
+		for _, i := range interfaces {
+			iface := i.Underlying().(*types.Interface)
+			var receiver string
+			switch {
+			case types.Implements(t, iface):
+				receiver = "value"
+			case types.Implements(types.NewPointer(t), iface):
+				receiver = "pointer"
+			default:
+				continue
+			}
+			records = append(records, []string{
+				"implements", t.Obj().Pkg().Path(), t.Obj().Name(), i.Obj().Pkg().Path(), i.Obj().Name(), receiver,
+			})
+		}
+	}
+	slices.SortFunc(records, func(a, b []string) int { return slices.Compare(a, b) })
+	for _, record := range records {
+		out.Write(record)
+	}
+}
+
+func main() {
+	withCFG := flag.Bool("cfg", false, "write the control flow graph of every function")
+	algorithm := flag.String("callgraph", "", "write the call graph built by cha or rta")
+	typesInfo := flag.String("types", "", "write the given maps of the type information, among defs, uses and types, separated by commas")
+	withInterfaces := flag.Bool("interfaces", false, "write the interfaces implemented by the named types")
+	flag.Parse()
+	cfg := &packages.Config{Mode: packages.LoadAllSyntax}
+	pkgs, err := packages.Load(cfg, flag.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	out := csv.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	// Packages which do not type-check, including those importing such packages, have no SSA form.
+	prog, ssaPkgs := ssautil.Packages(pkgs, ssa.BuilderMode(0))
+	prog.Build()
+
+	initial := make(map[*ssa.Package]bool)
+	for i, p := range pkgs {
+		status, message := "ok", ""
+		if ssaPkgs[i] == nil {
+			status = "ill-typed"
+		} else {
+			initial[ssaPkgs[i]] = true
+		}
+		if len(p.Errors) > 0 {
+			message = p.Errors[0].Msg
+		}
+		out.Write([]string{"package", p.PkgPath, status, strconv.Itoa(len(p.Errors)), message})
+	}
+
+	// The type information of the packages which do not type-check is partial, but written too.
+	if *typesInfo != "" {
+		writeTypesInfo(out, pkgs, strings.Split(*typesInfo, ","))
+	}
+	if *withInterfaces {
+		writeInterfaces(out, pkgs)
+	}
+
+	// Wrappers and instances of generic functions are synthesized by the builder and skipped.
+	var fns []*ssa.Function
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn.Pkg != nil && initial[fn.Pkg] && fn.Synthetic == "" {
+			fns = append(fns, fn)
+		}
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].String() < fns[j].String() })
+
+	for _, fn := range fns {
+		pos := prog.Fset.Position(fn.Pos())
+		s := summarize(fn)
+		cyclomatic := 0
+		if s.blocks > 0 {
+			cyclomatic = s.edges - s.blocks + 2
+		}
+		out.Write([]string{
+			"function",
+			fn.Pkg.Pkg.Path(),
+			fn.RelString(fn.Pkg.Pkg),
+			pos.Filename,
+			strconv.Itoa(pos.Line),
+			strconv.Itoa(len(fn.Params)),
+			strconv.Itoa(len(fn.FreeVars)),
+			strconv.Itoa(s.blocks),
+			strconv.Itoa(s.instructions),
+			strconv.Itoa(s.phis),
+			strconv.Itoa(s.calls),
+			strconv.Itoa(s.goroutines),
+			strconv.Itoa(s.defers),
+			strconv.Itoa(s.allocations),
+			strconv.Itoa(s.panics),
+			strconv.Itoa(cyclomatic),
+		})
+		if *withCFG {
+			writeCFG(out, prog, fn)
+		}
+	}
+
+	if *algorithm != "" {
+		graph, err := buildCallGraph(*algorithm, prog, initial, fns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		writeCallGraph(out, prog, graph, initial)
+	}
+}
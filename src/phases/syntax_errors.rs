@@ -0,0 +1,377 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/syntax_errors.md")]
+
+use std::collections::{HashMap, HashSet};
+
+use anyhow::Result;
+use clap::{Arg, ArgAction, Command};
+use polars::df;
+use polars::frame::DataFrame;
+use polars::prelude::{DataType, Field, Schema};
+use tracing::info;
+
+use crate::utils::dataframes;
+use crate::utils::fs::*;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("syntax_errors")
+        .about("Aggregates the syntax errors found by the parse subcommand across the corpus")
+        .long_about(include_str!("../docs/syntax_errors.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("SYNTAX_ERRORS_FILE.csv")
+                .help("Path to the syntax errors file written by the parse subcommand with --syntax-errors.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("logs")
+                .short('l')
+                .long("logs")
+                .value_name("LOGS_FILE.csv")
+                .help("Path to the logs file of the same run of the parse subcommand, used to relate the files with errors \
+                       to the files parsed in every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the errors grouped by kind.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("projects")
+                .short('p')
+                .long("projects")
+                .value_name("PROJECTS_FILE.csv")
+                .help("Path to the output csv file storing the errors grouped by project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output files if they already exist.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+}
+
+/// Parse errors of the logs files that do not denote a syntax error, but a file that was not parsed or has no error.
+const NOT_SYNTAX_ERRORS: &[&str] = &["none", "too-large", "generated", "timeout"];
+
+/// Maximum number of characters of the category of an error that could not be parsed.
+const CATEGORY_LENGTH: usize = 20;
+
+/// Returns the category of a syntax error: the kind of the node inserted by the parser for missing nodes,
+/// and the first token of the code that could not be parsed otherwise.
+///
+/// # Arguments
+///
+/// * `kind` - The kind of the error, `error` or `missing`.
+/// * `text` - The text of the error in the syntax errors file.
+fn category(kind: &str, text: &str) -> String {
+    if kind == "missing" {
+        text.to_string()
+    } else {
+        text.split_whitespace()
+            .next()
+            .unwrap_or_default()
+            .chars()
+            .take(CATEGORY_LENGTH)
+            .collect()
+    }
+}
+
+/// Errors of a group, i.e. of a category of errors or of a project.
+#[derive(Debug, Default)]
+struct Group<'a> {
+    /// Number of errors.
+    errors: u32,
+    /// Number of missing nodes among the errors.
+    missing: u32,
+    /// Files containing at least one of the errors.
+    files: HashSet<&'a str>,
+    /// Projects containing at least one of the errors.
+    projects: HashSet<u32>,
+    /// Location of the first error, as path:line:column.
+    example: String,
+}
+
+impl<'a> Group<'a> {
+    fn add(&mut self, id: u32, path: &'a str, kind: &str, start: &str) {
+        if self.errors == 0 {
+            self.example = format!("{path}:{start}");
+        }
+        self.errors += 1;
+        if kind == "missing" {
+            self.missing += 1;
+        }
+        self.files.insert(path);
+        self.projects.insert(id);
+    }
+}
+
+/// Sorts groups by decreasing number of errors, ties being broken by their keys.
+fn sorted<K: Ord>(groups: HashMap<K, Group<'_>>) -> Vec<(K, Group<'_>)> {
+    let mut groups: Vec<(K, Group)> = groups.into_iter().collect();
+    groups.sort_by(|(k1, g1), (k2, g2)| g2.errors.cmp(&g1.errors).then(k1.cmp(k2)));
+    groups
+}
+
+/// Aggregates the syntax errors listed by the parse subcommand, by category of errors and by project.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the syntax errors file written by the parse subcommand.
+/// * `logs_path` - The optional path to the logs file of the same run of the parse subcommand.
+/// * `output_path` - The optional path to the output CSV file storing the errors by category. Defaults to the input path with ".kinds.csv" appended.
+/// * `projects_path` - The optional path to the output CSV file storing the errors by project. Defaults to the input path with ".projects.csv" appended.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the input files could not be read or the output files could not be written.
+pub fn run(
+    input_path: &str,
+    logs_path: Option<&str>,
+    output_path: Option<&str>,
+    projects_path: Option<&str>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.kinds.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+    let default_projects_path = format!("{input_path}.projects.csv");
+    let projects_path = projects_path.unwrap_or(&default_projects_path);
+
+    check_path(input_path)?;
+    if let Some(logs_path) = logs_path {
+        check_path(logs_path)?;
+    }
+    log_output_file(output_path, false, force)?;
+    log_output_file(projects_path, false, force)?;
+
+    let errors: DataFrame = logger.run_task("Loading syntax errors", || {
+        open_csv(
+            input_path,
+            Some(Schema::from_iter(vec![
+                Field::new("id".into(), DataType::UInt32),
+                Field::new("path".into(), DataType::String),
+                Field::new("kind".into(), DataType::String),
+                Field::new("start".into(), DataType::String),
+                Field::new("text".into(), DataType::String),
+            ])),
+            Some(vec!["id", "path", "kind", "start", "text"]),
+        )
+    })?;
+    let ids: Vec<u32> = dataframes::u32(&errors, "id")?;
+    let paths: Vec<&str> = dataframes::str(&errors, "path")?;
+    let kinds: Vec<&str> = dataframes::str(&errors, "kind")?;
+    let starts: Vec<&str> = dataframes::str(&errors, "start")?;
+    let texts: Vec<&str> = dataframes::str(&errors, "text")?;
+    info!("{} syntax errors found.", ids.len());
+
+    let mut categories: HashMap<(&str, String), Group> = HashMap::new();
+    let mut projects: HashMap<u32, Group> = HashMap::new();
+    for i in 0..ids.len() {
+        categories
+            .entry((kinds[i], category(kinds[i], texts[i])))
+            .or_default()
+            .add(ids[i], paths[i], kinds[i], starts[i]);
+        projects
+            .entry(ids[i])
+            .or_default()
+            .add(ids[i], paths[i], kinds[i], starts[i]);
+    }
+
+    // Files parsed and files with a parse error in every project, according to the logs.
+    let logs: Option<DataFrame> = logs_path
+        .map(|logs_path| {
+            logger.run_task("Loading logs", || {
+                open_csv(
+                    logs_path,
+                    Some(Schema::from_iter(vec![
+                        Field::new("id".into(), DataType::UInt32),
+                        Field::new("parse_error".into(), DataType::String),
+                    ])),
+                    Some(vec!["id", "parse_error"]),
+                )
+            })
+        })
+        .transpose()?;
+    let mut parsed: HashMap<u32, (u32, u32)> = HashMap::new();
+    if let Some(logs) = &logs {
+        for (id, parse_error) in dataframes::u32(logs, "id")?
+            .into_iter()
+            .zip(dataframes::str(logs, "parse_error")?)
+        {
+            let (files, failed) = parsed.entry(id).or_default();
+            *files += 1;
+            if !NOT_SYNTAX_ERRORS.contains(&parse_error) {
+                *failed += 1;
+            }
+        }
+        // Projects without syntax errors are reported as well.
+        for id in parsed.keys() {
+            projects.entry(*id).or_default();
+        }
+    }
+
+    info!("Categories of errors: {}", categories.len());
+    info!(
+        "Projects with syntax errors: {}",
+        projects.values().filter(|p| p.errors > 0).count()
+    );
+
+    let categories: Vec<((&str, String), Group)> = sorted(categories);
+    let mut categories_df: DataFrame = df!(
+        "kind" => categories.iter().map(|((kind, _), _)| *kind).collect::<Vec<&str>>(),
+        "category" => categories.iter().map(|((_, category), _)| category.as_str()).collect::<Vec<&str>>(),
+        "errors" => categories.iter().map(|(_, g)| g.errors).collect::<Vec<u32>>(),
+        "files" => categories.iter().map(|(_, g)| g.files.len() as u32).collect::<Vec<u32>>(),
+        "projects" => categories.iter().map(|(_, g)| g.projects.len() as u32).collect::<Vec<u32>>(),
+        "example" => categories.iter().map(|(_, g)| g.example.as_str()).collect::<Vec<&str>>(),
+    )?;
+    log_write_output(logger, output_path, &mut categories_df, false)?;
+
+    let projects: Vec<(u32, Group)> = sorted(projects);
+    let mut projects_df: DataFrame = df!(
+        "id" => projects.iter().map(|(id, _)| *id).collect::<Vec<u32>>(),
+        "errors" => projects.iter().map(|(_, g)| g.errors).collect::<Vec<u32>>(),
+        "missing" => projects.iter().map(|(_, g)| g.missing).collect::<Vec<u32>>(),
+        "files_with_errors" => projects.iter().map(|(_, g)| g.files.len() as u32).collect::<Vec<u32>>(),
+        "example" => projects.iter().map(|(_, g)| g.example.as_str()).collect::<Vec<&str>>(),
+    )?;
+    if logs.is_some() {
+        let counts: Vec<(u32, u32)> = projects
+            .iter()
+            .map(|(id, _)| parsed.get(id).copied().unwrap_or_default())
+            .collect();
+        projects_df.with_column(polars::prelude::Column::new(
+            "files".into(),
+            counts.iter().map(|(files, _)| *files).collect::<Vec<u32>>(),
+        ))?;
+        projects_df.with_column(polars::prelude::Column::new(
+            "failed_files".into(),
+            counts
+                .iter()
+                .map(|(_, failed)| *failed)
+                .collect::<Vec<u32>>(),
+        ))?;
+    }
+    log_write_output(logger, projects_path, &mut projects_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn categories() {
+        assert_eq!(category("missing", ")"), ")");
+        assert_eq!(category("error", "~int | ~float64"), "~int");
+        assert_eq!(category("error", ""), "");
+        assert_eq!(
+            category("error", &"x".repeat(30)),
+            "x".repeat(CATEGORY_LENGTH)
+        );
+    }
+
+    #[test]
+    fn syntax_errors() -> Result<()> {
+        let test_dir = "target/tests/phases/syntax_errors";
+        let input_path = format!("{test_dir}/files.csv.syntax_errors.csv");
+        let logs_path = format!("{test_dir}/logs.csv");
+        delete_dir(test_dir, true)?;
+        write_file(
+            &input_path,
+            "id,path,kind,start,end,function,text\n\
+             1,a/x.go,error,3:1,3:5,none,~int | ~string\n\
+             1,a/x.go,missing,4:2,4:2,4:1,)\n\
+             1,a/y.go,error,1:1,1:3,none,~uint\n\
+             2,b/z.go,missing,7:1,7:1,none,)\n\
+             2,b/z.go,missing,9:1,9:1,none,)\n",
+        )?;
+        write_file(
+            &logs_path,
+            "id,name,language,functions,functions_with_kw,parse_error\n\
+             1,a/x.go,go,1,0,3:1\n\
+             1,a/y.go,go,0,0,1:1\n\
+             2,b/z.go,go,2,0,7:1\n\
+             2,b/w.go,go,2,0,none\n\
+             3,c/v.go,go,1,0,none\n",
+        )?;
+
+        run(
+            &input_path,
+            Some(&logs_path),
+            None,
+            None,
+            false,
+            test_logger(),
+        )?;
+        let kinds: DataFrame = open_csv(&format!("{input_path}.kinds.csv"), None, None)?;
+        assert_eq!(
+            dataframes::str(&kinds, "category")?,
+            vec![")", "~int", "~uint"]
+        );
+        assert_eq!(
+            kinds
+                .column("errors")?
+                .i64()?
+                .into_no_null_iter()
+                .collect::<Vec<_>>(),
+            vec![3, 1, 1]
+        );
+
+        let projects: DataFrame = open_csv(&format!("{input_path}.projects.csv"), None, None)?;
+        assert_eq!(
+            projects
+                .column("id")?
+                .i64()?
+                .into_no_null_iter()
+                .collect::<Vec<_>>(),
+            vec![1, 2, 3]
+        );
+        assert_eq!(
+            projects
+                .column("files")?
+                .i64()?
+                .into_no_null_iter()
+                .collect::<Vec<_>>(),
+            vec![2, 2, 1]
+        );
+        assert_eq!(
+            projects
+                .column("failed_files")?
+                .i64()?
+                .into_no_null_iter()
+                .collect::<Vec<_>>(),
+            vec![2, 1, 0]
+        );
+        delete_dir(test_dir, false)
+    }
+}
@@ -0,0 +1,299 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#![doc = include_str!("../docs/verify.md")]
+
+use std::path::Path;
+
+use anyhow::{bail, Context, Result};
+use clap::{Arg, ArgAction, Command};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use tracing::{info, warn};
+
+use crate::utils::fs::*;
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// Command line arguments parsing.
+pub fn cli() -> Command {
+    Command::new("verify")
+        .about("Checks that the downloaded projects have not been modified since their download")
+        .long_about(include_str!("../docs/verify.md"))
+        .disable_version_flag(true)
+        .arg(
+            Arg::new("input")
+                .short('i')
+                .long("input")
+                .value_name("MANIFEST_FILE.json")
+                .help("Path to the manifest written by the download subcommand.")
+                .required(true),
+        )
+        .arg(
+            Arg::new("output")
+                .short('o')
+                .long("output")
+                .value_name("OUTPUT_FILE.csv")
+                .help("Path to the output csv file storing the status of every project.")
+                .required(false),
+        )
+        .arg(
+            Arg::new("force")
+                .short('f')
+                .long("force")
+                .help("Override the output file if it already exists.")
+                .default_value("false")
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("no-output")
+                .long("no-output")
+                .help("Does not write the output file. Prints statistics only.")
+                .default_value("false")
+                .required(false)
+                .action(ArgAction::SetTrue)
+                .conflicts_with_all(vec!["output", "force"]),
+        )
+}
+
+/// Status of a project after verification.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Status {
+    /// The files of the project have not changed since the download.
+    Ok,
+    /// Files of the project have been added, removed or modified.
+    Modified,
+    /// The directory of the project does not exist anymore.
+    Missing,
+    /// The manifest does not record a hash for the project.
+    NoHash,
+}
+
+impl Status {
+    fn name(self) -> &'static str {
+        match self {
+            Status::Ok => "ok",
+            Status::Modified => "modified",
+            Status::Missing => "missing",
+            Status::NoHash => "no_hash",
+        }
+    }
+}
+
+/// Computes the hash of a downloaded project and compares it with the hash recorded in the manifest.
+///
+/// # Arguments
+///
+/// * `entry` - The entry of the project in the manifest.
+///
+/// # Returns
+///
+/// The status of the project, or an error if its files could not be read.
+fn verify_project(entry: &JsonValue) -> Result<Status> {
+    let path: &str = entry["path"]
+        .as_str()
+        .context("Manifest entry without path")?;
+    if !Path::new(path).is_dir() {
+        return Ok(Status::Missing);
+    }
+    match entry["hash"].as_str() {
+        Some(expected) if tree_hash(path)? == expected => Ok(Status::Ok),
+        Some(_) => Ok(Status::Modified),
+        None => Ok(Status::NoHash),
+    }
+}
+
+/// Checks that the projects listed in a manifest have not been modified since they were downloaded.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The optional path to the output CSV file. Defaults to the input path with ".verification.csv" appended.
+/// * `force` - Whether to override the output file if it already exists.
+/// * `no_output` - Whether to skip writing the output file.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if a project is missing or has been modified, or if the files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: Option<&str>,
+    force: bool,
+    no_output: bool,
+    logger: &Logger,
+) -> Result<()> {
+    let default_output_path = format!("{input_path}.verification.csv");
+    let output_path = output_path.unwrap_or(&default_output_path);
+
+    check_path(input_path)?;
+    log_output_file(output_path, no_output, force)?;
+
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+    let mut ids: Vec<Option<u32>> = Vec::with_capacity(entries.len());
+    let mut names: Vec<Option<String>> = Vec::with_capacity(entries.len());
+    let mut paths: Vec<Option<String>> = Vec::with_capacity(entries.len());
+    let mut statuses: Vec<&str> = Vec::with_capacity(entries.len());
+    let mut counts: [usize; 4] = [0; 4];
+    for entry in entries {
+        let status: Status = verify_project(entry)?;
+        if status == Status::Modified || status == Status::Missing {
+            warn!(
+                "Project {} is {}",
+                entry["name"].as_str().unwrap_or_default(),
+                status.name()
+            );
+        }
+        counts[status as usize] += 1;
+        ids.push(entry["id"].as_u32());
+        names.push(entry["name"].as_str().map(str::to_string));
+        paths.push(entry["path"].as_str().map(str::to_string));
+        statuses.push(status.name());
+        progress.inc(1);
+    }
+    progress.finish();
+
+    for status in [
+        Status::Ok,
+        Status::Modified,
+        Status::Missing,
+        Status::NoHash,
+    ] {
+        info!("{}: {}", status.name(), counts[status as usize]);
+    }
+
+    let mut report: DataFrame = df!(
+        "id" => ids,
+        "name" => names,
+        "path" => paths,
+        "status" => statuses,
+    )?;
+    log_write_output(logger, output_path, &mut report, no_output)?;
+
+    let corrupted: usize = counts[Status::Modified as usize] + counts[Status::Missing as usize];
+    if corrupted > 0 {
+        bail!("{corrupted} projects are missing or have been modified since their download");
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::ensure;
+
+    use super::*;
+    use crate::utils::logger::test_logger;
+
+    #[test]
+    fn verify() -> Result<()> {
+        let test_dir = "target/tests/phases/verify";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        let output_path = format!("{manifest_path}.verification.csv");
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/1/main.go"), "package main")?;
+        write_file(format!("{test_dir}/2/main.go"), "package main")?;
+        write_file(format!("{test_dir}/3/main.go"), "package main")?;
+
+        let entry = |id: u32, hash: Option<String>| {
+            let mut entry = json::object! {
+                id: id,
+                name: format!("owner/project{id}"),
+                path: format!("{test_dir}/{id}"),
+            };
+            if let Some(hash) = hash {
+                entry["hash"] = hash.into();
+            }
+            entry
+        };
+        let manifest = json::object! {
+            projects: [
+                entry(1, Some(tree_hash(format!("{test_dir}/1"))?)),
+                entry(2, Some(tree_hash(format!("{test_dir}/2"))?)),
+                entry(3, None),
+            ]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+
+        // Projects without a hash are reported but not considered corrupted.
+        run(&manifest_path, None, false, false, test_logger())?;
+        let report: DataFrame = open_csv(&output_path, None, None)?;
+        let statuses: Vec<Option<&str>> = report.column("status")?.str()?.into_iter().collect();
+        assert_eq!(statuses, vec![Some("ok"), Some("ok"), Some("no_hash")]);
+
+        delete_dir(format!("{test_dir}/1"), false)?;
+        write_file(format!("{test_dir}/2/main.go"), "package lib")?;
+        assert!(run(&manifest_path, None, true, false, test_logger()).is_err());
+        let report: DataFrame = open_csv(&output_path, None, None)?;
+        let statuses: Vec<Option<&str>> = report.column("status")?.str()?.into_iter().collect();
+        assert_eq!(
+            statuses,
+            vec![Some("missing"), Some("modified"), Some("no_hash")]
+        );
+
+        delete_dir(test_dir, false)
+    }
+
+    #[test]
+    fn verify_after_parse() -> Result<()> {
+        let test_dir = "target/tests/phases/verify_after_parse";
+        let manifest_path = format!("{test_dir}/manifest.json");
+        let files_path = format!("{test_dir}/files.csv");
+        delete_dir(test_dir, true)?;
+        write_file(
+            format!("{test_dir}/1/main.c"),
+            "double half(double x) {\n    return x / 2;\n}\n",
+        )?;
+        let manifest = json::object! {
+            projects: [{
+                id: 1,
+                name: "owner/project1",
+                path: format!("{test_dir}/1"),
+                hash: tree_hash(format!("{test_dir}/1"))?,
+            }]
+        };
+        write_file(&manifest_path, json::stringify(manifest))?;
+        write_file(
+            &files_path,
+            format!("id,name,language\n1,{test_dir}/1/main.c,c\n"),
+        )?;
+
+        // The functions written next to the parsed files are not part of the downloaded project.
+        crate::phases::parse::run(
+            &files_path,
+            &["tests/data/keywords/c_float.json"],
+            crate::phases::parse::Options::default(),
+            test_logger(),
+        )?;
+        ensure!(
+            Path::new(&format!("{test_dir}/1/main.c.functions")).is_dir(),
+            "The functions of main.c were not written"
+        );
+        run(&manifest_path, None, false, false, test_logger())?;
+        let report: DataFrame = open_csv(&format!("{manifest_path}.verification.csv"), None, None)?;
+        let statuses: Vec<Option<&str>> = report.column("status")?.str()?.into_iter().collect();
+        assert_eq!(statuses, vec![Some("ok")]);
+
+        delete_dir(test_dir, false)
+    }
+}
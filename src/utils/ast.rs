@@ -0,0 +1,330 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Compact encoding of syntax trees, stored in an on-disk cache keyed by the hash of the source files.
+//!
+//! Tree-sitter trees cannot be rebuilt without parsing, hence the cache stores a structural copy of them:
+//! the kind, field, byte range and flags of every node, in pre-order. The kinds and fields are stored by name,
+//! so that cached trees can be read without the grammar they were parsed with.
+
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicUsize, Ordering};
+
+use anyhow::{bail, ensure, Context, Result};
+use tree_sitter::{Tree, TreeCursor};
+
+use crate::utils::fs::{create_dir, write_file};
+
+/// Magic number and version of the encoding.
+const MAGIC: &[u8] = b"SCAST\x01";
+
+/// The node is named, i.e. not an anonymous token such as a punctuation.
+pub const NAMED: u8 = 1;
+/// The node is an error node.
+pub const ERROR: u8 = 2;
+/// The node was inserted by the parser to recover from a syntax error.
+pub const MISSING: u8 = 4;
+/// The node is an extra, such as a comment.
+pub const EXTRA: u8 = 8;
+
+/// A node of a syntax tree.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SyntaxNode {
+    /// Index of the kind of the node in the kinds of the tree.
+    pub kind: usize,
+    /// Index of the field of the node in its parent in the fields of the tree, if any.
+    pub field: Option<usize>,
+    /// Byte offset of the start of the node in the source file.
+    pub start: usize,
+    /// Byte offset of the end of the node in the source file.
+    pub end: usize,
+    /// Index of the parent of the node, None for the root.
+    pub parent: Option<usize>,
+    /// Number of children of the node, which directly follow it in pre-order.
+    pub children: usize,
+    /// Flags of the node (NAMED, ERROR, MISSING, EXTRA).
+    pub flags: u8,
+}
+
+/// A syntax tree, whose nodes are stored in pre-order.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct SyntaxTree {
+    /// Names of the kinds of the nodes.
+    pub kinds: Vec<String>,
+    /// Names of the fields of the nodes.
+    pub fields: Vec<String>,
+    /// Nodes of the tree in pre-order, the root first.
+    pub nodes: Vec<SyntaxNode>,
+}
+
+impl SyntaxTree {
+    /// Copies the structure of a Tree-sitter tree.
+    pub fn from_tree(tree: &Tree) -> SyntaxTree {
+        let mut res = SyntaxTree::default();
+        let mut kinds: HashMap<&'static str, usize> = HashMap::new();
+        let mut fields: HashMap<&'static str, usize> = HashMap::new();
+        let mut cursor: TreeCursor = tree.walk();
+        // Indices of the ancestors of the current node.
+        let mut ancestors: Vec<usize> = Vec::new();
+        loop {
+            let node = cursor.node();
+            let kind: usize = *kinds.entry(node.kind()).or_insert_with(|| {
+                res.kinds.push(node.kind().to_string());
+                res.kinds.len() - 1
+            });
+            let field: Option<usize> = cursor.field_name().map(|name| {
+                *fields.entry(name).or_insert_with(|| {
+                    res.fields.push(name.to_string());
+                    res.fields.len() - 1
+                })
+            });
+            let flags: u8 = [
+                (node.is_named(), NAMED),
+                (node.is_error(), ERROR),
+                (node.is_missing(), MISSING),
+                (node.is_extra(), EXTRA),
+            ]
+            .iter()
+            .filter(|(set, _)| *set)
+            .fold(0, |flags, (_, flag)| flags | flag);
+            res.nodes.push(SyntaxNode {
+                kind,
+                field,
+                start: node.start_byte(),
+                end: node.end_byte(),
+                parent: ancestors.last().copied(),
+                children: node.child_count(),
+                flags,
+            });
+            if cursor.goto_first_child() {
+                ancestors.push(res.nodes.len() - 1);
+                continue;
+            }
+            while !cursor.goto_next_sibling() {
+                if !cursor.goto_parent() {
+                    return res;
+                }
+                ancestors.pop();
+            }
+        }
+    }
+
+    /// Returns the name of the kind of a node.
+    pub fn kind(&self, node: &SyntaxNode) -> &str {
+        &self.kinds[node.kind]
+    }
+
+    /// Returns the name of the field of a node in its parent, if any.
+    pub fn field(&self, node: &SyntaxNode) -> Option<&str> {
+        node.field.map(|field| self.fields[field].as_str())
+    }
+
+    /// Encodes the tree. Integers are written as LEB128 variable-length integers, and the start of every node
+    /// relative to the start of its parent, so that most nodes take a few bytes only.
+    pub fn encode(&self) -> Vec<u8> {
+        let mut buf: Vec<u8> = MAGIC.to_vec();
+        for names in [&self.kinds, &self.fields] {
+            write_varint(&mut buf, names.len());
+            for name in names {
+                write_varint(&mut buf, name.len());
+                buf.extend_from_slice(name.as_bytes());
+            }
+        }
+        write_varint(&mut buf, self.nodes.len());
+        for node in &self.nodes {
+            let parent_start: usize = node.parent.map_or(0, |p| self.nodes[p].start);
+            write_varint(&mut buf, node.kind);
+            write_varint(&mut buf, node.field.map_or(0, |f| f + 1));
+            write_varint(&mut buf, node.start - parent_start);
+            write_varint(&mut buf, node.end - node.start);
+            write_varint(&mut buf, node.children);
+            buf.push(node.flags);
+        }
+        buf
+    }
+
+    /// Decodes a tree encoded with [`SyntaxTree::encode`].
+    pub fn decode(buf: &[u8]) -> Result<SyntaxTree> {
+        let mut rest: &[u8] = buf
+            .strip_prefix(MAGIC)
+            .context("Not an encoded syntax tree")?;
+        let mut res = SyntaxTree::default();
+        for names in [&mut res.kinds, &mut res.fields] {
+            for _ in 0..read_varint(&mut rest)? {
+                let len: usize = read_varint(&mut rest)?;
+                ensure!(rest.len() >= len, "Truncated syntax tree");
+                let (name, tail) = rest.split_at(len);
+                names.push(String::from_utf8(name.to_vec())?);
+                rest = tail;
+            }
+        }
+        // Number of children of every ancestor of the current node that are still to be read.
+        let mut ancestors: Vec<(usize, usize)> = Vec::new();
+        for i in 0..read_varint(&mut rest)? {
+            while ancestors.last().is_some_and(|&(_, left)| left == 0) {
+                ancestors.pop();
+            }
+            let parent: Option<usize> = ancestors.last_mut().map(|(parent, left)| {
+                *left -= 1;
+                *parent
+            });
+            if i > 0 && parent.is_none() {
+                bail!("Syntax tree with several roots");
+            }
+            let kind: usize = read_varint(&mut rest)?;
+            let field: Option<usize> = read_varint(&mut rest)?.checked_sub(1);
+            let start: usize = read_varint(&mut rest)? + parent.map_or(0, |p| res.nodes[p].start);
+            let end: usize = start + read_varint(&mut rest)?;
+            let children: usize = read_varint(&mut rest)?;
+            let (&flags, tail) = rest.split_first().context("Truncated syntax tree")?;
+            rest = tail;
+            ensure!(
+                kind < res.kinds.len() && field.is_none_or(|f| f < res.fields.len()),
+                "Invalid node in syntax tree"
+            );
+            res.nodes.push(SyntaxNode {
+                kind,
+                field,
+                start,
+                end,
+                parent,
+                children,
+                flags,
+            });
+            ancestors.push((i, children));
+        }
+        ensure!(rest.is_empty(), "Trailing bytes after syntax tree");
+        Ok(res)
+    }
+}
+
+/// Writes a LEB128 variable-length integer.
+fn write_varint(buf: &mut Vec<u8>, mut n: usize) {
+    while n >= 0x80 {
+        buf.push((n as u8 & 0x7f) | 0x80);
+        n >>= 7;
+    }
+    buf.push(n as u8);
+}
+
+/// Reads a LEB128 variable-length integer and advances the buffer past it.
+fn read_varint(buf: &mut &[u8]) -> Result<usize> {
+    let bytes: &[u8] = buf;
+    let mut n: usize = 0;
+    for (i, &byte) in bytes.iter().enumerate() {
+        ensure!(i < 10, "Invalid integer in syntax tree");
+        n |= ((byte & 0x7f) as usize) << (7 * i);
+        if byte & 0x80 == 0 {
+            *buf = &bytes[i + 1..];
+            return Ok(n);
+        }
+    }
+    bail!("Truncated syntax tree")
+}
+
+/// Returns the path of the tree of a source file in a cache, e.g. cache/ab/cdef....ast, given the hash of its content.
+pub fn cache_path(cache: impl AsRef<Path>, hash: &str) -> PathBuf {
+    let (prefix, rest) = hash.split_at(2.min(hash.len()));
+    cache.as_ref().join(prefix).join(format!("{rest}.ast"))
+}
+
+/// Stores the tree of a source file in a cache, unless it is already there.
+///
+/// # Arguments
+///
+/// * `cache` - The directory of the cache. It is created if it does not exist.
+/// * `hash` - The hash of the content of the source file.
+/// * `tree` - The syntax tree of the file.
+pub fn store_tree(cache: impl AsRef<Path>, hash: &str, tree: &Tree) -> Result<()> {
+    let path: PathBuf = cache_path(cache, hash);
+    if path.is_file() {
+        return Ok(());
+    }
+    create_dir(path.parent().context("Invalid cache path")?)?;
+    // Written to a temporary file first, unique to this call, so that other threads never read a partial tree.
+    static TMP_FILES: AtomicUsize = AtomicUsize::new(0);
+    let tmp: PathBuf = path.with_extension(format!(
+        "ast.{}.{}",
+        std::process::id(),
+        TMP_FILES.fetch_add(1, Ordering::Relaxed)
+    ));
+    write_file(&tmp, SyntaxTree::from_tree(tree).encode())?;
+    std::fs::rename(&tmp, &path)
+        .with_context(|| format!("Could not store syntax tree {}", path.display()))
+}
+
+/// Loads the tree of a source file from a cache.
+///
+/// # Arguments
+///
+/// * `cache` - The directory of the cache.
+/// * `hash` - The hash of the content of the source file.
+///
+/// # Returns
+///
+/// The syntax tree of the file, or None if it is not in the cache.
+pub fn load_tree(cache: impl AsRef<Path>, hash: &str) -> Result<Option<SyntaxTree>> {
+    let path: PathBuf = cache_path(cache, hash);
+    if !path.is_file() {
+        return Ok(None);
+    }
+    SyntaxTree::decode(&std::fs::read(&path)?)
+        .with_context(|| format!("Invalid syntax tree {}", path.display()))
+        .map(Some)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use tree_sitter::Parser;
+
+    use super::*;
+    use crate::utils::fs::delete_dir;
+
+    #[test]
+    fn syntax_trees() -> Result<()> {
+        let mut parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let source: &str = "package main\n\n// A comment.\nfunc main() { x := 1 +  }\n";
+        let tree: Tree = parser.parse(source, None).context("Failed to parse")?;
+
+        let copy: SyntaxTree = SyntaxTree::from_tree(&tree);
+        assert_eq!(copy.kind(&copy.nodes[0]), "source_file");
+        assert_eq!(copy.nodes[0].children, tree.root_node().child_count());
+        let name = copy
+            .nodes
+            .iter()
+            .find(|node| copy.field(node) == Some("name"))
+            .context("Missing function name")?;
+        assert_eq!(&source[name.start..name.end], "main");
+        assert!(copy.nodes.iter().any(|node| node.flags & EXTRA != 0));
+        assert!(copy
+            .nodes
+            .iter()
+            .any(|node| node.flags & (ERROR | MISSING) != 0));
+
+        let encoded: Vec<u8> = copy.encode();
+        assert_eq!(SyntaxTree::decode(&encoded)?, copy);
+        assert!(SyntaxTree::decode(&encoded[..encoded.len() - 1]).is_err());
+
+        let cache = "target/tests/utils/ast";
+        delete_dir(cache, true)?;
+        let hash: String = blake3::hash(source.as_bytes()).to_hex().to_string();
+        assert_eq!(load_tree(cache, &hash)?, None);
+        store_tree(cache, &hash, &tree)?;
+        assert_eq!(load_tree(cache, &hash)?, Some(copy));
+        delete_dir(cache, false)
+    }
+}
@@ -0,0 +1,570 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Censuses of the uses of a family of Go constructs in the downloaded projects, run by the analyzer subcommands.
+//!
+//! A census is defined by the categories of its constructs and by a function locating them in the syntax tree of a
+//! Go file. Every occurrence is written to a CSV file, and the number of occurrences of every category in every package
+//! of the corpus, i.e. every directory of a project containing Go files, to another one. The census of the packages
+//! can in turn be summed up in a profile of every project.
+
+use std::collections::{BTreeMap, HashMap};
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use indicatif::ProgressBar;
+use json::JsonValue;
+use polars::df;
+use polars::frame::DataFrame;
+use polars::prelude::{col, lit, when, Column, DataType, Expr, IntoLazy};
+use tracing::{info, warn};
+use tree_sitter::{Node, Parser, Tree};
+use walkdir::{DirEntry, WalkDir};
+
+use crate::phases::gomod::is_ignored_dir;
+use crate::utils::fs::{check_path, open_csv};
+use crate::utils::logger::{log_output_file, log_write_output, Logger};
+
+/// An occurrence of a construct in a Go file.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Occurrence {
+    /// The category of the construct, one of those of the census.
+    pub category: &'static str,
+    /// The construct itself, e.g. an operator or the qualified name of a function.
+    pub construct: String,
+    /// The line of the construct, starting at 1.
+    pub line: usize,
+    /// The column of the construct, starting at 1.
+    pub column: usize,
+    /// The offset of the first byte of the construct, locating its enclosing function.
+    pub start: usize,
+}
+
+impl Occurrence {
+    /// Creates the occurrence of a construct located at a node.
+    pub fn new(category: &'static str, construct: impl Into<String>, node: &Node) -> Self {
+        Occurrence {
+            category,
+            construct: construct.into(),
+            line: node.start_position().row + 1,
+            column: node.start_position().column + 1,
+            start: node.start_byte(),
+        }
+    }
+}
+
+/// Returns the source code of a node, empty if it is not valid UTF-8.
+pub fn text<'a>(node: &Node, source: &'a [u8]) -> &'a str {
+    node.utf8_text(source).unwrap_or_default()
+}
+
+/// Returns the nodes of a syntax tree, in pre-order.
+pub fn nodes<'a>(root: &Node<'a>) -> Vec<Node<'a>> {
+    let mut nodes: Vec<Node> = Vec::new();
+    let mut stack: Vec<Node> = vec![*root];
+    while let Some(node) = stack.pop() {
+        nodes.push(node);
+        let mut cursor = node.walk();
+        let children: Vec<Node> = node.children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
+    }
+    nodes
+}
+
+/// Returns the packages imported by a Go file, indexed by the name under which the file refers to them.
+/// Blank and dot imports have no such name and are left out.
+pub fn imported_packages(root: &Node, source: &[u8]) -> HashMap<String, String> {
+    nodes(root)
+        .into_iter()
+        .filter(|node| node.kind() == "import_spec")
+        .filter_map(|spec| {
+            let path: &str =
+                text(&spec.child_by_field_name("path")?, source).trim_matches(['"', '`']);
+            let name: &str = match spec.child_by_field_name("name") {
+                Some(name) => text(&name, source),
+                None => path.rsplit('/').next()?,
+            };
+            (name != "_" && name != ".").then(|| (name.to_string(), path.to_string()))
+        })
+        .collect()
+}
+
+/// Returns the import path of the package and the name of a qualified identifier, e.g. `math.Sqrt`, either a selector
+/// expression or a qualified type, if its package is imported by the file.
+///
+/// # Arguments
+///
+/// * `node` - The qualified identifier.
+/// * `source` - The source code of the file.
+/// * `imports` - The packages imported by the file, as returned by [`imported_packages`].
+pub fn qualified_name<'a>(
+    node: &Node,
+    source: &'a [u8],
+    imports: &'a HashMap<String, String>,
+) -> Option<(&'a str, &'a str)> {
+    let (package, name) = match node.kind() {
+        "selector_expression" => (
+            node.child_by_field_name("operand")?,
+            node.child_by_field_name("field")?,
+        ),
+        "qualified_type" => (
+            node.child_by_field_name("package")?,
+            node.child_by_field_name("name")?,
+        ),
+        _ => return None,
+    };
+    if package.kind() != "identifier" && package.kind() != "package_identifier" {
+        return None;
+    }
+    let path: &str = imports.get(text(&package, source))?;
+    Some((path, text(&name, source)))
+}
+
+/// Returns the import path of the package and the name of the function called by a call expression, if it is a function
+/// of a package imported by the file.
+pub fn called_function<'a>(
+    call: &Node,
+    source: &'a [u8],
+    imports: &'a HashMap<String, String>,
+) -> Option<(&'a str, &'a str)> {
+    if call.kind() != "call_expression" {
+        return None;
+    }
+    qualified_name(&call.child_by_field_name("function")?, source, imports)
+}
+
+/// Returns the name of the function or method declaration enclosing a node, empty at the top level of the file.
+/// Anonymous functions are part of the function declaring them, and methods are qualified by the name of their
+/// receiver type, without its type parameters (e.g. `Stack.Push` for a method of `*Stack[T]`).
+pub fn enclosing_function(node: &Node, source: &[u8]) -> String {
+    let mut current: Option<Node> = node.parent();
+    while let Some(ancestor) = current {
+        let name: &str = ancestor
+            .child_by_field_name("name")
+            .map_or("", |name| text(&name, source));
+        match ancestor.kind() {
+            "function_declaration" => return name.to_string(),
+            "method_declaration" => {
+                let receiver: &str = ancestor
+                    .child_by_field_name("receiver")
+                    .and_then(|receiver| receiver.named_child(0))
+                    .and_then(|parameter| parameter.child_by_field_name("type"))
+                    .map_or("", |t| text(&t, source));
+                let receiver: &str = receiver.trim_start_matches('*');
+                let receiver: &str = receiver.split('[').next().unwrap_or(receiver);
+                return format!("{receiver}.{name}");
+            }
+            _ => current = ancestor.parent(),
+        }
+    }
+    String::new()
+}
+
+/// Returns the paths of the Go files of a project, in lexicographic order, leaving out the directories ignored by the go command.
+pub fn go_files(project_path: &str) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = WalkDir::new(project_path)
+        .into_iter()
+        .filter_entry(|e| !is_ignored_dir(e))
+        .filter_map(Result::ok)
+        .filter(|e| e.file_type().is_file())
+        .map(DirEntry::into_path)
+        .filter(|p| p.extension().is_some_and(|ext| ext == "go"))
+        .collect();
+    files.sort();
+    files
+}
+
+/// Returns the path of a file or directory relative to the root of its project, "." for the root itself.
+fn relative_path(path: &Path, project_path: &str) -> Result<String> {
+    let relative: &Path = path.strip_prefix(project_path)?;
+    Ok(if relative.as_os_str().is_empty() {
+        ".".to_string()
+    } else {
+        relative.to_string_lossy().to_string()
+    })
+}
+
+/// A Go file of a project listed in a manifest, with its syntax tree.
+pub struct GoFile {
+    /// Index of the project in the manifest.
+    pub project: usize,
+    /// ID of the project.
+    pub id: Option<u32>,
+    /// Path of the file, relative to the root of the project.
+    pub path: String,
+    /// Path of the directory of the file, relative to the root of the project, "." for the root.
+    pub package: String,
+    pub source: Vec<u8>,
+    pub tree: Tree,
+}
+
+/// Parses the Go files of the projects listed in a manifest and passes them to a visitor, in the order of the projects
+/// and of the files. Files which cannot be read are skipped with a warning.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `visit` - The function called on every file.
+///
+/// # Returns
+///
+/// An error if the manifest could not be read, or the first error returned by the visitor.
+pub fn visit_go_files(
+    input_path: &str,
+    mut visit: impl FnMut(&GoFile) -> Result<()>,
+) -> Result<()> {
+    let manifest: JsonValue = json::parse(&std::fs::read_to_string(input_path)?)
+        .with_context(|| format!("Cannot parse manifest {input_path}"))?;
+    let entries: Vec<&JsonValue> = manifest["projects"].members().collect();
+    info!("{} projects found in the manifest.", entries.len());
+
+    let mut parser: Parser = Parser::new();
+    parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+
+    let progress = ProgressBar::new(entries.len() as u64);
+    progress.set_style(
+        indicatif::ProgressStyle::default_bar().template("{elapsed} {wide_bar} {percent}%")?,
+    );
+
+    for (project, entry) in entries.iter().enumerate() {
+        let project_path: &str = entry["path"]
+            .as_str()
+            .context("Manifest entry without path")?;
+        for file in go_files(project_path) {
+            let source: Vec<u8> = match std::fs::read(&file) {
+                Ok(source) => source,
+                Err(e) => {
+                    warn!("Cannot read {}: {e}", file.display());
+                    continue;
+                }
+            };
+            let tree: Tree = parser
+                .parse(&source, None)
+                .with_context(|| format!("Cannot parse {}", file.display()))?;
+            visit(&GoFile {
+                project,
+                id: entry["id"].as_u32(),
+                path: relative_path(&file, project_path)?,
+                package: relative_path(
+                    file.parent().unwrap_or(Path::new(project_path)),
+                    project_path,
+                )?,
+                source,
+                tree,
+            })?;
+        }
+        progress.inc(1);
+    }
+    progress.finish();
+    Ok(())
+}
+
+/// The occurrences of the constructs of a census, with the number of files and of occurrences of every category of the
+/// packages, in the order of the projects.
+pub struct Census<'a> {
+    categories: &'a [&'static str],
+    ids: Vec<Option<u32>>,
+    paths: Vec<String>,
+    packages: Vec<String>,
+    functions: Vec<String>,
+    found: Vec<&'static str>,
+    constructs: Vec<String>,
+    lines: Vec<u32>,
+    columns: Vec<u32>,
+    counts: BTreeMap<(usize, String), (Option<u32>, u32, Vec<u32>)>,
+}
+
+impl<'a> Census<'a> {
+    /// Creates an empty census of the given categories of constructs.
+    pub fn new(categories: &'a [&'static str]) -> Self {
+        Self {
+            categories,
+            ids: Vec::new(),
+            paths: Vec::new(),
+            packages: Vec::new(),
+            functions: Vec::new(),
+            found: Vec::new(),
+            constructs: Vec::new(),
+            lines: Vec::new(),
+            columns: Vec::new(),
+            counts: BTreeMap::new(),
+        }
+    }
+
+    /// Counts a file in the census of its package.
+    pub fn count_file(&mut self, file: &GoFile) {
+        self.package(file.project, file.id, &file.package).1 += 1;
+    }
+
+    /// Returns the census of a package, empty if it has not been counted yet.
+    fn package(
+        &mut self,
+        project: usize,
+        id: Option<u32>,
+        package: &str,
+    ) -> &mut (Option<u32>, u32, Vec<u32>) {
+        let categories: usize = self.categories.len();
+        self.counts
+            .entry((project, package.to_string()))
+            .or_insert_with(|| (id, 0, vec![0; categories]))
+    }
+
+    /// Records an occurrence of a construct.
+    ///
+    /// # Arguments
+    ///
+    /// * `project` - The index of the project of the file in the manifest.
+    /// * `id` - The ID of the project.
+    /// * `path` - The path of the file, relative to the root of the project.
+    /// * `package` - The package of the file, as in [`GoFile`].
+    /// * `function` - The function enclosing the occurrence, as returned by [`enclosing_function`].
+    /// * `occurrence` - The occurrence.
+    pub fn record(
+        &mut self,
+        project: usize,
+        id: Option<u32>,
+        path: &str,
+        package: &str,
+        function: String,
+        occurrence: Occurrence,
+    ) {
+        if let Some(index) = self
+            .categories
+            .iter()
+            .position(|c| *c == occurrence.category)
+        {
+            self.package(project, id, package).2[index] += 1;
+        }
+        self.ids.push(id);
+        self.paths.push(path.to_string());
+        self.packages.push(package.to_string());
+        self.functions.push(function);
+        self.found.push(occurrence.category);
+        self.constructs.push(occurrence.construct);
+        self.lines.push(occurrence.line as u32);
+        self.columns.push(occurrence.column as u32);
+    }
+
+    /// Writes the occurrences and the census of the packages. The output paths are expected to have been checked
+    /// with [`log_output_file`].
+    ///
+    /// # Arguments
+    ///
+    /// * `output_path` - The path to the output CSV file storing the occurrences of the constructs.
+    /// * `census_path` - The path to the output CSV file storing the number of occurrences of every category in every package.
+    /// * `logger` - The logger displaying the progress.
+    ///
+    /// # Returns
+    ///
+    /// An error if the output files could not be written.
+    pub fn write(self, output_path: &str, census_path: &str, logger: &Logger) -> Result<()> {
+        let mut census_ids: Vec<Option<u32>> = Vec::new();
+        let mut census_packages: Vec<String> = Vec::new();
+        let mut files: Vec<u32> = Vec::new();
+        let mut counts: Vec<Vec<u32>> = vec![Vec::new(); self.categories.len()];
+        for ((_, package), (id, package_files, package_counts)) in self.counts {
+            census_ids.push(id);
+            census_packages.push(package);
+            files.push(package_files);
+            for (column, count) in counts.iter_mut().zip(package_counts) {
+                column.push(count);
+            }
+        }
+
+        info!("Packages found: {}", census_packages.len());
+        info!("Occurrences found: {}", self.found.len());
+        for (category, column) in self.categories.iter().zip(&counts) {
+            info!(
+                "  {category}: {} in {} packages",
+                column.iter().sum::<u32>(),
+                column.iter().filter(|count| **count > 0).count()
+            );
+        }
+
+        let mut occurrences_df: DataFrame = df!(
+            "id" => self.ids,
+            "path" => self.paths,
+            "package" => self.packages,
+            "function" => self.functions,
+            "category" => self.found,
+            "construct" => self.constructs,
+            "line" => self.lines,
+            "column" => self.columns,
+        )?;
+        log_write_output(logger, output_path, &mut occurrences_df, false)?;
+
+        let mut census_df: DataFrame = df!(
+            "id" => census_ids,
+            "package" => census_packages,
+            "files" => files,
+        )?;
+        for (category, column) in self.categories.iter().zip(counts) {
+            census_df.with_column(Column::new((*category).into(), column))?;
+        }
+        log_write_output(logger, census_path, &mut census_df, false)
+    }
+}
+
+/// Takes the census of a family of Go constructs in the projects listed in a manifest.
+///
+/// # Arguments
+///
+/// * `input_path` - The path to the manifest written by the download phase.
+/// * `output_path` - The path to the output CSV file storing the occurrences of the constructs.
+/// * `census_path` - The path to the output CSV file storing the number of occurrences of every category in every package.
+/// * `categories` - The categories of the constructs.
+/// * `locate` - The function returning the occurrences of the constructs in the syntax tree of a file, given its source code.
+/// * `force` - Whether to override the output files if they already exist.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the manifest or the output files could not be read or written.
+pub fn run(
+    input_path: &str,
+    output_path: &str,
+    census_path: &str,
+    categories: &[&'static str],
+    locate: impl Fn(&Node, &[u8]) -> Vec<Occurrence>,
+    force: bool,
+    logger: &Logger,
+) -> Result<()> {
+    check_path(input_path)?;
+    log_output_file(output_path, false, force)?;
+    log_output_file(census_path, false, force)?;
+
+    let mut census: Census = Census::new(categories);
+    visit_go_files(input_path, |file| {
+        census.count_file(file);
+        let root: Node = file.tree.root_node();
+        for occurrence in locate(&root, &file.source) {
+            let function: String = root
+                .descendant_for_byte_range(occurrence.start, occurrence.start + 1)
+                .map(|node| enclosing_function(&node, &file.source))
+                .unwrap_or_default();
+            census.record(
+                file.project,
+                file.id,
+                &file.path,
+                &file.package,
+                function,
+                occurrence,
+            );
+        }
+        Ok(())
+    })?;
+    census.write(output_path, census_path, logger)
+}
+
+/// Sums up the census of the packages written by [`run`] in a profile of every project: its number of packages, of
+/// files and of occurrences of every category, and the share of every category among its occurrences.
+/// The profile path is expected to have been checked with [`log_output_file`] before the census was taken.
+///
+/// # Arguments
+///
+/// * `census_path` - The path to the CSV file storing the census of the packages.
+/// * `profile_path` - The path to the output CSV file storing the profile of every project.
+/// * `categories` - The categories of the constructs.
+/// * `logger` - The logger displaying the progress.
+///
+/// # Returns
+///
+/// An error if the census could not be read or the profile could not be written.
+pub fn profile(
+    census_path: &str,
+    profile_path: &str,
+    categories: &[&'static str],
+    logger: &Logger,
+) -> Result<()> {
+    let census: DataFrame = open_csv(census_path, None, None)?;
+
+    let mut sums: Vec<Expr> = vec![
+        col("package").count().alias("packages"),
+        col("files").cast(DataType::UInt32).sum(),
+    ];
+    sums.extend(
+        categories
+            .iter()
+            .map(|category| col(*category).cast(DataType::UInt32).sum()),
+    );
+    let total: Expr = categories
+        .iter()
+        .map(|category| col(*category))
+        .reduce(|a, b| a + b)
+        .unwrap_or(lit(0u32));
+    // Projects without any occurrence have a share of 0 in every category.
+    let shares: Vec<Expr> = categories
+        .iter()
+        .map(|category| {
+            when(col("occurrences").gt(lit(0)))
+                .then(
+                    col(*category).cast(DataType::Float64)
+                        / col("occurrences").cast(DataType::Float64),
+                )
+                .otherwise(lit(0.0))
+                .alias(format!("{category}_share"))
+        })
+        .collect();
+
+    let mut profile_df: DataFrame = census
+        .lazy()
+        .group_by_stable([col("id")])
+        .agg(sums)
+        .with_column(total.alias("occurrences"))
+        .with_columns(shares)
+        .collect()
+        .with_context(|| format!("Cannot sum up the census {census_path}"))?;
+    info!("Projects profiled: {}", profile_df.height());
+    log_write_output(logger, profile_path, &mut profile_df, false)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn qualified_names() -> Result<()> {
+        let source: &[u8] = b"package a\n\nimport (\n\tm \"math\"\n\t\"math/cmplx\"\n\t_ \"embed\"\n)\n\nvar x = m.Sqrt(cmplx.Abs(1i))\n";
+        let mut parser: Parser = Parser::new();
+        parser.set_language(&tree_sitter_go::LANGUAGE.into())?;
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let root: Node = tree.root_node();
+        let imports: HashMap<String, String> = imported_packages(&root, source);
+        assert_eq!(
+            imports,
+            HashMap::from([
+                ("m".to_string(), "math".to_string()),
+                ("cmplx".to_string(), "math/cmplx".to_string()),
+            ])
+        );
+        let calls: Vec<(&str, &str)> = nodes(&root)
+            .iter()
+            .filter_map(|node| called_function(node, source, &imports))
+            .collect();
+        assert_eq!(calls, vec![("math", "Sqrt"), ("math/cmplx", "Abs")]);
+
+        let source: &[u8] =
+            b"package a\n\nfunc f() { g(func() { h() }) }\n\nfunc (s *Stack[T]) Push() { h() }\n";
+        let tree = parser.parse(source, None).context("Failed to parse")?;
+        let functions: Vec<String> = nodes(&tree.root_node())
+            .iter()
+            .filter(|node| node.kind() == "call_expression")
+            .map(|call| enclosing_function(call, source))
+            .collect();
+        assert_eq!(functions, vec!["f", "f", "Stack.Push"]);
+        assert_eq!(enclosing_function(&tree.root_node(), source), "");
+        Ok(())
+    }
+}
@@ -0,0 +1,432 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Go build constraints, written in `//go:build` lines, legacy `// +build` lines and file name suffixes.
+
+use std::fmt;
+use std::iter::Peekable;
+use std::str::FromStr;
+
+use anyhow::{bail, ensure, Context, Result};
+
+/// Operating systems recognized by the Go toolchain.
+const KNOWN_OS: &[&str] = &[
+    "aix",
+    "android",
+    "darwin",
+    "dragonfly",
+    "freebsd",
+    "hurd",
+    "illumos",
+    "ios",
+    "js",
+    "linux",
+    "nacl",
+    "netbsd",
+    "openbsd",
+    "plan9",
+    "solaris",
+    "wasip1",
+    "windows",
+    "zos",
+];
+
+/// Operating systems satisfying the `unix` tag.
+const UNIX_OS: &[&str] = &[
+    "aix",
+    "android",
+    "darwin",
+    "dragonfly",
+    "freebsd",
+    "hurd",
+    "illumos",
+    "ios",
+    "linux",
+    "netbsd",
+    "openbsd",
+    "solaris",
+];
+
+/// Architectures recognized by the Go toolchain.
+pub const KNOWN_ARCH: &[&str] = &[
+    "386",
+    "amd64",
+    "amd64p32",
+    "arm",
+    "armbe",
+    "arm64",
+    "arm64be",
+    "loong64",
+    "mips",
+    "mipsle",
+    "mips64",
+    "mips64le",
+    "mips64p32",
+    "mips64p32le",
+    "ppc",
+    "ppc64",
+    "ppc64le",
+    "riscv",
+    "riscv64",
+    "s390",
+    "s390x",
+    "sparc",
+    "sparc64",
+    "wasm",
+];
+
+/// First-class ports of the Go toolchain, enumerated when all configurations are requested.
+const FIRST_CLASS_PORTS: &[(&str, &str)] = &[
+    ("linux", "386"),
+    ("linux", "amd64"),
+    ("linux", "arm"),
+    ("linux", "arm64"),
+    ("darwin", "amd64"),
+    ("darwin", "arm64"),
+    ("windows", "386"),
+    ("windows", "amd64"),
+];
+
+/// A build configuration, i.e. a target operating system and architecture.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct BuildConfig {
+    pub os: &'static str,
+    pub arch: &'static str,
+}
+
+impl BuildConfig {
+    /// Returns the first-class ports of the Go toolchain.
+    pub fn first_class_ports() -> Vec<BuildConfig> {
+        FIRST_CLASS_PORTS
+            .iter()
+            .map(|&(os, arch)| BuildConfig { os, arch })
+            .collect()
+    }
+
+    /// Whether a build tag is satisfied in this configuration.
+    /// Besides the operating system and the architecture, the `gc` and `cgo` tags and all release tags are satisfied,
+    /// as in a native build with the default toolchain. Custom tags are not.
+    pub fn has_tag(&self, tag: &str) -> bool {
+        tag == self.os
+            || tag == self.arch
+            || (tag == "unix" && UNIX_OS.contains(&self.os))
+            || (tag == "linux" && self.os == "android")
+            || (tag == "darwin" && self.os == "ios")
+            || (tag == "solaris" && self.os == "illumos")
+            || tag == "gc"
+            || tag == "cgo"
+            || tag
+                .strip_prefix("go1.")
+                .is_some_and(|minor| minor.parse::<u32>().is_ok())
+    }
+
+    /// Whether a file is built in this configuration according to the `_GOOS`, `_GOARCH` or `_GOOS_GOARCH` suffix of its name.
+    pub fn matches_file_name(&self, name: &str) -> bool {
+        let stem: &str = name.rsplit_once('.').map_or(name, |(stem, _)| stem);
+        let stem: &str = stem.strip_suffix("_test").unwrap_or(stem);
+        // The first element of the name is never a constraint, e.g. linux.go is built everywhere.
+        let parts: Vec<&str> = stem.split('_').skip(1).collect();
+        match parts.as_slice() {
+            [.., os, arch] if KNOWN_OS.contains(os) && KNOWN_ARCH.contains(arch) => {
+                self.has_tag(os) && self.has_tag(arch)
+            }
+            [.., last] if KNOWN_OS.contains(last) || KNOWN_ARCH.contains(last) => {
+                self.has_tag(last)
+            }
+            _ => true,
+        }
+    }
+}
+
+impl fmt::Display for BuildConfig {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}/{}", self.os, self.arch)
+    }
+}
+
+impl FromStr for BuildConfig {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        let (os, arch) = s
+            .split_once('/')
+            .with_context(|| format!("Invalid build configuration {s}, expected GOOS/GOARCH"))?;
+        match (
+            KNOWN_OS.iter().find(|&&known| known == os).copied(),
+            KNOWN_ARCH.iter().find(|&&known| known == arch).copied(),
+        ) {
+            (Some(os), Some(arch)) => Ok(BuildConfig { os, arch }),
+            (None, _) => bail!("Unknown operating system {os} in build configuration {s}"),
+            (_, None) => bail!("Unknown architecture {arch} in build configuration {s}"),
+        }
+    }
+}
+
+/// A boolean expression over build tags.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum Constraint {
+    Tag(String),
+    Not(Box<Constraint>),
+    And(Box<Constraint>, Box<Constraint>),
+    Or(Box<Constraint>, Box<Constraint>),
+}
+
+impl Constraint {
+    /// Whether the constraint is satisfied in a build configuration.
+    pub fn eval(&self, config: &BuildConfig) -> bool {
+        match self {
+            Constraint::Tag(tag) => config.has_tag(tag),
+            Constraint::Not(c) => !c.eval(config),
+            Constraint::And(a, b) => a.eval(config) && b.eval(config),
+            Constraint::Or(a, b) => a.eval(config) || b.eval(config),
+        }
+    }
+
+    /// Parses a legacy `// +build` line, whose space-separated options are or-ed and whose comma-separated terms are and-ed.
+    fn from_plus_build(options: &str) -> Option<Constraint> {
+        options
+            .split_whitespace()
+            .filter_map(|option| {
+                option
+                    .split(',')
+                    .map(|term| match term.strip_prefix('!') {
+                        Some(tag) => Constraint::Not(Box::new(Constraint::Tag(tag.to_string()))),
+                        None => Constraint::Tag(term.to_string()),
+                    })
+                    .reduce(|a, b| Constraint::And(Box::new(a), Box::new(b)))
+            })
+            .reduce(|a, b| Constraint::Or(Box::new(a), Box::new(b)))
+    }
+}
+
+impl FromStr for Constraint {
+    type Err = anyhow::Error;
+
+    /// Parses a `//go:build` expression, e.g. `linux && (amd64 || arm64) && !purego`.
+    fn from_str(s: &str) -> Result<Self> {
+        let mut tokens = tokenize(s)
+            .with_context(|| format!("Invalid build constraint {s}"))?
+            .into_iter()
+            .peekable();
+        let constraint: Constraint =
+            parse_or(&mut tokens).with_context(|| format!("Invalid build constraint {s}"))?;
+        ensure!(
+            tokens.next().is_none(),
+            "Invalid build constraint {s}: unexpected tokens after the expression"
+        );
+        Ok(constraint)
+    }
+}
+
+/// Splits a `//go:build` expression into parentheses, operators and tags.
+fn tokenize(s: &str) -> Result<Vec<&str>> {
+    let mut tokens: Vec<&str> = Vec::new();
+    let mut rest: &str = s.trim_start();
+    while let Some(c) = rest.chars().next() {
+        let len: usize = if rest.starts_with("&&") || rest.starts_with("||") {
+            2
+        } else if matches!(c, '(' | ')' | '!') {
+            1
+        } else {
+            let len: usize = rest
+                .find(|c: char| !(c.is_ascii_alphanumeric() || c == '_' || c == '.'))
+                .unwrap_or(rest.len());
+            ensure!(len > 0, "unexpected character {c}");
+            len
+        };
+        tokens.push(&rest[..len]);
+        rest = rest[len..].trim_start();
+    }
+    Ok(tokens)
+}
+
+fn parse_or<'a>(tokens: &mut Peekable<impl Iterator<Item = &'a str>>) -> Result<Constraint> {
+    let mut constraint: Constraint = parse_and(tokens)?;
+    while tokens.next_if_eq(&"||").is_some() {
+        constraint = Constraint::Or(Box::new(constraint), Box::new(parse_and(tokens)?));
+    }
+    Ok(constraint)
+}
+
+fn parse_and<'a>(tokens: &mut Peekable<impl Iterator<Item = &'a str>>) -> Result<Constraint> {
+    let mut constraint: Constraint = parse_not(tokens)?;
+    while tokens.next_if_eq(&"&&").is_some() {
+        constraint = Constraint::And(Box::new(constraint), Box::new(parse_not(tokens)?));
+    }
+    Ok(constraint)
+}
+
+fn parse_not<'a>(tokens: &mut Peekable<impl Iterator<Item = &'a str>>) -> Result<Constraint> {
+    match tokens.next() {
+        Some("!") => Ok(Constraint::Not(Box::new(parse_not(tokens)?))),
+        Some("(") => {
+            let constraint: Constraint = parse_or(tokens)?;
+            ensure!(tokens.next() == Some(")"), "missing closing parenthesis");
+            Ok(constraint)
+        }
+        Some(token @ (")" | "&&" | "||")) => bail!("unexpected {token}"),
+        Some(tag) => Ok(Constraint::Tag(tag.to_string())),
+        None => bail!("unexpected end of expression"),
+    }
+}
+
+/// Returns the build constraint in the header of a Go source file, i.e. in the comments preceding the package clause.
+/// A `//go:build` line takes precedence over `// +build` lines, which are and-ed together.
+pub fn header_constraint(source: &str) -> Result<Option<Constraint>> {
+    let mut plus_build: Option<Constraint> = None;
+    let mut in_comment: bool = false;
+    for line in source.lines() {
+        let line: &str = line.trim();
+        if in_comment {
+            if let Some((_, rest)) = line.split_once("*/") {
+                in_comment = false;
+                if !rest.trim().is_empty() {
+                    break;
+                }
+            }
+        } else if let Some(expr) = line.strip_prefix("//go:build") {
+            if expr.is_empty() || expr.starts_with([' ', '\t']) {
+                return expr.parse().map(Some);
+            }
+        } else if let Some(options) = line
+            .strip_prefix("//")
+            .and_then(|comment| comment.trim_start().strip_prefix("+build"))
+        {
+            if let Some(c) = Constraint::from_plus_build(options) {
+                plus_build = Some(match plus_build {
+                    Some(p) => Constraint::And(Box::new(p), Box::new(c)),
+                    None => c,
+                });
+            }
+        } else if let Some(comment) = line.strip_prefix("/*") {
+            in_comment = !comment.contains("*/");
+        } else if !line.is_empty() && !line.starts_with("//") {
+            break;
+        }
+    }
+    Ok(plus_build)
+}
+
+/// Returns the architectures in which a Go or assembly source file is built for at least one operating system,
+/// in the order of [`KNOWN_ARCH`].
+///
+/// # Arguments
+///
+/// * `file_name` - The name of the file, without its directory.
+/// * `source` - The source code of the file.
+pub fn architectures(file_name: &str, source: &str) -> Result<Vec<&'static str>> {
+    let configs: Vec<BuildConfig> = KNOWN_OS
+        .iter()
+        .flat_map(|&os| KNOWN_ARCH.iter().map(move |&arch| BuildConfig { os, arch }))
+        .collect();
+    let built: Vec<&BuildConfig> = configurations(file_name, source, &configs)?;
+    Ok(KNOWN_ARCH
+        .iter()
+        .copied()
+        .filter(|arch| built.iter().any(|config| config.arch == *arch))
+        .collect())
+}
+
+/// Returns the build configurations in which a Go source file is built, based on its name and on the constraint in its header.
+///
+/// # Arguments
+///
+/// * `file_name` - The name of the file, without its directory.
+/// * `source` - The source code of the file.
+/// * `configs` - The build configurations to consider.
+pub fn configurations<'a>(
+    file_name: &str,
+    source: &str,
+    configs: &'a [BuildConfig],
+) -> Result<Vec<&'a BuildConfig>> {
+    let constraint: Option<Constraint> = header_constraint(source)?;
+    Ok(configs
+        .iter()
+        .filter(|config| {
+            config.matches_file_name(file_name)
+                && constraint.as_ref().is_none_or(|c| c.eval(config))
+        })
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn build_constraints() -> Result<()> {
+        let linux: BuildConfig = "linux/amd64".parse()?;
+        let darwin: BuildConfig = "darwin/arm64".parse()?;
+        let windows: BuildConfig = "windows/386".parse()?;
+        let configs: Vec<BuildConfig> = vec![linux, darwin, windows];
+
+        let c: Constraint = "linux && (amd64 || arm64) && !purego".parse()?;
+        assert!(c.eval(&linux));
+        assert!(!c.eval(&darwin));
+        assert!("unix && go1.18".parse::<Constraint>()?.eval(&darwin));
+        assert!("linux &&".parse::<Constraint>().is_err());
+        assert!("(linux".parse::<Constraint>().is_err());
+        assert!("linux/amd".parse::<BuildConfig>().is_err());
+
+        assert_eq!(
+            configurations("poll_windows.go", "package poll\n", &configs)?,
+            vec![&windows]
+        );
+        assert_eq!(
+            configurations("linux.go", "package main\n", &configs)?.len(),
+            3
+        );
+        assert_eq!(
+            configurations("asm_darwin_arm64_test.go", "package asm\n", &configs)?,
+            vec![&darwin]
+        );
+        assert_eq!(
+            configurations(
+                "fd.go",
+                "// Copyright\n\n/* header */\n//go:build !windows\n// +build linux\n\npackage fd\n",
+                &configs
+            )?,
+            vec![&linux, &darwin]
+        );
+        assert_eq!(
+            configurations(
+                "fd.go",
+                "// +build linux,amd64 darwin\n\npackage fd\n",
+                &configs
+            )?,
+            vec![&linux, &darwin]
+        );
+        // Constraints after the package clause are ignored.
+        assert_eq!(
+            configurations("fd.go", "package fd\n//go:build ignore\n", &configs)?.len(),
+            3
+        );
+        assert!(
+            configurations("gen.go", "//go:build ignore\n\npackage main\n", &configs)?.is_empty()
+        );
+
+        assert_eq!(architectures("sqrt_amd64.s", "")?, vec!["amd64"]);
+        assert_eq!(architectures("sqrt_linux_arm64.s", "")?, vec!["arm64"]);
+        assert_eq!(
+            architectures(
+                "sqrt_asm.s",
+                "//go:build (386 || wasm) && !purego\n\n#include \"textflag.h\"\n"
+            )?,
+            vec!["386", "wasm"]
+        );
+        assert_eq!(architectures("sqrt.s", "")?.len(), KNOWN_ARCH.len());
+        Ok(())
+    }
+}
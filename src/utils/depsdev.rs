@@ -0,0 +1,111 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! The deps.dev API, reporting how many packages depend on open source packages.
+//!
+//! See <https://docs.deps.dev/api/v3alpha/> for the documentation of the endpoints.
+
+use anyhow::{ensure, Context, Result};
+use json::JsonValue;
+use reqwest::blocking::{Client, Response};
+use reqwest::Url;
+
+use crate::utils::throttle::wait_for_host;
+
+/// Base URL of the deps.dev API.
+const API_URL: &str = "https://api.deps.dev/v3alpha";
+
+/// A client of the deps.dev API.
+pub struct DepsDev {
+    client: Client,
+}
+
+impl DepsDev {
+    /// Creates a client of the deps.dev API, which does not require any authentication.
+    pub fn new() -> DepsDev {
+        DepsDev {
+            client: Client::new(),
+        }
+    }
+
+    /// Returns the URL of the dependents of a Go module version.
+    /// Module paths contain slashes and are sent as a single percent-encoded segment.
+    fn dependents_url(module: &str, version: &str) -> Result<Url> {
+        let mut url: Url = Url::parse(API_URL)?;
+        url.path_segments_mut()
+            .map_err(|_| anyhow::anyhow!("Invalid API URL {API_URL}"))?
+            .extend([
+                "systems",
+                "go",
+                "packages",
+                module,
+                "versions",
+                &format!("{version}:dependents"),
+            ]);
+        Ok(url)
+    }
+
+    /// Returns the number of packages depending on a version of a Go module, directly or indirectly.
+    ///
+    /// # Arguments
+    ///
+    /// * `module` - The module path.
+    /// * `version` - The version of the module.
+    ///
+    /// # Returns
+    ///
+    /// The number of dependents, `None` if deps.dev does not know the module version,
+    /// or an error if the request failed.
+    pub fn dependents(&self, module: &str, version: &str) -> Result<Option<u64>> {
+        let url: Url = DepsDev::dependents_url(module, version)?;
+        wait_for_host(url.host_str().unwrap_or_default());
+        let response: Response = self
+            .client
+            .get(url.clone())
+            .send()
+            .with_context(|| format!("Could not send request {url}"))?;
+        if response.status().as_u16() == 404 {
+            return Ok(None);
+        }
+        ensure!(
+            response.status().is_success(),
+            "Request {url} failed with response code {}",
+            response.status().as_u16()
+        );
+        let body: JsonValue = json::parse(&response.text()?)
+            .with_context(|| format!("Cannot parse json result of {url}"))?;
+        Ok(Some(body["dependentCount"].as_u64().unwrap_or_default()))
+    }
+}
+
+impl Default for DepsDev {
+    fn default() -> Self {
+        DepsDev::new()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn dependents_urls() -> Result<()> {
+        assert_eq!(
+            DepsDev::dependents_url("github.com/spf13/cobra", "v1.8.0")?.as_str(),
+            "https://api.deps.dev/v3alpha/systems/go/packages/github.com%2Fspf13%2Fcobra/versions/v1.8.0:dependents"
+        );
+        Ok(())
+    }
+}
@@ -0,0 +1,271 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! `//go:embed` directives, which embed the files matching their patterns in the variable they precede.
+
+use std::path::Path;
+
+use anyhow::{bail, Context, Result};
+use walkdir::{DirEntry, WalkDir};
+
+/// Returns the patterns of a `//go:embed` directive, or None if the comment is not such a directive.
+/// Patterns are separated by whitespace and may be quoted with double quotes or backquotes.
+///
+/// # Arguments
+///
+/// * `comment` - The text of the comment, including the leading `//`.
+pub fn embed_patterns(comment: &str) -> Result<Option<Vec<String>>> {
+    let Some(rest) = comment.strip_prefix("//go:embed") else {
+        return Ok(None);
+    };
+    // The directive must be followed by its arguments, e.g. //go:embedded is not a directive.
+    if !rest.is_empty() && !rest.starts_with(char::is_whitespace) {
+        return Ok(None);
+    }
+    let mut patterns: Vec<String> = Vec::new();
+    let mut rest: &str = rest.trim_start();
+    while !rest.is_empty() {
+        let (pattern, len): (String, usize) = match rest.chars().next() {
+            Some('`') => {
+                let end: usize = rest[1..]
+                    .find('`')
+                    .with_context(|| format!("Unterminated pattern in '{comment}'"))?;
+                (rest[1..end + 1].to_string(), end + 2)
+            }
+            Some('"') => {
+                let mut pattern: String = String::new();
+                let mut chars = rest.char_indices().skip(1);
+                let end: usize = loop {
+                    match chars.next() {
+                        Some((i, '"')) => break i + 1,
+                        Some((_, '\\')) => match chars.next() {
+                            Some((_, c)) => pattern.push(c),
+                            None => bail!("Unterminated pattern in '{comment}'"),
+                        },
+                        Some((_, c)) => pattern.push(c),
+                        None => bail!("Unterminated pattern in '{comment}'"),
+                    }
+                };
+                (pattern, end)
+            }
+            _ => {
+                let end: usize = rest.find(char::is_whitespace).unwrap_or(rest.len());
+                (rest[..end].to_string(), end)
+            }
+        };
+        patterns.push(pattern);
+        rest = rest[len..].trim_start();
+    }
+    if patterns.is_empty() {
+        bail!("No pattern in '{comment}'");
+    }
+    Ok(Some(patterns))
+}
+
+/// Whether a slash-separated path matches a pattern, with the syntax of Go's `path.Match`:
+/// `*` matches any sequence of characters other than `/`, `?` any single character other than `/`,
+/// `[...]` a character class, possibly negated with `^` and containing ranges, and `\` escapes the next character.
+/// Malformed patterns match nothing.
+pub fn match_pattern(pattern: &str, name: &str) -> bool {
+    fn matches(pattern: &[char], name: &[char]) -> Option<bool> {
+        match pattern.split_first() {
+            None => Some(name.is_empty()),
+            Some(('*', rest)) => {
+                // The star matches the longest prefix of the name without a slash.
+                let limit: usize = name.iter().position(|c| *c == '/').unwrap_or(name.len());
+                for i in 0..=limit {
+                    if matches(rest, &name[i..])? {
+                        return Some(true);
+                    }
+                }
+                Some(false)
+            }
+            Some(('?', rest)) => match name.split_first() {
+                Some((c, name)) if *c != '/' => matches(rest, name),
+                _ => Some(false),
+            },
+            Some(('[', rest)) => {
+                let (negated, rest) = match rest.split_first() {
+                    Some(('^', rest)) => (true, rest),
+                    _ => (false, rest),
+                };
+                let mut rest: &[char] = rest;
+                let mut matched: bool = false;
+                let c: Option<char> = name.first().copied().filter(|c| *c != '/');
+                loop {
+                    match rest.split_first() {
+                        Some((']', tail)) => {
+                            rest = tail;
+                            break;
+                        }
+                        Some(_) => {
+                            let (low, tail) = class_char(rest)?;
+                            let (high, tail) = match tail.split_first() {
+                                Some(('-', tail)) => class_char(tail)?,
+                                _ => (low, tail),
+                            };
+                            matched |= c.is_some_and(|c| low <= c && c <= high);
+                            rest = tail;
+                        }
+                        None => return None,
+                    }
+                }
+                if c.is_some() && matched != negated {
+                    matches(rest, &name[1..])
+                } else {
+                    Some(false)
+                }
+            }
+            Some(('\\', rest)) => match (rest.split_first(), name.split_first()) {
+                (Some((p, rest)), Some((c, name))) if p == c => matches(rest, name),
+                (Some(_), _) => Some(false),
+                (None, _) => None,
+            },
+            Some((p, rest)) => match name.split_first() {
+                Some((c, name)) if p == c => matches(rest, name),
+                _ => Some(false),
+            },
+        }
+    }
+    /// Returns a character of a class, possibly escaped, and the rest of the pattern.
+    fn class_char(pattern: &[char]) -> Option<(char, &[char])> {
+        match pattern.split_first()? {
+            ('\\', rest) => rest.split_first().map(|(c, rest)| (*c, rest)),
+            (']' | '-', _) => None,
+            (c, rest) => Some((*c, rest)),
+        }
+    }
+    let pattern: Vec<char> = pattern.chars().collect();
+    let name: Vec<char> = name.chars().collect();
+    matches(&pattern, &name).unwrap_or(false)
+}
+
+/// Whether an entry is ignored when embedding the content of a directory, unless the pattern has the `all:` prefix.
+fn is_hidden(entry: &DirEntry) -> bool {
+    entry
+        .file_name()
+        .to_str()
+        .is_some_and(|name| name.starts_with('.') || name.starts_with('_'))
+}
+
+/// Returns the number of files embedded by a pattern of a `//go:embed` directive.
+/// A matching directory embeds all the files it contains, recursively, except those whose name starts with `.` or `_`
+/// unless the pattern has the `all:` prefix.
+///
+/// # Arguments
+///
+/// * `dir` - The directory of the Go file containing the directive, to which the pattern is relative.
+/// * `pattern` - The pattern of the directive.
+pub fn embedded_files(dir: &Path, pattern: &str) -> Result<usize> {
+    let (all, pattern) = match pattern.strip_prefix("all:") {
+        Some(pattern) => (true, pattern),
+        None => (false, pattern),
+    };
+    // Patterns cannot leave the directory of the file.
+    if pattern.starts_with('/') || pattern.split('/').any(|part| part == "." || part == "..") {
+        return Ok(0);
+    }
+    let mut files: usize = 0;
+    let mut entries = WalkDir::new(dir)
+        .min_depth(1)
+        .max_depth(pattern.split('/').count())
+        .into_iter();
+    while let Some(entry) = entries.next() {
+        let entry: DirEntry = entry?;
+        let name: String = entry
+            .path()
+            .strip_prefix(dir)?
+            .components()
+            .map(|c| c.as_os_str().to_string_lossy())
+            .collect::<Vec<_>>()
+            .join("/");
+        if !match_pattern(pattern, &name) {
+            continue;
+        }
+        if entry.file_type().is_dir() {
+            for file in WalkDir::new(entry.path())
+                .min_depth(1)
+                .into_iter()
+                .filter_entry(|e| all || !is_hidden(e))
+            {
+                if file?.file_type().is_file() {
+                    files += 1;
+                }
+            }
+            entries.skip_current_dir();
+        } else if entry.file_type().is_file() {
+            files += 1;
+        }
+    }
+    Ok(files)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+    use crate::utils::fs::*;
+
+    #[test]
+    fn directives() -> Result<()> {
+        assert_eq!(
+            embed_patterns("//go:embed static/*.html  \"a b.txt\" `c.txt`")?,
+            Some(vec![
+                "static/*.html".to_string(),
+                "a b.txt".to_string(),
+                "c.txt".to_string()
+            ])
+        );
+        assert_eq!(embed_patterns("// go:embed x")?, None);
+        assert_eq!(embed_patterns("//go:embedded x")?, None);
+        assert!(embed_patterns("//go:embed").is_err());
+        assert!(embed_patterns("//go:embed \"x").is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn patterns() {
+        assert!(match_pattern("*.html", "index.html"));
+        assert!(!match_pattern("*.html", "static/index.html"));
+        assert!(match_pattern("static/?.txt", "static/a.txt"));
+        assert!(match_pattern("[a-c]*", "banner"));
+        assert!(!match_pattern("[^a-c]*", "banner"));
+        assert!(match_pattern("\\*", "*"));
+        assert!(!match_pattern("[a-", "a"));
+        assert!(match_pattern("static", "static"));
+    }
+
+    #[test]
+    fn embedded() -> Result<()> {
+        let dir: &str = "target/tests/utils/embed";
+        delete_dir(dir, true)?;
+        create_dir(&format!("{dir}/static/css"))?;
+        for file in [
+            "x.go",
+            "static/index.html",
+            "static/.hidden",
+            "static/css/a.css",
+        ] {
+            std::fs::write(format!("{dir}/{file}"), "")?;
+        }
+        let dir: &Path = Path::new(dir);
+        assert_eq!(embedded_files(dir, "static")?, 2);
+        assert_eq!(embedded_files(dir, "all:static")?, 3);
+        assert_eq!(embedded_files(dir, "static/*.html")?, 1);
+        assert_eq!(embedded_files(dir, "*.go")?, 1);
+        assert_eq!(embedded_files(dir, "missing.txt")?, 0);
+        assert_eq!(embedded_files(dir, "../x.go")?, 0);
+        Ok(())
+    }
+}
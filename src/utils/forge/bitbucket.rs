@@ -0,0 +1,193 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Bitbucket Cloud. Bitbucket Data Center has a different API and is not supported.
+
+use anyhow::{Context, Result};
+use base64::Engine as _;
+use json::JsonValue;
+use reqwest::blocking::Client;
+use reqwest::header::{HeaderMap, HeaderValue, AUTHORIZATION};
+use reqwest::Url;
+
+use super::{parse_date, Backend, Forge, ForgeProject, Page};
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::json::get_field;
+
+pub struct Bitbucket;
+
+impl Backend for Bitbucket {
+    /// Bitbucket tokens are either access tokens or app passwords, written `username:app_password`.
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &["BITBUCKET_TOKEN"]
+    }
+
+    fn api_url(&self, _host: &str) -> String {
+        "https://api.bitbucket.org/2.0".to_string()
+    }
+
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::Zip, ArchiveFormat::TarGz]
+    }
+
+    /// Bitbucket does not serve archives through its API.
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        _id: u32,
+        path: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url> {
+        Ok(Url::parse(&format!(
+            "https://{}/{path}/get/{commit}{}",
+            forge.host(),
+            format.extension()
+        ))?)
+    }
+
+    /// App passwords are sent with basic authentication, access tokens as bearer tokens.
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()> {
+        let value: String = if token.contains(':') {
+            format!(
+                "Basic {}",
+                base64::engine::general_purpose::STANDARD.encode(token)
+            )
+        } else {
+            format!("Bearer {token}")
+        };
+        headers.insert(AUTHORIZATION, HeaderValue::from_str(&value)?);
+        Ok(())
+    }
+
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page> {
+        forge.rest_page(
+            client,
+            token,
+            cursor,
+            || self.search_url(forge, query, namespace),
+            |page| &page["values"],
+        )
+    }
+
+    fn search_url(
+        &self,
+        forge: &Forge,
+        query: Option<&str>,
+        namespace: Option<&str>,
+    ) -> Result<Url> {
+        let mut url: Url = match namespace {
+            Some(ns) => forge.endpoint(&["repositories", ns])?,
+            None => forge.endpoint(&["repositories"])?,
+        };
+        if let Some(q) = query {
+            url.query_pairs_mut().append_pair("q", q);
+        }
+        url.query_pairs_mut()
+            .append_pair("pagelen", Forge::PER_PAGE);
+        Ok(url)
+    }
+
+    fn project_endpoint(&self, forge: &Forge, path: &str) -> Result<Url> {
+        let mut segments: Vec<&str> = vec!["repositories"];
+        segments.extend(path.split('/'));
+        forge.endpoint(&segments)
+    }
+
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        if item["mainbranch"].is_null() {
+            return Ok(None);
+        }
+        // Bitbucket does not have numeric ids, the first 32 bits of the UUID of the repository are used instead.
+        let uuid: String = get_field::<String>(item, "uuid")?;
+        let id: u32 = uuid
+            .trim_start_matches('{')
+            .get(..8)
+            .and_then(|prefix| u32::from_str_radix(prefix, 16).ok())
+            .with_context(|| format!("Invalid repository UUID {uuid}"))?;
+        Ok(Some((
+            ForgeProject {
+                id,
+                name: get_field::<String>(item, "full_name")?,
+                language: item["language"].as_str().unwrap_or_default().to_string(),
+                created: parse_date(item, "created_on")?,
+                pushed: parse_date(item, "updated_on")?,
+                fork: !item["parent"].is_null(),
+                size: item["size"].as_u64().map(|s| s / 1024),
+                license: "unknown".to_string(),
+                ..Default::default()
+            },
+            get_field::<String>(&item["mainbranch"], "name")?,
+        )))
+    }
+
+    fn latest_commit(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+        branch: &str,
+    ) -> Result<String> {
+        let mut segments: Vec<&str> = vec!["repositories"];
+        segments.extend(project.name.split('/'));
+        segments.extend(["refs", "branches", branch]);
+        get_field::<String>(
+            &forge.get_json(client, forge.endpoint(&segments)?, token)?["target"],
+            "hash",
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::ensure;
+
+    use super::*;
+
+    #[test]
+    fn bitbucket_project() -> Result<()> {
+        let item = json::parse(
+            r#"{
+                "uuid": "{0000002a-9dad-11d1-80b4-00c04fd430c8}",
+                "full_name": "workspace/repo",
+                "language": "go",
+                "created_on": "2020-01-01T00:00:00.123456+00:00",
+                "updated_on": "2020-01-02T00:00:00+00:00",
+                "size": 2048,
+                "parent": null,
+                "mainbranch": { "name": "main" }
+            }"#,
+        )?;
+        let (project, branch) = Bitbucket
+            .parse_project(&item)?
+            .context("Project should not be empty")?;
+        assert_eq!(branch, "main");
+        assert_eq!(project.id, 42);
+        assert_eq!(project.created, 1577836800);
+        assert_eq!(project.pushed, 1577923200);
+        assert_eq!(project.size, Some(2));
+        ensure!(!project.fork);
+        Ok(())
+    }
+}
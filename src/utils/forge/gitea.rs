@@ -0,0 +1,231 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Gitea and Forgejo, which share the same API.
+
+use anyhow::Result;
+use json::JsonValue;
+use reqwest::blocking::Client;
+use reqwest::header::{HeaderMap, HeaderValue, AUTHORIZATION};
+use reqwest::Url;
+
+use super::{license_name, parse_date, Backend, Forge, ForgeProject, Page};
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::json::get_field;
+
+pub struct Gitea;
+
+impl Backend for Gitea {
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &["GITEA_TOKEN", "FORGEJO_TOKEN"]
+    }
+
+    fn api_url(&self, host: &str) -> String {
+        format!("https://{host}/api/v1")
+    }
+
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::Zip, ArchiveFormat::TarGz]
+    }
+
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        _id: u32,
+        path: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url> {
+        let archive: String = format!("{commit}{}", format.extension());
+        let mut segments: Vec<&str> = vec!["repos"];
+        segments.extend(path.split('/'));
+        segments.extend(["archive", &archive]);
+        forge.endpoint(&segments)
+    }
+
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()> {
+        headers.insert(
+            AUTHORIZATION,
+            HeaderValue::from_str(&format!("token {token}"))?,
+        );
+        Ok(())
+    }
+
+    /// The repositories of a namespace cannot be searched server side,
+    /// they are listed and filtered on their name instead.
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page> {
+        let mut page: Page = forge.rest_page(
+            client,
+            token,
+            cursor,
+            || self.search_url(forge, query, namespace),
+            // The search endpoint wraps its results, listing endpoints do not.
+            |page| {
+                if page.is_array() {
+                    page
+                } else {
+                    &page["data"]
+                }
+            },
+        )?;
+        if let (Some(q), Some(_)) = (query, namespace) {
+            let q: String = q.to_lowercase();
+            page.items.retain(|item| {
+                item["name"]
+                    .as_str()
+                    .is_some_and(|name| name.to_lowercase().contains(&q))
+            });
+        }
+        Ok(page)
+    }
+
+    fn search_url(
+        &self,
+        forge: &Forge,
+        query: Option<&str>,
+        namespace: Option<&str>,
+    ) -> Result<Url> {
+        let mut url: Url = match namespace {
+            Some(ns) => forge.endpoint(&["users", ns, "repos"])?,
+            None => {
+                let mut url: Url = forge.endpoint(&["repos", "search"])?;
+                url.query_pairs_mut()
+                    .append_pair("q", query.unwrap_or_default())
+                    .append_pair("sort", "id")
+                    .append_pair("order", "asc");
+                url
+            }
+        };
+        url.query_pairs_mut().append_pair("limit", Forge::PER_PAGE);
+        Ok(url)
+    }
+
+    fn project_endpoint(&self, forge: &Forge, path: &str) -> Result<Url> {
+        let mut segments: Vec<&str> = vec!["repos"];
+        segments.extend(path.split('/'));
+        forge.endpoint(&segments)
+    }
+
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        if item["empty"].as_bool().unwrap_or_default() || item["default_branch"].is_null() {
+            return Ok(None);
+        }
+        Ok(Some((
+            ForgeProject {
+                id: get_field::<u32>(item, "id")?,
+                name: get_field::<String>(item, "full_name")?,
+                language: item["language"].as_str().unwrap_or_default().to_string(),
+                created: parse_date(item, "created_at")?,
+                pushed: parse_date(item, "updated_at")?,
+                fork: item["fork"].as_bool().unwrap_or_default(),
+                archived: item["archived"].as_bool().unwrap_or_default(),
+                stars: item["stars_count"].as_u32(),
+                forks: item["forks_count"].as_u32(),
+                size: item["size"].as_u64(),
+                // Only reported by recent versions, as a list of SPDX identifiers.
+                license: license_name(&item["licenses"][0]),
+                ..Default::default()
+            },
+            get_field::<String>(item, "default_branch")?,
+        )))
+    }
+
+    fn latest_commit(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+        branch: &str,
+    ) -> Result<String> {
+        let mut segments: Vec<&str> = vec!["repos"];
+        segments.extend(project.name.split('/'));
+        segments.extend(["branches", branch]);
+        get_field::<String>(
+            &forge.get_json(client, forge.endpoint(&segments)?, token)?["commit"],
+            "id",
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::{ensure, Context};
+
+    use super::*;
+    use crate::utils::forge::Provider;
+
+    #[test]
+    fn gitea_urls() -> Result<()> {
+        let forge = Forge::new(Provider::Forgejo, Some("codeberg.org"));
+        assert_eq!(Gitea.api_url("codeberg.org"), "https://codeberg.org/api/v1");
+        assert_eq!(
+            Gitea
+                .archive_url(&forge, 42, "owner/repo", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://codeberg.org/api/v1/repos/owner/repo/archive/abc.tar.gz"
+        );
+        assert_eq!(
+            Gitea.project_endpoint(&forge, "owner/repo")?.as_str(),
+            "https://codeberg.org/api/v1/repos/owner/repo"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn gitea_project() -> Result<()> {
+        let item = json::parse(
+            r#"{
+                "id": 42,
+                "full_name": "owner/repo",
+                "language": "Go",
+                "created_at": "2020-01-01T00:00:00Z",
+                "updated_at": "2020-01-02T00:00:00Z",
+                "fork": true,
+                "archived": false,
+                "stars_count": 3,
+                "forks_count": 1,
+                "size": 2048,
+                "licenses": ["MIT"],
+                "empty": false,
+                "default_branch": "main"
+            }"#,
+        )?;
+        let (project, branch) = Gitea
+            .parse_project(&item)?
+            .context("Project should not be empty")?;
+        assert_eq!(branch, "main");
+        assert_eq!(project.id, 42);
+        assert_eq!(project.name, "owner/repo");
+        assert_eq!(project.created, 1577836800);
+        assert_eq!(project.pushed, 1577923200);
+        assert_eq!(project.stars, Some(3));
+        assert_eq!(project.license, "MIT");
+        ensure!(project.fork && !project.archived);
+
+        let mut empty = item.clone();
+        empty["empty"] = true.into();
+        assert_eq!(Gitea.parse_project(&empty)?, None);
+        Ok(())
+    }
+}
@@ -0,0 +1,241 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! GitHub and GitHub Enterprise Server.
+
+use anyhow::Result;
+use json::JsonValue;
+use reqwest::blocking::Client;
+use reqwest::header::{HeaderMap, HeaderValue, AUTHORIZATION};
+use reqwest::Url;
+
+use super::{license_name, parse_date, Backend, Forge, ForgeProject, Page};
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::github::is_valid_token;
+use crate::utils::json::get_field;
+
+pub struct GitHub;
+
+impl Backend for GitHub {
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &["GITHUB_TOKEN", "GH_TOKEN"]
+    }
+
+    fn api_url(&self, host: &str) -> String {
+        if host == "github.com" {
+            "https://api.github.com".to_string()
+        } else {
+            // GitHub Enterprise Server
+            format!("https://{host}/api/v3")
+        }
+    }
+
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::Zip, ArchiveFormat::TarGz]
+    }
+
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        id: u32,
+        _path: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url> {
+        let endpoint: &str = match format {
+            ArchiveFormat::Zip => "zipball",
+            ArchiveFormat::TarGz => "tarball",
+        };
+        forge.endpoint(&["repositories", &id.to_string(), endpoint, commit])
+    }
+
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()> {
+        headers.insert(
+            AUTHORIZATION,
+            HeaderValue::from_str(&format!("Bearer {token}"))?,
+        );
+        Ok(())
+    }
+
+    fn check_token(&self, forge: &Forge, token: &str) -> Result<()> {
+        if forge.host() == "github.com" {
+            is_valid_token(token)
+        } else {
+            forge
+                .get_json(&Client::new(), forge.endpoint(&["user"])?, token)
+                .map(|_| ())
+        }
+    }
+
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page> {
+        forge.rest_page(
+            client,
+            token,
+            cursor,
+            || self.search_url(forge, query, namespace),
+            |page| &page["items"],
+        )
+    }
+
+    /// The namespace is part of the query, as a `user:` qualifier.
+    fn search_url(
+        &self,
+        forge: &Forge,
+        query: Option<&str>,
+        namespace: Option<&str>,
+    ) -> Result<Url> {
+        let q: String = [
+            query.map(|q| q.to_string()),
+            namespace.map(|ns| format!("user:{ns}")),
+        ]
+        .into_iter()
+        .flatten()
+        .collect::<Vec<String>>()
+        .join(" ");
+        let mut url: Url = forge.endpoint(&["search", "repositories"])?;
+        url.query_pairs_mut()
+            .append_pair("q", &q)
+            .append_pair("per_page", Forge::PER_PAGE);
+        Ok(url)
+    }
+
+    fn project_endpoint(&self, forge: &Forge, path: &str) -> Result<Url> {
+        let mut segments: Vec<&str> = vec!["repos"];
+        segments.extend(path.split('/'));
+        forge.endpoint(&segments)
+    }
+
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        if item["default_branch"].is_null() {
+            return Ok(None);
+        }
+        Ok(Some((
+            ForgeProject {
+                id: get_field::<u32>(item, "id")?,
+                name: get_field::<String>(item, "full_name")?,
+                language: item["language"].as_str().unwrap_or_default().to_string(),
+                created: parse_date(item, "created_at")?,
+                pushed: parse_date(item, "pushed_at")?,
+                fork: get_field::<bool>(item, "fork")?,
+                archived: get_field::<bool>(item, "archived")?,
+                stars: Some(get_field::<u32>(item, "stargazers_count")?),
+                forks: Some(get_field::<u32>(item, "forks_count")?),
+                size: Some(get_field::<u64>(item, "size")?),
+                license: license_name(&item["license"]["name"]),
+                ..Default::default()
+            },
+            get_field::<String>(item, "default_branch")?,
+        )))
+    }
+
+    fn latest_commit(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+        branch: &str,
+    ) -> Result<String> {
+        let mut segments: Vec<&str> = vec!["repos"];
+        segments.extend(project.name.split('/'));
+        segments.extend(["commits", branch]);
+        get_field::<String>(
+            &forge.get_json(client, forge.endpoint(&segments)?, token)?,
+            "sha",
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::{ensure, Context};
+
+    use super::*;
+    use crate::utils::forge::Provider;
+
+    #[test]
+    fn github_urls() -> Result<()> {
+        assert_eq!(GitHub.api_url("github.com"), "https://api.github.com");
+        assert_eq!(
+            GitHub.api_url("github.example.org"),
+            "https://github.example.org/api/v3"
+        );
+        let forge = Forge::new(Provider::GitHub, Some("github.com"));
+        assert_eq!(
+            GitHub
+                .archive_url(&forge, 42, "owner/repo", "abc", ArchiveFormat::Zip)?
+                .as_str(),
+            "https://api.github.com/repositories/42/zipball/abc"
+        );
+        assert_eq!(
+            GitHub
+                .archive_url(&forge, 42, "owner/repo", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://api.github.com/repositories/42/tarball/abc"
+        );
+        assert_eq!(
+            GitHub.project_endpoint(&forge, "owner/repo")?.as_str(),
+            "https://api.github.com/repos/owner/repo"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn github_project() -> Result<()> {
+        let item = json::parse(
+            r#"{
+                "id": 42,
+                "full_name": "owner/repo",
+                "language": "Go",
+                "created_at": "2020-01-01T00:00:00Z",
+                "pushed_at": "2020-01-02T00:00:00Z",
+                "fork": false,
+                "archived": true,
+                "stargazers_count": 3,
+                "forks_count": 1,
+                "size": 2048,
+                "license": { "name": "MIT License" },
+                "default_branch": "main"
+            }"#,
+        )?;
+        let (project, branch) = GitHub
+            .parse_project(&item)?
+            .context("Project should not be empty")?;
+        assert_eq!(branch, "main");
+        assert_eq!(project.id, 42);
+        assert_eq!(project.language, "Go");
+        assert_eq!(project.created, 1577836800);
+        assert_eq!(project.pushed, 1577923200);
+        assert_eq!(project.forks, Some(1));
+        ensure!(!project.fork && project.archived);
+
+        let mut empty = item.clone();
+        empty["default_branch"] = JsonValue::Null;
+        assert_eq!(GitHub.parse_project(&empty)?, None);
+
+        let mut invalid = item.clone();
+        invalid.remove("stargazers_count");
+        ensure!(GitHub.parse_project(&invalid).is_err());
+        Ok(())
+    }
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! GitLab, either gitlab.com or self-hosted instances.
+
+use anyhow::Result;
+use json::JsonValue;
+use reqwest::blocking::Client;
+use reqwest::header::{HeaderMap, HeaderName, HeaderValue};
+use reqwest::Url;
+
+use super::{license_name, parse_date, Backend, Forge, ForgeProject, Page};
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::json::get_field;
+
+pub struct GitLab;
+
+impl Backend for GitLab {
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &["GITLAB_TOKEN"]
+    }
+
+    fn api_url(&self, host: &str) -> String {
+        format!("https://{host}/api/v4")
+    }
+
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::Zip, ArchiveFormat::TarGz]
+    }
+
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        id: u32,
+        _path: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url> {
+        let archive: String = format!("archive{}", format.extension());
+        let mut url: Url =
+            forge.endpoint(&["projects", &id.to_string(), "repository", &archive])?;
+        url.query_pairs_mut().append_pair("sha", commit);
+        Ok(url)
+    }
+
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()> {
+        headers.insert(
+            HeaderName::from_static("private-token"),
+            HeaderValue::from_str(token)?,
+        );
+        Ok(())
+    }
+
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page> {
+        forge.rest_page(
+            client,
+            token,
+            cursor,
+            || self.search_url(forge, query, namespace),
+            |page| page,
+        )
+    }
+
+    fn search_url(
+        &self,
+        forge: &Forge,
+        query: Option<&str>,
+        namespace: Option<&str>,
+    ) -> Result<Url> {
+        let mut url: Url = match namespace {
+            Some(ns) => forge.endpoint(&["groups", ns, "projects"])?,
+            None => forge.endpoint(&["projects"])?,
+        };
+        if namespace.is_some() {
+            url.query_pairs_mut()
+                .append_pair("include_subgroups", "true");
+        }
+        if let Some(q) = query {
+            url.query_pairs_mut().append_pair("search", q);
+        }
+        url.query_pairs_mut()
+            .append_pair("order_by", "id")
+            .append_pair("sort", "asc")
+            .append_pair("per_page", Forge::PER_PAGE);
+        Ok(url)
+    }
+
+    /// Projects are identified by their URL-encoded path, nested groups included.
+    fn project_endpoint(&self, forge: &Forge, path: &str) -> Result<Url> {
+        forge.endpoint(&["projects", path])
+    }
+
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        if item["default_branch"].is_null() {
+            return Ok(None);
+        }
+        Ok(Some((
+            ForgeProject {
+                id: get_field::<u32>(item, "id")?,
+                name: get_field::<String>(item, "path_with_namespace")?,
+                created: parse_date(item, "created_at")?,
+                pushed: parse_date(item, "last_activity_at")?,
+                fork: !item["forked_from_project"].is_null(),
+                archived: item["archived"].as_bool().unwrap_or_default(),
+                stars: item["star_count"].as_u32(),
+                forks: item["forks_count"].as_u32(),
+                // Only reported to members of the project.
+                size: item["statistics"]["repository_size"]
+                    .as_u64()
+                    .map(|s| s / 1024),
+                license: license_name(&item["license"]["name"]),
+                ..Default::default()
+            },
+            get_field::<String>(item, "default_branch")?,
+        )))
+    }
+
+    fn latest_commit(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+        branch: &str,
+    ) -> Result<String> {
+        get_field::<String>(
+            &forge.get_json(
+                client,
+                forge.endpoint(&[
+                    "projects",
+                    &project.id.to_string(),
+                    "repository",
+                    "commits",
+                    branch,
+                ])?,
+                token,
+            )?,
+            "id",
+        )
+    }
+
+    /// GitLab reports the share of every language of a project, the main language being the largest one.
+    fn main_language(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+    ) -> Result<Option<String>> {
+        let languages: JsonValue = forge.get_json(
+            client,
+            forge.endpoint(&["projects", &project.id.to_string(), "languages"])?,
+            token,
+        )?;
+        Ok(main_language(&languages))
+    }
+}
+
+/// Returns the language with the largest share in the languages reported for a project.
+fn main_language(languages: &JsonValue) -> Option<String> {
+    languages
+        .entries()
+        .filter_map(|(language, share)| share.as_f64().map(|s| (language, s)))
+        .max_by(|(_, a), (_, b)| a.total_cmp(b))
+        .map(|(language, _)| language.to_string())
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn main_languages() -> Result<()> {
+        assert_eq!(
+            main_language(&json::parse(r#"{ "Go": 80.5, "Shell": 19.5 }"#)?),
+            Some("Go".to_string())
+        );
+        assert_eq!(main_language(&json::parse("{}")?), None);
+        Ok(())
+    }
+}
@@ -0,0 +1,575 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! The Go module proxy protocol, served by proxy.golang.org and by private proxies such as Athens.
+//!
+//! Projects are Go modules: their name is the module path and their commit is a module version.
+//! Module zips contain the source tree of a version without any VCS history, and can still be fetched
+//! when the repository of the module has moved or disappeared.
+//!
+//! Import paths are resolved to modules with [`ModuleResolver`], based on the module index of the proxy
+//! and on the go-import meta tags served by the hosts of the modules.
+//! Modules can also be discovered from the Go module index with [`index_modules`].
+
+use std::collections::{HashMap, HashSet};
+
+use anyhow::{bail, Context, Result};
+use json::JsonValue;
+use regex::Regex;
+use reqwest::blocking::{Client, Response};
+use reqwest::header::HeaderMap;
+use reqwest::Url;
+use tracing::debug;
+
+use super::{Backend, Forge, ForgeProject, Page, Provider};
+use crate::utils::csv::clean_string_to_csv;
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::github::ToCSV;
+use crate::utils::throttle::wait_for_host;
+
+pub struct GoProxy;
+
+/// Escapes a module path or version as required by the proxy protocol.
+/// Upper case letters are replaced by an exclamation mark followed by the lower case letter,
+/// so that modules are served correctly from case-insensitive file systems.
+fn escape(path: &str) -> String {
+    let mut escaped: String = String::with_capacity(path.len());
+    for c in path.chars() {
+        if c.is_ascii_uppercase() {
+            escaped.push('!');
+            escaped.push(c.to_ascii_lowercase());
+        } else {
+            escaped.push(c);
+        }
+    }
+    escaped
+}
+
+/// A Go module, as resolved from an import path.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Module {
+    /// The module path (e.g. golang.org/x/tools).
+    pub path: String,
+    /// The version of the module (e.g. v0.21.0).
+    pub version: String,
+    /// The URL of the repository of the module, if known.
+    pub repository: Option<String>,
+    /// The version control system of the repository (e.g. git), if known.
+    pub vcs: Option<String>,
+    /// The commit of the version in the repository, if reported by the proxy.
+    pub commit: Option<String>,
+}
+
+impl ToCSV for Module {
+    /// The id of the module, the number of import paths resolved to it,
+    /// and the number of packages depending on it if it is known.
+    type Key = (u32, usize, Option<u64>);
+
+    fn header() -> &'static [&'static str] {
+        &[
+            "id",
+            "name",
+            "latest_commit",
+            "repository",
+            "vcs",
+            "commit",
+            "imports",
+            "dependents",
+        ]
+    }
+
+    fn to_csv(&self, (id, imports, dependents): (u32, usize, Option<u64>)) -> String {
+        format!(
+            "{id},{},{},{},{},{},{imports},{}",
+            clean_string_to_csv(&self.path),
+            clean_string_to_csv(&self.version),
+            clean_string_to_csv(self.repository.as_deref().unwrap_or_default()),
+            self.vcs.as_deref().unwrap_or_default(),
+            self.commit.as_deref().unwrap_or_default(),
+            dependents.map(|d| d.to_string()).unwrap_or_default(),
+        )
+    }
+}
+
+/// The Go module index, listing the module versions served by proxy.golang.org in the order in which they were published.
+const MODULE_INDEX: &str = "https://index.golang.org/index";
+
+/// Maximum number of versions returned by a request to the module index.
+const INDEX_PAGE_SIZE: usize = 2000;
+
+/// Parses a page of the module index, made of one JSON object per line.
+///
+/// # Returns
+///
+/// The path of the module and the publication date (RFC 3339) of every version listed.
+fn parse_index_page(page: &str) -> Result<Vec<(String, String)>> {
+    page.lines()
+        .filter(|line| !line.trim().is_empty())
+        .map(|line| {
+            let entry: JsonValue =
+                json::parse(line).with_context(|| format!("Invalid module index entry {line}"))?;
+            match (entry["Path"].as_str(), entry["Timestamp"].as_str()) {
+                (Some(path), Some(timestamp)) => Ok((path.to_string(), timestamp.to_string())),
+                _ => bail!("Invalid module index entry {line}"),
+            }
+        })
+        .collect()
+}
+
+/// Lists the modules of the Go module index having a version published since a given date.
+///
+/// # Arguments
+///
+/// * `since` - The date from which versions are listed (epoch in seconds).
+/// * `limit` - The maximum number of modules to return. If not specified, all the modules are returned.
+///
+/// # Returns
+///
+/// The paths of the modules, in the order in which their first version since the date was published.
+pub fn index_modules(since: i64, limit: Option<usize>) -> Result<Vec<String>> {
+    let client: Client = Client::new();
+    let mut cursor: String = chrono::DateTime::from_timestamp(since, 0)
+        .with_context(|| format!("Invalid date {since}"))?
+        .to_rfc3339_opts(chrono::SecondsFormat::Secs, true);
+    let mut modules: Vec<String> = Vec::new();
+    let mut seen: HashSet<String> = HashSet::new();
+    loop {
+        let mut url: Url = Url::parse(MODULE_INDEX)?;
+        url.query_pairs_mut()
+            .append_pair("since", &cursor)
+            .append_pair("limit", &INDEX_PAGE_SIZE.to_string());
+        wait_for_host(url.host_str().unwrap_or_default());
+        let page: String = client
+            .get(url.clone())
+            .send()
+            .and_then(|response| response.error_for_status())
+            .and_then(|response| response.text())
+            .with_context(|| format!("Could not read {url}"))?;
+        let entries: Vec<(String, String)> = parse_index_page(&page)?;
+        debug!("{} versions listed since {cursor}", entries.len());
+        for (path, _) in entries.iter() {
+            if limit.is_some_and(|l| modules.len() >= l) {
+                return Ok(modules);
+            }
+            if seen.insert(path.clone()) {
+                modules.push(path.clone());
+            }
+        }
+        match entries.last() {
+            // Pages start at the given date included, the last version is therefore listed again.
+            Some((_, timestamp)) if entries.len() >= INDEX_PAGE_SIZE => cursor = timestamp.clone(),
+            _ => return Ok(modules),
+        }
+    }
+}
+
+/// Returns true if an import path belongs to the standard library, whose first element does not contain a dot.
+pub fn is_standard_library(import_path: &str) -> bool {
+    !import_path
+        .split('/')
+        .next()
+        .is_some_and(|first| first.contains('.'))
+}
+
+/// Returns the deprecation notice of a module, read from its go.mod file.
+/// A module is deprecated by a paragraph starting with "Deprecated:" in the comment block right before its module directive,
+/// or in the comment at the end of the directive.
+///
+/// # Arguments
+///
+/// * `go_mod` - The content of the go.mod file.
+///
+/// # Returns
+///
+/// The message following "Deprecated:", or None if the module is not deprecated.
+pub fn deprecation(go_mod: &str) -> Option<String> {
+    let mut comments: Vec<&str> = Vec::new();
+    for line in go_mod.lines().map(str::trim) {
+        if let Some(comment) = line.strip_prefix("//") {
+            comments.push(comment.trim());
+            continue;
+        }
+        let (directive, trailing) = line.split_once("//").unwrap_or((line, ""));
+        if directive.split_whitespace().next() == Some("module") {
+            if !trailing.is_empty() {
+                comments.extend(["", trailing.trim()]);
+            }
+            return comments
+                .split(|c| c.is_empty())
+                .find_map(|paragraph| {
+                    paragraph
+                        .first()?
+                        .strip_prefix("Deprecated:")
+                        .map(|m| (m, paragraph))
+                })
+                .map(|(first, paragraph)| {
+                    std::iter::once(first.trim())
+                        .chain(paragraph[1..].iter().copied())
+                        .collect::<Vec<&str>>()
+                        .join(" ")
+                        .trim()
+                        .to_string()
+                });
+        }
+        comments.clear();
+    }
+    None
+}
+
+/// Returns the paths that may be the module of an import path, from the longest to the shortest.
+/// Module paths have at least two elements, except for some vanity import paths with a single element (e.g. gopkg.in).
+fn module_candidates(import_path: &str) -> impl Iterator<Item = &str> {
+    import_path
+        .match_indices('/')
+        .map(|(i, _)| &import_path[..i])
+        .chain(std::iter::once(import_path))
+        .rev()
+}
+
+/// Parses the go-import meta tags of the page served for `?go-get=1` requests,
+/// and returns the version control system and the URL of the repository of a module.
+///
+/// # Arguments
+///
+/// * `html` - The page served by the host of the module.
+/// * `module` - The module path.
+///
+/// # Returns
+///
+/// The version control system and the URL of the repository declared for the longest import prefix of the module, if any.
+fn parse_go_import(html: &str, module: &str) -> Option<(String, String)> {
+    let go_import: Regex =
+        Regex::new(r#"(?i)<meta\s+name\s*=\s*["']go-import["']\s+content\s*=\s*["']([^"']+)["']"#)
+            .unwrap();
+    go_import
+        .captures_iter(html)
+        .filter_map(|c| {
+            let mut fields = c[1].split_whitespace();
+            match (fields.next(), fields.next(), fields.next()) {
+                (Some(prefix), Some(vcs), Some(url))
+                    if module == prefix || module.starts_with(&format!("{prefix}/")) =>
+                {
+                    Some((prefix.len(), vcs.to_string(), url.to_string()))
+                }
+                _ => None,
+            }
+        })
+        .max_by_key(|(len, _, _)| *len)
+        .map(|(_, vcs, url)| (vcs, url))
+}
+
+/// Resolves import paths to the modules they belong to.
+///
+/// The module of an import path is its longest prefix known by the module proxy.
+/// The repository of a module is read from the go-import meta tags served by its host and,
+/// if it does not declare any, from the origin reported by the proxy.
+/// Results are cached, as many import paths usually belong to the same module.
+pub struct ModuleResolver<'a> {
+    forge: &'a Forge,
+    client: Client,
+    /// Modules by path and requested version, `None` if the path is not a module.
+    modules: HashMap<(String, Option<String>), Option<Module>>,
+}
+
+impl<'a> ModuleResolver<'a> {
+    /// Creates a resolver querying the given module proxy.
+    ///
+    /// # Arguments
+    ///
+    /// * `forge` - The module proxy.
+    pub fn new(forge: &'a Forge) -> Result<ModuleResolver<'a>> {
+        if forge.provider() != Provider::GoProxy {
+            bail!("Import paths can only be resolved with the Go module proxy, not {forge}");
+        }
+        Ok(ModuleResolver {
+            forge,
+            client: Client::new(),
+            modules: HashMap::new(),
+        })
+    }
+
+    /// Resolves an import path to its module.
+    ///
+    /// # Arguments
+    ///
+    /// * `import_path` - The import path, or the path of a module.
+    /// * `version` - The version of the module. If not specified, the latest version is used.
+    ///
+    /// # Returns
+    ///
+    /// The module of the import path, `None` if no prefix of the path is known by the proxy,
+    /// or an error if the proxy could not be reached.
+    pub fn resolve(&mut self, import_path: &str, version: Option<&str>) -> Result<Option<Module>> {
+        for candidate in module_candidates(import_path) {
+            let key = (candidate.to_string(), version.map(str::to_string));
+            let module: Option<Module> = match self.modules.get(&key) {
+                Some(module) => module.clone(),
+                None => {
+                    let module: Option<Module> = self.module(candidate, version)?;
+                    self.modules.insert(key, module.clone());
+                    module
+                }
+            };
+            if module.is_some() {
+                return Ok(module);
+            }
+        }
+        Ok(None)
+    }
+
+    /// Queries the module index of the proxy for a module path.
+    fn module(&self, path: &str, version: Option<&str>) -> Result<Option<Module>> {
+        let module: String = escape(path);
+        let mut segments: Vec<&str> = module.split('/').collect();
+        let file: String;
+        match version {
+            Some(version) => {
+                file = format!("{}.info", escape(version));
+                segments.extend(["@v", &file]);
+            }
+            None => segments.push("@latest"),
+        }
+        let url: Url = self.forge.endpoint(&segments)?;
+        let response: Response = self
+            .forge
+            .send(&self.client, &url, &self.forge.headers(None)?)?;
+        // The proxy answers 404 or 410 for paths that are not modules.
+        if matches!(response.status().as_u16(), 404 | 410) {
+            return Ok(None);
+        }
+        let info: JsonValue = Forge::parse_response(&url, response)?;
+        let origin: &JsonValue = &info["Origin"];
+        let (vcs, repository) = match self.go_import(path) {
+            Some((vcs, url)) => (Some(vcs), Some(url)),
+            None => (
+                origin["VCS"].as_str().map(str::to_string),
+                origin["URL"].as_str().map(str::to_string),
+            ),
+        };
+        Ok(Some(Module {
+            path: path.to_string(),
+            version: info["Version"]
+                .as_str()
+                .with_context(|| format!("No version reported by {url}"))?
+                .to_string(),
+            repository,
+            vcs,
+            commit: origin["Hash"].as_str().map(str::to_string),
+        }))
+    }
+
+    /// Reads the go-import meta tags served by the host of a module.
+    /// Hosts that cannot be reached are ignored, as the proxy may still know the repository.
+    fn go_import(&self, module: &str) -> Option<(String, String)> {
+        let url: Url = Url::parse(&format!("https://{module}?go-get=1")).ok()?;
+        wait_for_host(url.host_str().unwrap_or_default());
+        let html: Result<String> = self
+            .forge
+            .headers(None)
+            .and_then(|headers| Ok(self.client.get(url.clone()).headers(headers).send()?))
+            .and_then(|response| Ok(response.error_for_status()?.text()?));
+        match html {
+            Ok(html) => parse_go_import(&html, module),
+            Err(e) => {
+                debug!("Could not read the go-import meta tags of {module}: {e}");
+                None
+            }
+        }
+    }
+}
+
+impl Backend for GoProxy {
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &[]
+    }
+
+    fn anonymous(&self) -> bool {
+        true
+    }
+
+    /// Returns the first HTTPS proxy of the GOPROXY environment variable.
+    /// The `direct` and `off` keywords, as well as other schemes, are ignored.
+    fn host_from_env(&self) -> Option<String> {
+        std::env::var("GOPROXY").ok().and_then(|proxies| {
+            proxies
+                .split([',', '|'])
+                .filter_map(|proxy| proxy.trim().strip_prefix("https://"))
+                .map(|proxy| proxy.trim_end_matches('/').to_lowercase())
+                .find(|proxy| !proxy.is_empty())
+        })
+    }
+
+    fn api_url(&self, host: &str) -> String {
+        format!("https://{host}")
+    }
+
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        _id: u32,
+        path: &str,
+        version: &str,
+        _format: ArchiveFormat,
+    ) -> Result<Url> {
+        let archive: String = format!("{}.zip", escape(version));
+        let module: String = escape(path);
+        let mut segments: Vec<&str> = module.split('/').collect();
+        segments.extend(["@v", &archive]);
+        forge.endpoint(&segments)
+    }
+
+    fn clone_url(&self, _forge: &Forge, path: &str) -> Result<Url> {
+        bail!("Module {path} cannot be cloned from the Go module proxy")
+    }
+
+    fn ssh_url(&self, _forge: &Forge, path: &str) -> Result<Url> {
+        bail!("Module {path} cannot be cloned from the Go module proxy")
+    }
+
+    /// Private proxies behind an authentication are not supported.
+    fn authenticate(&self, _headers: &mut HeaderMap, _token: &str) -> Result<()> {
+        Ok(())
+    }
+
+    fn check_token(&self, _forge: &Forge, _token: &str) -> Result<()> {
+        Ok(())
+    }
+
+    fn search_page(
+        &self,
+        _forge: &Forge,
+        _client: &Client,
+        _token: &str,
+        _query: Option<&str>,
+        _namespace: Option<&str>,
+        _cursor: Option<&str>,
+    ) -> Result<Page> {
+        bail!("The Go module proxy cannot be searched")
+    }
+
+    fn parse_project(&self, _item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        bail!("The Go module proxy cannot be searched")
+    }
+
+    fn latest_commit(
+        &self,
+        _forge: &Forge,
+        _client: &Client,
+        _token: &str,
+        _project: &ForgeProject,
+        _branch: &str,
+    ) -> Result<String> {
+        bail!("The Go module proxy cannot be searched")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn deprecations() {
+        assert_eq!(
+            deprecation("// Deprecated: use example.com/mod/v2 instead.\nmodule example.com/mod\n\ngo 1.21\n"),
+            Some("use example.com/mod/v2 instead.".to_string())
+        );
+        assert_eq!(
+            deprecation("// Package mod does things.\n//\n// Deprecated: unmaintained,\n// see the README.\nmodule example.com/mod\n"),
+            Some("unmaintained, see the README.".to_string())
+        );
+        assert_eq!(
+            deprecation("module example.com/mod // Deprecated: archived\n"),
+            Some("archived".to_string())
+        );
+        assert_eq!(
+            deprecation("// Deprecated: not the module comment\n\nmodule example.com/mod\n"),
+            None
+        );
+        assert_eq!(deprecation("module example.com/mod\n\ngo 1.21\n"), None);
+    }
+
+    #[test]
+    fn module_paths() {
+        assert_eq!(
+            module_candidates("golang.org/x/tools/go/packages").collect::<Vec<&str>>(),
+            vec![
+                "golang.org/x/tools/go/packages",
+                "golang.org/x/tools/go",
+                "golang.org/x/tools",
+                "golang.org/x",
+                "golang.org"
+            ]
+        );
+        assert!(is_standard_library("net/http"));
+        assert!(is_standard_library("fmt"));
+        assert!(!is_standard_library("gopkg.in/yaml.v3"));
+    }
+
+    #[test]
+    fn go_import_tags() {
+        let html = r#"<html><head>
+            <meta name="go-import" content="golang.org/x/tools git https://go.googlesource.com/tools">
+            <meta name="go-import" content="golang.org/x/tools/gopls git https://go.googlesource.com/tools-gopls">
+            <meta name="go-source" content="golang.org/x/tools https://github.com/golang/tools/">
+            </head></html>"#;
+        assert_eq!(
+            parse_go_import(html, "golang.org/x/tools"),
+            Some((
+                "git".to_string(),
+                "https://go.googlesource.com/tools".to_string()
+            ))
+        );
+        assert_eq!(
+            parse_go_import(html, "golang.org/x/tools/gopls"),
+            Some((
+                "git".to_string(),
+                "https://go.googlesource.com/tools-gopls".to_string()
+            ))
+        );
+        assert_eq!(parse_go_import(html, "golang.org/x/toolsx"), None);
+    }
+
+    #[test]
+    fn index_pages() -> Result<()> {
+        let page = r#"{"Path":"golang.org/x/text","Version":"v0.3.0","Timestamp":"2019-04-10T19:08:52.997264Z"}
+{"Path":"github.com/spf13/cobra","Version":"v1.8.0","Timestamp":"2019-04-10T19:10:00Z"}
+"#;
+        assert_eq!(
+            parse_index_page(page)?,
+            vec![
+                (
+                    "golang.org/x/text".to_string(),
+                    "2019-04-10T19:08:52.997264Z".to_string()
+                ),
+                (
+                    "github.com/spf13/cobra".to_string(),
+                    "2019-04-10T19:10:00Z".to_string()
+                ),
+            ]
+        );
+        assert!(parse_index_page(r#"{"Version":"v1.0.0"}"#).is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn escape_paths() {
+        assert_eq!(escape("golang.org/x/tools"), "golang.org/x/tools");
+        assert_eq!(
+            escape("github.com/BurntSushi/toml"),
+            "github.com/!burnt!sushi/toml"
+        );
+        assert_eq!(escape("v1.0.0-RC1"), "v1.0.0-!r!c1");
+    }
+}
@@ -0,0 +1,1231 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Code hosting platforms (forges) from which repositories can be searched and downloaded.
+//!
+//! Every provider is implemented as a [`Backend`] in its own module.
+//! Supporting a new provider amounts to implementing this trait and registering it in [`Provider`].
+
+mod bitbucket;
+mod gitea;
+mod github;
+mod gitlab;
+mod goproxy;
+mod sourcehut;
+
+pub use goproxy::{deprecation, index_modules, is_standard_library, Module, ModuleResolver};
+
+use std::fmt::Display;
+use std::str::FromStr;
+use std::thread::sleep;
+use std::time::Duration;
+
+use anyhow::{bail, ensure, Context, Result};
+use json::JsonValue;
+use reqwest::blocking::{Client, RequestBuilder, Response};
+use reqwest::header::{HeaderMap, HeaderValue, CONTENT_TYPE, LINK, USER_AGENT};
+use reqwest::Url;
+use tracing::warn;
+
+use crate::utils::audit;
+use crate::utils::csv::{clean_string_to_csv, CSVFile};
+use crate::utils::fs::{ArchiveFormat, FileMode};
+use crate::utils::github::{rate_limit_delay, ToCSV};
+use crate::utils::json::get_field;
+use crate::utils::logger::Logger;
+use crate::utils::throttle::wait_for_host;
+
+/// Code hosting platforms supported by Scyros.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum Provider {
+    GitHub,
+    GitLab,
+    Bitbucket,
+    Gitea,
+    Forgejo,
+    SourceHut,
+    /// The Go module proxy, serving the source of Go modules by module path and version.
+    GoProxy,
+}
+
+impl Provider {
+    /// Names of the providers, as accepted on the command line.
+    pub const NAMES: [&'static str; 7] = [
+        "github",
+        "gitlab",
+        "bitbucket",
+        "gitea",
+        "forgejo",
+        "sourcehut",
+        "goproxy",
+    ];
+
+    /// Returns the name of the provider, as accepted on the command line.
+    pub fn name(&self) -> &'static str {
+        match self {
+            Provider::GitHub => "github",
+            Provider::GitLab => "gitlab",
+            Provider::Bitbucket => "bitbucket",
+            Provider::Gitea => "gitea",
+            Provider::Forgejo => "forgejo",
+            Provider::SourceHut => "sourcehut",
+            Provider::GoProxy => "goproxy",
+        }
+    }
+
+    /// Returns the host of the public instance of the provider.
+    pub fn default_host(&self) -> &'static str {
+        match self {
+            Provider::GitHub => "github.com",
+            Provider::GitLab => "gitlab.com",
+            Provider::Bitbucket => "bitbucket.org",
+            Provider::Gitea => "gitea.com",
+            Provider::Forgejo => "codeberg.org",
+            Provider::SourceHut => "git.sr.ht",
+            Provider::GoProxy => "proxy.golang.org",
+        }
+    }
+
+    /// Returns the environment variables from which a token is read when no token file is provided, in order of precedence.
+    pub fn token_env_vars(&self) -> &'static [&'static str] {
+        self.backend().token_env_vars()
+    }
+
+    /// Returns the implementation of the API of the provider.
+    fn backend(&self) -> &'static dyn Backend {
+        match self {
+            Provider::GitHub => &github::GitHub,
+            Provider::GitLab => &gitlab::GitLab,
+            Provider::Bitbucket => &bitbucket::Bitbucket,
+            // Forgejo is a fork of Gitea and kept its API.
+            Provider::Gitea | Provider::Forgejo => &gitea::Gitea,
+            Provider::SourceHut => &sourcehut::SourceHut,
+            Provider::GoProxy => &goproxy::GoProxy,
+        }
+    }
+
+    /// Guesses the provider serving a host from its name.
+    ///
+    /// # Arguments
+    ///
+    /// * `host` - The host name, e.g. `gitlab.example.com`.
+    ///
+    /// # Returns
+    ///
+    /// The provider, or `None` if the host cannot be attributed to any provider.
+    fn from_host(host: &str) -> Option<Provider> {
+        let host: String = host.to_lowercase();
+        let labels: Vec<&str> = host.split('.').collect();
+        if host == "github.com" || host.ends_with(".github.com") {
+            Some(Provider::GitHub)
+        } else if host == "bitbucket.org" {
+            Some(Provider::Bitbucket)
+        } else if host == "codeberg.org" || labels.contains(&"forgejo") {
+            Some(Provider::Forgejo)
+        } else if host == "sr.ht" || host.ends_with(".sr.ht") {
+            Some(Provider::SourceHut)
+        } else if host == "proxy.golang.org" {
+            Some(Provider::GoProxy)
+        } else if labels.contains(&"gitlab") {
+            Some(Provider::GitLab)
+        } else if labels.contains(&"gitea") {
+            Some(Provider::Gitea)
+        } else {
+            None
+        }
+    }
+}
+
+impl FromStr for Provider {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.to_lowercase().as_str() {
+            "github" => Ok(Provider::GitHub),
+            "gitlab" => Ok(Provider::GitLab),
+            "bitbucket" => Ok(Provider::Bitbucket),
+            "gitea" => Ok(Provider::Gitea),
+            "forgejo" | "codeberg" => Ok(Provider::Forgejo),
+            "sourcehut" | "srht" => Ok(Provider::SourceHut),
+            "goproxy" => Ok(Provider::GoProxy),
+            _ => bail!(
+                "Unknown provider {s}, expected one of {}",
+                Provider::NAMES.join(", ")
+            ),
+        }
+    }
+}
+
+impl Display for Provider {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{}", self.name())
+    }
+}
+
+/// A project found on a forge, along with the metadata reported by the forge.
+/// Metadata that the forge does not report are left empty.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct ForgeProject {
+    /// The id of the project on the forge.
+    pub id: u32,
+    /// The full name of the project (namespace/name).
+    pub name: String,
+    /// The hash of the latest commit on the default branch.
+    pub latest_commit: String,
+    /// The main language of the project.
+    pub language: String,
+    /// The creation date of the project (epoch in seconds).
+    pub created: i64,
+    /// The date of the last push or activity on the project (epoch in seconds).
+    pub pushed: i64,
+    /// Whether the project is a fork.
+    pub fork: bool,
+    /// Whether the project is archived.
+    pub archived: bool,
+    /// The number of stars of the project.
+    pub stars: Option<u32>,
+    /// The number of forks of the project.
+    pub forks: Option<u32>,
+    /// The size of the project in kilobytes.
+    pub size: Option<u64>,
+    /// The name of the license of the project, "unknown" if not reported.
+    pub license: String,
+    /// The name of the default branch of the project.
+    pub default_branch: String,
+}
+
+impl ToCSV for ForgeProject {
+    type Key = ();
+
+    fn header() -> &'static [&'static str] {
+        &[
+            "id",
+            "name",
+            "latest_commit",
+            "language",
+            "created",
+            "pushed",
+            "fork",
+            "archived",
+            "stars",
+            "forks",
+            "size",
+            "license",
+            "default_branch",
+        ]
+    }
+
+    fn to_csv(&self, _key: ()) -> String {
+        fn opt<T: ToString>(value: &Option<T>) -> String {
+            value.as_ref().map(|v| v.to_string()).unwrap_or_default()
+        }
+        format!(
+            "{},{},{},{},{},{},{},{},{},{},{},{},{}",
+            self.id,
+            clean_string_to_csv(&self.name),
+            self.latest_commit,
+            clean_string_to_csv(&self.language),
+            self.created,
+            self.pushed,
+            self.fork,
+            self.archived,
+            opt(&self.stars),
+            opt(&self.forks),
+            opt(&self.size),
+            clean_string_to_csv(&self.license),
+            clean_string_to_csv(&self.default_branch),
+        )
+    }
+}
+
+/// Parses a date time field of a JSON object and returns its epoch representation.
+/// Forges do not agree on the precision of their timestamps, all RFC 3339 dates are therefore accepted.
+///
+/// # Arguments
+///
+/// * `json` - The JSON object to parse.
+/// * `field` - The field name containing the date time string.
+fn parse_date(json: &JsonValue, field: &str) -> Result<i64> {
+    let date: String = get_field::<String>(json, field)?;
+    Ok(chrono::DateTime::parse_from_rfc3339(&date)
+        .with_context(|| format!("Could not parse date {date}"))?
+        .timestamp())
+}
+
+/// Returns the name of a license, or "unknown" if the forge did not report any.
+fn license_name(name: &JsonValue) -> String {
+    name.as_str()
+        .map(|n| n.to_string())
+        .unwrap_or_else(|| "unknown".to_string())
+}
+
+/// A page of search results.
+struct Page {
+    /// The projects of the page, as returned by the forge.
+    items: Vec<JsonValue>,
+    /// The cursor to the next page, or `None` if this is the last page.
+    /// For REST APIs, the cursor is the URL of the next page.
+    next: Option<String>,
+}
+
+/// The API of a provider.
+///
+/// Backends only describe the endpoints and the JSON documents of the provider;
+/// sending requests, waiting for rate limits and paginating is handled by [`Forge`].
+trait Backend: Sync {
+    /// Environment variables from which a token is read, in order of precedence.
+    fn token_env_vars(&self) -> &'static [&'static str];
+
+    /// Whether the provider can be used without any token.
+    fn anonymous(&self) -> bool {
+        false
+    }
+
+    /// Host configured in the environment, used instead of the public instance when no host is given.
+    fn host_from_env(&self) -> Option<String> {
+        None
+    }
+
+    /// Base URL of the API of an instance of the provider.
+    fn api_url(&self, host: &str) -> String;
+
+    /// Formats of the archives served by the provider, the default one first.
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::Zip]
+    }
+
+    /// URL of the archive of a project at a given commit, in one of the formats served by the provider.
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        id: u32,
+        path: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url>;
+
+    /// URL from which a project can be cloned with git.
+    fn clone_url(&self, forge: &Forge, path: &str) -> Result<Url> {
+        Ok(Url::parse(&format!("https://{}/{path}.git", forge.host()))?)
+    }
+
+    /// URL from which a project can be cloned with git over SSH, authenticated with the SSH keys of the user.
+    fn ssh_url(&self, forge: &Forge, path: &str) -> Result<Url> {
+        Ok(Url::parse(&format!(
+            "ssh://git@{}/{path}.git",
+            forge.host()
+        ))?)
+    }
+
+    /// Adds the authentication headers of a token to a request.
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()>;
+
+    /// Checks that a token is accepted by the provider.
+    fn check_token(&self, forge: &Forge, token: &str) -> Result<()> {
+        forge
+            .get_json(&Client::new(), forge.endpoint(&["user"])?, token)
+            .map(|_| ())
+    }
+
+    /// Fetches a page of projects matching a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `forge` - The instance of the provider.
+    /// * `client` - The HTTP client to use.
+    /// * `token` - The token used for authentication.
+    /// * `query` - The search query, if any.
+    /// * `namespace` - The namespace the search is restricted to, if any.
+    /// * `cursor` - The cursor returned with the previous page, or `None` for the first page.
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page>;
+
+    /// URL of the first page of the results of a search, for the providers with a REST search API.
+    fn search_url(
+        &self,
+        forge: &Forge,
+        _query: Option<&str>,
+        _namespace: Option<&str>,
+    ) -> Result<Url> {
+        bail!("{forge} cannot be searched with a REST endpoint")
+    }
+
+    /// Endpoint returning a project from its path (namespace/name), in the same format as the search results.
+    fn project_endpoint(&self, forge: &Forge, path: &str) -> Result<Url> {
+        bail!("Projects cannot be looked up by name on {forge} ({path})")
+    }
+
+    /// Parses a project from a search result.
+    ///
+    /// # Returns
+    ///
+    /// The project and the name of its default branch, or `None` if the project is empty and has no default branch.
+    /// If the latest commit is not part of the search result, it is left empty and resolved with [`Backend::latest_commit`].
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>>;
+
+    /// Returns the hash of the latest commit on a branch of a project.
+    fn latest_commit(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        project: &ForgeProject,
+        branch: &str,
+    ) -> Result<String>;
+
+    /// Returns the main language of a project, for the providers that do not report it along with the project.
+    fn main_language(
+        &self,
+        _forge: &Forge,
+        _client: &Client,
+        _token: &str,
+        _project: &ForgeProject,
+    ) -> Result<Option<String>> {
+        Ok(None)
+    }
+}
+
+/// An instance of a provider, e.g. gitlab.com or a self-hosted GitLab server.
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+pub struct Forge {
+    provider: Provider,
+    host: String,
+}
+
+impl Forge {
+    /// Number of results requested per page when listing projects.
+    const PER_PAGE: &'static str = "100";
+
+    /// Maximum number of attempts when a request cannot be sent.
+    const MAX_RETRIES: usize = 5;
+
+    /// Creates a new forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `provider` - The provider of the forge.
+    /// * `host` - The host of the forge. If not specified, the host configured in the environment
+    ///   (GOPROXY for the Go module proxy) or the public instance of the provider is used.
+    pub fn new(provider: Provider, host: Option<&str>) -> Forge {
+        Forge {
+            provider,
+            host: host
+                .map(|h| h.trim_end_matches('/').to_lowercase())
+                .or_else(|| provider.backend().host_from_env())
+                .unwrap_or_else(|| provider.default_host().to_string()),
+        }
+    }
+
+    /// Returns the path of a project (namespace/name) from its name, stripping the URL or the provider prefix if any,
+    /// as well as the subtrees selected in the name (see [`Forge::subtrees`]).
+    ///
+    /// # Arguments
+    ///
+    /// * `name` - The name of the project, as accepted by [`Forge::detect`].
+    pub fn project_path(name: &str) -> &str {
+        let path: &str = match name.split_once("://") {
+            Some((_, rest)) => rest.split_once('/').map_or("", |(_, path)| path),
+            None => match name.split_once(':') {
+                Some((prefix, path)) if prefix.parse::<Provider>().is_ok() => path,
+                _ => name,
+            },
+        };
+        let path: &str = path.split_once("//").map_or(path, |(path, _)| path);
+        path.trim_matches('/').trim_end_matches(".git")
+    }
+
+    /// Returns the subtrees of a project selected in its name, after a double slash and separated by semicolons
+    /// (e.g. `kubernetes/kubernetes//staging/;cmd/kubectl`).
+    ///
+    /// # Arguments
+    ///
+    /// * `name` - The name of the project, as accepted by [`Forge::detect`].
+    ///
+    /// # Returns
+    ///
+    /// The path prefixes of the subtrees, relative to the root of the project, or no prefix if the whole project is selected.
+    pub fn subtrees(name: &str) -> Vec<&str> {
+        let path: &str = name.split_once("://").map_or(name, |(_, rest)| rest);
+        path.split_once("//")
+            .map(|(_, subtrees)| {
+                subtrees
+                    .split(';')
+                    .map(|s| s.trim().trim_matches('/'))
+                    .filter(|s| !s.is_empty())
+                    .collect()
+            })
+            .unwrap_or_default()
+    }
+
+    /// Detects the forge hosting a project from its name.
+    ///
+    /// The name can either be prefixed with the name of a provider (`gitlab:group/project`)
+    /// or be the URL of the project (`https://gitlab.example.com/group/project`).
+    /// Plain names (`owner/project`) do not carry any information on the forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `name` - The name of the project.
+    ///
+    /// # Returns
+    ///
+    /// The forge hosting the project, or `None` if it cannot be detected.
+    pub fn detect(name: &str) -> Option<Forge> {
+        if let Some((scheme, rest)) = name.split_once("://") {
+            if scheme != "http" && scheme != "https" {
+                return None;
+            }
+            let host: &str = rest.split('/').next()?;
+            Provider::from_host(host).map(|p| Forge::new(p, Some(host)))
+        } else if let Some((prefix, _)) = name.split_once(':') {
+            prefix.parse::<Provider>().ok().map(|p| Forge::new(p, None))
+        } else {
+            None
+        }
+    }
+
+    /// Returns the provider of the forge.
+    pub fn provider(&self) -> Provider {
+        self.provider
+    }
+
+    /// Returns the host of the forge.
+    pub fn host(&self) -> &str {
+        &self.host
+    }
+
+    /// Returns the base URL of the API of the forge.
+    pub fn api_url(&self) -> String {
+        self.provider.backend().api_url(&self.host)
+    }
+
+    /// Builds the URL of an API endpoint from its path segments.
+    /// Segments are percent-encoded, so that branch names or project paths containing slashes can be used as is.
+    fn endpoint(&self, segments: &[&str]) -> Result<Url> {
+        let mut url: Url = Url::parse(&self.api_url())?;
+        url.path_segments_mut()
+            .map_err(|_| anyhow::anyhow!("Invalid API URL {}", self.api_url()))?
+            .pop_if_empty()
+            .extend(segments);
+        Ok(url)
+    }
+
+    /// Returns the format of the archives downloaded from the forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `preferred` - The format requested by the user, if any. Otherwise, the default format of the provider is used.
+    ///
+    /// # Returns
+    ///
+    /// The format, or an error if the forge does not serve archives in the preferred format.
+    pub fn archive_format(&self, preferred: Option<ArchiveFormat>) -> Result<ArchiveFormat> {
+        let formats: &[ArchiveFormat] = self.provider.backend().archive_formats();
+        match preferred {
+            Some(format) if formats.contains(&format) => Ok(format),
+            Some(format) => bail!(
+                "{} does not serve {} archives",
+                self.provider,
+                format.extension()
+            ),
+            None => Ok(formats[0]),
+        }
+    }
+
+    /// Returns the URL of the archive of a project at a given commit.
+    ///
+    /// # Arguments
+    ///
+    /// * `id` - The id of the project on the forge.
+    /// * `name` - The name of the project.
+    /// * `commit` - The hash of the commit to download.
+    /// * `format` - The format of the archive, as returned by [`Forge::archive_format`].
+    pub fn archive_url(
+        &self,
+        id: u32,
+        name: &str,
+        commit: &str,
+        format: ArchiveFormat,
+    ) -> Result<Url> {
+        self.provider
+            .backend()
+            .archive_url(self, id, Forge::project_path(name), commit, format)
+    }
+
+    /// Returns the URL from which a project can be cloned with git.
+    ///
+    /// # Arguments
+    ///
+    /// * `name` - The name of the project.
+    pub fn clone_url(&self, name: &str) -> Result<Url> {
+        self.provider
+            .backend()
+            .clone_url(self, Forge::project_path(name))
+    }
+
+    /// Returns the URL from which a project can be cloned with git over SSH.
+    ///
+    /// # Arguments
+    ///
+    /// * `name` - The name of the project.
+    pub fn ssh_url(&self, name: &str) -> Result<Url> {
+        self.provider
+            .backend()
+            .ssh_url(self, Forge::project_path(name))
+    }
+
+    /// Returns the headers to attach to every request sent to the forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `token` - The token used for authentication, if any.
+    pub fn headers(&self, token: Option<&str>) -> Result<HeaderMap> {
+        let mut headers: HeaderMap = HeaderMap::new();
+        headers.insert(USER_AGENT, HeaderValue::from_static("Scyros"));
+        if let Some(token) = token {
+            self.provider.backend().authenticate(&mut headers, token)?;
+        }
+        Ok(headers)
+    }
+
+    /// Checks that a token is accepted by the forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `token` - The token to check.
+    ///
+    /// # Returns
+    ///
+    /// An error if the request could not be sent or if the forge rejected the token.
+    pub fn check_token(&self, token: &str) -> Result<()> {
+        self.provider.backend().check_token(self, token)
+    }
+
+    /// Returns the first token found in the environment variables of the provider.
+    /// Empty variables are ignored.
+    pub fn token_from_env(&self) -> Option<String> {
+        self.provider
+            .token_env_vars()
+            .iter()
+            .filter_map(|var| std::env::var(var).ok())
+            .map(|token| token.trim().to_string())
+            .find(|token| !token.is_empty())
+    }
+
+    /// Loads and checks the tokens used to query the forge.
+    ///
+    /// # Arguments
+    ///
+    /// * `tokens_file` - Path to a CSV file with a column 'token'. If not specified, the token is read from the environment,
+    ///   unless the provider can be used anonymously.
+    /// * `logger` - The logger displaying the progress.
+    ///
+    /// # Returns
+    ///
+    /// The list of tokens, or an error if no valid token could be found.
+    pub fn load_tokens(&self, tokens_file: Option<&str>, logger: &Logger) -> Result<Vec<String>> {
+        match (tokens_file, self.provider) {
+            // A single empty token, so that one download thread is spawned.
+            (None, _) if self.provider.backend().anonymous() => Ok(vec![String::new()]),
+            // GitHub token files are checked by the logger.
+            (Some(file), Provider::GitHub) if self.host == "github.com" => logger.log_tokens(file),
+            (Some(file), _) => logger.run_task("Loading tokens", || {
+                let tokens: Vec<String> = CSVFile::new(file, FileMode::Read)?.column(0)?;
+                ensure!(!tokens.is_empty(), "Token file is empty");
+                for (i, token) in tokens.iter().enumerate() {
+                    self.check_token(token)
+                        .with_context(|| format!("Token in line {} is invalid", i + 2))?;
+                }
+                Ok(tokens)
+            }),
+            (None, _) => logger.run_task("Loading token from the environment", || {
+                let token: String = self.token_from_env().with_context(|| {
+                    format!(
+                        "No token file provided and none of the environment variables {} is set",
+                        self.provider.token_env_vars().join(", ")
+                    )
+                })?;
+                self.check_token(&token)
+                    .context("The token from the environment is invalid")?;
+                Ok(vec![token])
+            }),
+        }
+    }
+
+    /// Sends a GET request to the forge.
+    ///
+    /// Requests that cannot be sent are retried with an exponential backoff.
+    /// Rate limited requests are sent again once the quota is restored;
+    /// waiting for the rate limit does not count as a failed attempt.
+    ///
+    /// # Arguments
+    ///
+    /// * `client` - The HTTP client to use.
+    /// * `url` - The URL to request.
+    /// * `headers` - The headers of the request.
+    ///
+    /// # Returns
+    ///
+    /// The first response that is not rate limited, whatever its status code,
+    /// or an error if the request could not be sent after the maximum number of retries.
+    pub fn send(&self, client: &Client, url: &Url, headers: &HeaderMap) -> Result<Response> {
+        self.send_request(url, || client.get(url.clone()).headers(headers.clone()))
+    }
+
+    /// Sends a request to the forge, with the same retry policy as [`Forge::send`].
+    ///
+    /// # Arguments
+    ///
+    /// * `url` - The URL of the request, used in error messages.
+    /// * `request` - Function building the request to send.
+    fn send_request(&self, url: &Url, request: impl Fn() -> RequestBuilder) -> Result<Response> {
+        fn retry_delay(attempt: usize) -> Duration {
+            // exp backoff: 250ms, 500ms, 1s, 2s, 4s ...
+            let base_ms: u64 = 250u64.saturating_mul(1u64 << attempt.min(Forge::MAX_RETRIES));
+            Duration::from_millis(base_ms)
+        }
+
+        let mut attempts: usize = 0;
+        loop {
+            wait_for_host(url.host_str().unwrap_or_default());
+            let sent: reqwest::Result<Response> = request().send();
+            audit::record(
+                "request",
+                match &sent {
+                    Ok(response) => json::object! {
+                        url: audit::redact(url),
+                        status: response.status().as_u16(),
+                    },
+                    Err(e) => json::object! { url: audit::redact(url), error: e.to_string() },
+                },
+            )?;
+            match sent {
+                Ok(response) => {
+                    match rate_limit_delay(
+                        response.status().as_u16(),
+                        response.headers(),
+                        chrono::Utc::now().timestamp(),
+                    ) {
+                        Some(delay) => {
+                            warn!(
+                                "Rate limit reached on {}, waiting {} seconds",
+                                self.host,
+                                delay.as_secs()
+                            );
+                            sleep(delay);
+                        }
+                        None => return Ok(response),
+                    }
+                }
+                Err(e) => {
+                    attempts += 1;
+                    if attempts < Forge::MAX_RETRIES {
+                        // Wait before retrying
+                        sleep(retry_delay(attempts));
+                    } else {
+                        return Err(e).with_context(|| {
+                            format!(
+                                "Could not send request {url}, maximum number of retries reached"
+                            )
+                        });
+                    }
+                }
+            }
+        }
+    }
+
+    /// Parses the JSON body of a successful response.
+    fn parse_response(url: &Url, response: Response) -> Result<JsonValue> {
+        let status = response.status();
+        ensure!(
+            status.is_success(),
+            "Request {url} failed with response code {}",
+            status.as_u16()
+        );
+        let body: String = response.text()?;
+        json::parse(&body).with_context(|| format!("Cannot parse json result of {url}"))
+    }
+
+    /// Sends an authenticated GET request to the forge and parses the JSON response.
+    ///
+    /// # Returns
+    ///
+    /// The body of the response and the URL of the next page of results, if any.
+    fn get_json_page(
+        &self,
+        client: &Client,
+        url: Url,
+        token: &str,
+    ) -> Result<(JsonValue, Option<Url>)> {
+        let response: Response = self.send(client, &url, &self.headers(Some(token))?)?;
+        let link: Option<Url> = next_page(response.headers());
+        let json: JsonValue = Forge::parse_response(&url, response)?;
+        // Some forges put the URL of the next page in the body of the response.
+        let next: Option<Url> =
+            link.or_else(|| json["next"].as_str().and_then(|n| Url::parse(n).ok()));
+        Ok((json, next))
+    }
+
+    /// Sends an authenticated GET request to the forge and parses the JSON response.
+    fn get_json(&self, client: &Client, url: Url, token: &str) -> Result<JsonValue> {
+        self.get_json_page(client, url, token).map(|(json, _)| json)
+    }
+
+    /// Sends an authenticated POST request with a JSON body to the forge and parses the JSON response.
+    fn post_json(
+        &self,
+        client: &Client,
+        url: Url,
+        token: &str,
+        body: &JsonValue,
+    ) -> Result<JsonValue> {
+        let mut headers: HeaderMap = self.headers(Some(token))?;
+        headers.insert(CONTENT_TYPE, HeaderValue::from_static("application/json"));
+        let body: String = body.dump();
+        let response: Response = self.send_request(&url, || {
+            client
+                .post(url.clone())
+                .headers(headers.clone())
+                .body(body.clone())
+        })?;
+        Forge::parse_response(&url, response)
+    }
+
+    /// Fetches a page of a paginated REST endpoint.
+    ///
+    /// # Arguments
+    ///
+    /// * `client` - The HTTP client to use.
+    /// * `token` - The token used for authentication.
+    /// * `cursor` - The URL of the page, or `None` for the first page.
+    /// * `first` - Function building the URL of the first page.
+    /// * `items` - Function extracting the projects from the body of the response.
+    fn rest_page(
+        &self,
+        client: &Client,
+        token: &str,
+        cursor: Option<&str>,
+        first: impl FnOnce() -> Result<Url>,
+        items: impl FnOnce(&JsonValue) -> &JsonValue,
+    ) -> Result<Page> {
+        let url: Url = match cursor {
+            Some(c) => Url::parse(c)?,
+            None => first()?,
+        };
+        let (page, next) = self.get_json_page(client, url, token)?;
+        Ok(Page {
+            items: items(&page).members().cloned().collect(),
+            next: next.map(|u| u.to_string()),
+        })
+    }
+
+    /// Returns the latest commit of a branch of a project.
+    ///
+    /// # Arguments
+    ///
+    /// * `token` - The token used for authentication.
+    /// * `id` - The id of the project on the forge.
+    /// * `name` - The name of the project, as accepted by [`Forge::project_path`].
+    /// * `branch` - The name of the branch.
+    ///
+    /// # Returns
+    ///
+    /// The hash of the latest commit of the branch, or an error if the branch does not exist
+    /// or if the forge cannot resolve branches.
+    pub fn branch_commit(&self, token: &str, id: u32, name: &str, branch: &str) -> Result<String> {
+        let client: Client = Client::builder()
+            .connect_timeout(Duration::from_secs(10))
+            .build()?;
+        let project: ForgeProject = ForgeProject {
+            id,
+            name: Forge::project_path(name).to_string(),
+            ..Default::default()
+        };
+        let commit: String = self
+            .provider
+            .backend()
+            .latest_commit(self, &client, token, &project, branch)?;
+        ensure!(
+            !commit.is_empty(),
+            "Branches cannot be resolved on {}",
+            self.provider
+        );
+        Ok(commit)
+    }
+
+    /// Completes a project parsed by the backend with its default branch and, if they are not known yet,
+    /// its latest commit and its main language.
+    fn complete(
+        &self,
+        client: &Client,
+        token: &str,
+        mut project: ForgeProject,
+        branch: String,
+    ) -> Result<ForgeProject> {
+        if project.latest_commit.is_empty() {
+            project.latest_commit = self
+                .provider
+                .backend()
+                .latest_commit(self, client, token, &project, &branch)?;
+        }
+        if project.language.is_empty() {
+            if let Some(language) = self
+                .provider
+                .backend()
+                .main_language(self, client, token, &project)?
+            {
+                project.language = language;
+            }
+        }
+        project.default_branch = branch;
+        Ok(project)
+    }
+
+    /// Looks up a project from its name and resolves the latest commit of its default branch.
+    ///
+    /// # Arguments
+    ///
+    /// * `token` - The token used for authentication.
+    /// * `name` - The name of the project, as accepted by [`Forge::project_path`].
+    ///
+    /// # Returns
+    ///
+    /// The project, `None` if it does not exist or is empty, or an error if a request failed.
+    pub fn project(&self, token: &str, name: &str) -> Result<Option<ForgeProject>> {
+        let backend: &dyn Backend = self.provider.backend();
+        let client: Client = Client::builder()
+            .connect_timeout(Duration::from_secs(10))
+            .build()?;
+        let url: Url = backend.project_endpoint(self, Forge::project_path(name))?;
+        let response: Response = self.send(&client, &url, &self.headers(Some(token))?)?;
+        if response.status().as_u16() == 404 {
+            return Ok(None);
+        }
+        match backend.parse_project(&Forge::parse_response(&url, response)?)? {
+            Some((project, branch)) => Ok(Some(self.complete(&client, token, project, branch)?)),
+            None => Ok(None),
+        }
+    }
+
+    /// Returns the URL of the first page of the results of a search.
+    ///
+    /// # Arguments
+    ///
+    /// * `query` - The search query, in the syntax of the forge.
+    /// * `namespace` - The user, organization, group or workspace the search is restricted to, if any.
+    ///
+    /// # Returns
+    ///
+    /// The URL, or an error if the forge has no REST search endpoint.
+    pub fn search_url(&self, query: Option<&str>, namespace: Option<&str>) -> Result<Url> {
+        self.provider.backend().search_url(self, query, namespace)
+    }
+
+    /// Searches the forge for projects matching a query and resolves the latest commit of their default branch.
+    /// Results are fetched page by page until the forge has no more results or the limit is reached.
+    /// Empty projects, which have no default branch, are skipped.
+    ///
+    /// # Arguments
+    ///
+    /// * `token` - The token used for authentication.
+    /// * `query` - The search query, in the syntax of the forge. If not specified, all the projects of the namespace are returned.
+    /// * `namespace` - The user, organization, group or workspace the search is restricted to, if any.
+    /// * `limit` - The maximum number of projects to return. If not specified, all results are returned.
+    /// * `on_project` - Function called on every project found.
+    ///
+    /// # Returns
+    ///
+    /// The number of projects found, or an error if a request failed.
+    pub fn search(
+        &self,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        limit: Option<usize>,
+        mut on_project: impl FnMut(ForgeProject) -> Result<()>,
+    ) -> Result<usize> {
+        ensure!(
+            query.is_some() || namespace.is_some(),
+            "Either a query or a namespace must be specified"
+        );
+
+        let backend: &dyn Backend = self.provider.backend();
+        let client: Client = Client::builder()
+            .connect_timeout(Duration::from_secs(10))
+            .build()?;
+
+        let mut found: usize = 0;
+        let mut cursor: Option<String> = None;
+        loop {
+            let page: Page =
+                backend.search_page(self, &client, token, query, namespace, cursor.as_deref())?;
+            for item in page.items.iter() {
+                if limit.is_some_and(|l| found >= l) {
+                    return Ok(found);
+                }
+                if let Some((project, branch)) = backend.parse_project(item)? {
+                    on_project(self.complete(&client, token, project, branch)?)?;
+                    found += 1;
+                }
+            }
+            match page.next {
+                Some(next) => cursor = Some(next),
+                None => return Ok(found),
+            }
+        }
+    }
+}
+
+impl Display for Forge {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{} ({})", self.host, self.provider)
+    }
+}
+
+/// Extracts the URL of the next page of results from the `link` header of a response.
+///
+/// # Arguments
+///
+/// * `headers` - The headers of the response.
+///
+/// # Returns
+///
+/// The URL of the next page, or `None` if the response is the last page.
+pub fn next_page(headers: &HeaderMap) -> Option<Url> {
+    headers
+        .get(LINK)
+        .and_then(|v| v.to_str().ok())?
+        .split(',')
+        .filter_map(|link| link.split_once(';'))
+        .find(|(_, params)| {
+            params
+                .split(';')
+                .any(|p| p.trim().replace(' ', "") == "rel=\"next\"")
+        })
+        .and_then(|(url, _)| {
+            Url::parse(url.trim().trim_start_matches('<').trim_end_matches('>')).ok()
+        })
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn provider_names() -> Result<()> {
+        for name in Provider::NAMES {
+            assert_eq!(name.parse::<Provider>()?.name(), name);
+        }
+        ensure!("GitLab".parse::<Provider>()? == Provider::GitLab);
+        ensure!("codeberg".parse::<Provider>()? == Provider::Forgejo);
+        ensure!("sourceforge".parse::<Provider>().is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn detect_forge() {
+        assert_eq!(Forge::detect("fxpl/scyros"), None);
+        assert_eq!(
+            Forge::detect("gitlab:group/project"),
+            Some(Forge::new(Provider::GitLab, None))
+        );
+        assert_eq!(
+            Forge::detect("https://gitlab.example.org/group/sub/project"),
+            Some(Forge::new(Provider::GitLab, Some("gitlab.example.org")))
+        );
+        assert_eq!(
+            Forge::detect("https://github.com/fxpl/scyros"),
+            Some(Forge::new(Provider::GitHub, None))
+        );
+        assert_eq!(
+            Forge::detect("https://bitbucket.org/workspace/repo"),
+            Some(Forge::new(Provider::Bitbucket, None))
+        );
+        assert_eq!(
+            Forge::detect("https://codeberg.org/owner/repo"),
+            Some(Forge::new(Provider::Forgejo, None))
+        );
+        assert_eq!(
+            Forge::detect("https://git.sr.ht/~user/repo"),
+            Some(Forge::new(Provider::SourceHut, None))
+        );
+        assert_eq!(Forge::detect("https://example.org/group/project"), None);
+        assert_eq!(Forge::detect("ssh://gitlab.com/group/project"), None);
+    }
+
+    #[test]
+    fn project_paths() {
+        assert_eq!(Forge::project_path("fxpl/scyros"), "fxpl/scyros");
+        assert_eq!(Forge::project_path("gitlab:group/project"), "group/project");
+        assert_eq!(
+            Forge::project_path("https://gitlab.com/group/sub/project.git"),
+            "group/sub/project"
+        );
+        assert_eq!(
+            Forge::project_path("https://git.sr.ht/~user/repo"),
+            "~user/repo"
+        );
+        assert_eq!(
+            Forge::project_path("https://github.com/kubernetes/kubernetes//staging/"),
+            "kubernetes/kubernetes"
+        );
+        assert_eq!(
+            Forge::subtrees("kubernetes/kubernetes//staging/;cmd/kubectl"),
+            vec!["staging", "cmd/kubectl"]
+        );
+        assert!(Forge::subtrees("https://github.com/fxpl/scyros").is_empty());
+    }
+
+    #[test]
+    fn ssh_urls() -> Result<()> {
+        assert_eq!(
+            Forge::new(Provider::GitHub, None)
+                .ssh_url("https://github.com/fxpl/scyros")?
+                .as_str(),
+            "ssh://git@github.com/fxpl/scyros.git"
+        );
+        assert_eq!(
+            Forge::new(Provider::SourceHut, None)
+                .ssh_url("~user/repo")?
+                .as_str(),
+            "ssh://git@git.sr.ht/~user/repo"
+        );
+        ensure!(Forge::new(Provider::GoProxy, Some("proxy.golang.org"))
+            .ssh_url("golang.org/x/tools")
+            .is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn archive_urls() -> Result<()> {
+        assert_eq!(
+            Forge::new(Provider::GitHub, None)
+                .archive_url(42, "fxpl/scyros", "abc", ArchiveFormat::Zip)?
+                .as_str(),
+            "https://api.github.com/repositories/42/zipball/abc"
+        );
+        assert_eq!(
+            Forge::new(Provider::GitLab, Some("gitlab.example.org/"))
+                .archive_url(42, "group/project", "abc", ArchiveFormat::Zip)?
+                .as_str(),
+            "https://gitlab.example.org/api/v4/projects/42/repository/archive.zip?sha=abc"
+        );
+        assert_eq!(
+            Forge::new(Provider::Bitbucket, None)
+                .archive_url(
+                    42,
+                    "https://bitbucket.org/workspace/repo",
+                    "abc",
+                    ArchiveFormat::Zip
+                )?
+                .as_str(),
+            "https://bitbucket.org/workspace/repo/get/abc.zip"
+        );
+        assert_eq!(
+            Forge::new(Provider::Forgejo, None)
+                .archive_url(42, "owner/repo", "abc", ArchiveFormat::Zip)?
+                .as_str(),
+            "https://codeberg.org/api/v1/repos/owner/repo/archive/abc.zip"
+        );
+        assert_eq!(
+            Forge::new(Provider::SourceHut, None)
+                .archive_url(42, "~user/repo", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://git.sr.ht/~user/repo/archive/abc.tar.gz"
+        );
+        assert_eq!(
+            Forge::new(Provider::GitLab, None)
+                .clone_url("https://gitlab.com/group/sub/project")?
+                .as_str(),
+            "https://gitlab.com/group/sub/project.git"
+        );
+        ensure!(Forge::new(Provider::GoProxy, Some("proxy.golang.org"))
+            .clone_url("golang.org/x/tools")
+            .is_err());
+        assert_eq!(
+            Forge::new(Provider::GoProxy, Some("proxy.golang.org"))
+                .archive_url(
+                    42,
+                    "goproxy:github.com/BurntSushi/toml",
+                    "v1.3.2",
+                    ArchiveFormat::Zip
+                )?
+                .as_str(),
+            "https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v1.3.2.zip"
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn tarball_urls() -> Result<()> {
+        assert_eq!(
+            Forge::new(Provider::GitHub, None)
+                .archive_url(42, "fxpl/scyros", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://api.github.com/repositories/42/tarball/abc"
+        );
+        assert_eq!(
+            Forge::new(Provider::GitLab, None)
+                .archive_url(42, "group/project", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://gitlab.com/api/v4/projects/42/repository/archive.tar.gz?sha=abc"
+        );
+        assert_eq!(
+            Forge::new(Provider::Gitea, None)
+                .archive_url(42, "owner/repo", "abc", ArchiveFormat::TarGz)?
+                .as_str(),
+            "https://gitea.com/api/v1/repos/owner/repo/archive/abc.tar.gz"
+        );
+        assert_eq!(
+            Forge::new(Provider::SourceHut, None).archive_format(None)?,
+            ArchiveFormat::TarGz
+        );
+        ensure!(Forge::new(Provider::SourceHut, None)
+            .archive_format(Some(ArchiveFormat::Zip))
+            .is_err());
+        ensure!(Forge::new(Provider::GoProxy, None)
+            .archive_format(Some(ArchiveFormat::TarGz))
+            .is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn next_page_link() -> Result<()> {
+        let mut headers = HeaderMap::new();
+        ensure!(next_page(&headers).is_none());
+        headers.insert(
+            LINK,
+            "<https://gitlab.com/api/v4/projects?page=1>; rel=\"prev\", <https://gitlab.com/api/v4/projects?page=3>; rel=\"next\""
+                .parse()?,
+        );
+        assert_eq!(
+            next_page(&headers).map(|u| u.to_string()),
+            Some("https://gitlab.com/api/v4/projects?page=3".to_string())
+        );
+        headers.insert(
+            LINK,
+            "<https://api.github.com/search/repositories?page=1>; rel=\"first\"".parse()?,
+        );
+        ensure!(next_page(&headers).is_none());
+        Ok(())
+    }
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! SourceHut, whose API is only available through GraphQL.
+
+use anyhow::{bail, ensure, Context, Result};
+use json::JsonValue;
+use reqwest::blocking::Client;
+use reqwest::header::{HeaderMap, HeaderValue, AUTHORIZATION};
+use reqwest::Url;
+
+use super::{parse_date, Backend, Forge, ForgeProject, Page};
+use crate::utils::fs::ArchiveFormat;
+use crate::utils::json::get_field;
+
+/// Lists the repositories of a user, one page at a time.
+const REPOSITORIES_QUERY: &str = "query repositories($username: String!, $cursor: Cursor) {
+    user(username: $username) {
+        repositories(cursor: $cursor) {
+            results { id name created updated owner { canonicalName } HEAD { name target } }
+            cursor
+        }
+    }
+}";
+
+pub struct SourceHut;
+
+impl SourceHut {
+    /// Sends a GraphQL query and returns its data, failing if the API reported any error.
+    fn query(
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: &str,
+        variables: JsonValue,
+    ) -> Result<JsonValue> {
+        let mut response: JsonValue = forge.post_json(
+            client,
+            Url::parse(&forge.api_url())?,
+            token,
+            &json::object! { query: query, variables: variables },
+        )?;
+        if let Some(error) = response["errors"].members().next() {
+            bail!("GraphQL query failed: {}", error["message"]);
+        }
+        Ok(response["data"].take())
+    }
+}
+
+impl Backend for SourceHut {
+    fn token_env_vars(&self) -> &'static [&'static str] {
+        &["SRHT_TOKEN"]
+    }
+
+    fn api_url(&self, host: &str) -> String {
+        format!("https://{host}/query")
+    }
+
+    /// SourceHut only serves tarballs.
+    fn archive_formats(&self) -> &'static [ArchiveFormat] {
+        &[ArchiveFormat::TarGz]
+    }
+
+    fn archive_url(
+        &self,
+        forge: &Forge,
+        _id: u32,
+        path: &str,
+        commit: &str,
+        _format: ArchiveFormat,
+    ) -> Result<Url> {
+        Ok(Url::parse(&format!(
+            "https://{}/{path}/archive/{commit}.tar.gz",
+            forge.host()
+        ))?)
+    }
+
+    fn clone_url(&self, forge: &Forge, path: &str) -> Result<Url> {
+        Ok(Url::parse(&format!("https://{}/{path}", forge.host()))?)
+    }
+
+    fn ssh_url(&self, forge: &Forge, path: &str) -> Result<Url> {
+        Ok(Url::parse(&format!("ssh://git@{}/{path}", forge.host()))?)
+    }
+
+    fn authenticate(&self, headers: &mut HeaderMap, token: &str) -> Result<()> {
+        headers.insert(
+            AUTHORIZATION,
+            HeaderValue::from_str(&format!("Bearer {token}"))?,
+        );
+        Ok(())
+    }
+
+    fn check_token(&self, forge: &Forge, token: &str) -> Result<()> {
+        SourceHut::query(
+            forge,
+            &Client::new(),
+            token,
+            "{ me { canonicalName } }",
+            JsonValue::new_object(),
+        )
+        .map(|_| ())
+    }
+
+    /// SourceHut has no global search, the repositories of the namespace are listed and filtered on their name.
+    fn search_page(
+        &self,
+        forge: &Forge,
+        client: &Client,
+        token: &str,
+        query: Option<&str>,
+        namespace: Option<&str>,
+        cursor: Option<&str>,
+    ) -> Result<Page> {
+        let username: &str = namespace
+            .context("SourceHut cannot be searched without a namespace")?
+            .trim_start_matches('~');
+        let mut data: JsonValue = SourceHut::query(
+            forge,
+            client,
+            token,
+            REPOSITORIES_QUERY,
+            json::object! { username: username, cursor: cursor },
+        )?;
+        ensure!(!data["user"].is_null(), "Unknown SourceHut user {username}");
+        let repositories: JsonValue = data["user"]["repositories"].take();
+        let query: Option<String> = query.map(|q| q.to_lowercase());
+        Ok(Page {
+            items: repositories["results"]
+                .members()
+                .filter(|item| {
+                    query.as_ref().is_none_or(|q| {
+                        item["name"]
+                            .as_str()
+                            .is_some_and(|name| name.to_lowercase().contains(q))
+                    })
+                })
+                .cloned()
+                .collect(),
+            next: repositories["cursor"].as_str().map(|c| c.to_string()),
+        })
+    }
+
+    /// The latest commit is part of the search results, no further request is needed.
+    fn parse_project(&self, item: &JsonValue) -> Result<Option<(ForgeProject, String)>> {
+        let head: &JsonValue = &item["HEAD"];
+        if head.is_null() {
+            return Ok(None);
+        }
+        let branch: String = get_field::<String>(head, "name")?;
+        Ok(Some((
+            ForgeProject {
+                id: get_field::<u32>(item, "id")?,
+                name: format!(
+                    "{}/{}",
+                    get_field::<String>(&item["owner"], "canonicalName")?,
+                    get_field::<String>(item, "name")?
+                ),
+                latest_commit: get_field::<String>(head, "target")?,
+                created: parse_date(item, "created")?,
+                pushed: parse_date(item, "updated")?,
+                license: "unknown".to_string(),
+                ..Default::default()
+            },
+            branch
+                .strip_prefix("refs/heads/")
+                .unwrap_or(&branch)
+                .to_string(),
+        )))
+    }
+
+    fn latest_commit(
+        &self,
+        _forge: &Forge,
+        _client: &Client,
+        _token: &str,
+        project: &ForgeProject,
+        _branch: &str,
+    ) -> Result<String> {
+        Ok(project.latest_commit.clone())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn sourcehut_project() -> Result<()> {
+        let item = json::parse(
+            r#"{
+                "id": 42,
+                "name": "repo",
+                "created": "2020-01-01T00:00:00.123456Z",
+                "updated": "2020-01-02T00:00:00Z",
+                "owner": { "canonicalName": "~user" },
+                "HEAD": { "name": "refs/heads/trunk", "target": "abc" }
+            }"#,
+        )?;
+        let (project, branch) = SourceHut
+            .parse_project(&item)?
+            .context("Project should not be empty")?;
+        assert_eq!(branch, "trunk");
+        assert_eq!(project.name, "~user/repo");
+        assert_eq!(project.latest_commit, "abc");
+        assert_eq!(project.created, 1577836800);
+        assert_eq!(project.pushed, 1577923200);
+
+        let mut empty = item.clone();
+        empty["HEAD"] = JsonValue::Null;
+        assert_eq!(SourceHut.parse_project(&empty)?, None);
+        Ok(())
+    }
+}
@@ -15,14 +15,17 @@
 //! Utility functions for file operations and I/O.
 
 use anyhow::{bail, Context, Error, Result};
+use flate2::read::GzDecoder;
 use pathdiff::diff_paths;
 use polars::io::SerWriter;
 use polars::prelude::{CsvReadOptions, CsvWriter, Schema};
 use polars::{frame::DataFrame, io::SerReader};
 use walkdir::WalkDir;
+use zip_extensions::zip_extract::zip_extract;
 
+use std::collections::HashMap;
 use std::fs;
-use std::io::BufWriter;
+use std::io::{BufWriter, Read};
 use std::path::{Component, PathBuf};
 use std::sync::Arc;
 use std::{
@@ -91,10 +94,18 @@ pub fn check_path(path: &str) -> Result<PathBuf> {
 /// Two kinds of errors are possible:
 /// * If the file size exceeds the memory limit, returns the size of the file.
 /// * If the file could not be read, returns an error.
+///
+/// Entries of archives, whose path is the path of the archive followed by `!/` and the path of the entry, are read
+/// from the archive (see `load_archive_entry`).
 pub fn load_file(
     path: impl AsRef<Path>,
     memory_limit: u64,
 ) -> Result<core::result::Result<Vec<u8>, u64>> {
+    if let Some((archive, format, entry)) = path.as_ref().to_str().and_then(split_archive_entry) {
+        if Path::new(archive).is_file() {
+            return load_archive_entry(archive, format, entry, memory_limit);
+        }
+    }
     let metadata = std::fs::metadata(&path).with_context(|| {
         format!(
             "Could not fetch metadata for file {}",
@@ -221,6 +232,201 @@ pub fn write_file(path: impl AsRef<Path>, content: impl AsRef<[u8]>) -> Result<(
     Ok(())
 }
 
+/// Formats of the source archives downloaded from forges.
+#[derive(PartialEq, Eq, Debug, Copy, Clone)]
+pub enum ArchiveFormat {
+    Zip,
+    TarGz,
+}
+
+impl ArchiveFormat {
+    /// Names of the formats, as accepted on the command line.
+    pub const NAMES: [&'static str; 2] = ["zip", "tar.gz"];
+
+    /// Returns the file extension of the format, including the leading dot.
+    pub fn extension(&self) -> &'static str {
+        match self {
+            ArchiveFormat::Zip => ".zip",
+            ArchiveFormat::TarGz => ".tar.gz",
+        }
+    }
+
+    /// Returns the format of an archive from the extension of its path, or None if it is not an archive.
+    pub fn of_path(path: &str) -> Option<ArchiveFormat> {
+        let path: String = path.to_lowercase();
+        if path.ends_with(".zip") {
+            Some(ArchiveFormat::Zip)
+        } else if path.ends_with(".tar.gz") || path.ends_with(".tgz") {
+            Some(ArchiveFormat::TarGz)
+        } else {
+            None
+        }
+    }
+}
+
+impl std::str::FromStr for ArchiveFormat {
+    type Err = Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.to_lowercase().trim_start_matches('.') {
+            "zip" => Ok(ArchiveFormat::Zip),
+            "tar.gz" | "tgz" | "tarball" => Ok(ArchiveFormat::TarGz),
+            _ => bail!(
+                "Unknown archive format {s}, expected one of {}",
+                ArchiveFormat::NAMES.join(", ")
+            ),
+        }
+    }
+}
+
+/// Extracts an archive into a directory, creating the directory if it does not exist.
+///
+/// # Arguments
+/// * `archive` - The path to the archive.
+/// * `format` - The format of the archive.
+/// * `dest` - The directory to extract the archive into.
+///
+/// # Returns
+/// An error if the archive could not be read or extracted.
+pub fn extract_archive(
+    archive: impl AsRef<Path>,
+    format: ArchiveFormat,
+    dest: impl AsRef<Path>,
+) -> Result<()> {
+    match format {
+        ArchiveFormat::Zip => zip_extract(
+            &archive.as_ref().to_path_buf(),
+            &dest.as_ref().to_path_buf(),
+        )?,
+        ArchiveFormat::TarGz => {
+            create_dir(&dest)?;
+            let file: File = open_file(&archive, FileMode::Read)?;
+            tar::Archive::new(GzDecoder::new(BufReader::new(file))).unpack(&dest)?
+        }
+    }
+    Ok(())
+}
+
+/// Separator between the path of an archive and the path of one of its entries, e.g. `mod.zip!/pkg/file.go`.
+pub const ARCHIVE_ENTRY_SEPARATOR: &str = "!/";
+
+/// Splits the path of an entry of an archive into the path of the archive, its format and the path of the entry.
+///
+/// # Returns
+/// None if the path does not refer to an entry of an archive.
+pub fn split_archive_entry(path: &str) -> Option<(&str, ArchiveFormat, &str)> {
+    let (archive, entry) = path.split_once(ARCHIVE_ENTRY_SEPARATOR)?;
+    Some((archive, ArchiveFormat::of_path(archive)?, entry))
+}
+
+/// Lists the regular files of an archive, without extracting them.
+///
+/// # Arguments
+/// * `archive` - The path to the archive.
+/// * `format` - The format of the archive.
+///
+/// # Returns
+/// The normalized path of every file in the archive with its uncompressed size, in the order of the archive,
+/// or an error if the archive could not be read.
+pub fn archive_entries(
+    archive: impl AsRef<Path>,
+    format: ArchiveFormat,
+) -> Result<Vec<(String, u64)>> {
+    let file: BufReader<File> = BufReader::new(open_file(&archive, FileMode::Read)?);
+    let mut entries: Vec<(String, u64)> = Vec::new();
+    match format {
+        ArchiveFormat::Zip => {
+            let mut zip = zip::ZipArchive::new(file)?;
+            for idx in 0..zip.len() {
+                let entry = zip.by_index(idx)?;
+                if entry.is_file() {
+                    entries.push((normalize_path(entry.name()), entry.size()));
+                }
+            }
+        }
+        ArchiveFormat::TarGz => {
+            let mut tar = tar::Archive::new(GzDecoder::new(file));
+            for entry in tar.entries()? {
+                let entry = entry?;
+                if entry.header().entry_type().is_file() {
+                    entries.push((
+                        normalize_path(&entry.path()?.to_string_lossy()),
+                        entry.size(),
+                    ));
+                }
+            }
+        }
+    }
+    Ok(entries)
+}
+
+/// Loads an entry of an archive into memory if its size is less than a given limit, without extracting the archive.
+/// Zip entries are read directly from the central directory of the archive, while tarballs are decompressed until
+/// the entry is found.
+///
+/// # Arguments
+/// * `archive` - The path to the archive.
+/// * `format` - The format of the archive.
+/// * `entry` - The normalized path of the entry in the archive, as listed by `archive_entries`.
+/// * `memory_limit` - The maximum size of the entry in bytes.
+///
+/// # Returns
+/// The content of the entry, or its size if it exceeds the memory limit, or an error if the archive could not be
+/// read or does not contain the entry.
+pub fn load_archive_entry(
+    archive: impl AsRef<Path>,
+    format: ArchiveFormat,
+    entry: &str,
+    memory_limit: u64,
+) -> Result<core::result::Result<Vec<u8>, u64>> {
+    let not_found = || format!("No file {entry} in archive {}", archive.as_ref().display());
+    let file: BufReader<File> = BufReader::new(open_file(&archive, FileMode::Read)?);
+    let read = |reader: &mut dyn Read, size: u64| -> Result<core::result::Result<Vec<u8>, u64>> {
+        if size > memory_limit {
+            return Ok(Err(size));
+        }
+        let mut content: Vec<u8> = Vec::with_capacity(size as usize);
+        reader.read_to_end(&mut content).with_context(|| {
+            format!(
+                "Could not read {entry} in archive {}",
+                archive.as_ref().display()
+            )
+        })?;
+        Ok(Ok(content))
+    };
+    match format {
+        ArchiveFormat::Zip => {
+            let mut zip = zip::ZipArchive::new(file)?;
+            // Entries are looked up by their raw name first, and by their normalized name otherwise.
+            let idx: usize = match zip.index_for_name(entry) {
+                Some(idx) => idx,
+                None => (0..zip.len())
+                    .find(|idx| {
+                        zip.by_index_raw(*idx)
+                            .is_ok_and(|e| e.is_file() && normalize_path(e.name()) == entry)
+                    })
+                    .with_context(not_found)?,
+            };
+            let mut zip_file = zip.by_index(idx)?;
+            let size: u64 = zip_file.size();
+            read(&mut zip_file, size)
+        }
+        ArchiveFormat::TarGz => {
+            let mut tar = tar::Archive::new(GzDecoder::new(file));
+            for tar_entry in tar.entries()? {
+                let mut tar_entry = tar_entry?;
+                if tar_entry.header().entry_type().is_file()
+                    && normalize_path(&tar_entry.path()?.to_string_lossy()) == entry
+                {
+                    let size: u64 = tar_entry.size();
+                    return read(&mut tar_entry, size);
+                }
+            }
+            bail!(not_found())
+        }
+    }
+}
+
 /// Reads a CSV file into a DataFrame.
 ///
 /// # Arguments
@@ -264,6 +470,203 @@ pub fn write_csv(path: &str, df: &mut DataFrame) -> Result<()> {
         .with_context(|| format!("Could not write to {path}"))
 }
 
+/// Computes the total size of the files in a directory and its subdirectories, in bytes.
+/// Symbolic links are not followed.
+///
+/// # Arguments
+///
+/// * `path` - The path to the directory.
+///
+/// # Returns
+///
+/// The size of the directory, or 0 if it does not exist.
+pub fn dir_size(path: impl AsRef<Path>) -> Result<u64> {
+    let mut size: u64 = 0;
+    for entry in WalkDir::new(path).into_iter().filter_map(Result::ok) {
+        if entry.file_type().is_file() {
+            size += entry.metadata()?.len();
+        }
+    }
+    Ok(size)
+}
+
+/// Computes a hash of the content of a directory: the relative paths and the contents of its files, in lexicographic order.
+/// Empty directories, symbolic links and the '.git' directories of cloned repositories are ignored, so that the hash
+/// only depends on the files that are analyzed. The folders written by the parse phase next to the files it parses
+/// (e.g. main.c.functions) are ignored as well, so that a project keeps its hash once it has been parsed.
+///
+/// # Arguments
+///
+/// * `path` - The path to the directory.
+///
+/// # Returns
+///
+/// The hexadecimal representation of the BLAKE3 hash, or an error if a file cannot be read.
+pub fn tree_hash(path: impl AsRef<Path>) -> Result<String> {
+    let root: &Path = path.as_ref();
+    let mut hasher = blake3::Hasher::new();
+    for entry in WalkDir::new(root)
+        .sort_by_file_name()
+        .into_iter()
+        .filter_entry(|e| e.file_name() != ".git" && !is_functions_dir(e))
+    {
+        let entry = entry?;
+        if entry.file_type().is_file() {
+            let relative: &Path = entry.path().strip_prefix(root)?;
+            let content: Vec<u8> = fs::read(entry.path())
+                .with_context(|| format!("Could not read {}", entry.path().display()))?;
+            // Lengths delimit the paths and contents, so that no two trees share the same input.
+            let relative: &[u8] = relative.as_os_str().as_encoded_bytes();
+            hasher.update(&(relative.len() as u64).to_le_bytes());
+            hasher.update(relative);
+            hasher.update(&(content.len() as u64).to_le_bytes());
+            hasher.update(&content);
+        }
+    }
+    Ok(hasher.finalize().to_hex().to_string())
+}
+
+/// Checks whether a directory entry is a folder where the parse phase stored the functions of a file,
+/// i.e. a folder named after a sibling file with ".functions" appended.
+fn is_functions_dir(entry: &walkdir::DirEntry) -> bool {
+    entry.file_type().is_dir()
+        && entry
+            .file_name()
+            .to_str()
+            .and_then(|name| name.strip_suffix(".functions"))
+            .is_some_and(|file| entry.path().with_file_name(file).is_file())
+}
+
+/// Moves the files of a directory to a content-addressable store, where every content is stored once
+/// under its BLAKE3 hash (e.g. store/ab/cdef...), and replaces them with hard links to their content.
+/// Files whose content is already in the store only take the space of the link.
+/// The store must be on the same file system as the directory. Symbolic links and the '.git' directories of cloned repositories are left as is.
+///
+/// # Arguments
+///
+/// * `path` - The path to the directory.
+/// * `store` - The path to the store. It is created if it does not exist.
+///
+/// # Returns
+///
+/// The number of bytes added to the store, i.e. the size of the contents that were not stored yet.
+pub fn store_files(path: impl AsRef<Path>, store: impl AsRef<Path>) -> Result<u64> {
+    let mut stored: u64 = 0;
+    for entry in WalkDir::new(path)
+        .into_iter()
+        .filter_entry(|e| e.file_name() != ".git")
+    {
+        let entry = entry?;
+        if !entry.file_type().is_file() {
+            continue;
+        }
+        let content: Vec<u8> = fs::read(entry.path())
+            .with_context(|| format!("Could not read {}", entry.path().display()))?;
+        let hash: String = blake3::hash(&content).to_hex().to_string();
+        let blob: PathBuf = store.as_ref().join(&hash[..2]).join(&hash[2..]);
+        create_dir(blob.parent().unwrap_or(store.as_ref()))?;
+        // Another project, possibly downloaded by another thread, may have stored the content first.
+        match fs::hard_link(entry.path(), &blob) {
+            Ok(()) => stored += content.len() as u64,
+            Err(e) if e.kind() == std::io::ErrorKind::AlreadyExists => {
+                fs::remove_file(entry.path())?;
+                fs::hard_link(&blob, entry.path()).with_context(|| {
+                    format!("Could not link {} to the store", entry.path().display())
+                })?;
+            }
+            Err(e) => {
+                return Err(e).with_context(|| {
+                    format!(
+                        "Could not store {} in {}, which must be on the same file system",
+                        entry.path().display(),
+                        store.as_ref().display()
+                    )
+                })
+            }
+        }
+    }
+    Ok(stored)
+}
+
+/// Normalizes a path lexically, without accessing the file system: empty and '.' components are removed,
+/// and '..' components are resolved against the previous component when there is one.
+///
+/// # Arguments
+///
+/// * `path` - The path to normalize, with '/' as separator.
+///
+/// # Returns
+///
+/// The normalized path, "." if it is empty.
+pub fn normalize_path(path: &str) -> String {
+    let mut components: Vec<&str> = Vec::new();
+    for component in path.split('/') {
+        match component {
+            "" | "." => {}
+            ".." if components.last().is_some_and(|last| *last != "..") => {
+                components.pop();
+            }
+            _ => components.push(component),
+        }
+    }
+    let normalized: String = components.join("/");
+    match (path.starts_with('/'), normalized.is_empty()) {
+        (true, _) => format!("/{normalized}"),
+        (false, true) => ".".to_string(),
+        (false, false) => normalized,
+    }
+}
+
+/// Whether a path or one of its ancestors is a symbolic link.
+///
+/// # Arguments
+///
+/// * `path` - The path to check.
+/// * `cache` - Whether the directories already checked are symbolic links or have one among their ancestors.
+pub fn has_symlink(path: &Path, cache: &mut HashMap<PathBuf, bool>) -> bool {
+    if path
+        .symlink_metadata()
+        .is_ok_and(|m| m.file_type().is_symlink())
+    {
+        return true;
+    }
+    match path
+        .parent()
+        .filter(|parent| !parent.as_os_str().is_empty())
+    {
+        Some(parent) => match cache.get(parent) {
+            Some(linked) => *linked,
+            None => {
+                let linked: bool = has_symlink(parent, cache);
+                cache.insert(parent.to_path_buf(), linked);
+                linked
+            }
+        },
+        None => false,
+    }
+}
+
+/// Whether two paths lead to the same file. On Unix, files are identified by their device and inode numbers,
+/// so that the paths differing only by their case on case-insensitive file systems are identified too.
+/// Elsewhere, the canonical paths of the files are compared.
+pub fn same_file(a: impl AsRef<Path>, b: impl AsRef<Path>) -> bool {
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::MetadataExt;
+        match (fs::metadata(a), fs::metadata(b)) {
+            (Ok(a), Ok(b)) => a.dev() == b.dev() && a.ino() == b.ino(),
+            _ => false,
+        }
+    }
+    #[cfg(not(unix))]
+    {
+        match (fs::canonicalize(a), fs::canonicalize(b)) {
+            (Ok(a), Ok(b)) => a == b,
+            _ => false,
+        }
+    }
+}
+
 pub fn is_empty_dir(path: impl AsRef<Path>) -> Result<bool> {
     Ok(fs::read_dir(path)?.next().is_none())
 }
@@ -272,6 +675,8 @@ pub fn delete_empty_dirs(path: impl AsRef<Path>) -> Result<()> {
     for entry in WalkDir::new(path)
         .contents_first(true)
         .into_iter()
+        // Empty directories are part of the layout of git repositories.
+        .filter_entry(|e| e.file_name() != ".git")
         .filter_map(Result::ok)
         .filter(|e| e.file_type().is_dir())
     {
@@ -427,6 +832,181 @@ mod io_tests {
         Ok(())
     }
 
+    #[test]
+    fn normalize_path_test() {
+        assert_eq!(normalize_path("a/./b//c.go"), "a/b/c.go");
+        assert_eq!(normalize_path("a/b/../c.go"), "a/c.go");
+        assert_eq!(normalize_path("../a/.."), "..");
+        assert_eq!(normalize_path("/a/../b"), "/b");
+        assert_eq!(normalize_path("./"), ".");
+    }
+
+    #[test]
+    fn archive_entries_test() -> Result<()> {
+        let test_dir = "target/tests/fs/archives";
+        delete_dir(test_dir, true)?;
+        create_dir(test_dir)?;
+
+        let zip_path = format!("{test_dir}/mod.zip");
+        let mut zip = zip::ZipWriter::new(File::create(&zip_path)?);
+        zip.add_directory("mod@v1.0.0/pkg/", zip::write::SimpleFileOptions::default())?;
+        zip.start_file(
+            "mod@v1.0.0/pkg/a.go",
+            zip::write::SimpleFileOptions::default(),
+        )?;
+        zip.write_all(b"package pkg")?;
+        zip.start_file(
+            "mod@v1.0.0/go.mod",
+            zip::write::SimpleFileOptions::default(),
+        )?;
+        zip.write_all(b"module mod")?;
+        zip.finish()?;
+
+        let tar_path = format!("{test_dir}/repo.tar.gz");
+        let mut tar = tar::Builder::new(flate2::write::GzEncoder::new(
+            File::create(&tar_path)?,
+            flate2::Compression::default(),
+        ));
+        for (name, content) in [("./repo/a.go", "package a"), ("./repo/b/b.go", "package b")] {
+            let mut header = tar::Header::new_gnu();
+            header.set_size(content.len() as u64);
+            header.set_mode(0o644);
+            header.set_cksum();
+            tar.append_data(&mut header, name, content.as_bytes())?;
+        }
+        tar.into_inner()?.finish()?;
+
+        assert_eq!(
+            archive_entries(&zip_path, ArchiveFormat::Zip)?,
+            vec![
+                ("mod@v1.0.0/pkg/a.go".to_string(), 11),
+                ("mod@v1.0.0/go.mod".to_string(), 10)
+            ]
+        );
+        assert_eq!(
+            archive_entries(&tar_path, ArchiveFormat::TarGz)?,
+            vec![("repo/a.go".to_string(), 9), ("repo/b/b.go".to_string(), 9)]
+        );
+
+        assert_eq!(
+            split_archive_entry("dl/mod.zip!/mod@v1.0.0/go.mod"),
+            Some(("dl/mod.zip", ArchiveFormat::Zip, "mod@v1.0.0/go.mod"))
+        );
+        assert_eq!(split_archive_entry("dl/mod!/go.mod"), None);
+        assert_eq!(split_archive_entry("dl/mod.zip"), None);
+
+        assert_eq!(
+            load_file(format!("{zip_path}!/mod@v1.0.0/pkg/a.go"), 1024)?,
+            core::result::Result::Ok(b"package pkg".to_vec())
+        );
+        assert_eq!(
+            load_file(format!("{tar_path}!/repo/b/b.go"), 1024)?,
+            core::result::Result::Ok(b"package b".to_vec())
+        );
+        assert_eq!(
+            load_file(format!("{tar_path}!/repo/b/b.go"), 4)?,
+            core::result::Result::Err(9)
+        );
+        ensure!(load_file(format!("{zip_path}!/missing.go"), 1024).is_err());
+        Ok(())
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn symlinks_test() -> Result<()> {
+        let test_dir = "target/tests/fs/symlinks";
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/dir/a.go"), "package a")?;
+        std::os::unix::fs::symlink("dir", format!("{test_dir}/link"))?;
+        let mut cache: HashMap<PathBuf, bool> = HashMap::new();
+        ensure!(!has_symlink(
+            Path::new(&format!("{test_dir}/dir/a.go")),
+            &mut cache
+        ));
+        ensure!(has_symlink(
+            Path::new(&format!("{test_dir}/link/a.go")),
+            &mut cache
+        ));
+        ensure!(has_symlink(
+            Path::new(&format!("{test_dir}/link")),
+            &mut cache
+        ));
+        ensure!(same_file(
+            format!("{test_dir}/dir/a.go"),
+            format!("{test_dir}/link/a.go")
+        ));
+        ensure!(!same_file(
+            format!("{test_dir}/dir/a.go"),
+            format!("{test_dir}/dir")
+        ));
+        Ok(())
+    }
+
+    #[test]
+    fn dir_size_test() -> Result<()> {
+        let test_dir = "target/tests/fs/dir_size";
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/a.txt"), "hello")?;
+        write_file(format!("{test_dir}/sub/b.txt"), "world!")?;
+        assert_eq!(dir_size(test_dir)?, 11);
+        delete_dir(test_dir, false)?;
+        assert_eq!(dir_size(test_dir)?, 0);
+        Ok(())
+    }
+
+    #[test]
+    fn store_files_test() -> Result<()> {
+        let test_dir = "target/tests/fs/store_files";
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/a/vendor/lib.go"), "package lib")?;
+        write_file(format!("{test_dir}/a/main.go"), "package main")?;
+        write_file(format!("{test_dir}/b/third_party/lib.go"), "package lib")?;
+        let store: String = format!("{test_dir}/store");
+        assert_eq!(store_files(format!("{test_dir}/a"), &store)?, 23);
+        let hash: String = tree_hash(format!("{test_dir}/b"))?;
+        // The content of lib.go is already in the store.
+        assert_eq!(store_files(format!("{test_dir}/b"), &store)?, 0);
+        assert_eq!(tree_hash(format!("{test_dir}/b"))?, hash);
+        assert_eq!(dir_size(&store)?, 23);
+        assert_eq!(
+            fs::read_to_string(format!("{test_dir}/b/third_party/lib.go"))?,
+            "package lib"
+        );
+        delete_dir(test_dir, false)
+    }
+
+    #[test]
+    fn tree_hash_test() -> Result<()> {
+        let test_dir = "target/tests/fs/tree_hash";
+        delete_dir(test_dir, true)?;
+        write_file(format!("{test_dir}/a/b.txt"), "hello")?;
+        write_file(format!("{test_dir}/c.txt"), "world")?;
+        let hash: String = tree_hash(test_dir)?;
+
+        write_file(format!("{test_dir}/.git/HEAD"), "ref")?;
+        create_dir(format!("{test_dir}/empty"))?;
+        write_file(format!("{test_dir}/c.txt.functions/1-1"), "world")?;
+        assert_eq!(tree_hash(test_dir)?, hash);
+
+        // Only the folders named after a file are written by the parse phase.
+        write_file(format!("{test_dir}/d.functions/e.txt"), "!")?;
+        assert_ne!(tree_hash(test_dir)?, hash);
+        delete_dir(format!("{test_dir}/d.functions"), false)?;
+
+        write_file(format!("{test_dir}/c.txt"), "world!")?;
+        assert_ne!(tree_hash(test_dir)?, hash);
+
+        // Moving content from a file to its path changes the hash.
+        write_file(format!("{test_dir}/c.txt"), "world")?;
+        std::fs::rename(
+            format!("{test_dir}/a/b.txt"),
+            format!("{test_dir}/a/bhello"),
+        )?;
+        write_file(format!("{test_dir}/a/bhello"), "")?;
+        assert_ne!(tree_hash(test_dir)?, hash);
+        delete_dir(test_dir, false)
+    }
+
     #[test]
     fn create_delete_file_test() -> Result<()> {
         let test_file = "tests/new_file.txt";
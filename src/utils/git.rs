@@ -0,0 +1,326 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Utility functions for cloning repositories with the git command line.
+
+use anyhow::{bail, ensure, Context, Result};
+use std::path::Path;
+use std::process::{Command, Output};
+use tracing::debug;
+use walkdir::DirEntry;
+
+use crate::utils::fs::create_dir;
+
+/// Runs a git command in a directory.
+///
+/// # Arguments
+///
+/// * `dir` - The directory in which the command is run.
+/// * `args` - The arguments of the command.
+///
+/// # Returns
+///
+/// An error containing the standard error of git if the command could not be run or failed.
+fn git(dir: &Path, args: &[&str]) -> Result<()> {
+    let output: Output = Command::new("git")
+        .arg("-C")
+        .arg(dir)
+        .args(args)
+        // Never wait for credentials on private or deleted repositories.
+        .env("GIT_TERMINAL_PROMPT", "0")
+        .output()
+        .context("Could not run git, is it installed?")?;
+    if !output.status.success() {
+        bail!(
+            "git {} failed: {}",
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        );
+    }
+    Ok(())
+}
+
+/// Configures the SSH command run by git for clones over SSH, so that git never waits for a passphrase
+/// or for the confirmation of an unknown host key. Host keys are accepted the first time a host is reached.
+///
+/// # Arguments
+///
+/// * `key` - The private key offered to the servers. If not specified, the keys of the SSH agent and the default keys
+///   of the user are used, and an SSH command already set in `GIT_SSH_COMMAND` is kept as is.
+///
+/// # Returns
+///
+/// An error if the key file does not exist.
+pub fn configure_ssh(key: Option<&str>) -> Result<()> {
+    let mut command: String =
+        String::from("ssh -o BatchMode=yes -o StrictHostKeyChecking=accept-new");
+    match key {
+        Some(key) => {
+            ensure!(Path::new(key).is_file(), "SSH key {key} does not exist");
+            command.push_str(&format!(
+                " -o IdentitiesOnly=yes -i '{}'",
+                key.replace('\'', "'\\''")
+            ));
+        }
+        None if std::env::var_os("GIT_SSH_COMMAND").is_some() => return Ok(()),
+        None => {}
+    }
+    debug!("Cloning over SSH with {command}");
+    std::env::set_var("GIT_SSH_COMMAND", command);
+    Ok(())
+}
+
+/// The history fetched when cloning a repository.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum History {
+    /// The full history.
+    #[default]
+    Full,
+    /// The given number of commits.
+    Depth(u32),
+    /// The commits more recent than the given date (epoch).
+    Since(i64),
+}
+
+impl History {
+    /// Returns the arguments of git fetch limiting the history, if any.
+    fn fetch_args(&self) -> Vec<String> {
+        match self {
+            History::Full => Vec::new(),
+            History::Depth(depth) => vec!["--depth".to_string(), depth.to_string()],
+            History::Since(since) => vec![format!("--shallow-since={since}")],
+        }
+    }
+}
+
+/// Clones a repository and checks out a given commit.
+///
+/// With a limited history, only the history leading to the commit is fetched, up to the given number of commits
+/// or back to the given date. Servers are not required to serve arbitrary commits; if the commit cannot be fetched directly,
+/// or if it is older than the given date, the whole repository is fetched instead.
+///
+/// # Arguments
+///
+/// * `url` - The URL of the repository.
+/// * `commit` - The hash of the commit to check out.
+/// * `dest` - The directory in which the repository is cloned. It is created if it does not exist.
+/// * `history` - The history to fetch.
+///
+/// # Returns
+///
+/// An error if the repository could not be cloned or if the commit does not exist.
+pub fn clone_at(url: &str, commit: &str, dest: impl AsRef<Path>, history: History) -> Result<()> {
+    let dest: &Path = dest.as_ref();
+    create_dir(dest)?;
+    git(dest, &["init", "-q"])?;
+    git(dest, &["remote", "add", "origin", url])?;
+    checkout(url, commit, dest, history)
+}
+
+/// Updates a repository cloned with [`clone_at`] to another commit.
+/// The working tree is restored to the content of the commit: files and directories that are not tracked are removed,
+/// and tracked files that were deleted are checked out again.
+///
+/// # Arguments
+///
+/// * `url` - The URL of the repository.
+/// * `commit` - The hash of the commit to check out.
+/// * `dest` - The directory of the repository.
+/// * `history` - The history to fetch.
+///
+/// # Returns
+///
+/// An error if the repository could not be fetched or if the commit does not exist.
+pub fn update_at(url: &str, commit: &str, dest: impl AsRef<Path>, history: History) -> Result<()> {
+    let dest: &Path = dest.as_ref();
+    git(dest, &["remote", "set-url", "origin", url])?;
+    checkout(url, commit, dest, history)?;
+    git(dest, &["clean", "-q", "-f", "-d", "-x"])
+}
+
+/// Fetches all the branches of the origin remote of a repository cloned with [`clone_at`], as remote-tracking branches,
+/// so that they are available in the repository besides the commit checked out.
+///
+/// # Arguments
+///
+/// * `dest` - The directory of the repository.
+/// * `history` - The history to fetch on every branch.
+///
+/// # Returns
+///
+/// An error if the branches could not be fetched.
+pub fn fetch_branches(dest: impl AsRef<Path>, history: History) -> Result<()> {
+    let limit: Vec<String> = history.fetch_args();
+    let mut args: Vec<&str> = vec!["fetch", "-q"];
+    args.extend(limit.iter().map(|a| a.as_str()));
+    args.extend(["origin", "+refs/heads/*:refs/remotes/origin/*"]);
+    git(dest.as_ref(), &args)
+}
+
+/// Fetches a commit from the origin remote of a repository and checks it out.
+fn checkout(url: &str, commit: &str, dest: &Path, history: History) -> Result<()> {
+    let shallow: bool = match history {
+        History::Full => false,
+        _ => {
+            let limit: Vec<String> = history.fetch_args();
+            let mut args: Vec<&str> = vec!["fetch", "-q"];
+            args.extend(limit.iter().map(|a| a.as_str()));
+            args.extend(["origin", commit]);
+            match git(dest, &args) {
+                Ok(()) => true,
+                Err(e) => {
+                    debug!("Shallow fetch of {url} failed, fetching the full history: {e}");
+                    false
+                }
+            }
+        }
+    };
+    if !shallow {
+        git(dest, &["fetch", "-q", "origin"])?;
+    }
+    git(
+        dest,
+        &[
+            "-c",
+            "advice.detachedHead=false",
+            "checkout",
+            "-q",
+            "--force",
+            commit,
+        ],
+    )
+}
+
+/// Initializes and fetches the submodules of a repository cloned with [`clone_at`], recursively,
+/// at the commits recorded by the repository.
+///
+/// # Arguments
+///
+/// * `dest` - The directory of the repository.
+/// * `depth` - The number of commits to fetch for every submodule. If not specified, the full history is fetched.
+///
+/// # Returns
+///
+/// An error if a submodule could not be fetched.
+pub fn update_submodules(dest: impl AsRef<Path>, depth: Option<u32>) -> Result<()> {
+    let depth: Option<String> = depth.map(|d| d.to_string());
+    let mut args: Vec<&str> = vec!["submodule", "update", "-q", "--init", "--recursive"];
+    if let Some(depth) = &depth {
+        args.extend(["--depth", depth]);
+    }
+    git(dest.as_ref(), &args)
+}
+
+/// A submodule declared in the .gitmodules file of a repository.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Submodule {
+    /// The path of the submodule, relative to the root of the repository.
+    pub path: String,
+    /// The URL of the repository of the submodule.
+    pub url: String,
+}
+
+/// Reads the submodules declared in the .gitmodules file at the root of a repository.
+/// Archives do not contain the submodules of a repository, but still contain this file.
+///
+/// # Arguments
+///
+/// * `dir` - The root of the repository.
+///
+/// # Returns
+///
+/// The submodules declared, empty if the repository has no .gitmodules file, or an error if the file cannot be read.
+pub fn read_gitmodules(dir: impl AsRef<Path>) -> Result<Vec<Submodule>> {
+    let path = dir.as_ref().join(".gitmodules");
+    if !path.is_file() {
+        return Ok(Vec::new());
+    }
+    let content: String = std::fs::read_to_string(&path)
+        .with_context(|| format!("Could not read {}", path.display()))?;
+    Ok(parse_gitmodules(&content))
+}
+
+/// Parses the content of a .gitmodules file. Submodules without a path are ignored.
+fn parse_gitmodules(content: &str) -> Vec<Submodule> {
+    let mut submodules: Vec<Submodule> = Vec::new();
+    let mut current: Option<Submodule> = None;
+    for line in content.lines().map(str::trim) {
+        if line.starts_with('[') {
+            submodules.extend(current.take().filter(|s| !s.path.is_empty()));
+            if line.starts_with("[submodule") {
+                current = Some(Submodule::default());
+            }
+        } else if let (Some(submodule), Some((key, value))) =
+            (current.as_mut(), line.split_once('='))
+        {
+            match key.trim() {
+                "path" => submodule.path = value.trim().trim_matches('/').to_string(),
+                "url" => submodule.url = value.trim().to_string(),
+                _ => {}
+            }
+        }
+    }
+    submodules.extend(current.filter(|s| !s.path.is_empty()));
+    submodules
+}
+
+/// Checks whether an entry of a directory walk is the metadata directory of a git repository.
+pub fn is_git_dir(entry: &DirEntry) -> bool {
+    entry.file_type().is_dir() && entry.file_name() == ".git"
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn history_args() {
+        assert!(History::Full.fetch_args().is_empty());
+        assert_eq!(History::Depth(1).fetch_args(), vec!["--depth", "1"]);
+        assert_eq!(
+            History::Since(1577836800).fetch_args(),
+            vec!["--shallow-since=1577836800"]
+        );
+    }
+
+    #[test]
+    fn gitmodules() {
+        let content = r#"
+[submodule "vendor/lib"]
+    path = vendor/lib
+    url = https://github.com/owner/lib.git
+[core]
+    path = ignored
+[submodule "docs"]
+	url = ../docs.git
+	path = docs/
+[submodule "broken"]
+    url = https://example.com/broken.git
+"#;
+        assert_eq!(
+            parse_gitmodules(content),
+            vec![
+                Submodule {
+                    path: "vendor/lib".to_string(),
+                    url: "https://github.com/owner/lib.git".to_string(),
+                },
+                Submodule {
+                    path: "docs".to_string(),
+                    url: "../docs.git".to_string(),
+                },
+            ]
+        );
+    }
+}
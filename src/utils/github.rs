@@ -21,7 +21,10 @@ use anyhow::{bail, Context, Error, Result};
 use curl::easy::{Easy, List as CurlList};
 use json::JsonValue;
 use polars::prelude::{DataFrame, DataType, Field, Schema};
+use reqwest::header::HeaderMap;
 use std::iter::FromIterator as _;
+use std::time::Duration;
+
 /// Checks if a file is a valid GitHub token file.
 ///
 /// A valid GitHub token file is a CSV file with a header "token" and that contains at least one token.
@@ -49,32 +52,88 @@ pub fn is_valid_token_file(file_path: &str) -> Result<()> {
             .into_iter()
             .enumerate()
         {
-            let mut headers: CurlList = CurlList::new();
-
-            let mut easy = Easy::new();
-
-            easy.url("https://api.github.com").and_then(|_| {
-                easy.get(true)
-                    .and_then(|_| headers.append(&format!("Authorization: token {token}")))
-                    .and_then(|_| headers.append("User-Agent: Rust-curl"))
-                    .and_then(|_| easy.http_headers(headers))
-            })?;
-
-            let perform = easy.perform();
-            if perform.is_err() {
-                perform.with_context(|| format!("Token in line {} is invalid", i + 2))?
-            }
-            ensure!(
-                easy.response_code()? == 200,
-                "Token in line {} is invalid: response code {}",
-                i + 2,
-                easy.response_code()?
-            );
+            is_valid_token(token).with_context(|| format!("Token in line {} is invalid", i + 2))?;
         }
         Ok(())
     }
 }
 
+/// Checks if a GitHub token is accepted by the GitHub API.
+///
+/// # Arguments
+///
+/// * `token` - The token to check.
+///
+/// # Returns
+///
+/// An error if the request could not be sent or if the API rejected the token.
+pub fn is_valid_token(token: &str) -> Result<()> {
+    let mut headers: CurlList = CurlList::new();
+
+    let mut easy = Easy::new();
+
+    easy.url("https://api.github.com").and_then(|_| {
+        easy.get(true)
+            .and_then(|_| headers.append(&format!("Authorization: token {token}")))
+            .and_then(|_| headers.append("User-Agent: Rust-curl"))
+            .and_then(|_| easy.http_headers(headers))
+    })?;
+
+    easy.perform()?;
+    ensure!(
+        easy.response_code()? == 200,
+        "response code {}",
+        easy.response_code()?
+    );
+    Ok(())
+}
+
+/// Computes how long to wait before sending a new request after a rate limited response.
+///
+/// GitHub signals an exhausted primary rate limit with a 403 or 429 status code, the header
+/// `x-ratelimit-remaining: 0` and the epoch at which the quota is restored in `x-ratelimit-reset`.
+/// Secondary rate limits are signaled with a `retry-after` header instead.
+/// GitLab uses the same scheme with the headers `ratelimit-remaining` and `ratelimit-reset`.
+///
+/// # Arguments
+///
+/// * `status` - The status code of the response.
+/// * `headers` - The headers of the response.
+/// * `now` - The current epoch in seconds.
+///
+/// # Returns
+///
+/// The duration to wait before retrying, or `None` if the response is not rate limited.
+pub fn rate_limit_delay(status: u16, headers: &HeaderMap, now: i64) -> Option<Duration> {
+    // Waiting time when the API reports a rate limit without saying for how long.
+    const DEFAULT_DELAY: u64 = 60;
+
+    let header = |name: &str| -> Option<i64> {
+        headers
+            .get(name)
+            .and_then(|v| v.to_str().ok())
+            .and_then(|v| v.trim().parse::<i64>().ok())
+    };
+
+    if status != 403 && status != 429 {
+        None
+    } else if let Some(seconds) = header("retry-after") {
+        Some(Duration::from_secs(seconds.max(0) as u64))
+    } else if header("x-ratelimit-remaining").or(header("ratelimit-remaining")) == Some(0) {
+        // One extra second to make sure the quota has been restored.
+        Some(Duration::from_secs(
+            match header("x-ratelimit-reset").or(header("ratelimit-reset")) {
+                Some(reset) => (reset - now).max(0) as u64 + 1,
+                None => DEFAULT_DELAY,
+            },
+        ))
+    } else if status == 429 {
+        Some(Duration::from_secs(DEFAULT_DELAY))
+    } else {
+        None
+    }
+}
+
 /// Objects that can be converted to CSV rows.
 // TODO: Tests
 pub trait ToCSV: Default {
@@ -180,4 +239,55 @@ mod tests {
         ensure!(is_valid_token_file("tests/data/invalid_csv.csv").is_err());
         Ok(())
     }
+
+    fn headers(entries: &[(&'static str, &str)]) -> Result<HeaderMap> {
+        let mut headers = HeaderMap::new();
+        for (name, value) in entries {
+            headers.insert(*name, value.parse()?);
+        }
+        Ok(headers)
+    }
+
+    #[test]
+    fn rate_limit_not_limited() -> Result<()> {
+        ensure!(rate_limit_delay(200, &headers(&[])?, 0).is_none());
+        ensure!(rate_limit_delay(404, &headers(&[("retry-after", "10")])?, 0).is_none());
+        ensure!(rate_limit_delay(403, &headers(&[("x-ratelimit-remaining", "12")])?, 0).is_none());
+        Ok(())
+    }
+
+    #[test]
+    fn rate_limit_primary() -> Result<()> {
+        let h = headers(&[
+            ("x-ratelimit-remaining", "0"),
+            ("x-ratelimit-reset", "1000"),
+        ])?;
+        assert_eq!(
+            rate_limit_delay(403, &h, 990),
+            Some(Duration::from_secs(11))
+        );
+        assert_eq!(
+            rate_limit_delay(403, &h, 2000),
+            Some(Duration::from_secs(1))
+        );
+        Ok(())
+    }
+
+    #[test]
+    fn rate_limit_gitlab() -> Result<()> {
+        let h = headers(&[("ratelimit-remaining", "0"), ("ratelimit-reset", "100")])?;
+        assert_eq!(rate_limit_delay(429, &h, 90), Some(Duration::from_secs(11)));
+        Ok(())
+    }
+
+    #[test]
+    fn rate_limit_secondary() -> Result<()> {
+        let h = headers(&[("retry-after", "30")])?;
+        assert_eq!(rate_limit_delay(403, &h, 0), Some(Duration::from_secs(30)));
+        assert_eq!(
+            rate_limit_delay(429, &headers(&[])?, 0),
+            Some(Duration::from_secs(60))
+        );
+        Ok(())
+    }
 }
@@ -0,0 +1,368 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Parsing of go.mod and go.sum files.
+
+use std::collections::{HashMap, HashSet};
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+use anyhow::{bail, Context, Result};
+
+/// A require, replace or exclude directive of a go.mod file.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Directive {
+    /// The verb of the directive (require, replace or exclude).
+    pub verb: &'static str,
+    /// The path of the module the directive applies to.
+    pub module: String,
+    /// The version of the module, empty if a replace directive applies to every version.
+    pub version: String,
+    /// Whether the requirement is marked with an `// indirect` comment.
+    pub indirect: bool,
+    /// The module path or directory replacing the module, empty for other directives.
+    pub replacement: String,
+    /// The version of the replacement, empty if it is a directory.
+    pub replacement_version: String,
+}
+
+/// The content of a go.mod file.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct GoMod {
+    /// The module path.
+    pub module: String,
+    /// The Go version of the go directive, if any.
+    pub go: Option<String>,
+    /// The Go toolchain of the toolchain directive, if any.
+    pub toolchain: Option<String>,
+    /// The require, replace and exclude directives, in the order of the file.
+    pub directives: Vec<Directive>,
+}
+
+impl GoMod {
+    /// Returns the number of directives with the given verb.
+    pub fn count(&self, verb: &str) -> usize {
+        self.directives.iter().filter(|d| d.verb == verb).count()
+    }
+}
+
+/// Splits a line of a go.mod file into its tokens and its trailing comment.
+/// Tokens are separated by whitespace and may be quoted with double quotes or backquotes.
+fn tokenize(line: &str) -> Result<(Vec<String>, &str)> {
+    let mut tokens: Vec<String> = Vec::new();
+    let mut rest: &str = line.trim_start();
+    while !rest.is_empty() {
+        if let Some(comment) = rest.strip_prefix("//") {
+            return Ok((tokens, comment.trim()));
+        }
+        let token: &str = match rest.chars().next() {
+            Some(quote @ ('"' | '`')) => {
+                let end: usize = rest[1..]
+                    .find(quote)
+                    .with_context(|| format!("Unterminated string in line '{line}'"))?;
+                tokens.push(rest[1..end + 1].to_string());
+                &rest[..end + 2]
+            }
+            _ => {
+                let end: usize = rest.find(char::is_whitespace).unwrap_or(rest.len());
+                let end: usize = rest.find("//").map_or(end, |comment| end.min(comment));
+                tokens.push(rest[..end].to_string());
+                &rest[..end]
+            }
+        };
+        rest = rest[token.len()..].trim_start();
+    }
+    Ok((tokens, ""))
+}
+
+/// Parses the arguments of a require, replace or exclude directive.
+///
+/// # Arguments
+///
+/// * `verb` - The verb of the directive.
+/// * `args` - The tokens following the verb, or the tokens of the line in a block.
+/// * `comment` - The trailing comment of the line.
+fn directive(verb: &'static str, args: &[String], comment: &str) -> Result<Directive> {
+    let mut directive = Directive {
+        verb,
+        ..Default::default()
+    };
+    match (verb, args) {
+        ("require" | "exclude", [module, version]) => {
+            directive.module = module.clone();
+            directive.version = version.clone();
+            // The comment may be followed by other annotations, e.g. "indirect; for tests".
+            directive.indirect = verb == "require"
+                && comment
+                    .split(';')
+                    .next()
+                    .is_some_and(|c| c.trim() == "indirect");
+        }
+        ("replace", _) => {
+            let arrow: usize = args
+                .iter()
+                .position(|a| a == "=>")
+                .context("Replace directive without '=>'")?;
+            let (old, new) = (&args[..arrow], &args[arrow + 1..]);
+            match (old, new) {
+                ([module, version @ ..], [replacement, replacement_version @ ..])
+                    if version.len() <= 1 && replacement_version.len() <= 1 =>
+                {
+                    directive.module = module.clone();
+                    directive.version = version.concat();
+                    directive.replacement = replacement.clone();
+                    directive.replacement_version = replacement_version.concat();
+                }
+                _ => bail!("Invalid replace directive '{}'", args.join(" ")),
+            }
+        }
+        _ => bail!("Invalid {verb} directive '{}'", args.join(" ")),
+    }
+    Ok(directive)
+}
+
+/// Parses the content of a go.mod file.
+/// Directives other than module, go, toolchain, require, replace and exclude (e.g. retract or tool) are ignored.
+///
+/// # Arguments
+///
+/// * `content` - The content of the go.mod file.
+///
+/// # Returns
+///
+/// The module path, Go version and directives of the file, or an error if it is malformed or has no module directive.
+pub fn parse_go_mod(content: &str) -> Result<GoMod> {
+    let mut go_mod = GoMod::default();
+    let mut block: Option<String> = None;
+    for (i, line) in content.lines().enumerate() {
+        let (tokens, comment) =
+            tokenize(line).with_context(|| format!("Cannot parse line {}", i + 1))?;
+        let Some(first) = tokens.first() else {
+            continue;
+        };
+        let (verb, args): (&str, &[String]) = match &block {
+            Some(_) if first == ")" => {
+                block = None;
+                continue;
+            }
+            Some(verb) => (verb.as_str(), &tokens),
+            None if tokens.len() == 2 && tokens[1] == "(" => {
+                block = Some(first.clone());
+                continue;
+            }
+            None => (first.as_str(), &tokens[1..]),
+        };
+        let verb: &'static str = match verb {
+            "module" => {
+                go_mod.module = args.concat();
+                continue;
+            }
+            "go" => {
+                go_mod.go = Some(args.concat());
+                continue;
+            }
+            "toolchain" => {
+                go_mod.toolchain = Some(args.concat());
+                continue;
+            }
+            "require" => "require",
+            "replace" => "replace",
+            "exclude" => "exclude",
+            _ => continue,
+        };
+        go_mod.directives.push(
+            directive(verb, args, comment)
+                .with_context(|| format!("Cannot parse line {}", i + 1))?,
+        );
+    }
+    if block.is_some() {
+        bail!("Unterminated block");
+    }
+    if go_mod.module.is_empty() {
+        bail!("No module directive");
+    }
+    Ok(go_mod)
+}
+
+/// Returns the number of module versions listed in a go.sum file.
+/// Every version is listed with the hash of its go.mod file, and with the hash of its content if it is needed for the build.
+///
+/// # Arguments
+///
+/// * `content` - The content of the go.sum file.
+pub fn go_sum_versions(content: &str) -> usize {
+    content
+        .lines()
+        .filter_map(|line| {
+            let mut fields = line.split_whitespace();
+            let module: &str = fields.next()?;
+            let version: &str = fields.next()?;
+            Some((module, version.trim_end_matches("/go.mod")))
+        })
+        .collect::<HashSet<(&str, &str)>>()
+        .len()
+}
+
+/// Go version assumed by the toolchain for a module whose go.mod file has no go directive.
+pub const DEFAULT_GO_VERSION: &str = "1.16";
+
+/// Go versions of the modules the files of a tree belong to, read from the go directive of their go.mod file.
+/// The version of every directory is cached, since the files of a module share the same go.mod file.
+#[derive(Debug, Default)]
+pub struct GoVersions {
+    dirs: Mutex<HashMap<PathBuf, Option<String>>>,
+}
+
+impl GoVersions {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Returns the Go version of the module a file belongs to, i.e. of the go.mod file of its closest ancestor directory having one.
+    /// The version is [`DEFAULT_GO_VERSION`] if the go.mod file has no go directive,
+    /// and None if the file does not belong to a module or if its go.mod file is malformed.
+    ///
+    /// # Arguments
+    ///
+    /// * `path` - The path to the file.
+    pub fn of_file(&self, path: &Path) -> Option<String> {
+        self.of_dir(path.parent()?)
+    }
+
+    fn of_dir(&self, dir: &Path) -> Option<String> {
+        if let Some(version) = self.dirs.lock().unwrap().get(dir) {
+            return version.clone();
+        }
+        let go_mod: PathBuf = dir.join("go.mod");
+        let version: Option<String> = if go_mod.is_file() {
+            std::fs::read_to_string(&go_mod)
+                .ok()
+                .and_then(|content| parse_go_mod(&content).ok())
+                .map(|go_mod| go_mod.go.unwrap_or(DEFAULT_GO_VERSION.to_string()))
+        } else {
+            dir.parent().and_then(|parent| self.of_dir(parent))
+        };
+        self.dirs
+            .lock()
+            .unwrap()
+            .insert(dir.to_path_buf(), version.clone());
+        version
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+    use crate::utils::fs::*;
+
+    #[test]
+    fn go_mod_files() -> Result<()> {
+        let go_mod: GoMod = parse_go_mod(
+            r#"// Deprecated: use example.com/v2 instead.
+module "example.com/m" // the module
+
+go 1.21
+
+toolchain go1.22.1
+
+require golang.org/x/text v0.14.0
+
+require (
+	github.com/spf13/cobra v1.8.0
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect; for cobra
+)
+
+replace golang.org/x/text => ../text
+
+replace (
+	github.com/spf13/cobra v1.8.0 => github.com/fork/cobra v1.8.1
+)
+
+exclude github.com/spf13/pflag v1.0.4
+
+retract [v0.1.0, v0.1.5]
+"#,
+        )?;
+        assert_eq!(go_mod.module, "example.com/m");
+        assert_eq!(go_mod.go.as_deref(), Some("1.21"));
+        assert_eq!(go_mod.toolchain.as_deref(), Some("go1.22.1"));
+        assert_eq!(go_mod.count("require"), 4);
+        assert_eq!(go_mod.count("replace"), 2);
+        assert_eq!(go_mod.count("exclude"), 1);
+        assert_eq!(
+            go_mod
+                .directives
+                .iter()
+                .filter(|d| d.indirect)
+                .map(|d| d.module.as_str())
+                .collect::<Vec<&str>>(),
+            vec![
+                "github.com/inconshreveable/mousetrap",
+                "github.com/spf13/pflag"
+            ]
+        );
+        assert_eq!(
+            go_mod.directives[4],
+            Directive {
+                verb: "replace",
+                module: "golang.org/x/text".to_string(),
+                replacement: "../text".to_string(),
+                ..Default::default()
+            }
+        );
+        assert_eq!(go_mod.directives[5].version, "v1.8.0");
+        assert_eq!(go_mod.directives[5].replacement_version, "v1.8.1");
+
+        assert!(parse_go_mod("go 1.21\n").is_err());
+        assert!(parse_go_mod("module m\nrequire (\n\ta v1.0.0\n").is_err());
+        assert!(parse_go_mod("module m\nreplace a v1.0.0 b v1.0.0\n").is_err());
+        assert!(parse_go_mod("module m\nrequire a\n").is_err());
+        Ok(())
+    }
+
+    #[test]
+    fn go_sum_files() {
+        assert_eq!(
+            go_sum_versions(
+                "github.com/spf13/cobra v1.8.0 h1:abc=\n\
+                 github.com/spf13/cobra v1.8.0/go.mod h1:def=\n\
+                 github.com/spf13/pflag v1.0.5/go.mod h1:ghi=\n"
+            ),
+            2
+        );
+        assert_eq!(go_sum_versions(""), 0);
+    }
+
+    #[test]
+    fn go_versions() -> Result<()> {
+        let dir: &str = "target/tests/utils/gomod";
+        delete_dir(dir, true)?;
+        create_dir(format!("{dir}/a/cmd"))?;
+        create_dir(format!("{dir}/a/b"))?;
+        create_dir(format!("{dir}/a/c"))?;
+        std::fs::write(format!("{dir}/a/go.mod"), "module a\n\ngo 1.22.1\n")?;
+        std::fs::write(format!("{dir}/a/b/go.mod"), "module a/b\n")?;
+        std::fs::write(format!("{dir}/a/c/go.mod"), "go 1.21\n")?;
+
+        let versions = GoVersions::new();
+        let version = |file: &str| versions.of_file(&Path::new(dir).join(file));
+        assert_eq!(version("a/main.go"), Some("1.22.1".to_string()));
+        assert_eq!(version("a/cmd/main.go"), Some("1.22.1".to_string()));
+        assert_eq!(version("a/b/b.go"), Some(DEFAULT_GO_VERSION.to_string()));
+        assert_eq!(version("a/c/c.go"), None);
+        Ok(())
+    }
+}
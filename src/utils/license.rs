@@ -0,0 +1,318 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Heuristics to identify the license of a project.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Names of the files holding the license of a project, without extension (case insensitive).
+const LICENSE_FILES: [&str; 4] = ["license", "licence", "copying", "unlicense"];
+
+/// Names of the files holding the notices of a project (e.g. the attributions required by the Apache license), without extension (case insensitive).
+const NOTICE_FILES: [&str; 1] = ["notice"];
+
+/// Maximum number of bytes of a license file read to identify the license.
+const MAX_LICENSE_SIZE: usize = 64 * 1024;
+
+/// Phrases identifying licenses, in order of precedence, along with the SPDX identifier of the license.
+/// All the phrases of an entry must be found in the normalized text of a license file for it to match.
+/// Licenses whose text mentions other licenses (e.g. the LGPL, which refers to the GPL) come first.
+const LICENSE_PHRASES: [(&str, &[&str]); 17] = [
+    ("AGPL-3.0", &["gnu affero general public license version 3"]),
+    ("LGPL-3.0", &["gnu lesser general public license version 3"]),
+    (
+        "LGPL-2.1",
+        &["gnu lesser general public license version 2.1"],
+    ),
+    (
+        "LGPL-2.0",
+        &["gnu library general public license version 2"],
+    ),
+    ("GPL-3.0", &["gnu general public license version 3"]),
+    ("GPL-2.0", &["gnu general public license version 2"]),
+    ("Apache-2.0", &["apache license version 2.0"]),
+    ("MPL-2.0", &["mozilla public license", "2.0"]),
+    ("EPL-2.0", &["eclipse public license", "2.0"]),
+    ("EPL-1.0", &["eclipse public license", "1.0"]),
+    ("BSL-1.0", &["boost software license"]),
+    ("CC0-1.0", &["cc0 1.0 universal"]),
+    (
+        "Unlicense",
+        &["free and unencumbered software released into the public domain"],
+    ),
+    (
+        "ISC",
+        &["permission to use, copy, modify, and/or distribute this software for any purpose"],
+    ),
+    ("MIT", &["permission is hereby granted, free of charge"]),
+    (
+        "BSD-3-Clause",
+        &[
+            "redistribution and use in source and binary forms",
+            "neither the name",
+        ],
+    ),
+    (
+        "BSD-2-Clause",
+        &["redistribution and use in source and binary forms"],
+    ),
+];
+
+/// Identifies a license from its text.
+///
+/// # Arguments
+///
+/// * `text` - The text of the license, or the name of the license as reported by a forge.
+///
+/// # Returns
+///
+/// The SPDX identifier of the license, or `None` if it is not recognized.
+pub fn identify_license(text: &str) -> Option<&'static str> {
+    let text: String = text
+        .split_whitespace()
+        .collect::<Vec<&str>>()
+        .join(" ")
+        .to_lowercase();
+    // The text may already be an SPDX identifier.
+    if let Some((spdx, _)) = LICENSE_PHRASES
+        .iter()
+        .find(|(spdx, _)| spdx.eq_ignore_ascii_case(&text))
+    {
+        return Some(spdx);
+    }
+    LICENSE_PHRASES
+        .iter()
+        .find(|(_, phrases)| phrases.iter().all(|phrase| text.contains(phrase)))
+        .map(|(spdx, _)| *spdx)
+        .or_else(|| identify_license_name(&text))
+}
+
+/// Identifies a license from the short name reported by forges (e.g. "MIT License" or "GNU General Public License v3.0").
+fn identify_license_name(name: &str) -> Option<&'static str> {
+    let gpl = |kind: &str, v3: &'static str, v2: &'static str| {
+        name.contains(kind).then(|| {
+            if name.contains("v3") || name.contains(" 3") {
+                v3
+            } else {
+                v2
+            }
+        })
+    };
+    if name.starts_with("mit") {
+        Some("MIT")
+    } else if name.starts_with("bsd 3-clause") {
+        Some("BSD-3-Clause")
+    } else if name.starts_with("bsd 2-clause") {
+        Some("BSD-2-Clause")
+    } else if name.starts_with("apache license 2.0") {
+        Some("Apache-2.0")
+    } else if name.starts_with("mozilla public license 2.0") {
+        Some("MPL-2.0")
+    } else if name == "the unlicense" {
+        Some("Unlicense")
+    } else if name.starts_with("isc") {
+        Some("ISC")
+    } else {
+        gpl("affero general public license", "AGPL-3.0", "AGPL-3.0")
+            .or_else(|| gpl("lesser general public license", "LGPL-3.0", "LGPL-2.1"))
+            .or_else(|| gpl("general public license", "GPL-3.0", "GPL-2.0"))
+    }
+}
+
+/// A license or notice file found at the root of a project.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct LegalFile {
+    /// The path of the file, relative to the directory of the project.
+    pub path: String,
+    /// Whether the file is a notice file rather than a license file.
+    pub notice: bool,
+    /// The SPDX identifier of the license recognized in the file, if any.
+    pub license: Option<&'static str>,
+    /// The text of the file, truncated to its first 64 KiB.
+    pub text: String,
+}
+
+/// Checks whether the name of a file, without extension, is one of the given names, optionally followed by a dash and a suffix
+/// (e.g. LICENSE-MIT), case insensitively.
+fn has_stem(path: &Path, names: &[&str]) -> bool {
+    path.file_stem()
+        .and_then(|stem| stem.to_str())
+        .is_some_and(|stem| {
+            let stem: String = stem.to_lowercase();
+            names
+                .iter()
+                .any(|name| stem == *name || stem.starts_with(&format!("{name}-")))
+        })
+}
+
+/// Finds the license and notice files at the root of a project.
+/// Archives downloaded from forges wrap the project in a top-level directory, which is searched as well.
+///
+/// # Arguments
+///
+/// * `project_path` - The path to the directory of the project.
+///
+/// # Returns
+///
+/// The license and notice files of the project, sorted by path, with the license they contain if it is recognized.
+pub fn legal_files(project_path: impl AsRef<Path>) -> Vec<LegalFile> {
+    let root: &Path = project_path.as_ref();
+    let mut dirs: Vec<PathBuf> = vec![root.to_path_buf()];
+    if let Ok(entries) = fs::read_dir(root) {
+        let subdirs: Vec<PathBuf> = entries
+            .filter_map(Result::ok)
+            .map(|e| e.path())
+            .filter(|p| p.is_dir() && p.file_name().is_some_and(|n| n != ".git"))
+            .collect();
+        if subdirs.len() == 1 {
+            dirs.extend(subdirs);
+        }
+    }
+    let mut files: Vec<LegalFile> = dirs
+        .iter()
+        .filter_map(|dir| fs::read_dir(dir).ok())
+        .flat_map(|entries| entries.filter_map(Result::ok))
+        .map(|e| e.path())
+        .filter(|path| path.is_file())
+        .filter_map(|path| {
+            let notice: bool = if has_stem(&path, &LICENSE_FILES) {
+                false
+            } else if has_stem(&path, &NOTICE_FILES) {
+                true
+            } else {
+                return None;
+            };
+            let content: Vec<u8> = fs::read(&path).ok()?;
+            let end: usize = content.len().min(MAX_LICENSE_SIZE);
+            let text: String = String::from_utf8_lossy(&content[..end]).into_owned();
+            Some(LegalFile {
+                path: path
+                    .strip_prefix(root)
+                    .ok()?
+                    .to_string_lossy()
+                    .replace('\\', "/"),
+                notice,
+                license: identify_license(&text),
+                text,
+            })
+        })
+        .collect();
+    files.sort_by(|a, b| a.path.cmp(&b.path));
+    files
+}
+
+/// Detects the license of a project from the license files at its root (see [`legal_files`]).
+///
+/// # Arguments
+///
+/// * `project_path` - The path to the directory of the project.
+///
+/// # Returns
+///
+/// The SPDX identifier of the first license recognized, or `None` if the project has no recognized license file.
+pub fn detect_license(project_path: impl AsRef<Path>) -> Option<&'static str> {
+    legal_files(project_path)
+        .into_iter()
+        .filter(|file| !file.notice)
+        .find_map(|file| file.license)
+}
+
+/// Checks whether a license is accepted by lists of allowed and denied licenses.
+/// Licenses are compared on their SPDX identifiers, case insensitively.
+///
+/// # Arguments
+///
+/// * `license` - The SPDX identifier of the license, or "unknown".
+/// * `allow` - The licenses allowed. If empty, all licenses that are not denied are allowed.
+/// * `deny` - The licenses denied.
+pub fn is_license_accepted(license: &str, allow: &[String], deny: &[String]) -> bool {
+    let listed = |list: &[String]| list.iter().any(|l| l.eq_ignore_ascii_case(license));
+    (allow.is_empty() || listed(allow)) && !listed(deny)
+}
+
+#[cfg(test)]
+mod tests {
+
+    use super::*;
+
+    #[test]
+    fn identify_licenses() {
+        assert_eq!(
+            identify_license(
+                "MIT License\n\nCopyright (c) 2025\n\nPermission is hereby granted, free of charge, to any person"
+            ),
+            Some("MIT")
+        );
+        assert_eq!(
+            identify_license("                  GNU LESSER GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007"),
+            Some("LGPL-3.0")
+        );
+        assert_eq!(
+            identify_license("Apache License\n  Version 2.0, January 2004"),
+            Some("Apache-2.0")
+        );
+        assert_eq!(
+            identify_license(
+                "Redistribution and use in source and binary forms, with or without\nmodification"
+            ),
+            Some("BSD-2-Clause")
+        );
+        assert_eq!(identify_license("mit"), Some("MIT"));
+        assert_eq!(
+            identify_license("GNU General Public License v3.0"),
+            Some("GPL-3.0")
+        );
+        assert_eq!(identify_license("Other"), None);
+    }
+
+    #[test]
+    fn legal() -> anyhow::Result<()> {
+        let root: &str = "target/tests/license/legal";
+        crate::utils::fs::delete_dir(root, true)?;
+        crate::utils::fs::write_file(format!("{root}/LICENSE-MIT"), "MIT License")?;
+        crate::utils::fs::write_file(format!("{root}/NOTICE.txt"), "Copyright 2025")?;
+        crate::utils::fs::write_file(format!("{root}/main.go"), "package main")?;
+        let files: Vec<LegalFile> = legal_files(root);
+        assert_eq!(
+            files,
+            vec![
+                LegalFile {
+                    path: "LICENSE-MIT".to_string(),
+                    notice: false,
+                    license: Some("MIT"),
+                    text: "MIT License".to_string(),
+                },
+                LegalFile {
+                    path: "NOTICE.txt".to_string(),
+                    notice: true,
+                    license: None,
+                    text: "Copyright 2025".to_string(),
+                },
+            ]
+        );
+        assert_eq!(detect_license(root), Some("MIT"));
+        crate::utils::fs::delete_dir(root, false)
+    }
+
+    #[test]
+    fn accepted_licenses() {
+        let allow: Vec<String> = vec!["MIT".to_string(), "apache-2.0".to_string()];
+        let deny: Vec<String> = vec!["GPL-3.0".to_string()];
+        assert!(is_license_accepted("Apache-2.0", &allow, &[]));
+        assert!(!is_license_accepted("unknown", &allow, &[]));
+        assert!(is_license_accepted("unknown", &[], &deny));
+        assert!(!is_license_accepted("GPL-3.0", &[], &deny));
+    }
+}
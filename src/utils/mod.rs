@@ -12,12 +12,25 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+pub mod ast;
+pub mod audit;
 pub mod bow;
+pub mod census;
+pub mod constraints;
 pub mod csv;
 pub mod dataframes;
+pub mod depsdev;
+pub mod embed;
+pub mod forge;
 pub mod fs;
+pub mod git;
 pub mod github;
 pub mod github_api;
+pub mod gomod;
 pub mod json;
+pub mod license;
 pub mod logger;
+pub mod proxy;
 pub mod regex;
+pub mod throttle;
+pub mod visitors;
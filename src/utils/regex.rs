@@ -198,6 +198,47 @@ pub fn count_text_lines(text: &[u8]) -> usize {
     text.lines().count()
 }
 
+/// Returns a regex matching the paths matched by a pattern.
+/// Patterns are globs matching whole paths, in which `**` matches any number of directories, `*` any sequence of characters
+/// other than `/` and `?` any character other than `/`, unless they are prefixed with `re:`, in which case they are regexes
+/// matched anywhere in the paths.
+///
+/// # Arguments
+///
+/// * `pattern` - The glob, or the regex prefixed with `re:`.
+///
+/// # Returns
+///
+/// The regex, or an error if the pattern is an invalid regex.
+pub fn path_matcher(pattern: &str) -> Result<Regex> {
+    if let Some(regex) = pattern.strip_prefix("re:") {
+        return Regex::new(regex).with_context(|| format!("Invalid path regex {regex}"));
+    }
+    let mut regex: String = "^".to_string();
+    let mut rest: &str = pattern;
+    while let Some(c) = rest.chars().next() {
+        let (matched, len): (&str, usize) = if rest.starts_with("**/") {
+            ("(?:.*/)?", 3)
+        } else if rest == "/**" {
+            ("(?:/.*)?", 3)
+        } else if rest.starts_with("**") {
+            (".*", 2)
+        } else if c == '*' {
+            ("[^/]*", 1)
+        } else if c == '?' {
+            ("[^/]", 1)
+        } else {
+            regex.push_str(&regex::escape(&rest[..c.len_utf8()]));
+            rest = &rest[c.len_utf8()..];
+            continue;
+        };
+        regex.push_str(matched);
+        rest = &rest[len..];
+    }
+    regex.push('$');
+    Regex::new(&regex).with_context(|| format!("Invalid path pattern {pattern}"))
+}
+
 /// A structure representing a collection of files enumerating keywords to match against for different programming languages.
 /// Programming languages are identified by their name, and a mapping from file extensions to programming languages is also provided.
 ///
@@ -486,6 +527,28 @@ impl KeywordFiles {
 mod tests {
     use super::*;
 
+    #[test]
+    fn path_patterns() -> Result<()> {
+        let internal: Regex = path_matcher("**/internal/**")?;
+        assert!(internal.is_match(b"1-abc/internal"));
+        assert!(internal.is_match(b"1-abc/pkg/internal/x"));
+        assert!(internal.is_match(b"internal"));
+        assert!(!internal.is_match(b"1-abc/internals"));
+
+        let math: Regex = path_matcher("*/math/*")?;
+        assert!(math.is_match(b"1-abc/math/big"));
+        assert!(!math.is_match(b"1-abc/math"));
+        assert!(!math.is_match(b"1-abc/src/math/big"));
+        assert!(path_matcher("1-ab?/a.b")?.is_match(b"1-abc/a.b"));
+        assert!(!path_matcher("1-ab?/a.b")?.is_match(b"1-abc/axb"));
+
+        let regex: Regex = path_matcher("re:/(cmd|tools)/")?;
+        assert!(regex.is_match(b"1-abc/cmd/x"));
+        assert!(!regex.is_match(b"1-abc/cmdx"));
+        assert!(path_matcher("re:(").is_err());
+        Ok(())
+    }
+
     #[test]
     fn count_matches_test() -> Result<()> {
         let text = b"Parole, parole, parole, paroleParole parole_parole parole_Parole";
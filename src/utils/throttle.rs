@@ -0,0 +1,375 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Bandwidth and request rate limiting shared by concurrent downloads.
+
+use std::io::{self, Read};
+use std::str::FromStr;
+use std::sync::{Mutex, OnceLock};
+use std::thread::sleep;
+use std::time::{Duration, Instant};
+
+use anyhow::{bail, ensure, Context, Result};
+use tracing::info;
+
+use crate::utils::forge::Provider;
+
+/// Limits the rate at which bytes are transferred, across all the threads sharing it.
+///
+/// Every transfer reserves a time slot proportional to its size after the slots reserved before it,
+/// and waits until its slot starts. Idle time is not accumulated: the rate is never exceeded, even after a pause.
+#[derive(Debug)]
+pub struct Throttle {
+    /// Maximum number of bytes per second, or None if the rate is not limited.
+    rate: Option<u64>,
+    /// End of the last reserved time slot.
+    next: Mutex<Instant>,
+}
+
+impl Throttle {
+    /// Creates a throttle.
+    ///
+    /// # Arguments
+    ///
+    /// * `rate` - The maximum number of bytes per second, or None if the rate is not limited.
+    pub fn new(rate: Option<u64>) -> Throttle {
+        Throttle {
+            rate: rate.filter(|r| *r > 0),
+            next: Mutex::new(Instant::now()),
+        }
+    }
+
+    /// Accounts for the transfer of a number of bytes, waiting as long as needed to respect the rate.
+    ///
+    /// # Arguments
+    ///
+    /// * `bytes` - The number of bytes transferred.
+    pub fn consume(&self, bytes: u64) {
+        if let Some(rate) = self.rate {
+            let wait: Duration = {
+                let mut next = self.next.lock().expect("Mutex poisoned");
+                let now: Instant = Instant::now();
+                let start: Instant = (*next).max(now);
+                *next = start + Duration::from_secs_f64(bytes as f64 / rate as f64);
+                start - now
+            };
+            if !wait.is_zero() {
+                sleep(wait);
+            }
+        }
+    }
+
+    /// Wraps a reader so that the bytes read from it are accounted for by the throttle.
+    pub fn reader<R: Read>(&self, inner: R) -> ThrottledReader<'_, R> {
+        ThrottledReader {
+            inner,
+            throttle: self,
+        }
+    }
+}
+
+/// Reader whose throughput is limited by a throttle.
+pub struct ThrottledReader<'a, R: Read> {
+    inner: R,
+    throttle: &'a Throttle,
+}
+
+impl<R: Read> Read for ThrottledReader<'_, R> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        let n: usize = self.inner.read(buf)?;
+        self.throttle.consume(n as u64);
+        Ok(n)
+    }
+}
+
+/// Minimum delay between two requests sent to a host, across all the threads sharing it.
+#[derive(Debug)]
+struct HostLimit {
+    /// The host, in lower case. The limit also applies to its subdomains.
+    host: String,
+    /// Minimum delay between the start of two requests.
+    delay: Duration,
+    /// Time at which the next request can be sent.
+    next: Mutex<Instant>,
+}
+
+/// Request limits of the hosts, set once when the program starts.
+static HOST_LIMITS: OnceLock<Vec<HostLimit>> = OnceLock::new();
+
+/// Politeness profiles, setting the delays between the requests sent to the public instances of the forges
+/// and to the Go module services.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum Politeness {
+    /// No delay, requests are only limited by the rate limits of the forges.
+    #[default]
+    None,
+    /// Short delays, suited to crawls of a few thousand projects.
+    Moderate,
+    /// Long delays, suited to large crawls running unattended.
+    Polite,
+}
+
+impl Politeness {
+    /// Returns the delays of the profile, in milliseconds, for every host it applies to.
+    /// Small instances run by non-profit organizations get longer delays.
+    fn delays(&self) -> &'static [(&'static str, u64)] {
+        match self {
+            Politeness::None => &[],
+            Politeness::Moderate => &[
+                ("github.com", 100),
+                ("gitlab.com", 100),
+                ("bitbucket.org", 200),
+                ("gitea.com", 500),
+                ("codeberg.org", 500),
+                ("git.sr.ht", 500),
+                ("proxy.golang.org", 50),
+                ("index.golang.org", 50),
+                ("deps.dev", 100),
+            ],
+            Politeness::Polite => &[
+                ("github.com", 1000),
+                ("gitlab.com", 1000),
+                ("bitbucket.org", 1000),
+                ("gitea.com", 2000),
+                ("codeberg.org", 2000),
+                ("git.sr.ht", 2000),
+                ("proxy.golang.org", 500),
+                ("index.golang.org", 500),
+                ("deps.dev", 1000),
+            ],
+        }
+    }
+}
+
+impl FromStr for Politeness {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        match s.to_lowercase().as_str() {
+            "none" => Ok(Politeness::None),
+            "moderate" => Ok(Politeness::Moderate),
+            "polite" => Ok(Politeness::Polite),
+            _ => bail!("Unknown politeness profile {s}, expected none, moderate or polite"),
+        }
+    }
+}
+
+/// Parses a host rate limit given on the command line, written `HOST=REQUESTS_PER_SECOND` (e.g. github.com=5).
+pub fn parse_host_limit(arg: &str) -> Result<(String, u64)> {
+    let (host, rate) = arg
+        .split_once('=')
+        .with_context(|| format!("Invalid rate limit {arg}, expected HOST=REQUESTS_PER_SECOND"))?;
+    let host: String = host.trim().trim_end_matches('/').to_lowercase();
+    ensure!(
+        !host.is_empty(),
+        "Invalid rate limit {arg}, the host is empty"
+    );
+    let rate: u64 = rate.trim().parse().with_context(|| {
+        format!("Invalid rate limit {arg}, the rate must be a positive integer")
+    })?;
+    ensure!(
+        rate > 0,
+        "Invalid rate limit {arg}, the rate must be a positive integer"
+    );
+    Ok((host, rate))
+}
+
+/// Parses a delay between requests given on the command line, written `PROVIDER=DELAY` or `HOST=DELAY`
+/// (e.g. codeberg=2s or gitlab.example.com=500ms). Providers stand for their public instance.
+/// Delays are numbers of seconds, optionally followed by 's', or numbers of milliseconds followed by 'ms'.
+pub fn parse_host_delay(arg: &str) -> Result<(String, Duration)> {
+    let (target, delay) = arg
+        .split_once('=')
+        .with_context(|| format!("Invalid delay {arg}, expected PROVIDER=DELAY or HOST=DELAY"))?;
+    let target: &str = target.trim().trim_end_matches('/');
+    ensure!(!target.is_empty(), "Invalid delay {arg}, the host is empty");
+    let host: String = match target.parse::<Provider>() {
+        Ok(provider) => provider.default_host().to_string(),
+        Err(_) => target.to_lowercase(),
+    };
+    let delay: &str = delay.trim();
+    let seconds: f64 = match delay.strip_suffix("ms") {
+        Some(ms) => ms.trim().parse::<f64>().map(|ms| ms / 1000.0),
+        None => delay.trim_end_matches('s').trim().parse::<f64>(),
+    }
+    .ok()
+    .filter(|s| s.is_finite() && *s >= 0.0)
+    .with_context(|| format!("Invalid delay {arg}, expected e.g. 2s or 500ms"))?;
+    Ok((host, Duration::from_secs_f64(seconds)))
+}
+
+/// Sets the request limits of the hosts. Limits can only be set once.
+/// The limit of a host also applies to its subdomains (e.g. api.github.com for github.com).
+/// Explicit limits replace the delays of the profile; when several are given for the same host, the longest delay is kept.
+///
+/// # Arguments
+///
+/// * `politeness` - The politeness profile, setting the default delays of the public forges.
+/// * `rates` - The hosts and their maximum number of requests per second.
+/// * `delays` - The hosts and the minimum delay between two requests.
+pub fn limit_hosts(
+    politeness: Politeness,
+    rates: Vec<(String, u64)>,
+    delays: Vec<(String, Duration)>,
+) -> Result<()> {
+    let mut limits: Vec<(String, Duration)> = politeness
+        .delays()
+        .iter()
+        .map(|(host, ms)| (host.to_string(), Duration::from_millis(*ms)))
+        .collect();
+    // Explicit limits override the profile.
+    let explicit: Vec<(String, Duration)> = rates
+        .into_iter()
+        .map(|(host, rate)| (host, Duration::from_secs_f64(1.0 / rate as f64)))
+        .chain(delays)
+        .collect();
+    limits.retain(|(host, _)| !explicit.iter().any(|(h, _)| h == host));
+    for (host, delay) in explicit {
+        match limits.iter_mut().find(|(h, _)| *h == host) {
+            Some((_, d)) => *d = (*d).max(delay),
+            None => limits.push((host, delay)),
+        }
+    }
+    for (host, delay) in limits.iter() {
+        info!(
+            "Waiting {} ms between requests to {host}",
+            delay.as_millis()
+        );
+    }
+    let limits: Vec<HostLimit> = limits
+        .into_iter()
+        .map(|(host, delay)| HostLimit {
+            host,
+            delay,
+            next: Mutex::new(Instant::now()),
+        })
+        .collect();
+    if HOST_LIMITS.set(limits).is_err() {
+        bail!("Rate limits are already set");
+    }
+    Ok(())
+}
+
+/// Returns the limit of the most specific host matching a host, if any.
+fn host_limit<'a>(limits: &'a [HostLimit], host: &str) -> Option<&'a HostLimit> {
+    let host: String = host.to_lowercase();
+    limits
+        .iter()
+        .filter(|limit| {
+            host == limit.host
+                || host
+                    .strip_suffix(limit.host.as_str())
+                    .is_some_and(|sub| sub.ends_with('.'))
+        })
+        .max_by_key(|limit| limit.host.len())
+}
+
+/// Waits until a request can be sent to a host without exceeding its limit.
+/// Requests to hosts without any limit are sent right away.
+///
+/// # Arguments
+///
+/// * `host` - The host the request is sent to.
+pub fn wait_for_host(host: &str) {
+    if let Some(limit) = HOST_LIMITS
+        .get()
+        .and_then(|limits| host_limit(limits, host))
+    {
+        let wait: Duration = {
+            let mut next = limit.next.lock().expect("Mutex poisoned");
+            let now: Instant = Instant::now();
+            let start: Instant = (*next).max(now);
+            *next = start + limit.delay;
+            start - now
+        };
+        if !wait.is_zero() {
+            sleep(wait);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::{ensure, Result};
+
+    use super::*;
+
+    #[test]
+    fn throttle() -> Result<()> {
+        let throttle: Throttle = Throttle::new(Some(1000));
+        let start: Instant = Instant::now();
+        // The first transfer starts right away, the second one waits for the first one to end.
+        throttle.consume(500);
+        throttle.consume(500);
+        ensure!(start.elapsed() >= Duration::from_millis(500));
+
+        let mut content: Vec<u8> = Vec::new();
+        Throttle::new(None)
+            .reader(&b"content"[..])
+            .read_to_end(&mut content)?;
+        assert_eq!(content, b"content");
+
+        let start: Instant = Instant::now();
+        Throttle::new(None).consume(u64::MAX);
+        ensure!(start.elapsed() < Duration::from_millis(100));
+        Ok(())
+    }
+
+    #[test]
+    fn host_limits() -> Result<()> {
+        assert_eq!(
+            parse_host_limit("GitHub.com=5")?,
+            ("github.com".to_string(), 5)
+        );
+        ensure!(parse_host_limit("github.com").is_err());
+        ensure!(parse_host_limit("github.com=0").is_err());
+        ensure!(parse_host_limit("=2").is_err());
+
+        let limit = |host: &str, ms: u64| HostLimit {
+            host: host.to_string(),
+            delay: Duration::from_millis(ms),
+            next: Mutex::new(Instant::now()),
+        };
+        let limits: Vec<HostLimit> = vec![limit("github.com", 200), limit("api.github.com", 500)];
+        let delay = |host: &str| host_limit(&limits, host).map(|l| l.delay.as_millis());
+        assert_eq!(delay("github.com"), Some(200));
+        assert_eq!(delay("codeload.github.com"), Some(200));
+        assert_eq!(delay("API.github.com"), Some(500));
+        assert_eq!(delay("notgithub.com"), None);
+        Ok(())
+    }
+
+    #[test]
+    fn host_delays() -> Result<()> {
+        assert_eq!(
+            parse_host_delay("codeberg=2s")?,
+            ("codeberg.org".to_string(), Duration::from_secs(2))
+        );
+        assert_eq!(
+            parse_host_delay("GitLab.example.com=500ms")?,
+            ("gitlab.example.com".to_string(), Duration::from_millis(500))
+        );
+        assert_eq!(
+            parse_host_delay("github=0.25")?,
+            ("github.com".to_string(), Duration::from_millis(250))
+        );
+        ensure!(parse_host_delay("github").is_err());
+        ensure!(parse_host_delay("github=-1s").is_err());
+        ensure!(parse_host_delay("=1s").is_err());
+        assert_eq!("Polite".parse::<Politeness>()?, Politeness::Polite);
+        ensure!("rude".parse::<Politeness>().is_err());
+        Ok(())
+    }
+}
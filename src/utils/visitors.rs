@@ -0,0 +1,154 @@
+// Copyright 2025 Andrea Gilot
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//! Syntax tree visitors supplied by the programs using scyros as a library, run by the parse subcommand on every file
+//! it parses, so that custom extractions do not require forking it.
+//!
+//! Visitors are registered with [`register`] before the parse subcommand is run. Every visitor writes its rows to a
+//! separate CSV file, named after the input file with the name of the visitor and the `.csv` suffix, and its rows are
+//! checkpointed and reused by incremental runs like those of the built-in extractions.
+
+use std::sync::{Arc, Mutex};
+
+use anyhow::{bail, Result};
+use tree_sitter::Node;
+
+/// The registered visitors, in the order of their registration.
+static VISITORS: Mutex<Vec<Arc<dyn Visitor>>> = Mutex::new(Vec::new());
+
+/// The corpus context of a file visited by a visitor.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FileContext<'a> {
+    /// The id of the project to which the file belongs.
+    pub project_id: u32,
+    /// The path of the file.
+    pub path: &'a str,
+    /// The language of the file.
+    pub language: &'a str,
+    /// The package of the file, i.e. the directory containing it.
+    pub package: &'a str,
+    /// The generator of the file, if it is machine-generated.
+    pub generator: Option<&'a str>,
+    /// The vendored tree the file belongs to, if any.
+    pub vendored: Option<&'a str>,
+    /// The kind of test file of the file: `none`, `internal` or `external`.
+    pub test_kind: &'a str,
+    /// The Go version of the module of the file, if Go versions are recorded.
+    pub go_version: Option<&'a str>,
+    /// Whether the file has syntax errors.
+    pub parse_error: bool,
+}
+
+/// A syntax tree visitor run on every parsed file.
+pub trait Visitor: Send + Sync {
+    /// The name of the visitor, made of lowercase letters, digits, dashes and underscores, which names its output file.
+    fn name(&self) -> &str;
+
+    /// The columns of the rows of the visitor, written after the `id` and `path` columns.
+    fn columns(&self) -> Vec<String>;
+
+    /// Whether the visitor runs on the files of a language. Visitors run on all the languages by default.
+    fn accepts(&self, _language: &str) -> bool {
+        true
+    }
+
+    /// Visits the syntax tree of a file.
+    ///
+    /// # Arguments
+    ///
+    /// * `context` - The corpus context of the file.
+    /// * `root` - The root node of the file.
+    /// * `source` - The source code of the file.
+    ///
+    /// # Returns
+    ///
+    /// The rows of the file, each with a value for every column of the visitor, or an error handled as a failure
+    /// to parse the file.
+    fn visit(&self, context: &FileContext, root: &Node, source: &[u8]) -> Result<Vec<Vec<String>>>;
+}
+
+/// Registers a visitor, run by the parse subcommand on every file it parses from then on.
+///
+/// # Arguments
+///
+/// * `visitor` - The visitor.
+///
+/// # Returns
+///
+/// An error if the name of the visitor is invalid or already taken.
+pub fn register(visitor: impl Visitor + 'static) -> Result<()> {
+    let name: &str = visitor.name();
+    if name.is_empty()
+        || !name
+            .chars()
+            .all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || c == '-' || c == '_')
+    {
+        bail!("Invalid visitor name {name}, expected lowercase letters, digits, dashes and underscores");
+    }
+    let mut visitors = VISITORS.lock().expect("Mutex poisoned");
+    if visitors.iter().any(|v| v.name() == name) {
+        bail!("A visitor named {name} is already registered");
+    }
+    visitors.push(Arc::new(visitor));
+    Ok(())
+}
+
+/// Returns the registered visitors, in the order of their registration.
+pub fn registered() -> Vec<Arc<dyn Visitor>> {
+    VISITORS.lock().expect("Mutex poisoned").clone()
+}
+
+/// Unregisters all the visitors.
+pub fn clear() {
+    VISITORS.lock().expect("Mutex poisoned").clear();
+}
+
+#[cfg(test)]
+mod tests {
+
+    use anyhow::ensure;
+
+    use super::*;
+
+    /// A visitor running on no file.
+    struct Idle(&'static str);
+
+    impl Visitor for Idle {
+        fn name(&self) -> &str {
+            self.0
+        }
+
+        fn columns(&self) -> Vec<String> {
+            Vec::new()
+        }
+
+        fn accepts(&self, _language: &str) -> bool {
+            false
+        }
+
+        fn visit(&self, _: &FileContext, _: &Node, _: &[u8]) -> Result<Vec<Vec<String>>> {
+            Ok(Vec::new())
+        }
+    }
+
+    #[test]
+    fn registration() -> Result<()> {
+        ensure!(register(Idle("")).is_err());
+        ensure!(register(Idle("Calls.csv")).is_err());
+        register(Idle("idle_visitor"))?;
+        ensure!(register(Idle("idle_visitor")).is_err());
+        ensure!(registered().iter().any(|v| v.name() == "idle_visitor"));
+        Ok(())
+    }
+}